@@ -30,36 +30,160 @@ const (
 	DefaultUser = "me"
 )
 
+// Operation is a kind of access a command needs against the Gmail API.
+// Each ScopeProfile declares which operations its scopes allow.
+type Operation int
+
+const (
+	ReadMessagesOp Operation = iota
+	ReadLabelsOp
+	ReadSettingsOp
+	ModifyMessagesOp
+	ModifyLabelsOp
+	ModifySettingsOp
+	SendMessagesOp
+	ComposeDraftsOp
+)
+
+var operationNames = map[Operation]string{
+	ReadMessagesOp:   "read messages",
+	ReadLabelsOp:     "read labels",
+	ReadSettingsOp:   "read settings",
+	ModifyMessagesOp: "modify messages",
+	ModifyLabelsOp:   "modify labels",
+	ModifySettingsOp: "modify settings",
+	SendMessagesOp:   "send messages",
+	ComposeDraftsOp:  "compose drafts",
+}
+
+func (op Operation) String() string {
+	if name, ok := operationNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("Operation(%d)", int(op))
+}
+
 type ScopeProfile struct {
+	Name string
+	// Alternate names accepted by the authorize command
+	Aliases  []string
+	Desc     string
 	Scopes   []string
 	CredFile string
+	Ops      []Operation
 }
 
 func (s *ScopeProfile) ScopesString() string {
 	return strings.Join(s.Scopes, " ")
 }
 
+func (s *ScopeProfile) Allows(op Operation) bool {
+	for _, o := range s.Ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ScopeProfile) AllowsAll(ops []Operation) bool {
+	for _, op := range ops {
+		if !s.Allows(op) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *ScopeProfile) HasName(name string) bool {
+	return s.Name == name || util.StringSliceContains(name, s.Aliases)
+}
+
 // Scope docs: https://godoc.org/google.golang.org/api/gmail/v1
 // If modifying these scopes, delete your previously saved credentials
 // at ~/.credentials/...
 var ReadScope = &ScopeProfile{
+	Name:     "read",
+	Desc:     "Used to search and read emails, labels and filters, without changing anything.",
 	Scopes:   []string{gmail.GmailReadonlyScope},
 	CredFile: "gmailcli_read.json",
+	Ops:      []Operation{ReadMessagesOp, ReadLabelsOp, ReadSettingsOp},
+}
+
+// Note that this does not allow reading the account profile, so it cannot be
+// used on its own with GmailHelper.
+var SendScope = &ScopeProfile{
+	Name:     "send",
+	Desc:     "Used to send emails (e.g. for unsubscribing), without reading any.",
+	Scopes:   []string{gmail.GmailSendScope},
+	CredFile: "gmailcli_send.json",
+	Ops:      []Operation{SendMessagesOp},
+}
+
+var ComposeScope = &ScopeProfile{
+	Name:     "compose",
+	Desc:     "Used to send emails and manage drafts, without reading other emails.",
+	Scopes:   []string{gmail.GmailComposeScope},
+	CredFile: "gmailcli_compose.json",
+	Ops:      []Operation{SendMessagesOp, ComposeDraftsOp},
 }
 
 var LabelsScope = &ScopeProfile{
-	Scopes:   []string{gmail.GmailReadonlyScope, gmail.GmailMetadataScope},
+	Name:     "labels",
+	Desc:     "Used to read emails, and create or edit labels (but not apply them).",
+	Scopes:   []string{gmail.GmailReadonlyScope, gmail.GmailLabelsScope},
 	CredFile: "gmailcli_labels.json",
+	Ops: []Operation{
+		ReadMessagesOp, ReadLabelsOp, ReadSettingsOp, ModifyLabelsOp},
 }
 
 var ModifyScope = &ScopeProfile{
+	Name:     "modify",
+	Aliases:  []string{"email"},
+	Desc:     "Used to modify, search emails.",
 	Scopes:   []string{gmail.GmailModifyScope},
 	CredFile: "gmailcli_modify.json",
+	Ops: []Operation{
+		ReadMessagesOp, ReadLabelsOp, ReadSettingsOp,
+		ModifyMessagesOp, ModifyLabelsOp, SendMessagesOp, ComposeDraftsOp},
 }
 
 var FiltersScope = &ScopeProfile{
+	Name:     "filters",
+	Desc:     "Used to modify and organize gmail filter rules.",
 	Scopes:   []string{gmail.GmailMetadataScope, gmail.GmailSettingsBasicScope},
 	CredFile: "gmailcli_filters.json",
+	Ops:      []Operation{ReadLabelsOp, ReadSettingsOp, ModifySettingsOp},
+}
+
+// ScopeProfiles is the registry of all known profiles, ordered from least to
+// most privileged. ScopeProfileForOps relies on this ordering.
+var ScopeProfiles = []*ScopeProfile{
+	ReadScope,
+	SendScope,
+	ComposeScope,
+	LabelsScope,
+	ModifyScope,
+	FiltersScope,
+}
+
+func ScopeProfileByName(name string) (*ScopeProfile, bool) {
+	for _, profile := range ScopeProfiles {
+		if profile.HasName(name) {
+			return profile, true
+		}
+	}
+	return nil, false
+}
+
+// ScopeProfileForOps returns the narrowest profile which allows all of ops.
+func ScopeProfileForOps(ops ...Operation) (*ScopeProfile, error) {
+	for _, profile := range ScopeProfiles {
+		if profile.AllowsAll(ops) {
+			return profile, nil
+		}
+	}
+	return nil, fmt.Errorf("No scope profile allows all of %v", ops)
 }
 
 // tokenCacheFile generates credential file ~/.credentials/gmailcli.json
@@ -234,6 +358,17 @@ func styledClientSecretInstructions() string {
 	)
 }
 
+// NewGmailClientForOps creates a client with the narrowest ScopeProfile that
+// allows all of ops.
+func NewGmailClientForOps(ops ...Operation) *gmail.Service {
+	scope, err := ScopeProfileForOps(ops...)
+	if err != nil {
+		util.ExternFatalf("%s: %v\n", prnt.Style().FgRed().Bold().On("Error"), err)
+	}
+	prnt.Deb.Ln("Using scope profile", scope.Name, "for", ops)
+	return NewGmailClient(scope)
+}
+
 func NewGmailClient(scope *ScopeProfile) *gmail.Service {
 	ctx := context.Background()
 
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+func draftWithRaw(id string, raw []byte, threadId string) *gm.Draft {
+	return &gm.Draft{Id: id, Message: &gm.Message{
+		Raw:      base64.URLEncoding.EncodeToString(raw),
+		ThreadId: threadId,
+	}}
+}
+
+// UpdateDraft replaces the content of draft id.
+func (h *MsgHelper) UpdateDraft(id string, raw []byte, threadId string) (*gm.Draft, error) {
+	return h.srv.Users.Drafts.Update(h.User, id, draftWithRaw(id, raw, threadId)).Do()
+}
+
+// SendDraft sends draft id as it is. The draft is removed once sent.
+func (h *MsgHelper) SendDraft(id string) (*gm.Message, error) {
+	return h.srv.Users.Drafts.Send(h.User, &gm.Draft{Id: id}).Do()
+}
+
+// DeleteDraft permanently deletes draft id (it does not go to the trash).
+func (h *MsgHelper) DeleteDraft(id string) error {
+	return h.srv.Users.Drafts.Delete(h.User, id).Do()
+}
+
+// GetDraft loads draft id, with its message at the given detail.
+func (h *MsgHelper) GetDraft(id string, detail MessageDetailLevel) (*gm.Draft, error) {
+	prnt.Deb.Ln("Loading draft", id, "at level", detail)
+	return h.srv.Users.Drafts.Get(h.User, id).
+		Format(detail.Format().ToString()).Do()
+}
+
+// QueryDrafts returns the drafts matching query (with the same syntax as
+// QueryMessages), and loads their messages to detailLevel.
+//
+// maxDrafts: a value greater than 0 to apply a max
+func (h *MsgHelper) QueryDrafts(
+	query string, maxDrafts int64, detailLevel MessageDetailLevel,
+) ([]*gm.Draft, error) {
+
+	pageToken := ""
+	queriedPageCnt := 0
+	var drafts []*gm.Draft
+
+	for queriedPageCnt == 0 || pageToken != "" {
+		queriedPageCnt++
+		util.Debugf("Querying drafts: '%s', page: %d\n", query, queriedPageCnt)
+
+		call := h.srv.Users.Drafts.List(h.User).Q(query)
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+		if maxDrafts > 0 {
+			call = call.MaxResults(maxDrafts)
+		}
+		r, err := call.Do()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to get drafts: %v", err)
+		}
+
+		pageToken = r.NextPageToken
+
+		for _, d := range r.Drafts {
+			drafts = append(drafts, d)
+			if maxDrafts > 0 && int64(len(drafts)) == maxDrafts {
+				pageToken = ""
+				break
+			}
+		}
+	}
+
+	if detailLevel != IdsOnly && len(drafts) > 0 {
+		msgs := make([]*gm.Message, 0, len(drafts))
+		for _, d := range drafts {
+			msgs = append(msgs, d.Message)
+		}
+		// Draft messages are regular messages, so can be loaded as such.
+		detailedMsgs, err := h.fetchMessages(msgs, detailLevel)
+		if err != nil {
+			return nil, err
+		}
+		msgsById := make(map[string]*gm.Message)
+		for _, m := range detailedMsgs {
+			msgsById[m.Id] = m
+		}
+		for _, d := range drafts {
+			if m, ok := msgsById[d.Message.Id]; ok {
+				d.Message = m
+			}
+		}
+	}
+	return drafts, nil
+}
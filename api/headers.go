@@ -0,0 +1,253 @@
+package api
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/mime"
+)
+
+type EmailAddress struct {
+	Address string
+	Name    string
+	// The display name of the RFC 5322 group this address was listed in, if any
+	Group string
+}
+
+// String returns the address in RFC 5322 form, with the name quoted (or
+// encoded) as needed.
+func (e EmailAddress) String() string {
+	if e.Name == "" {
+		return e.Address
+	}
+	return (&mail.Address{Name: e.Name, Address: e.Address}).String()
+}
+
+type Headers struct {
+	Subject string
+	From    EmailAddress
+	To      []EmailAddress
+	Cc      []EmailAddress
+	Bcc     []EmailAddress
+	ReplyTo []EmailAddress
+	// Zero if the message has no valid Date header
+	Date time.Time
+
+	// Message IDs include their angle brackets, e.g. <abc@mail.example.com>
+	MessageId  string
+	InReplyTo  []string
+	References []string
+
+	// The list identifier, without the description (e.g. list.example.com)
+	ListId string
+	// URIs from List-Unsubscribe, in order of preference
+	ListUnsubscribe []string
+	// Value of List-Unsubscribe-Post. "List-Unsubscribe=One-Click" indicates
+	// support for RFC 8058 one-click unsubscription.
+	ListUnsubscribePost string
+}
+
+// AllRecipients returns To, Cc and Bcc addresses
+func (h *Headers) AllRecipients() []EmailAddress {
+	all := make([]EmailAddress, 0, len(h.To)+len(h.Cc)+len(h.Bcc))
+	all = append(all, h.To...)
+	all = append(all, h.Cc...)
+	return append(all, h.Bcc...)
+}
+
+var addressParser = &mail.AddressParser{WordDecoder: mime.WordDecoder}
+
+// Used as a fallback for addresses net/mail rejects
+var namedEmailRegexp = regexp.MustCompile(`\s*(\S|\S.*\S)\s*<(.*)>\s*`)
+var unnamedEmailRegexp = regexp.MustCompile(`^\s*(\S+)\s*$`)
+
+type addressListEntry struct {
+	group string
+	addr  string
+}
+
+// splitAddressList splits an address list header value on its top-level
+// commas. Commas inside quoted strings, comments, and angle brackets are not
+// separators. Members of groups (Name: a@x.com, b@x.com;) are returned with
+// their group name.
+func splitAddressList(val string) []addressListEntry {
+	var entries []addressListEntry
+	var cur strings.Builder
+	group := ""
+	inQuote := false
+	escaped := false
+	commentDepth := 0
+	inAngle := false
+
+	flush := func() {
+		addr := strings.TrimSpace(cur.String())
+		if addr != "" {
+			entries = append(entries, addressListEntry{group, addr})
+		}
+		cur.Reset()
+	}
+
+	for _, c := range val {
+		if escaped {
+			escaped = false
+			cur.WriteRune(c)
+			continue
+		}
+		switch {
+		case c == '\\' && (inQuote || commentDepth > 0):
+			escaped = true
+		case inQuote:
+			if c == '"' {
+				inQuote = false
+			}
+		case commentDepth > 0:
+			if c == '(' {
+				commentDepth++
+			} else if c == ')' {
+				commentDepth--
+			}
+		case c == '"':
+			inQuote = true
+		case c == '(':
+			commentDepth++
+		case c == '<':
+			inAngle = true
+		case c == '>':
+			inAngle = false
+		case inAngle:
+		case c == ',':
+			flush()
+			continue
+		case c == ':' && group == "":
+			group = mime.DecodeHeader(strings.Trim(strings.TrimSpace(cur.String()), `"`))
+			cur.Reset()
+			continue
+		case c == ';' && group != "":
+			flush()
+			group = ""
+			continue
+		}
+		cur.WriteRune(c)
+	}
+	flush()
+	return entries
+}
+
+func parseAddress(entry addressListEntry) (EmailAddress, bool) {
+	if addr, err := addressParser.Parse(entry.addr); err == nil {
+		return EmailAddress{Address: addr.Address, Name: addr.Name, Group: entry.group},
+			true
+	}
+	// Be lenient with malformed addresses, since we're only reading them.
+	if matches := namedEmailRegexp.FindStringSubmatch(entry.addr); len(matches) > 1 {
+		name := mime.DecodeHeader(strings.Trim(matches[1], `"`))
+		return EmailAddress{Address: matches[2], Name: name, Group: entry.group}, true
+	}
+	if matches := unnamedEmailRegexp.FindStringSubmatch(entry.addr); len(matches) > 1 {
+		return EmailAddress{Address: matches[1], Group: entry.group}, true
+	}
+	return EmailAddress{}, false
+}
+
+// GetEmailsInField parses an address list header value (e.g. From, To, Cc),
+// as specified by RFC 5322. Display names are decoded per RFC 2047.
+func GetEmailsInField(headerVal string) []EmailAddress {
+	emails := make([]EmailAddress, 0)
+	for _, entry := range splitAddressList(headerVal) {
+		if email, ok := parseAddress(entry); ok {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+var angleBracketedRegexp = regexp.MustCompile(`<[^<>]*>`)
+
+// parseMsgIdList parses headers like References and In-Reply-To
+func parseMsgIdList(val string) []string {
+	ids := angleBracketedRegexp.FindAllString(val, -1)
+	if len(ids) == 0 {
+		// Some clients omit the brackets
+		for _, id := range strings.Fields(val) {
+			ids = append(ids, "<"+id+">")
+		}
+	}
+	return ids
+}
+
+// parseListId extracts the identifier from "Description <list.example.com>"
+func parseListId(val string) string {
+	if id := angleBracketedRegexp.FindString(val); id != "" {
+		return strings.Trim(id, "<>")
+	}
+	return strings.TrimSpace(val)
+}
+
+// parseListUnsubscribe extracts the URIs from a List-Unsubscribe header
+// (RFC 2369). Each URI must be in angle brackets.
+func parseListUnsubscribe(val string) []string {
+	var uris []string
+	for _, uri := range angleBracketedRegexp.FindAllString(val, -1) {
+		uri = strings.Join(strings.Fields(strings.Trim(uri, "<>")), "")
+		if uri != "" {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
+
+// HeadersFromPairs parses the headers from name/value pairs, as they appear in
+// a message payload.
+func HeadersFromPairs(hdrs []*gm.MessagePartHeader) *Headers {
+	headers := &Headers{}
+	for _, hdr := range hdrs {
+		switch strings.ToLower(hdr.Name) {
+		case "subject":
+			headers.Subject = mime.DecodeHeader(hdr.Value)
+		case "from":
+			emails := GetEmailsInField(hdr.Value)
+			if len(emails) > 0 {
+				headers.From = emails[0]
+			}
+		case "to":
+			headers.To = append(headers.To, GetEmailsInField(hdr.Value)...)
+		case "cc":
+			headers.Cc = append(headers.Cc, GetEmailsInField(hdr.Value)...)
+		case "bcc":
+			headers.Bcc = append(headers.Bcc, GetEmailsInField(hdr.Value)...)
+		case "reply-to":
+			headers.ReplyTo = append(headers.ReplyTo, GetEmailsInField(hdr.Value)...)
+		case "date":
+			if date, err := mail.ParseDate(strings.TrimSpace(hdr.Value)); err == nil {
+				headers.Date = date
+			}
+		case "message-id":
+			if ids := parseMsgIdList(hdr.Value); len(ids) > 0 {
+				headers.MessageId = ids[0]
+			}
+		case "in-reply-to":
+			headers.InReplyTo = parseMsgIdList(hdr.Value)
+		case "references":
+			headers.References = parseMsgIdList(hdr.Value)
+		case "list-id":
+			headers.ListId = parseListId(hdr.Value)
+		case "list-unsubscribe":
+			headers.ListUnsubscribe = parseListUnsubscribe(hdr.Value)
+		case "list-unsubscribe-post":
+			headers.ListUnsubscribePost = strings.TrimSpace(hdr.Value)
+		}
+	}
+	return headers
+}
+
+func GetMsgHeaders(msg *gm.Message) (*Headers, error) {
+	if msg.Payload != nil && msg.Payload.Headers != nil {
+		return HeadersFromPairs(msg.Payload.Headers), nil
+	}
+	return nil, fmt.Errorf("No headers found")
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/base64"
 	"fmt"
 	"log"
 	"sync"
@@ -116,6 +117,20 @@ func (h *MsgHelper) getCache() *Cache {
 	return h.cache
 }
 
+// Forget drops all loaded labels, threads and messages, so that they are
+// reloaded from the server when next needed. For long running processes,
+// where these may have changed since they were loaded.
+func (h *MsgHelper) Forget() {
+	h.mutex.Lock()
+	h.loadedThreads = make(map[string]*gm.Thread)
+	h.labels = nil
+	h.mutex.Unlock()
+	if h.cache != nil {
+		h.cache.Close()
+		h.cache = nil
+	}
+}
+
 // ---------- Message methods ----------------
 
 func (h *MsgHelper) loadLabels() error {
@@ -155,6 +170,16 @@ func (h *MsgHelper) LabelNames(ids []string) []string {
 	return lNames
 }
 
+// LabelNamesById returns a copy of the label ID to name lookup.
+func (h *MsgHelper) LabelNamesById() map[string]string {
+	h.requireLabels()
+	names := make(map[string]string, len(h.labels))
+	for id, name := range h.labels {
+		names[id] = name
+	}
+	return names
+}
+
 func (h *MsgHelper) MessageLabelNames(m *gm.Message) []string {
 	return h.LabelNames(m.LabelIds)
 }
@@ -304,6 +329,64 @@ func (h *MsgHelper) loadMessage(id string, detail MessageDetailLevel,
 	return msg, err
 }
 
+// GetRawMessage loads the message in raw format, and decodes the full RFC 2822
+// message content. Raw messages are not cached, since they may be very large.
+// The returned message has no Payload, but does have its labels set.
+func (h *MsgHelper) GetRawMessage(id string) (*gm.Message, []byte, error) {
+	prnt.Deb.Ln("Loading raw msg", id)
+	msg, err := h.srv.Users.Messages.Get(h.User, id).
+		Format(MessageFormatRaw.ToString()).Do()
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := DecodeBase64Url(msg.Raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to decode raw message %s: %v", id, err)
+	}
+	return msg, raw, nil
+}
+
+// GetAttachmentData returns the decoded content of the attachment. Small
+// attachments may be included in the message itself, but larger ones are
+// fetched separately.
+func (h *MsgHelper) GetAttachmentData(att *AttachmentInfo) ([]byte, error) {
+	body := att.part.Body
+	if body == nil {
+		return []byte{}, nil
+	}
+	if body.AttachmentId == "" {
+		return DecodeBase64Url(body.Data)
+	}
+	prnt.Deb.Ln("Loading attachment", att.PartId, "of msg", att.MessageId)
+	r, err := h.srv.Users.Messages.Attachments.Get(
+		h.User, att.MessageId, body.AttachmentId).Do()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeBase64Url(r.Data)
+}
+
+// SendMessage sends a full RFC 2822 message. If threadId is not empty, the
+// message is added to that thread (the message's headers must also be valid
+// for the thread).
+func (h *MsgHelper) SendMessage(raw []byte, threadId string) (*gm.Message, error) {
+	msg := &gm.Message{
+		Raw:      base64.URLEncoding.EncodeToString(raw),
+		ThreadId: threadId,
+	}
+	return h.srv.Users.Messages.Send(h.User, msg).Do()
+}
+
+// CreateDraft saves a full RFC 2822 message as a draft, optionally in the
+// thread threadId.
+func (h *MsgHelper) CreateDraft(raw []byte, threadId string) (*gm.Draft, error) {
+	draft := &gm.Draft{Message: &gm.Message{
+		Raw:      base64.URLEncoding.EncodeToString(raw),
+		ThreadId: threadId,
+	}}
+	return h.srv.Users.Drafts.Create(h.User, draft).Do()
+}
+
 func (h *MsgHelper) ThreadIsLoaded(id string) bool {
 	_, ok := h.loadedThreads[id]
 	return ok
@@ -479,15 +562,152 @@ func (h *MsgHelper) LabelIdsForLabels(labels []Label) []string {
 	return labelIds
 }
 
-func (h *MsgHelper) LabelIdFromName(label string) string {
+// LabelIdByName returns the ID of the label named label, if it exists.
+func (h *MsgHelper) LabelIdByName(label string) (string, bool) {
 	h.requireLabels()
 	for lId, lName := range h.labels {
 		if label == lName {
-			return lId
+			return lId, true
+		}
+	}
+	return "", false
+}
+
+func (h *MsgHelper) LabelIdFromName(label string) string {
+	lId, ok := h.LabelIdByName(label)
+	if !ok {
+		log.Fatalf("%v\n", h.unknownLabelError(label))
+	}
+	return lId
+}
+
+func (h *MsgHelper) unknownLabelError(label string) error {
+	h.requireLabels()
+	names := make([]string, 0, len(h.labels))
+	for _, name := range h.labels {
+		names = append(names, name)
+	}
+	suggestion, _ := ClosestLabelName(label, names)
+	return &UnknownLabelError{Name: label, Suggestion: suggestion}
+}
+
+// MissingLabelNames returns the names in labels which do not exist, or an
+// UnknownLabelError for the first of them if createMissing is false. Labels
+// given by ID are assumed to exist.
+func (h *MsgHelper) MissingLabelNames(labels []Label, createMissing bool,
+) ([]string, error) {
+	var missing []string
+	for _, l := range labels {
+		if l.id != "" || util.StringSliceContains(l.name, missing) {
+			continue
+		}
+		if _, ok := h.LabelIdByName(l.name); !ok {
+			if !createMissing {
+				return nil, h.unknownLabelError(l.name)
+			}
+			missing = append(missing, l.name)
+		}
+	}
+	return missing, nil
+}
+
+// CreateMissingLabels creates any of the named labels (and their parents) which
+// do not exist, and then reloads the label map, so that IDs can be resolved
+// for all of them. Returns the names which were created.
+func (h *MsgHelper) CreateMissingLabels(names []string) ([]string, error) {
+	missing, err := h.MissingLabelNames(LabelsFromLabelNames(names), true)
+	if err != nil || len(missing) == 0 {
+		return nil, err
+	}
+	for _, name := range missing {
+		if _, ok := h.LabelIdByName(name); ok {
+			// Created as the parent of an earlier label
+			continue
+		}
+		if _, err := h.CreateLabel(name); err != nil {
+			return nil, fmt.Errorf("Failed to create label %s: %v", name, err)
+		}
+	}
+	if err := h.loadLabels(); err != nil {
+		return nil, fmt.Errorf("Failed to reload labels: %v", err)
+	}
+	return missing, nil
+}
+
+// ---------- Label management ----------------
+
+// ListLabels returns all labels, without message counts. The name lookup used
+// by LabelName, etc. is refreshed as well.
+func (h *MsgHelper) ListLabels() ([]*gm.Label, error) {
+	r, err := h.srv.Users.Labels.List(h.User).Do()
+	if err != nil {
+		return nil, err
+	}
+	labelMap := make(map[string]string)
+	for _, l := range r.Labels {
+		labelMap[l.Id] = l.Name
+	}
+	h.labels = labelMap
+	return r.Labels, nil
+}
+
+// GetLabel returns the label with its message and thread counts.
+func (h *MsgHelper) GetLabel(id string) (*gm.Label, error) {
+	return h.srv.Users.Labels.Get(h.User, id).Do()
+}
+
+// CreateLabel creates a label. For nested names (Parent/Child), any missing
+// parent labels are created first, so that the label appears nested.
+func (h *MsgHelper) CreateLabel(name string) (*gm.Label, error) {
+	h.requireLabels()
+	if _, ok := h.LabelIdByName(name); ok {
+		return nil, fmt.Errorf("Label %s already exists", name)
+	}
+	for _, parent := range LabelParentNames(name) {
+		if _, ok := h.LabelIdByName(parent); ok {
+			continue
+		}
+		if _, err := h.createSingleLabel(parent); err != nil {
+			return nil, fmt.Errorf("Failed to create parent label %s: %v", parent, err)
 		}
 	}
-	log.Fatalf("No label named %s found\n", label)
-	return ""
+	return h.createSingleLabel(name)
+}
+
+func (h *MsgHelper) createSingleLabel(name string) (*gm.Label, error) {
+	prnt.Deb.Ln("Creating label", name)
+	label, err := h.srv.Users.Labels.Create(h.User, &gm.Label{
+		Name:                  name,
+		LabelListVisibility:   "labelShow",
+		MessageListVisibility: "show",
+	}).Do()
+	if err != nil {
+		return nil, err
+	}
+	h.labels[label.Id] = label.Name
+	return label, nil
+}
+
+// PatchLabel updates the fields of label id which are set in patch.
+func (h *MsgHelper) PatchLabel(id string, patch *gm.Label) (*gm.Label, error) {
+	label, err := h.srv.Users.Labels.Patch(h.User, id, patch).Do()
+	if err != nil {
+		return nil, err
+	}
+	if h.labels != nil {
+		h.labels[label.Id] = label.Name
+	}
+	return label, nil
+}
+
+// DeleteLabel deletes the label. It is removed from all messages, which are
+// not otherwise affected.
+func (h *MsgHelper) DeleteLabel(id string) error {
+	err := h.srv.Users.Labels.Delete(h.User, id).Do()
+	if err == nil && h.labels != nil {
+		delete(h.labels, id)
+	}
+	return err
 }
 
 const (
@@ -610,12 +830,10 @@ func (h *MsgHelper) ApplyLabelsByIdIter(
 }
 
 func (h *MsgHelper) ApplyLabelsToThreads(threads []*gm.Thread, labelNames []string) error {
-	allMsgs := make([]*gm.Message, 0, len(threads))
+	threadIds := make([]string, 0, len(threads))
 	for _, thread := range threads {
-		for _, msg := range thread.Messages {
-			allMsgs = append(allMsgs, msg)
-		}
+		threadIds = append(threadIds, thread.Id)
 	}
 
-	return h.ApplyLabels(allMsgs, LabelsFromLabelNames(labelNames), nil)
+	return h.ModifyThreads(threadIds, LabelsFromLabelNames(labelNames), nil)
 }
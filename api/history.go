@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+// ErrHistoryExpired is returned by AddedMessageIdsSince when the start history
+// ID is too old for Gmail to have its history (typically about a week).
+var ErrHistoryExpired = fmt.Errorf("History ID is too old. It must be reset")
+
+// IsNotFound returns true if err is a 404 from the API.
+func IsNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// CurrentHistoryId returns the latest history ID of the mailbox.
+func (h *MsgHelper) CurrentHistoryId() (uint64, error) {
+	r, err := h.srv.Users.GetProfile(h.User).Do()
+	if err != nil {
+		return 0, err
+	}
+	return r.HistoryId, nil
+}
+
+// AddedMessageIdsSince returns the IDs of messages added to the mailbox after
+// startHistoryId (in the order they were added), and the history ID they are
+// current to, to use as the start of the next call.
+func (h *MsgHelper) AddedMessageIdsSince(startHistoryId uint64) ([]string, uint64, error) {
+	pageToken := ""
+	queriedPageCnt := 0
+	latestHistoryId := startHistoryId
+	var ids []string
+	seen := make(map[string]bool)
+
+	for queriedPageCnt == 0 || pageToken != "" {
+		queriedPageCnt++
+		util.Debugf("Querying history since %d, page: %d\n", startHistoryId, queriedPageCnt)
+
+		call := h.srv.Users.History.List(h.User).
+			StartHistoryId(startHistoryId).HistoryTypes("messageAdded")
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+		r, err := call.Do()
+		if err != nil {
+			if IsNotFound(err) {
+				return nil, 0, ErrHistoryExpired
+			}
+			return nil, 0, fmt.Errorf("Unable to get history: %v", err)
+		}
+
+		pageToken = r.NextPageToken
+		if r.HistoryId > latestHistoryId {
+			latestHistoryId = r.HistoryId
+		}
+		for _, hist := range r.History {
+			for _, added := range hist.MessagesAdded {
+				if added.Message != nil && !seen[added.Message.Id] {
+					seen[added.Message.Id] = true
+					ids = append(ids, added.Message.Id)
+				}
+			}
+		}
+	}
+	return ids, latestHistoryId, nil
+}
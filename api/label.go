@@ -1,5 +1,16 @@
 package api
 
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/util"
+)
+
 type Label struct {
 	name string
 	id   string
@@ -31,3 +42,169 @@ func (l Label) String() string {
 // Constant Labels
 var InboxLabel = NewLabelWithId("INBOX")
 var TrashLabel = NewLabelWithId("TRASH")
+var UnreadLabel = NewLabelWithId("UNREAD")
+
+const LabelSeparator = "/"
+
+// IsSystemLabel returns true for labels which are managed by Gmail (INBOX,
+// CATEGORY_*, etc.), rather than by the user.
+func IsSystemLabel(l *gm.Label) bool {
+	return l.Type == "system"
+}
+
+// LabelParentNames returns the names of all ancestors of a nested label name,
+// outermost first. e.g. "A/B/C" -> ["A", "A/B"]
+func LabelParentNames(name string) []string {
+	parts := strings.Split(name, LabelSeparator)
+	var parents []string
+	for i := 1; i < len(parts); i++ {
+		parents = append(parents, strings.Join(parts[:i], LabelSeparator))
+	}
+	return parents
+}
+
+// IsLabelOrChild returns true if name is label, or nested anywhere under it.
+func IsLabelOrChild(name, label string) bool {
+	return name == label || strings.HasPrefix(name, label+LabelSeparator)
+}
+
+// RenamedLabel returns the new name for name, when label is renamed to
+// newLabel. Children of label are moved along with it.
+func RenamedLabel(name, label, newLabel string) string {
+	if !IsLabelOrChild(name, label) {
+		return name
+	}
+	return newLabel + strings.TrimPrefix(name, label)
+}
+
+// ClosestLabelName returns the name in names most similar to name, for
+// suggesting a correction when name is misspelled. Comparison ignores case.
+// Returns false if nothing is close enough to be a plausible typo.
+func ClosestLabelName(name string, names []string) (string, bool) {
+	lower := strings.ToLower(name)
+	maxDist := util.IntMax(2, len([]rune(name))/3)
+	best, bestDist := "", maxDist+1
+	for _, n := range names {
+		d := util.EditDistance(lower, strings.ToLower(n))
+		if d < bestDist || (d == bestDist && n < best) {
+			best, bestDist = n, d
+		}
+	}
+	return best, best != ""
+}
+
+// UnknownLabelError is returned when a label name does not exist.
+type UnknownLabelError struct {
+	Name string
+	// The closest existing label name, if any
+	Suggestion string
+}
+
+func (e *UnknownLabelError) Error() string {
+	if e.Suggestion != "" {
+		return fmt.Sprintf("No label named %s found (did you mean %s?)",
+			e.Name, e.Suggestion)
+	}
+	return fmt.Sprintf("No label named %s found", e.Name)
+}
+
+// LabelQueryName returns the form of a label name used in search queries
+// (e.g. "My Label/Sub" -> "my-label-sub").
+func LabelQueryName(name string) string {
+	return strings.ToLower(labelQueryNameReplacer.Replace(name))
+}
+
+var labelQueryNameReplacer = strings.NewReplacer(" ", "-", LabelSeparator, "-")
+
+// labelTermRegexp matches label: terms in a query for any of names, in either
+// their quoted or query name form. Groups are the "label:" prefix, the name,
+// and the trailing delimiter.
+func labelTermRegexp(names []string) *regexp.Regexp {
+	var alts []string
+	for _, name := range names {
+		alts = append(alts, regexp.QuoteMeta(`"`+name+`"`),
+			regexp.QuoteMeta(LabelQueryName(name)))
+	}
+	return regexp.MustCompile(
+		`(?i)(\blabel:)(` + strings.Join(alts, "|") + `)([\s(){}]|$)`)
+}
+
+// QueryReferencesLabel returns true if query has a label: term for label.
+func QueryReferencesLabel(query, label string) bool {
+	return labelTermRegexp([]string{label}).MatchString(query)
+}
+
+// RenameLabelsInQuery rewrites label: terms in a search query, for labels
+// which have been renamed (old name to new name).
+func RenameLabelsInQuery(query string, renames map[string]string) string {
+	if len(renames) == 0 {
+		return query
+	}
+	// Match the longest names first, so that children are not partially
+	// rewritten by their parent.
+	olds := make([]string, 0, len(renames))
+	for old := range renames {
+		olds = append(olds, old)
+	}
+	sort.Slice(olds, func(i, j int) bool { return len(olds[i]) > len(olds[j]) })
+
+	re := labelTermRegexp(olds)
+	return re.ReplaceAllStringFunc(query, func(match string) string {
+		sub := re.FindStringSubmatch(match)
+		name := sub[2]
+		for _, old := range olds {
+			if strings.EqualFold(name, `"`+old+`"`) {
+				return sub[1] + `"` + renames[old] + `"` + sub[3]
+			}
+			if strings.EqualFold(name, LabelQueryName(old)) {
+				return sub[1] + LabelQueryName(renames[old]) + sub[3]
+			}
+		}
+		return match
+	})
+}
+
+// LabelColorPalette holds the only colors the API accepts for labels.
+var LabelColorPalette = []string{
+	"#000000", "#434343", "#666666", "#999999", "#cccccc", "#efefef", "#f3f3f3",
+	"#ffffff", "#fb4c2f", "#ffad47", "#fad165", "#16a766", "#43d692", "#4a86e8",
+	"#a479e2", "#f691b3", "#f6c5be", "#ffe6c7", "#fef1d1", "#b9e4d0", "#c6f3de",
+	"#c9daf8", "#e4d7f5", "#fcdee8", "#efa093", "#ffd6a2", "#fce8b3", "#89d3b2",
+	"#a0eac9", "#a4c2f4", "#d0bcf1", "#fbc8d9", "#e66550", "#ffbc6b", "#fcda83",
+	"#44b984", "#68dfa9", "#6d9eeb", "#b694e8", "#f7a7c0", "#cc3a21", "#eaa041",
+	"#f2c960", "#149e60", "#3dc789", "#3c78d8", "#8e63ce", "#e07798", "#ac2b16",
+	"#cf8933", "#d5ae49", "#0b804b", "#2a9c68", "#285bac", "#653e9b", "#b65775",
+	"#822111", "#a46a21", "#aa8831", "#076239", "#1a764d", "#1c4587", "#41236d",
+	"#83334c", "#464646", "#e7e7e7", "#0d3472", "#b6cff5", "#0d3b44", "#98d7e4",
+	"#3d188e", "#e3d7ff", "#711a36", "#fbd3e0", "#8a1c0a", "#f2b2a8", "#7a2e0b",
+	"#ffc8af", "#7a4706", "#ffdeb5", "#594c05", "#fbe983", "#684e07", "#fdedc1",
+	"#0b4f30", "#b3efd3", "#04502e", "#a2dcc1", "#c2c2c2", "#4986e7", "#2da2bb",
+	"#b99aff", "#994a64", "#f691b2", "#ff7537", "#ffad46", "#662e37", "#ebdbde",
+	"#cca6ac", "#094228", "#42d692", "#16a765",
+}
+
+// ValidateLabelColor normalizes color (a hex color, with or without '#'), and
+// checks that it is in LabelColorPalette.
+func ValidateLabelColor(color string) (string, error) {
+	color = strings.ToLower(strings.TrimSpace(color))
+	if !strings.HasPrefix(color, "#") {
+		color = "#" + color
+	}
+	if !util.StringSliceContains(color, LabelColorPalette) {
+		return "", fmt.Errorf("%s is not an allowed label color. Allowed colors are:\n%s",
+			color, strings.Join(LabelColorPalette, " "))
+	}
+	return color, nil
+}
+
+// ContrastingTextColor returns black or white, whichever is more readable on
+// the background color (in the form "#rrggbb").
+func ContrastingTextColor(background string) string {
+	var r, g, b int
+	fmt.Sscanf(background, "#%02x%02x%02x", &r, &g, &b)
+	// Perceived brightness (ITU-R BT.601)
+	if (299*r+587*g+114*b)/1000 > 150 {
+		return "#000000"
+	}
+	return "#ffffff"
+}
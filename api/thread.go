@@ -0,0 +1,102 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+// ThreadSummary describes a thread as a whole, for printing one line per
+// thread rather than per message.
+type ThreadSummary struct {
+	Id           string
+	Subject      string
+	MessageCount int
+	// Senders of the messages, in order of first appearance
+	Participants []EmailAddress
+	// Date of the most recent message
+	LatestDate time.Time
+	// Union of the labels of all messages
+	LabelIds []string
+}
+
+// SummarizeThread summarizes a thread, whose messages must have been loaded
+// with their headers (as GetThread does).
+func SummarizeThread(thread *gm.Thread) *ThreadSummary {
+	summary := &ThreadSummary{Id: thread.Id, MessageCount: len(thread.Messages)}
+	seenSenders := make(map[string]bool)
+	seenLabels := make(map[string]bool)
+	for _, msg := range thread.Messages {
+		if date := util.TimeFromMillis(msg.InternalDate); date.After(summary.LatestDate) {
+			summary.LatestDate = date
+		}
+		for _, lId := range msg.LabelIds {
+			if !seenLabels[lId] {
+				seenLabels[lId] = true
+				summary.LabelIds = append(summary.LabelIds, lId)
+			}
+		}
+
+		headers, err := GetMsgHeaders(msg)
+		if err != nil {
+			continue
+		}
+		if summary.Subject == "" {
+			summary.Subject = headers.Subject
+		}
+		if headers.From.Address != "" && !seenSenders[headers.From.Address] {
+			seenSenders[headers.From.Address] = true
+			summary.Participants = append(summary.Participants, headers.From)
+		}
+	}
+	return summary
+}
+
+// ModifyThreads adds and removes labels on all messages of each thread.
+// Threads have no batch modify, so threads are modified concurrently.
+func (h *MsgHelper) ModifyThreads(
+	threadIds []string, labelsToAdd []Label, labelsToRemove []Label) error {
+
+	modReq := &gm.ModifyThreadRequest{
+		AddLabelIds:    h.LabelIdsForLabels(labelsToAdd),
+		RemoveLabelIds: h.LabelIdsForLabels(labelsToRemove),
+	}
+
+	prnt.HPrintf(prnt.Quietable, "Applying changes to threads ")
+	querySem := make(chan bool, MaxConcurrentRequests)
+	errChan := make(chan error)
+	for _, id_ := range threadIds {
+		go func(id string) {
+			querySem <- true
+			defer func() { <-querySem }()
+
+			_, err := h.srv.Users.Threads.Modify(h.User, id, modReq).Do()
+			if err != nil {
+				err = fmt.Errorf("Failed to modify thread %s: %w", id, err)
+			}
+			errChan <- err
+		}(id_)
+	}
+
+	var firstErr error
+	progP := prnt.NewProgressPrinter(len(threadIds))
+	for i := 0; i < len(threadIds); i++ {
+		progP.Progress(1)
+		if err := <-errChan; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	prnt.HPrintf(prnt.Quietable, "\n")
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, id := range threadIds {
+		// The cached thread labels are now out of date
+		delete(h.loadedThreads, id)
+	}
+	return firstErr
+}
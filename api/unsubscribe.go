@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type UnsubscribeMethod string
+
+const (
+	// RFC 8058 one-click POST to an https URI
+	OneClickUnsubscribe UnsubscribeMethod = "one-click"
+	// Send an email to a mailto URI
+	MailtoUnsubscribe UnsubscribeMethod = "mailto"
+	// An http(s) URI which must be visited in a browser
+	ManualUnsubscribe UnsubscribeMethod = "manual"
+)
+
+const oneClickPostValue = "List-Unsubscribe=One-Click"
+
+// UnsubscribeOption is a single way of unsubscribing from a list, from a
+// List-Unsubscribe header.
+type UnsubscribeOption struct {
+	Method UnsubscribeMethod
+	Uri    string
+}
+
+// UnsubscribeOptions returns the usable List-Unsubscribe options in headers, in
+// order of preference: one-click, then mailto, then manual.
+func UnsubscribeOptions(headers *Headers) []UnsubscribeOption {
+	oneClick := strings.EqualFold(
+		strings.Join(strings.Fields(headers.ListUnsubscribePost), ""), oneClickPostValue)
+
+	var opts, mailtos, manuals []UnsubscribeOption
+	for _, uri := range headers.ListUnsubscribe {
+		lower := strings.ToLower(uri)
+		switch {
+		case strings.HasPrefix(lower, "mailto:"):
+			mailtos = append(mailtos, UnsubscribeOption{MailtoUnsubscribe, uri})
+		case strings.HasPrefix(lower, "https://") && oneClick:
+			opts = append(opts, UnsubscribeOption{OneClickUnsubscribe, uri})
+		case strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://"):
+			manuals = append(manuals, UnsubscribeOption{ManualUnsubscribe, uri})
+		}
+	}
+	opts = append(opts, mailtos...)
+	return append(opts, manuals...)
+}
+
+var unsubscribeHttpClient = &http.Client{Timeout: 30 * time.Second}
+
+// PostOneClickUnsubscribe performs an RFC 8058 one-click unsubscribe request.
+func PostOneClickUnsubscribe(uri string) error {
+	resp, err := unsubscribeHttpClient.Post(uri, "application/x-www-form-urlencoded",
+		strings.NewReader(oneClickPostValue))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Unsubscribe request returned %s", resp.Status)
+	}
+	return nil
+}
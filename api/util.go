@@ -3,8 +3,6 @@ package api
 import (
 	"bytes"
 	"encoding/base64"
-	"fmt"
-	"regexp"
 	"sort"
 	"strings"
 
@@ -35,63 +33,10 @@ type MessageId struct {
 	Id string
 }
 
-type EmailAddress struct {
-	Address string
-	Name    string
-}
-
-type Headers struct {
-	Subject string
-	From    EmailAddress
-	To      []EmailAddress
-	Cc      []EmailAddress
-}
-
-var namedEmailRegexp = regexp.MustCompile(`\s*(\S|\S.*\S)\s*<(.*)>\s*`)
-var unnamedEmailRegexp = regexp.MustCompile(`^\s*(\S*)\s*$`)
-
-func GetEmailsInField(fromHeaderVal string) []EmailAddress {
-	emails := make([]EmailAddress, 0)
-	emailStrs := strings.Split(fromHeaderVal, ",")
-	for _, emailStr := range emailStrs {
-		matches := namedEmailRegexp.FindStringSubmatch(emailStr)
-		if len(matches) > 1 {
-			emails = append(emails, EmailAddress{
-				Address: matches[2],
-				Name:    matches[1]})
-		} else {
-			// Try unnamed
-			matches = unnamedEmailRegexp.FindStringSubmatch(emailStr)
-			if len(matches) > 0 {
-				emails = append(emails, EmailAddress{
-					Address: matches[1],
-					Name:    ""})
-			}
-		}
-	}
-	return emails
-}
-
-func GetMsgHeaders(msg *gm.Message) (*Headers, error) {
-	if msg.Payload != nil && msg.Payload.Headers != nil {
-		headers := &Headers{}
-		for _, hdr := range msg.Payload.Headers {
-			if hdr.Name == "Subject" {
-				headers.Subject = hdr.Value
-			} else if hdr.Name == "From" {
-				emails := GetEmailsInField(hdr.Value)
-				if len(emails) > 0 {
-					headers.From = emails[0]
-				}
-			} else if hdr.Name == "To" {
-				headers.To = GetEmailsInField(hdr.Value)
-			} else if hdr.Name == "Cc" {
-				headers.Cc = GetEmailsInField(hdr.Value)
-			}
-		}
-		return headers, nil
-	}
-	return nil, fmt.Errorf("No headers found")
+// DecodeBase64Url decodes data as used by the API for message bodies and raw
+// messages. Padding is optional.
+func DecodeBase64Url(data string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(data, "="))
 }
 
 func decodePartBody(part *gm.MessagePart) string {
@@ -103,18 +48,82 @@ func decodePartBody(part *gm.MessagePart) string {
 	return string(b[:])
 }
 
+// WalkMessageParts calls fn on part and all of its descendant parts, depth
+// first, in the order they appear in the message.
+func WalkMessageParts(part *gm.MessagePart, fn func(*gm.MessagePart)) {
+	if part == nil {
+		return
+	}
+	fn(part)
+	for _, child := range part.Parts {
+		WalkMessageParts(child, fn)
+	}
+}
+
+func IsAttachmentPart(part *gm.MessagePart) bool {
+	return part.Filename != "" || (part.Body != nil && part.Body.AttachmentId != "")
+}
+
 // Decodes the messages' body text, putting each part as a separate entry in the
-// returned slice. Will be at least size 1
+// returned slice. Attachments are skipped. Will be at least size 1
 func GetMessageBody(msg *gm.Message) []string {
 	partTexts := make([]string, 0, 1+len(msg.Payload.Parts))
-	partTexts = append(partTexts, decodePartBody(msg.Payload))
-	for _, part := range msg.Payload.Parts {
-		// For multipart messages
-		partTexts = append(partTexts, decodePartBody(part))
-	}
+	WalkMessageParts(msg.Payload, func(part *gm.MessagePart) {
+		if part == msg.Payload || (!IsAttachmentPart(part) && part.Body != nil &&
+			part.Body.Data != "") {
+			partTexts = append(partTexts, decodePartBody(part))
+		}
+	})
 	return partTexts
 }
 
+type AttachmentInfo struct {
+	MessageId string
+	PartId    string
+	Filename  string
+	MimeType  string
+	// Size in bytes, as reported by the API
+	Size int64
+
+	part *gm.MessagePart
+}
+
+// NewAttachmentInfo refers to an attachment stored separately from its
+// message, for use with MsgHelper.GetAttachmentData
+func NewAttachmentInfo(msgId, partId, attachmentId string) *AttachmentInfo {
+	return &AttachmentInfo{
+		MessageId: msgId,
+		PartId:    partId,
+		part: &gm.MessagePart{
+			PartId: partId,
+			Body:   &gm.MessagePartBody{AttachmentId: attachmentId},
+		},
+	}
+}
+
+// MessageAttachments finds all attachments in the message's MIME tree. The
+// message must have been loaded with its payload.
+func MessageAttachments(msg *gm.Message) []*AttachmentInfo {
+	var atts []*AttachmentInfo
+	WalkMessageParts(msg.Payload, func(part *gm.MessagePart) {
+		if !IsAttachmentPart(part) {
+			return
+		}
+		att := &AttachmentInfo{
+			MessageId: msg.Id,
+			PartId:    part.PartId,
+			Filename:  part.Filename,
+			MimeType:  part.MimeType,
+			part:      part,
+		}
+		if part.Body != nil {
+			att.Size = part.Body.Size
+		}
+		atts = append(atts, att)
+	})
+	return atts
+}
+
 func MessageHasBody(msg *gm.Message) bool {
 	return msg.Payload != nil && msg.Payload.Body != nil
 }
@@ -0,0 +1,84 @@
+// Package classifier is a naive Bayes classifier of message interest, trained
+// from how the user has handled their messages.
+package classifier
+
+import (
+	"regexp"
+	"strings"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+const sentLabel = "SENT"
+
+var subjectTokenRegexp = regexp.MustCompile(`[\pL\pN]{3,}`)
+
+// Tokens too common in subjects to say anything about the message
+var subjectStopWords = map[string]bool{
+	"and": true, "for": true, "fwd": true, "the": true, "you": true, "your": true,
+}
+
+// threadSent returns whether the user sent a message in thread before m, and
+// whether they sent one after m (i.e. replied to it).
+func threadSent(m *gm.Message, thread *gm.Thread) (before, after bool) {
+	if thread == nil {
+		return false, false
+	}
+	for _, tMsg := range thread.Messages {
+		if tMsg.Id == m.Id || !util.StringSliceContains(sentLabel, tMsg.LabelIds) {
+			continue
+		}
+		if tMsg.InternalDate < m.InternalDate {
+			before = true
+		} else {
+			after = true
+		}
+	}
+	return before, after
+}
+
+// Features returns the features of m used by the classifier: its sender,
+// sender domain, List-Id, subject words, and whether the user had already taken
+// part in its thread when it arrived. Replies to m are not features, since they
+// decide its training Class. m must be loaded with at least api.LabelsOnly.
+// thread may be nil if it is not known.
+func Features(m *gm.Message, thread *gm.Thread) []string {
+	var features []string
+	seen := make(map[string]bool)
+	add := func(f string) {
+		if !seen[f] {
+			seen[f] = true
+			features = append(features, f)
+		}
+	}
+
+	if headers, err := api.GetMsgHeaders(m); err == nil {
+		addr := strings.ToLower(headers.From.Address)
+		if addr != "" {
+			add("from:" + addr)
+			// The domain and each parent domain, down to e.g. example.com
+			domain := addr[strings.LastIndex(addr, "@")+1:]
+			for strings.Count(domain, ".") > 0 {
+				add("domain:" + domain)
+				domain = domain[strings.Index(domain, ".")+1:]
+			}
+		}
+		if headers.ListId != "" {
+			add("list:" + strings.ToLower(headers.ListId))
+		}
+		for _, tok := range subjectTokenRegexp.FindAllString(
+			strings.ToLower(headers.Subject), -1) {
+			if !subjectStopWords[tok] {
+				add("subject:" + tok)
+			}
+		}
+	}
+
+	if participated, _ := threadSent(m, thread); participated {
+		add("thread:participated")
+	}
+	return features
+}
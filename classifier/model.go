@@ -0,0 +1,145 @@
+package classifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+// ModelFileName is the file in ~/.gmailcli which the trained model is stored
+// in.
+const ModelFileName = "classifier.json"
+
+const modelVersion = 1
+
+// Class is a category of interest learned by the classifier
+type Class int
+
+const (
+	Uninteresting Class = iota
+	Interesting
+)
+
+func (c Class) String() string {
+	if c == Interesting {
+		return "interesting"
+	}
+	return "uninteresting"
+}
+
+// Sample is a message to train on or evaluate with, of a known class.
+type Sample struct {
+	Id       string
+	Features []string
+	Class    Class
+}
+
+// Model is a naive Bayes model of the interest of messages, given their
+// features.
+type Model struct {
+	Version int       `json:"version"`
+	Trained time.Time `json:"trained"`
+	// Number of training messages of each class
+	Messages [2]int `json:"messages"`
+	// Number of training messages of each class with each feature
+	Features map[string][2]int `json:"features"`
+}
+
+// Train returns a model trained on samples.
+func Train(samples []*Sample, now time.Time) *Model {
+	m := &Model{Version: modelVersion, Trained: now, Features: make(map[string][2]int)}
+	for _, s := range samples {
+		m.Messages[s.Class]++
+		for _, f := range s.Features {
+			counts := m.Features[f]
+			counts[s.Class]++
+			m.Features[f] = counts
+		}
+	}
+	return m
+}
+
+// IsTrained returns true if the model has seen messages of both classes.
+func (m *Model) IsTrained() bool {
+	return m.Messages[Uninteresting] > 0 && m.Messages[Interesting] > 0
+}
+
+// Probability returns the probability that a message with features is
+// interesting. Features not seen in training are ignored. ok is false if the
+// model is not trained, or none of the features are known.
+func (m *Model) Probability(features []string) (p float64, ok bool) {
+	if !m.IsTrained() {
+		return 0, false
+	}
+	n0 := float64(m.Messages[Uninteresting])
+	n1 := float64(m.Messages[Interesting])
+	logOdds := math.Log(n1 / n0)
+	for _, f := range features {
+		counts, known := m.Features[f]
+		if !known {
+			continue
+		}
+		ok = true
+		// Laplace smoothed likelihood of the feature in each class
+		logOdds += math.Log((float64(counts[Interesting])+1)/(n1+2)) -
+			math.Log((float64(counts[Uninteresting])+1)/(n0+2))
+	}
+	return 1 / (1 + math.Exp(-logOdds)), ok
+}
+
+// Predict returns the class of a message with features, if the model is at
+// least threshold (0.5 to 1) confident of it.
+func (m *Model) Predict(features []string, threshold float64) (Class, float64, bool) {
+	p, ok := m.Probability(features)
+	if !ok {
+		return Uninteresting, 0, false
+	}
+	if p >= threshold {
+		return Interesting, p, true
+	} else if 1-p >= threshold {
+		return Uninteresting, 1 - p, true
+	}
+	return Uninteresting, math.Max(p, 1-p), false
+}
+
+// ModelFile returns the path of the model file in ~/.gmailcli
+func ModelFile() (string, error) {
+	return util.HomeDirAndFile(util.UserAppDirName, ModelFileName)
+}
+
+// LoadModel reads the model file fname. If it does not exist, the model is
+// untrained.
+func LoadModel(fname string) (*Model, error) {
+	m := &Model{Version: modelVersion}
+	data, err := os.ReadFile(fname)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %v", fname, err)
+	}
+	if m.Version != modelVersion {
+		return nil, fmt.Errorf("%s is from an incompatible version of gmailcli. "+
+			"Run 'classifier train' to replace it.", fname)
+	}
+	return m, nil
+}
+
+// Save writes the model to fname, replacing the file atomically.
+func (m *Model) Save(fname string) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	tmpName := fname + ".tmp"
+	if err = os.WriteFile(tmpName, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, fname)
+}
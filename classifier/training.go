@@ -0,0 +1,167 @@
+package classifier
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+const (
+	defaultTrainingQuery       = "newer_than:1y -in:chats"
+	defaultMaxTrainingMessages = 2000
+	defaultThreshold           = 0.8
+)
+
+// Config is the classifier section of PluginConfig in config.yaml
+type Config struct {
+	// Query for the messages to train on. Defaults to the last year.
+	TrainingQuery       string `yaml:"TrainingQuery"`
+	MaxTrainingMessages int64  `yaml:"MaxTrainingMessages"`
+	// How confident (0.5 to 1) the classifier must be to give an interest
+	// level. Defaults to 0.8.
+	Threshold float64 `yaml:"Threshold"`
+}
+
+func (c *Config) GetTrainingQuery() string {
+	if c.TrainingQuery == "" {
+		return defaultTrainingQuery
+	}
+	return c.TrainingQuery
+}
+
+func (c *Config) GetMaxTrainingMessages() int64 {
+	if c.MaxTrainingMessages == 0 {
+		return defaultMaxTrainingMessages
+	}
+	return c.MaxTrainingMessages
+}
+
+func (c *Config) GetThreshold() float64 {
+	if c.Threshold == 0 {
+		return defaultThreshold
+	}
+	return c.Threshold
+}
+
+func (c *Config) Validate() error {
+	if c.Threshold != 0 && (c.Threshold < 0.5 || c.Threshold > 1) {
+		return fmt.Errorf("Classifier Threshold must be between 0.5 and 1")
+	}
+	return nil
+}
+
+// Labeler decides which class a message belongs to for training, from how the
+// user has handled it.
+type Labeler struct {
+	// e.g. the InterestingLabelPatterns
+	InterestingLabels []*regexp.Regexp
+	// e.g. the AlwaysUninterestingLabelPatterns
+	UninterestingLabels []*regexp.Regexp
+	// The ApplyLabelOnTouch label. Touched messages which have been archived
+	// are uninteresting.
+	TouchLabel string
+}
+
+func anyLabelMatches(res []*regexp.Regexp, labelNames []string) bool {
+	for _, re := range res {
+		for _, name := range labelNames {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Class returns the class of m, which has labelNames. Messages which are
+// starred, were replied to, or have an interesting label are interesting.
+// Touched and archived messages, or those with an uninteresting label, are
+// uninteresting. ok is false if the message is neither, or both.
+func (l *Labeler) Class(m *gm.Message, labelNames []string, thread *gm.Thread,
+) (class Class, ok bool) {
+	_, replied := threadSent(m, thread)
+	interesting := replied ||
+		util.StringSliceContains("STARRED", m.LabelIds) ||
+		anyLabelMatches(l.InterestingLabels, labelNames)
+	uninteresting := anyLabelMatches(l.UninterestingLabels, labelNames) ||
+		(l.TouchLabel != "" && util.StringSliceContains(l.TouchLabel, labelNames) &&
+			!util.StringSliceContains("INBOX", m.LabelIds))
+
+	if interesting == uninteresting {
+		return Uninteresting, false
+	}
+	if interesting {
+		return Interesting, true
+	}
+	return Uninteresting, true
+}
+
+// SplitHoldout deterministically splits samples into those to train on, and
+// about percent of them to test with.
+func SplitHoldout(samples []*Sample, percent int) (train, test []*Sample) {
+	for _, s := range samples {
+		h := fnv.New32a()
+		h.Write([]byte(s.Id))
+		if int(h.Sum32()%100) < percent {
+			test = append(test, s)
+		} else {
+			train = append(train, s)
+		}
+	}
+	return train, test
+}
+
+// ClassStats are the results for one class in an Evaluation
+type ClassStats struct {
+	TruePositives  int
+	FalsePositives int
+	FalseNegatives int
+}
+
+// Precision is the fraction of messages predicted as the class which were
+// correct.
+func (s *ClassStats) Precision() float64 {
+	if s.TruePositives+s.FalsePositives == 0 {
+		return 0
+	}
+	return float64(s.TruePositives) / float64(s.TruePositives+s.FalsePositives)
+}
+
+// Recall is the fraction of messages of the class which were predicted as it.
+func (s *ClassStats) Recall() float64 {
+	if s.TruePositives+s.FalseNegatives == 0 {
+		return 0
+	}
+	return float64(s.TruePositives) / float64(s.TruePositives+s.FalseNegatives)
+}
+
+// Evaluation is how well a model predicted the classes of test samples.
+type Evaluation struct {
+	Samples int
+	// Samples which the model was not confident enough to classify. These
+	// count against recall.
+	Undecided int
+	Classes   [2]ClassStats
+}
+
+// Evaluate predicts the class of each of samples with m.
+func Evaluate(m *Model, samples []*Sample, threshold float64) *Evaluation {
+	ev := &Evaluation{Samples: len(samples)}
+	for _, s := range samples {
+		predicted, _, ok := m.Predict(s.Features, threshold)
+		if !ok {
+			ev.Undecided++
+			ev.Classes[s.Class].FalseNegatives++
+		} else if predicted == s.Class {
+			ev.Classes[s.Class].TruePositives++
+		} else {
+			ev.Classes[predicted].FalsePositives++
+			ev.Classes[s.Class].FalseNegatives++
+		}
+	}
+	return ev
+}
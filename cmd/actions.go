@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/plugin"
+	"github.com/tsiemens/gmail-tools/prnt"
+)
+
+// msgAction is a plugin's MessageAction, and the plugin's Context
+type msgAction struct {
+	*plugin.MessageAction
+	Ctx *plugin.Context
+}
+
+func allMessageActions(gHelper *GmailHelper) map[string]msgAction {
+	allActions := make(map[string]msgAction)
+	for _, plug := range gHelper.GetPlugins() {
+		for name, action := range plug.MessageActions {
+			allActions[name] = msgAction{action, plug.Ctx}
+		}
+	}
+	return allActions
+}
+
+func dumpMessageActions(gHelper *GmailHelper) {
+	for _, plug := range gHelper.GetPlugins() {
+		if len(plug.MessageActions) > 0 {
+			prnt.Hum.Always.F("From %s:\n", plug.Name)
+			for name, action := range plug.MessageActions {
+				prnt.Hum.Always.F("%-30s %s\n", name, action.Desc)
+			}
+		}
+	}
+}
+
+// checkMessageActionNames returns an error if any of names is not an action.
+func checkMessageActionNames(gHelper *GmailHelper, names []string) error {
+	allActions := allMessageActions(gHelper)
+	for _, name := range names {
+		if _, ok := allActions[name]; !ok {
+			return fmt.Errorf("'%s' is not an available action. "+
+				"Run search --list-actions for available actions.", name)
+		}
+	}
+	return nil
+}
+
+type msgActionResult struct {
+	plugin.ActionResult
+	Err error
+}
+
+// runMessageAction runs action concurrently on msgs, and returns the result
+// for each.
+func runMessageAction(action msgAction, msgs []*gm.Message, dryRun bool,
+) []msgActionResult {
+	results := make([]msgActionResult, len(msgs))
+	progress := prnt.NewProgressPrinter(len(msgs))
+	var progressMutex sync.Mutex
+	querySem := make(chan bool, api.MaxConcurrentRequests)
+	var wg sync.WaitGroup
+	for i := range msgs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			querySem <- true
+			defer func() { <-querySem }()
+			res, err := action.Run(action.Ctx, msgs[i], dryRun)
+			results[i] = msgActionResult{res, err}
+			progressMutex.Lock()
+			progress.Progress(1)
+			progressMutex.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	prnt.Hum.Always.Ln()
+	return results
+}
+
+func printMessageActionResults(name string, msgs []*gm.Message,
+	results []msgActionResult, dryRun bool) error {
+
+	changed := 0
+	failed := 0
+	for i, res := range results {
+		desc := res.Desc
+		if res.Err != nil {
+			failed++
+			desc = prnt.Colorize("Error: "+res.Err.Error(), "red")
+		} else if res.Changed {
+			changed++
+		}
+		if !Quiet {
+			prnt.Hum.Always.F("  %-18s %s\n", msgs[i].Id, desc)
+		}
+	}
+	verb := "changed"
+	if dryRun {
+		verb = "would change"
+	}
+	prnt.HPrintf(prnt.Always, "Action %s %s %d of %d messages\n",
+		name, verb, changed, len(msgs))
+	if failed > 0 {
+		return fmt.Errorf("Action %s failed on %d messages", name, failed)
+	}
+	return nil
+}
+
+// maybeRunMessageActions runs the named actions on msgs, in order, once
+// confirmed. With --dry, the actions only describe what they would do.
+func maybeRunMessageActions(gHelper *GmailHelper, msgs []*gm.Message,
+	names []string) error {
+
+	allActions := allMessageActions(gHelper)
+	for _, name := range names {
+		action := allActions[name]
+		if DryRun {
+			prnt.Hum.Always.F("Running action %s as a dry run (--dry provided) ", name)
+		} else if MaybeConfirmFromInput(
+			fmt.Sprintf("Run action %s on %d messages?", name, len(msgs)), true) {
+			prnt.Hum.Always.F("Running action %s ", name)
+		} else {
+			continue
+		}
+		results := runMessageAction(action, msgs, DryRun)
+		if err := printMessageActionResults(name, msgs, results, DryRun); err != nil {
+			return err
+		}
+	}
+	return nil
+}
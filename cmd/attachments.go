@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+const defaultAttachmentNameTemplate = "{{.Filename}}"
+
+var attachmentsDownloadDir string
+var attachmentsNameTemplate string
+var attachmentsMaxMsgs int64
+
+// Fields available to --name-template
+type attachmentNameData struct {
+	MessageId string
+	ThreadId  string
+	// Formatted as YYYY-MM-DD
+	Date    string
+	From    string
+	Subject string
+	// The full attachment filename, and its parts
+	Filename string
+	Base     string
+	Ext      string
+	// Index of the attachment within its message, starting at 1
+	Index int
+}
+
+func newAttachmentNameData(msg *gm.Message, att *api.AttachmentInfo, index int,
+) *attachmentNameData {
+	data := &attachmentNameData{
+		MessageId: msg.Id,
+		ThreadId:  msg.ThreadId,
+		Date:      util.TimeFromMillis(msg.InternalDate).Format("2006-01-02"),
+		Filename:  att.Filename,
+		Index:     index,
+	}
+	if data.Filename == "" {
+		data.Filename = fmt.Sprintf("attachment-%s", att.PartId)
+	}
+	data.Ext = filepath.Ext(data.Filename)
+	data.Base = strings.TrimSuffix(data.Filename, data.Ext)
+
+	if headers, err := api.GetMsgHeaders(msg); err == nil {
+		data.Subject = headers.Subject
+		data.From = headers.From.Address
+	}
+	return data
+}
+
+// sanitizePathComponent makes str safe to use as a single file name.
+func sanitizePathComponent(str string) string {
+	str = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, str)
+	str = strings.TrimSpace(str)
+	if str == "" || str == "." || str == ".." {
+		return "_"
+	}
+	return str
+}
+
+// attachmentStore writes attachments into a directory, skipping any whose
+// content is already present.
+type attachmentStore struct {
+	dir string
+	// SHA-256 hex digest to the file holding that content
+	hashes map[string]string
+}
+
+func hashFile(fname string) (string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func newAttachmentStore(dir string) (*attachmentStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	store := &attachmentStore{dir: dir, hashes: make(map[string]string)}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		store.hashes[sum] = path
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	prnt.Deb.F("Found %d existing files in %s\n", len(store.hashes), dir)
+	return store, nil
+}
+
+// uniquePath returns path, or path with a numeric suffix if it already exists.
+func uniquePath(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+// Save writes data to relPath (with '/' separated components) under the store
+// directory. Returns the path written, and whether the content was a duplicate
+// of an existing file (in which case that file's path is returned).
+func (s *attachmentStore) Save(relPath string, data []byte) (string, bool, error) {
+	sumBytes := sha256.Sum256(data)
+	sum := hex.EncodeToString(sumBytes[:])
+	if existing, ok := s.hashes[sum]; ok {
+		return existing, true, nil
+	}
+
+	var comps []string
+	for _, comp := range strings.Split(relPath, "/") {
+		comps = append(comps, sanitizePathComponent(comp))
+	}
+	path := filepath.Join(append([]string{s.dir}, comps...)...)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", false, err
+	}
+	path = uniquePath(path)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", false, err
+	}
+	s.hashes[sum] = path
+	return path, false, nil
+}
+
+func printMessageAttachments(gHelper *GmailHelper, msg *gm.Message,
+	atts []*api.AttachmentInfo) {
+	gHelper.PrintMessage(msg, 0)
+	for _, att := range atts {
+		prnt.Printf("   %-40s %-30s %10s\n", att.Filename, att.MimeType,
+			util.HumanReadableSize(att.Size))
+	}
+}
+
+// downloadAttachments saves all attachments of msg. Returns false if any
+// could not be saved.
+func downloadAttachments(gHelper *GmailHelper, store *attachmentStore,
+	nameTmpl *template.Template, msg *gm.Message, atts []*api.AttachmentInfo) bool {
+
+	ok := true
+	for i, att := range atts {
+		var nameBuf bytes.Buffer
+		err := nameTmpl.Execute(&nameBuf, newAttachmentNameData(msg, att, i+1))
+		if err != nil {
+			prnt.StderrLog.Printf("Failed to build name for %s: %v\n", att.Filename, err)
+			ok = false
+			continue
+		}
+
+		data, err := gHelper.Msgs.GetAttachmentData(att)
+		if err != nil {
+			prnt.StderrLog.Printf("Failed to download %s from message %s: %v\n",
+				att.Filename, msg.Id, err)
+			ok = false
+			continue
+		}
+
+		path, dup, err := store.Save(nameBuf.String(), data)
+		if err != nil {
+			prnt.StderrLog.Printf("Failed to save %s: %v\n", att.Filename, err)
+			ok = false
+		} else if dup {
+			prnt.LPrintf(prnt.Quietable, "   %s: same as %s, skipped\n",
+				att.Filename, path)
+		} else {
+			prnt.LPrintf(prnt.Quietable, "   %s -> %s\n", att.Filename, path)
+		}
+	}
+	return ok
+}
+
+func runAttachmentsCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	modifying := CmdMsgLabelModOptions.Modifies()
+	if modifying && attachmentsDownloadDir == "" {
+		return fmt.Errorf("Label changes require --download")
+	}
+	nameTmpl, err := template.New("name").Parse(attachmentsNameTemplate)
+	if err != nil {
+		return fmt.Errorf("Invalid --name-template: %v", err)
+	}
+
+	conf := config.AppConfig()
+	ValidateTouchOption(conf)
+
+	srv := api.NewGmailClientForOps(CmdMsgLabelModOptions.Ops()...)
+	gHelper := NewGmailHelper(srv, api.DefaultUser, conf)
+	if err := validateLabelModOptions(gHelper, &CmdMsgLabelModOptions); err != nil {
+		return err
+	}
+
+	// Don't bother loading messages which can't have attachments
+	query := args[0] + " has:attachment"
+	msgs, err := gHelper.Msgs.QueryMessages(
+		query, false, false, attachmentsMaxMsgs, api.LabelsAndPayload)
+	if err != nil {
+		return err
+	}
+
+	var store *attachmentStore
+	if attachmentsDownloadDir != "" {
+		store, err = newAttachmentStore(attachmentsDownloadDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	var downloadedMsgs []*gm.Message
+	nAtts := 0
+	for _, msg := range api.MessagesLatestFirst(msgs) {
+		atts := api.MessageAttachments(msg)
+		if len(atts) == 0 {
+			continue
+		}
+		nAtts += len(atts)
+		printMessageAttachments(gHelper, msg, atts)
+		if store != nil {
+			if downloadAttachments(gHelper, store, nameTmpl, msg, atts) {
+				downloadedMsgs = append(downloadedMsgs, msg)
+			}
+		}
+	}
+	prnt.HPrintf(prnt.Always, "Found %d attachments\n", nAtts)
+
+	if store != nil && len(downloadedMsgs) > 0 {
+		modifyMsgLabels(gHelper, downloadedMsgs, &CmdMsgLabelModOptions)
+	}
+	return nil
+}
+
+var attachmentsCmd = &cobra.Command{
+	Use:   "attachments QUERY",
+	Short: "Lists and downloads attachments of messages matching the query",
+	Long: `Lists the attachments of all messages matching QUERY, including those
+nested in multipart parts.
+
+With --download, attachments are saved into the given directory. Files whose
+content (by SHA-256) is already in the directory are skipped. --name-template
+is a Go template, with the fields:
+  .MessageId .ThreadId .Date .From .Subject .Filename .Base .Ext .Index
+'/' in the template creates subdirectories. For example:
+  --name-template '{{.Date}}/{{.Base}}-{{.MessageId}}{{.Ext}}'
+
+Label flags (e.g. --trash, --add-label) are applied only to messages for which
+every attachment was downloaded successfully.`,
+	Aliases: []string{"att"},
+	RunE:    runAttachmentsCmd,
+	Args:    cobra.ExactArgs(1),
+}
+
+func init() {
+	RootCmd.AddCommand(attachmentsCmd)
+
+	attachmentsCmd.Flags().StringVarP(&attachmentsDownloadDir, "download", "d", "",
+		"Download attachments into this directory")
+	attachmentsCmd.Flags().StringVar(&attachmentsNameTemplate, "name-template",
+		defaultAttachmentNameTemplate, "Template for downloaded file names")
+	attachmentsCmd.Flags().Int64VarP(&attachmentsMaxMsgs, "max", "m", -1,
+		"Set a max on how many results are queried.")
+
+	addLabelModFlags(attachmentsCmd)
+	addDryFlag(attachmentsCmd)
+	addAssumeYesFlag(attachmentsCmd)
+}
@@ -1,26 +1,26 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/spf13/cobra"
 
 	"github.com/tsiemens/gmail-tools/api"
 	"github.com/tsiemens/gmail-tools/prnt"
 )
 
+const defaultAuthProfileName = "modify"
+
 var forceAuthorize bool = false
 
 func runAuthCmd(cmd *cobra.Command, args []string) {
-	profileName := "email"
+	profileName := defaultAuthProfileName
 	if len(args) >= 1 {
 		profileName = args[0]
 	}
-	var profile *api.ScopeProfile
-	switch profileName {
-	case "email":
-		profile = api.ModifyScope
-	case "filters":
-		profile = api.FiltersScope
-	default:
+	profile, ok := api.ScopeProfileByName(profileName)
+	if !ok {
 		prnt.StderrLog.Fatalf("Invalid profile name '%s'", profileName)
 	}
 
@@ -30,25 +30,55 @@ func runAuthCmd(cmd *cobra.Command, args []string) {
 	_ = api.NewGmailClient(profile)
 }
 
+func authProfileNames() []string {
+	names := make([]string, 0, len(api.ScopeProfiles))
+	for _, profile := range api.ScopeProfiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+func authProfilesHelp() string {
+	lines := make([]string, 0, len(api.ScopeProfiles))
+	for _, profile := range api.ScopeProfiles {
+		nameStr := profile.Name
+		if len(profile.Aliases) > 0 {
+			nameStr += fmt.Sprintf(" (AKA '%s')", strings.Join(profile.Aliases, "', '"))
+		}
+		descStr := profile.Desc
+		if profile.Name == defaultAuthProfileName {
+			descStr += " This is the default used by the authorize command."
+		}
+		opStrs := make([]string, 0, len(profile.Ops))
+		for _, op := range profile.Ops {
+			opStrs = append(opStrs, op.String())
+		}
+		lines = append(lines, fmt.Sprintf("\t%s: %s\n\t\tAllows: %s",
+			nameStr, descStr, strings.Join(opStrs, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
 // authCmd represents the auth command
 var authCmd = &cobra.Command{
-	Use:   "authorize [email|filters]",
-	Short: "Just set up the authentication of this tool with a Google account",
-	Long: `Authenticates the client with your gmail account.
-Attempts to open a browser window, where the user can obtain an auth code for gmailcli
-to use to access that account. By default, it will do nothing if already authenticated.
-Pass --force to re-authenticate.
-
-There are multiple authentication profiles the app uses, to avoid accidental changes
-to the account. Currently, these profiles are:
-	email (AKA 'modify'): Used to modify, search emails. This is the default used by the autorize command.
-	filters: Used to modify and organize gmail filter rules.`,
+	Short:   "Just set up the authentication of this tool with a Google account",
 	Aliases: []string{"auth"},
 	Run:     runAuthCmd,
 	Args:    cobra.RangeArgs(0, 1),
 }
 
 func init() {
+	authCmd.Use = fmt.Sprintf("authorize [%s]", strings.Join(authProfileNames(), "|"))
+	authCmd.Long = `Authenticates the client with your gmail account.
+Attempts to open a browser window, where the user can obtain an auth code for gmailcli
+to use to access that account. By default, it will do nothing if already authenticated.
+Pass --force to re-authenticate.
+
+There are multiple authentication profiles the app uses, to avoid accidental changes
+to the account. Each command requests the least privileged profile which allows the
+operations it needs. Currently, these profiles are:
+` + authProfilesHelp()
+
 	authCmd.Flags().BoolVar(&forceAuthorize, "force", false,
 		"Re-authorize even if previously authorized.")
 	RootCmd.AddCommand(authCmd)
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/classifier"
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/prnt"
+)
+
+var classifierMaxMsgs int64
+var classifierHoldoutPercent int
+
+// loadClassifierConfig loads the classifier plugin's section of PluginConfig
+func loadClassifierConfig() (*classifier.Config, error) {
+	classConf := &classifier.Config{}
+	if err := config.LoadPluginConfigInto("classifier", classConf); err != nil {
+		return nil, err
+	}
+	return classConf, classConf.Validate()
+}
+
+func classifierLabeler(conf *config.Config) *classifier.Labeler {
+	return &classifier.Labeler{
+		InterestingLabels:   conf.InterLabelRegexps,
+		UninterestingLabels: conf.AlwaysUninterLabelRegexps,
+		TouchLabel:          conf.ApplyLabelOnTouch,
+	}
+}
+
+// collectClassifierSamples finds the messages to train on or evaluate with.
+// args may override the TrainingQuery.
+func collectClassifierSamples(gHelper *GmailHelper, conf *config.Config,
+	classConf *classifier.Config, args []string) ([]*classifier.Sample, error) {
+
+	query := classConf.GetTrainingQuery()
+	if len(args) > 0 {
+		query = args[0]
+	}
+	maxMsgs := classConf.GetMaxTrainingMessages()
+	if classifierMaxMsgs != 0 {
+		maxMsgs = classifierMaxMsgs
+	}
+
+	msgs, err := gHelper.Msgs.QueryMessages(query, false, false, maxMsgs, api.LabelsOnly)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("Query matched no messages")
+	}
+
+	labeler := classifierLabeler(conf)
+	prnt.Hum.Always.P("Loading threads ")
+	querySem := make(chan bool, api.MaxConcurrentRequests)
+	sampleChan := make(chan *classifier.Sample, 100)
+	errChan := make(chan error, len(msgs))
+	for _, msg_ := range msgs {
+		go func(m *gm.Message) {
+			querySem <- true
+			defer func() { <-querySem }()
+			thread, err := gHelper.Msgs.GetThread(m.ThreadId, api.IdsOnly)
+			if err != nil {
+				errChan <- err
+				sampleChan <- nil
+				return
+			}
+			class, ok := labeler.Class(m, gHelper.Msgs.MessageLabelNames(m), thread)
+			if !ok {
+				sampleChan <- nil
+				return
+			}
+			sampleChan <- &classifier.Sample{
+				Id: m.Id, Features: classifier.Features(m, thread), Class: class}
+		}(msg_)
+	}
+
+	var samples []*classifier.Sample
+	var counts [2]int
+	progP := prnt.NewProgressPrinter(len(msgs))
+	for i := 0; i < len(msgs); i++ {
+		progP.Progress(1)
+		if s := <-sampleChan; s != nil {
+			samples = append(samples, s)
+			counts[s.Class]++
+		}
+	}
+	prnt.Hum.Always.P("\n")
+	if len(errChan) > 0 {
+		return nil, fmt.Errorf("Failed to load thread: %v", <-errChan)
+	}
+
+	prnt.HPrintf(prnt.Quietable,
+		"Found %d interesting and %d uninteresting messages, of %d queried\n",
+		counts[classifier.Interesting], counts[classifier.Uninteresting], len(msgs))
+	if counts[classifier.Interesting] == 0 || counts[classifier.Uninteresting] == 0 {
+		return nil, errors.New("Both interesting and uninteresting messages are " +
+			"required. Messages which are starred, replied to or have an " +
+			"InterestingLabelPatterns label are interesting. Those which are touched " +
+			"and archived, or have an AlwaysUninterestingLabelPatterns label are " +
+			"uninteresting.")
+	}
+	return samples, nil
+}
+
+func newClassifierGmailHelper() *GmailHelper {
+	srv := api.NewGmailClientForOps(msgOps(false)...)
+	return NewGmailHelper(srv, api.DefaultUser, config.AppConfig())
+}
+
+func runClassifierTrainCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	fname, err := classifier.ModelFile()
+	if err != nil {
+		return err
+	}
+	conf := config.AppConfig()
+	classConf, err := loadClassifierConfig()
+	if err != nil {
+		return err
+	}
+	samples, err := collectClassifierSamples(newClassifierGmailHelper(), conf, classConf,
+		args)
+	if err != nil {
+		return err
+	}
+
+	model := classifier.Train(samples, time.Now())
+	prnt.HPrintf(prnt.Always, "Trained on %d messages, with %d features\n",
+		len(samples), len(model.Features))
+	if DryRun {
+		prnt.HPrintln(prnt.Always, "Dry run. Model not saved.")
+		return nil
+	}
+	if err = model.Save(fname); err != nil {
+		return fmt.Errorf("Failed to save model: %v", err)
+	}
+	prnt.HPrintf(prnt.Quietable, "Model saved to %s\n", fname)
+	return nil
+}
+
+func printClassifierEvaluation(ev *classifier.Evaluation, nTrained int, threshold float64) {
+	prnt.Hum.Always.F("Evaluated on %d held out messages, after training on %d\n\n",
+		ev.Samples, nTrained)
+	prnt.Hum.Always.F("%-16s %-10s %s\n", "CLASS", "PRECISION", "RECALL")
+	for _, class := range []classifier.Class{classifier.Interesting, classifier.Uninteresting} {
+		stats := &ev.Classes[class]
+		prnt.Hum.Always.F("%-16s %-10s %.1f%%\n", class,
+			fmt.Sprintf("%.1f%%", stats.Precision()*100), stats.Recall()*100)
+	}
+	prnt.Hum.Always.F("\n%d undecided (less than %.0f%% confident)\n",
+		ev.Undecided, threshold*100)
+}
+
+func runClassifierEvalCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if classifierHoldoutPercent < 1 || classifierHoldoutPercent > 99 {
+		return errors.New("--holdout must be between 1 and 99")
+	}
+	conf := config.AppConfig()
+	classConf, err := loadClassifierConfig()
+	if err != nil {
+		return err
+	}
+	samples, err := collectClassifierSamples(newClassifierGmailHelper(), conf, classConf,
+		args)
+	if err != nil {
+		return err
+	}
+
+	train, test := classifier.SplitHoldout(samples, classifierHoldoutPercent)
+	if len(test) == 0 || len(train) == 0 {
+		return errors.New("Too few messages to evaluate with. Try a larger --holdout.")
+	}
+	model := classifier.Train(train, time.Now())
+	threshold := classConf.GetThreshold()
+	printClassifierEvaluation(classifier.Evaluate(model, test, threshold), len(train), threshold)
+	return nil
+}
+
+// classifierCmd represents the classifier command tree
+var classifierCmd = &cobra.Command{
+	Use:   "classifier",
+	Short: "Trains and evaluates the interest classifier plugin",
+	Long: `The classifier plugin categorizes messages as weakly interesting or
+uninteresting, with a naive Bayes model of their sender, domain, List-Id,
+subject words, and whether you took part in (or replied to) their thread.
+
+It learns from the messages matched by TrainingQuery. Messages which are starred,
+replied to, or have a label matched by InterestingLabelPatterns are interesting.
+Those which have the ApplyLabelOnTouch label and were archived, or have a label
+matched by AlwaysUninterestingLabelPatterns, are uninteresting. It is configured
+in the classifier section of PluginConfig in ~/.gmailcli/config.yaml. For example:
+
+PluginConfig:
+  classifier:
+    TrainingQuery: newer_than:6m
+    MaxTrainingMessages: 5000
+    Threshold: 0.9`,
+}
+
+var classifierTrainCmd = &cobra.Command{
+	Use:   "train [QUERY]",
+	Short: "Trains the classifier on your messages",
+	Long: `Trains the classifier on the messages matched by QUERY (or TrainingQuery),
+and saves the model to ~/.gmailcli/` + classifier.ModelFileName + `.`,
+	RunE: runClassifierTrainCmd,
+	Args: cobra.RangeArgs(0, 1),
+}
+
+var classifierEvalCmd = &cobra.Command{
+	Use:   "eval [QUERY]",
+	Short: "Reports the classifier's precision and recall",
+	Long: `Trains a model on most of the messages matched by QUERY (or TrainingQuery),
+and reports its precision and recall for each class on the rest. The saved
+model is not changed.`,
+	RunE: runClassifierEvalCmd,
+	Args: cobra.RangeArgs(0, 1),
+}
+
+func init() {
+	RootCmd.AddCommand(classifierCmd)
+	classifierCmd.AddCommand(classifierTrainCmd)
+	classifierCmd.AddCommand(classifierEvalCmd)
+
+	for _, c := range []*cobra.Command{classifierTrainCmd, classifierEvalCmd} {
+		c.Flags().Int64VarP(&classifierMaxMsgs, "max", "m", 0,
+			"Set a max on how many messages are queried. "+
+				"Overrides MaxTrainingMessages.")
+	}
+	classifierEvalCmd.Flags().IntVar(&classifierHoldoutPercent, "holdout", 20,
+		"Percent of messages to evaluate with, rather than train on")
+	addDryFlag(classifierTrainCmd)
+}
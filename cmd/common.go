@@ -15,6 +15,7 @@ import (
 
 var DryRun = false
 var AssumeYes = false
+var ThreadMode = false
 
 type MsgLabelModOptions struct {
 	LabelNamesToAdd []string
@@ -22,6 +23,8 @@ type MsgLabelModOptions struct {
 	Touch           bool
 	Trash           bool
 	Archive         bool
+	// Create labels in LabelNamesToAdd (or the touch label) if they don't exist
+	CreateMissingLabels bool
 }
 
 var CmdMsgLabelModOptions = MsgLabelModOptions{
@@ -30,6 +33,33 @@ var CmdMsgLabelModOptions = MsgLabelModOptions{
 	Touch:           false,
 	Trash:           false,
 	Archive:         false,
+	CreateMissingLabels: false,
+}
+
+// Modifies returns true if any of the options would change message labels.
+func (o *MsgLabelModOptions) Modifies() bool {
+	return len(o.LabelNamesToAdd) > 0 || len(o.LabelNamesToRemove) > 0 ||
+		o.Touch || o.Trash || o.Archive
+}
+
+// msgOps returns the API operations needed to read messages, and optionally
+// modify them.
+func msgOps(modify bool) []api.Operation {
+	ops := []api.Operation{api.ReadMessagesOp, api.ReadLabelsOp}
+	if modify {
+		ops = append(ops, api.ModifyMessagesOp)
+	}
+	return ops
+}
+
+// Ops returns the API operations needed to query messages and apply the
+// options to them.
+func (o *MsgLabelModOptions) Ops() []api.Operation {
+	ops := msgOps(o.Modifies())
+	if o.CreateMissingLabels {
+		ops = append(ops, api.ModifyLabelsOp)
+	}
+	return ops
 }
 
 func addDryFlag(command *cobra.Command) {
@@ -42,6 +72,10 @@ func addAssumeYesFlag(command *cobra.Command) {
 		"Answer 'yes' for all prompts")
 }
 
+func addThreadsFlag(command *cobra.Command, usage string) {
+	command.Flags().BoolVarP(&ThreadMode, "threads", "T", false, usage)
+}
+
 // @targetDesc should be something describing what messages will be labelled.
 func addLabelModFlags(command *cobra.Command) {
 	command.Flags().StringArrayVar(
@@ -56,6 +90,9 @@ func addLabelModFlags(command *cobra.Command) {
 		"Send messages to the trash")
 	command.Flags().BoolVar(&CmdMsgLabelModOptions.Archive, "archive", false,
 		"Archive messages (remove from inbox)")
+	command.Flags().BoolVar(
+		&CmdMsgLabelModOptions.CreateMissingLabels, "create-labels", false,
+		"Create labels given to --add-label (or the touch label) if they don't exist")
 }
 
 func ValidateTouchOption(conf *config.Config) {
@@ -65,6 +102,49 @@ func ValidateTouchOption(conf *config.Config) {
 	}
 }
 
+// labelsToAddFromOptions returns the user labels (not system labels) which
+// opts would add to messages.
+func labelsToAddFromOptions(gHelper *GmailHelper, opts *MsgLabelModOptions) []api.Label {
+	labels := api.LabelsFromLabelNames(opts.LabelNamesToAdd)
+	if opts.Touch {
+		labels = append(labels, gHelper.GetTouchLabel())
+	}
+	return labels
+}
+
+// validateLabelModOptions checks that the labels named in opts exist, so that
+// typos are reported before any (possibly long) query is run. With
+// CreateMissingLabels, labels to add which don't exist are created instead
+// (unless this is a dry run).
+func validateLabelModOptions(gHelper *GmailHelper, opts *MsgLabelModOptions) error {
+	_, err := gHelper.Msgs.MissingLabelNames(
+		api.LabelsFromLabelNames(opts.LabelNamesToRemove), false)
+	if err != nil {
+		return err
+	}
+	toAdd := labelsToAddFromOptions(gHelper, opts)
+	missing, err := gHelper.Msgs.MissingLabelNames(toAdd, opts.CreateMissingLabels)
+	if err != nil {
+		if _, ok := err.(*api.UnknownLabelError); ok {
+			return fmt.Errorf("%v. Use --create-labels to create it", err)
+		}
+		return err
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if DryRun {
+		prnt.HPrintf(prnt.Quietable, "Would create label(s) %v\n", missing)
+		return nil
+	}
+	created, err := gHelper.Msgs.CreateMissingLabels(missing)
+	if err != nil {
+		return err
+	}
+	prnt.HPrintf(prnt.Quietable, "Created label(s) %v\n", created)
+	return nil
+}
+
 func maybeApplyLabels(
 	msgs []*gm.Message, gHelper *GmailHelper,
 	labelsToAdd []api.Label, labelsToRemove []api.Label) {
@@ -75,6 +155,15 @@ func maybeApplyLabels(
 func maybeApplyLabelsToMsgIdIter(
 	msgs api.SizedMessageIdIterator, gHelper *GmailHelper,
 	labelsToAdd []api.Label, labelsToRemove []api.Label) {
+	maybeApplyLabelChanges(labelsToAdd, labelsToRemove, func() error {
+		return gHelper.Msgs.ApplyLabelsByIdIter(msgs, labelsToAdd, labelsToRemove)
+	})
+}
+
+// maybeApplyLabelChanges describes the label changes, and calls apply to make
+// them once confirmed (unless this is a dry run).
+func maybeApplyLabelChanges(
+	labelsToAdd []api.Label, labelsToRemove []api.Label, apply func() error) {
 
 	actionStr := ""
 	if labelsToAdd != nil && len(labelsToAdd) > 0 {
@@ -92,7 +181,7 @@ func maybeApplyLabelsToMsgIdIter(
 		fmt.Printf("Skipping application of %s (--dry provided)\n", actionStr)
 	} else {
 		if MaybeConfirmFromInput(fmt.Sprintf("Apply: %s ?", actionStr), true) {
-			err := gHelper.Msgs.ApplyLabelsByIdIter(msgs, labelsToAdd, labelsToRemove)
+			err := apply()
 			if err != nil {
 				log.Fatalf("Failed to %s: %s\n", actionStr, err)
 			} else {
@@ -102,19 +191,12 @@ func maybeApplyLabelsToMsgIdIter(
 	}
 }
 
-func modifyMsgLabels(gHelper *GmailHelper, msgs []*gm.Message, opts *MsgLabelModOptions) {
-	modifyMsgLabelsByMsgIdIter(
-		gHelper, api.SizedMessageIdIteratorFromMsgs(msgs), opts)
-}
-
-func modifyMsgLabelsByMsgIdIter(
-	gHelper *GmailHelper, msgIdIter api.SizedMessageIdIterator, opts *MsgLabelModOptions) {
-
-	var labelsToAdd []api.Label = nil
+// labelChangesFromOptions returns the labels which opts adds and removes.
+func labelChangesFromOptions(gHelper *GmailHelper, opts *MsgLabelModOptions,
+) (labelsToAdd []api.Label, labelsToRemove []api.Label) {
 	if len(opts.LabelNamesToAdd) > 0 {
 		labelsToAdd = api.LabelsFromLabelNames(opts.LabelNamesToAdd)
 	}
-	var labelsToRemove []api.Label = nil
 	if len(opts.LabelNamesToRemove) > 0 {
 		labelsToRemove = api.LabelsFromLabelNames(opts.LabelNamesToRemove)
 	}
@@ -128,8 +210,31 @@ func modifyMsgLabelsByMsgIdIter(
 	if opts.Trash {
 		labelsToAdd = append(labelsToAdd, api.TrashLabel)
 	}
+	return labelsToAdd, labelsToRemove
+}
 
+func modifyMsgLabels(gHelper *GmailHelper, msgs []*gm.Message, opts *MsgLabelModOptions) {
+	modifyMsgLabelsByMsgIdIter(
+		gHelper, api.SizedMessageIdIteratorFromMsgs(msgs), opts)
+}
+
+func modifyMsgLabelsByMsgIdIter(
+	gHelper *GmailHelper, msgIdIter api.SizedMessageIdIterator, opts *MsgLabelModOptions) {
+
+	labelsToAdd, labelsToRemove := labelChangesFromOptions(gHelper, opts)
 	if labelsToAdd != nil || labelsToRemove != nil {
 		maybeApplyLabelsToMsgIdIter(msgIdIter, gHelper, labelsToAdd, labelsToRemove)
 	}
 }
+
+// modifyThreadLabels applies opts to every message in the threads. Unlike
+// modifyMsgLabels, this uses threads.modify, so Gmail applies the labels to
+// the thread as a whole.
+func modifyThreadLabels(gHelper *GmailHelper, threadIds []string, opts *MsgLabelModOptions) {
+	labelsToAdd, labelsToRemove := labelChangesFromOptions(gHelper, opts)
+	if labelsToAdd != nil || labelsToRemove != nil {
+		maybeApplyLabelChanges(labelsToAdd, labelsToRemove, func() error {
+			return gHelper.Msgs.ModifyThreads(threadIds, labelsToAdd, labelsToRemove)
+		})
+	}
+}
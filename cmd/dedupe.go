@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/dedupe"
+	"github.com/tsiemens/gmail-tools/prnt"
+)
+
+var dedupeKeepPolicy string
+var dedupeLabel string
+var dedupeMaxMsgs int64
+
+func printDuplicateGroups(gHelper *GmailHelper, groups []*dedupe.Group) {
+	for _, g := range groups {
+		prnt.Hum.Always.F("\n%s (%d copies)\n", g.Describe(), len(g.Duplicates)+1)
+		prnt.Hum.Always.Ln("  Keep:")
+		gHelper.PrintMessage(g.Keep, 4)
+		prnt.Hum.Always.Ln("  Duplicates:")
+		for _, m := range g.Duplicates {
+			gHelper.PrintMessage(m, 4)
+		}
+	}
+	prnt.Hum.Always.Ln()
+}
+
+func runDedupeCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	conf := config.AppConfig()
+	dedupeConf := &dedupe.Config{}
+	if err := config.LoadPluginConfigInto("dedupe", dedupeConf); err != nil {
+		return err
+	}
+	keep := dedupeConf.Keep
+	if dedupeKeepPolicy != "" {
+		keep = dedupeKeepPolicy
+	}
+	policy, err := dedupe.ParsePolicy(keep)
+	if err != nil {
+		return err
+	}
+	query := ""
+	if len(args) > 0 {
+		query = args[0]
+	}
+
+	srv := api.NewGmailClientForOps(msgOps(!DryRun)...)
+	gHelper := NewGmailHelper(srv, api.DefaultUser, conf)
+	if dedupeLabel != "" {
+		_, err = gHelper.Msgs.MissingLabelNames(
+			[]api.Label{api.NewLabelWithName(dedupeLabel)}, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	groups, err := dedupe.Find(gHelper.Msgs, query, dedupeMaxMsgs, policy)
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		prnt.HPrintln(prnt.Always, "No duplicates found")
+		return nil
+	}
+	dups := dedupe.AllDuplicates(groups)
+	if !Quiet {
+		printDuplicateGroups(gHelper, groups)
+	}
+	prnt.HPrintf(prnt.Always, "Found %d duplicates in %d groups, keeping the %s\n",
+		len(dups), len(groups), policyDesc(policy))
+
+	if dedupeLabel != "" {
+		maybeApplyLabels(dups, gHelper, []api.Label{api.NewLabelWithName(dedupeLabel)}, nil)
+		return nil
+	}
+	if DryRun {
+		prnt.HPrintf(prnt.Always, "Skipping trashing of %d messages (--dry provided)\n",
+			len(dups))
+		return nil
+	}
+	if !MaybeConfirmFromInput(fmt.Sprintf("Trash %d duplicates?", len(dups)), false) {
+		return nil
+	}
+	return gHelper.Msgs.BatchModifyByIdIter(api.SizedMessageIdIteratorFromMsgs(dups),
+		&gm.BatchModifyMessagesRequest{AddLabelIds: []string{"TRASH"}})
+}
+
+func policyDesc(policy dedupe.Policy) string {
+	switch policy {
+	case dedupe.KeepMostLabels:
+		return "copy with the most labels"
+	case dedupe.KeepInbox:
+		return "copy in the inbox"
+	}
+	return "oldest copy"
+}
+
+var dedupeCmd = &cobra.Command{
+	Use:   "dedupe [QUERY]",
+	Short: "Trashes or labels duplicate copies of messages",
+	Long: `Finds messages matched by QUERY which are copies of each other, e.g. when
+received through both a list and an alias. Copies have the same Message-ID
+header or, for messages without one, the same subject and body.
+
+One message of each group is kept, chosen by --keep (or Keep in the dedupe
+section of PluginConfig in config.yaml): "oldest" (the default), "most-labels", or "inbox".
+The rest are trashed, or labelled with --label.
+
+Duplicates are also found by search --outdated, and by the 'duplicate' xfilter
+(which only uses Message-IDs).`,
+	RunE: runDedupeCmd,
+	Args: cobra.RangeArgs(0, 1),
+}
+
+func init() {
+	RootCmd.AddCommand(dedupeCmd)
+
+	dedupeCmd.Flags().StringVar(&dedupeKeepPolicy, "keep", "",
+		"Which copy to keep: oldest, most-labels or inbox")
+	dedupeCmd.Flags().StringVar(&dedupeLabel, "label", "",
+		"Apply this label to duplicates rather than trashing them")
+	dedupeCmd.Flags().Int64VarP(&dedupeMaxMsgs, "max", "m", -1,
+		"Set a max on how many messages are queried.")
+	addDryFlag(dedupeCmd)
+	addAssumeYesFlag(dedupeCmd)
+}
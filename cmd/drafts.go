@@ -0,0 +1,336 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/prnt"
+)
+
+var draftsMaxDrafts int64
+var draftsPrintIdsOnly = false
+var draftsQuery string
+var draftsThreadId string
+var draftsShowHeadersOnly = false
+var draftsShowHtml = false
+var draftsShowPartIndex int
+
+// draftBulkOps are needed to look up and print drafts, and then act on them.
+var draftBulkOps = []api.Operation{
+	api.ReadMessagesOp, api.ReadLabelsOp, api.ComposeDraftsOp}
+
+func newDraftsGmailHelper(ops ...api.Operation) *GmailHelper {
+	conf := config.AppConfig()
+	srv := api.NewGmailClientForOps(ops...)
+	return NewGmailHelper(srv, api.DefaultUser, conf)
+}
+
+func printDraft(gHelper *GmailHelper, draft *gm.Draft) {
+	prnt.Printf("%s ", draft.Id)
+	gHelper.PrintMessage(draft.Message, 0)
+}
+
+// checkDraftSelection returns an error unless exactly one of ids or query is
+// provided.
+func checkDraftSelection(ids []string, query string) error {
+	if (len(ids) == 0) == (query == "") {
+		return fmt.Errorf("Exactly one of DRAFT_IDs or --query must be provided")
+	}
+	return nil
+}
+
+// loadDrafts returns the drafts with the given IDs, or matching query, as
+// checked by checkDraftSelection.
+func loadDrafts(gHelper *GmailHelper, ids []string, query string,
+) ([]*gm.Draft, error) {
+	if query != "" {
+		return gHelper.Msgs.QueryDrafts(query, draftsMaxDrafts, api.LabelsOnly)
+	}
+	var drafts []*gm.Draft
+	for _, id := range ids {
+		draft, err := gHelper.Msgs.GetDraft(id, api.LabelsOnly)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get draft %s: %v", id, err)
+		}
+		drafts = append(drafts, draft)
+	}
+	return drafts, nil
+}
+
+// confirmDraftAction prints the drafts, and confirms that action should be
+// done to them.
+func confirmDraftAction(gHelper *GmailHelper, drafts []*gm.Draft, action string) bool {
+	for _, draft := range drafts {
+		printDraft(gHelper, draft)
+	}
+	if DryRun {
+		prnt.LPrintln(prnt.Quietable, "Skipping committing changes (--dry provided)")
+		return false
+	}
+	confirmStr := fmt.Sprintf("%s %d drafts?", action, len(drafts))
+	if len(drafts) > 1 {
+		return MaybeConfirmFromInputLong(confirmStr)
+	}
+	return MaybeConfirmFromInput(confirmStr, false)
+}
+
+// ---------- list ----------------
+
+func runDraftsListCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	gHelper := newDraftsGmailHelper(msgOps(false)...)
+
+	query := ""
+	if len(args) > 0 {
+		query = args[0]
+	}
+	detail := api.LabelsOnly
+	if draftsPrintIdsOnly {
+		detail = api.IdsOnly
+	}
+	drafts, err := gHelper.Msgs.QueryDrafts(query, draftsMaxDrafts, detail)
+	if err != nil {
+		return err
+	}
+	if len(drafts) == 0 {
+		prnt.HPrintln(prnt.Always, "No drafts found")
+		return nil
+	}
+	prnt.HPrintf(prnt.Always, "Found %d drafts\n", len(drafts))
+
+	for _, draft := range drafts {
+		if draftsPrintIdsOnly {
+			prnt.Printf("%s,%s,%s\n", draft.Id, draft.Message.Id, draft.Message.ThreadId)
+		} else {
+			printDraft(gHelper, draft)
+		}
+	}
+	return nil
+}
+
+// ---------- show ----------------
+
+func runDraftsShowCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if draftsShowHtml && draftsShowPartIndex > 0 {
+		return fmt.Errorf("--html and --part are mutually exclusive")
+	}
+	gHelper := newDraftsGmailHelper(msgOps(false)...)
+
+	draft, err := gHelper.Msgs.GetDraft(args[0], api.LabelsAndPayload)
+	if err != nil {
+		return err
+	}
+	printMessageContent(gHelper, draft.Message, draftsShowPartIndex,
+		draftsShowHeadersOnly, draftsShowHtml)
+	return nil
+}
+
+// ---------- create/update ----------------
+
+func runDraftsCreateCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	raw, err := readFileOrStdin(args[0])
+	if err != nil {
+		return err
+	}
+	gHelper := newDraftsGmailHelper(api.ComposeDraftsOp)
+
+	draft, err := gHelper.Msgs.CreateDraft([]byte(raw), draftsThreadId)
+	if err != nil {
+		return fmt.Errorf("Failed to create draft: %v", err)
+	}
+	prnt.HPrintf(prnt.Quietable, "Created draft %s\n", draft.Id)
+	return nil
+}
+
+func runDraftsUpdateCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	id := args[0]
+	raw, err := readFileOrStdin(args[1])
+	if err != nil {
+		return err
+	}
+	gHelper := newDraftsGmailHelper(api.ComposeDraftsOp)
+
+	threadId := draftsThreadId
+	if threadId == "" {
+		// Keep the draft in its current thread
+		draft, err := gHelper.Msgs.GetDraft(id, api.IdsOnly)
+		if err != nil {
+			return fmt.Errorf("Failed to get draft %s: %v", id, err)
+		}
+		threadId = draft.Message.ThreadId
+	}
+	draft, err := gHelper.Msgs.UpdateDraft(id, []byte(raw), threadId)
+	if err != nil {
+		return fmt.Errorf("Failed to update draft: %v", err)
+	}
+	prnt.HPrintf(prnt.Quietable, "Updated draft %s\n", draft.Id)
+	return nil
+}
+
+// ---------- send/delete ----------------
+
+func runDraftsSendCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if err := checkDraftSelection(args, draftsQuery); err != nil {
+		return err
+	}
+	gHelper := newDraftsGmailHelper(draftBulkOps...)
+	drafts, err := loadDrafts(gHelper, args, draftsQuery)
+	if err != nil {
+		return err
+	}
+	if len(drafts) == 0 {
+		prnt.HPrintln(prnt.Always, "No drafts found")
+		return nil
+	}
+	if !confirmDraftAction(gHelper, drafts, "Send") {
+		return nil
+	}
+
+	nFailed := 0
+	for _, draft := range drafts {
+		sent, err := gHelper.Msgs.SendDraft(draft.Id)
+		if err != nil {
+			prnt.StderrLog.Printf("Failed to send draft %s: %v\n", draft.Id, err)
+			nFailed++
+			continue
+		}
+		prnt.HPrintf(prnt.Quietable, "Sent draft %s as message %s\n", draft.Id, sent.Id)
+	}
+	if nFailed > 0 {
+		return fmt.Errorf("%d of %d drafts failed to send", nFailed, len(drafts))
+	}
+	return nil
+}
+
+func runDraftsDeleteCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if err := checkDraftSelection(args, draftsQuery); err != nil {
+		return err
+	}
+	gHelper := newDraftsGmailHelper(draftBulkOps...)
+	drafts, err := loadDrafts(gHelper, args, draftsQuery)
+	if err != nil {
+		return err
+	}
+	if len(drafts) == 0 {
+		prnt.HPrintln(prnt.Always, "No drafts found")
+		return nil
+	}
+	if !confirmDraftAction(gHelper, drafts, "Permanently delete") {
+		return nil
+	}
+
+	nFailed := 0
+	for _, draft := range drafts {
+		if err := gHelper.Msgs.DeleteDraft(draft.Id); err != nil {
+			prnt.StderrLog.Printf("Failed to delete draft %s: %v\n", draft.Id, err)
+			nFailed++
+		}
+	}
+	if nFailed > 0 {
+		return fmt.Errorf("%d of %d drafts failed to delete", nFailed, len(drafts))
+	}
+	prnt.HPrintf(prnt.Quietable, "Deleted %d drafts\n", len(drafts))
+	return nil
+}
+
+// draftsCmd represents the drafts command tree
+var draftsCmd = &cobra.Command{
+	Use:     "drafts",
+	Short:   "Draft related commands",
+	Aliases: []string{"draft", "dr"},
+}
+
+var draftsListCmd = &cobra.Command{
+	Use:   "list [QUERY]",
+	Short: "Lists drafts matching the query",
+	Long: `Lists drafts matching QUERY, which uses the same syntax as search
+(e.g. 'older_than:30d').`,
+	Aliases: []string{"ls"},
+	RunE:    runDraftsListCmd,
+	Args:    cobra.MaximumNArgs(1),
+}
+
+var draftsShowCmd = &cobra.Command{
+	Use:   "show DRAFT_ID",
+	Short: "Shows the headers and body of a draft",
+	RunE:  runDraftsShowCmd,
+	Args:  cobra.ExactArgs(1),
+}
+
+var draftsCreateCmd = &cobra.Command{
+	Use:   "create FILE",
+	Short: "Creates a draft from an RFC 2822 message file",
+	Long: `Creates a draft from an RFC 2822 (.eml) message file, or stdin if FILE is
+'-'. To compose a draft from parts instead, use 'send --draft'.`,
+	RunE: runDraftsCreateCmd,
+	Args: cobra.ExactArgs(1),
+}
+
+var draftsUpdateCmd = &cobra.Command{
+	Use:   "update DRAFT_ID FILE",
+	Short: "Replaces the content of a draft from an RFC 2822 message file",
+	RunE:  runDraftsUpdateCmd,
+	Args:  cobra.ExactArgs(2),
+}
+
+var draftsSendCmd = &cobra.Command{
+	Use:   "send [DRAFT_ID...]",
+	Short: "Sends drafts",
+	Long:  `Sends the given drafts, or all drafts matching --query.`,
+	RunE:  runDraftsSendCmd,
+}
+
+var draftsDeleteCmd = &cobra.Command{
+	Use:   "delete [DRAFT_ID...]",
+	Short: "Permanently deletes drafts",
+	Long: `Permanently deletes the given drafts, or all drafts matching --query.
+For example, to clean up stale drafts:
+  drafts delete --query 'older_than:90d'`,
+	Aliases: []string{"rm"},
+	RunE:    runDraftsDeleteCmd,
+}
+
+func init() {
+	RootCmd.AddCommand(draftsCmd)
+	draftsCmd.AddCommand(draftsListCmd)
+	draftsCmd.AddCommand(draftsShowCmd)
+	draftsCmd.AddCommand(draftsCreateCmd)
+	draftsCmd.AddCommand(draftsUpdateCmd)
+	draftsCmd.AddCommand(draftsSendCmd)
+	draftsCmd.AddCommand(draftsDeleteCmd)
+
+	for _, c := range []*cobra.Command{draftsListCmd, draftsSendCmd, draftsDeleteCmd} {
+		c.Flags().Int64VarP(&draftsMaxDrafts, "max", "m", -1,
+			"Set a max on how many results are queried.")
+	}
+	draftsListCmd.Flags().BoolVar(&draftsPrintIdsOnly, "ids-only", false,
+		"Only prints out draftId,messageId,threadId")
+
+	draftsShowCmd.Flags().BoolVarP(&draftsShowHeadersOnly, "headers-only", "H", false,
+		"Don't print the message body")
+	draftsShowCmd.Flags().BoolVar(&draftsShowHtml, "html", false,
+		"Print the HTML body rather than the plain text")
+	draftsShowCmd.Flags().IntVar(&draftsShowPartIndex, "part", 0,
+		"Print only the decoded content of part N")
+
+	for _, c := range []*cobra.Command{draftsCreateCmd, draftsUpdateCmd} {
+		c.Flags().StringVar(&draftsThreadId, "thread", "",
+			"Place the draft in this thread")
+	}
+
+	for _, c := range []*cobra.Command{draftsSendCmd, draftsDeleteCmd} {
+		c.Flags().StringVar(&draftsQuery, "query", "",
+			"Act on all drafts matching this query, rather than by ID")
+		addDryFlag(c)
+		addAssumeYesFlag(c)
+	}
+}
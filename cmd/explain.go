@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"encoding/json"
+	"sync"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/plugin"
+	"github.com/tsiemens/gmail-tools/prnt"
+)
+
+// InterestVerdictJson is the interest which a plugin gave a message.
+type InterestVerdictJson struct {
+	Plugin   string `json:"plugin"`
+	Interest string `json:"interest"`
+	Reason   string `json:"reason,omitempty"`
+	// True for the verdict which determined the combined interest
+	Decisive bool `json:"decisive"`
+}
+
+// InterestExplanationJson is how a message's interest was determined, as
+// printed by --explain.
+type InterestExplanationJson struct {
+	MessageId string                 `json:"messageId"`
+	Subject   string                 `json:"subject"`
+	Verdicts  []*InterestVerdictJson `json:"verdicts"`
+	// The combined interest level
+	Interest string `json:"interest"`
+	Category string `json:"category"`
+
+	msg *gm.Message
+}
+
+// ExplainMsgInterest returns each plugin's verdict on m's interest, and the
+// result of combining them.
+func (h *GmailHelper) ExplainMsgInterest(m *gm.Message) *InterestExplanationJson {
+	verdicts := h.MsgInterestVerdicts(m)
+	level, decider := plugin.CombineVerdicts(verdicts)
+
+	expl := &InterestExplanationJson{
+		MessageId: m.Id,
+		Verdicts:  make([]*InterestVerdictJson, 0, len(verdicts)),
+		Interest:  level.String(),
+		Category:  interestCategory(level).String(),
+		msg:       m,
+	}
+	if headers, err := api.GetMsgHeaders(m); err == nil {
+		expl.Subject = headers.Subject
+	}
+	for i, v := range verdicts {
+		expl.Verdicts = append(expl.Verdicts, &InterestVerdictJson{
+			Plugin:   v.Plugin,
+			Interest: v.Level.String(),
+			Reason:   v.Reason,
+			Decisive: i == decider,
+		})
+	}
+	return expl
+}
+
+// ExplainMessagesInterest is ExplainMsgInterest for each of msgs, which should
+// be loaded with RequiredDetailForPluginInterest.
+func (h *GmailHelper) ExplainMessagesInterest(msgs []*gm.Message,
+) []*InterestExplanationJson {
+	expls := make([]*InterestExplanationJson, len(msgs))
+	querySem := make(chan bool, api.MaxConcurrentRequests)
+	var wg sync.WaitGroup
+	for i := range msgs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			querySem <- true
+			defer func() { <-querySem }()
+			expls[i] = h.ExplainMsgInterest(msgs[i])
+		}(i)
+	}
+	wg.Wait()
+	return expls
+}
+
+// PrintInterestExplanations prints expls as a table for each message, or as
+// json.
+func (h *GmailHelper) PrintInterestExplanations(
+	expls []*InterestExplanationJson, asJson bool) {
+
+	if asJson {
+		bytes, err := json.MarshalIndent(expls, "", "  ")
+		if err != nil {
+			prnt.StderrLog.Printf("Failed to marshal explanations: %v", err)
+			return
+		}
+		prnt.Printf("%s\n", string(bytes))
+		return
+	}
+
+	for i, expl := range expls {
+		if i > 0 {
+			prnt.Hum.Always.Ln()
+		}
+		prnt.Hum.Always.F("Message %s\n", expl.MessageId)
+		h.PrintMessage(expl.msg, 0)
+		if len(expl.Verdicts) == 0 {
+			prnt.Hum.Always.Ln("  No plugins categorize interest")
+		} else {
+			prnt.Hum.Always.F("  %-20s %-23s %s\n", "PLUGIN", "INTEREST", "REASON")
+			for _, v := range expl.Verdicts {
+				marker := " "
+				if v.Decisive {
+					marker = "*"
+				}
+				prnt.Hum.Always.F("%s %-20s %-23s %s\n", marker, v.Plugin, v.Interest, v.Reason)
+			}
+		}
+		prnt.Hum.Always.F("  => %s (%s)\n", expl.Interest, expl.Category)
+	}
+}
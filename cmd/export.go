@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/export"
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+var exportFormatStr string
+var exportOut string
+var exportMsgIds []string
+var exportMaxMsgs int64
+var exportNoResume = false
+
+type exportResult struct {
+	msg *export.Message
+	err error
+}
+
+func fetchExportMessage(gHelper *GmailHelper, id string) (*export.Message, error) {
+	msg, raw, err := gHelper.Msgs.GetRawMessage(id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get message %s: %v", id, err)
+	}
+	return &export.Message{
+		Id:           msg.Id,
+		Raw:          raw,
+		Labels:       gHelper.Msgs.MessageLabelNames(msg),
+		InternalDate: msg.InternalDate,
+		Unread:       util.StringSliceContains("UNREAD", msg.LabelIds),
+		Starred:      util.StringSliceContains("STARRED", msg.LabelIds),
+	}, nil
+}
+
+// exportMessages fetches the messages concurrently, and writes them in the
+// order they arrive. Each message is recorded in state once written.
+func exportMessages(gHelper *GmailHelper, ids []string, writer export.Writer,
+	state *export.State) error {
+
+	querySem := make(chan bool, api.MaxConcurrentRequests)
+	resultChan := make(chan exportResult)
+
+	for _, id_ := range ids {
+		go func(id string) {
+			querySem <- true
+			defer func() { <-querySem }()
+			msg, err := fetchExportMessage(gHelper, id)
+			resultChan <- exportResult{msg, err}
+		}(id_)
+	}
+
+	prnt.Hum.Always.P("Exporting messages ")
+	var errs []error
+	progP := prnt.NewProgressPrinter(len(ids))
+	for i := 0; i < len(ids); i++ {
+		res := <-resultChan
+		progP.Progress(1)
+		if res.err != nil {
+			errs = append(errs, res.err)
+			continue
+		}
+		if err := writer.Write(res.msg); err != nil {
+			errs = append(errs, fmt.Errorf("Failed to write message %s: %v",
+				res.msg.Id, err))
+			continue
+		}
+		if err := state.MarkExported(res.msg.Id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	prnt.Hum.Always.P("\n")
+
+	for _, err := range errs {
+		prnt.StderrLog.Println(err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d messages failed to export. "+
+			"Re-run the same command to retry them.", len(errs), len(ids))
+	}
+	return nil
+}
+
+func runExportCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if (len(args) == 0) == (len(exportMsgIds) == 0) {
+		return fmt.Errorf("Exactly one of QUERY or --id must be provided")
+	}
+	format, err := export.ParseFormat(exportFormatStr)
+	if err != nil {
+		return err
+	}
+	if exportOut == "" {
+		return fmt.Errorf("--out is required")
+	}
+
+	conf := config.AppConfig()
+	srv := api.NewGmailClientForOps(msgOps(false)...)
+	gHelper := NewGmailHelper(srv, api.DefaultUser, conf)
+
+	ids := exportMsgIds
+	if len(args) > 0 {
+		var msgs []*gm.Message
+		msgs, err = gHelper.Msgs.QueryMessages(
+			args[0], false, false, exportMaxMsgs, api.IdsOnly)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			ids = append(ids, msg.Id)
+		}
+	}
+
+	stateFile := export.StateFileFor(format, exportOut)
+	if exportNoResume {
+		util.CheckErr(util.RemoveIfExists(stateFile))
+	}
+	state, err := export.LoadState(stateFile)
+	if err != nil {
+		return fmt.Errorf("Failed to load export state %s: %v", stateFile, err)
+	}
+	defer state.Close()
+
+	var toExport []string
+	for _, id := range ids {
+		if !state.IsExported(id) {
+			toExport = append(toExport, id)
+		}
+	}
+	if skipped := len(ids) - len(toExport); skipped > 0 {
+		prnt.HPrintf(prnt.Quietable,
+			"Skipping %d messages already exported to %s\n", skipped, exportOut)
+	}
+	if len(toExport) == 0 {
+		prnt.HPrintln(prnt.Quietable, "Nothing to export")
+		return nil
+	}
+
+	writer, err := export.NewWriter(format, exportOut, exportNoResume)
+	if err != nil {
+		return err
+	}
+	err = exportMessages(gHelper, toExport, writer, state)
+	if cErr := writer.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	prnt.HPrintf(prnt.Quietable, "Exported %d messages to %s\n", len(toExport), exportOut)
+	return nil
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export [QUERY]",
+	Short: "Exports messages as EML files, an mbox file or a Maildir tree",
+	Long: `Exports the full content of messages matching QUERY (or given with --id).
+
+Message labels are preserved in an X-Gmail-Labels header. In Maildir format, a
+copy of each message is also placed in a folder for each of its labels.
+
+Exports are resumable. Messages already written to the destination are recorded,
+and are skipped if the command is run again (unless --restart is given).`,
+	RunE: runExportCmd,
+	Args: cobra.MaximumNArgs(1),
+}
+
+func init() {
+	RootCmd.AddCommand(exportCmd)
+
+	formatStrs := make([]string, 0, len(export.Formats))
+	for _, f := range export.Formats {
+		formatStrs = append(formatStrs, string(f))
+	}
+
+	exportCmd.Flags().StringVar(&exportFormatStr, "format", string(export.EmlFormat),
+		"Export format. One of: "+strings.Join(formatStrs, ", "))
+	exportCmd.Flags().StringVarP(&exportOut, "out", "o", "",
+		"Output directory (or file, for mbox)")
+	exportCmd.Flags().StringArrayVar(&exportMsgIds, "id", []string{},
+		"Export this message ID (may be provided multiple times)")
+	exportCmd.Flags().Int64VarP(&exportMaxMsgs, "max", "m", -1,
+		"Set a max on how many results are queried.")
+	exportCmd.Flags().BoolVar(&exportNoResume, "restart", false,
+		"Forget previously exported messages, and export everything again "+
+			"(replacing an existing mbox file)")
+}
@@ -14,6 +14,9 @@ import (
 	"github.com/tsiemens/gmail-tools/prnt"
 )
 
+var filterModifyOps = []api.Operation{
+	api.ReadLabelsOp, api.ReadSettingsOp, api.ModifySettingsOp}
+
 func copyFilterAndCriteria(filter *gm.Filter) *gm.Filter {
 	// Make a copy of the filter, and important pointers
 	updatedFilter := &gm.Filter{}
@@ -40,20 +43,26 @@ func maybeDoFilterChanges(gHelper *GmailHelper, updatedFilters []*gm.Filter) {
 			commit = MaybeConfirmFromInput(confirmStr, false)
 		}
 		if commit {
-			for _, fltr := range updatedFilters {
-				id := fltr.Id
-				createdFltr, err := gHelper.CreateFilter(fltr)
-				if err != nil {
-					prnt.StderrLog.Fatalln("Failed to create filter:", err)
-				}
-				prnt.Printf("Created filter %s\n", createdFltr.Id)
-				err = gHelper.DeleteFilter(id)
-				if err != nil {
-					prnt.StderrLog.Fatalf("Failed to delete filter %s: %v\n", id, err)
-				}
-				prnt.Printf("Deleted filter %s\n", id)
-			}
+			replaceFilters(gHelper, updatedFilters)
+		}
+	}
+}
+
+// replaceFilters replaces each filter (by its Id) with its updated version.
+// Filters cannot be edited, so this creates a new filter and deletes the old.
+func replaceFilters(gHelper *GmailHelper, updatedFilters []*gm.Filter) {
+	for _, fltr := range updatedFilters {
+		id := fltr.Id
+		createdFltr, err := gHelper.CreateFilter(fltr)
+		if err != nil {
+			prnt.StderrLog.Fatalln("Failed to create filter:", err)
+		}
+		prnt.Printf("Created filter %s\n", createdFltr.Id)
+		err = gHelper.DeleteFilter(id)
+		if err != nil {
+			prnt.StderrLog.Fatalf("Failed to delete filter %s: %v\n", id, err)
 		}
+		prnt.Printf("Deleted filter %s\n", id)
 	}
 }
 
@@ -82,7 +91,7 @@ func runReplaceFilterCmd(cmd *cobra.Command, args []string) {
 	replStr := args[1]
 
 	conf := config.AppConfig()
-	srv := api.NewGmailClient(api.FiltersScope)
+	srv := api.NewGmailClientForOps(filterModifyOps...)
 	gHelper := NewGmailHelper(srv, api.DefaultUser, conf)
 	filters, err := gHelper.GetFilters()
 	if err != nil {
@@ -126,7 +135,7 @@ func runReplaceFilterCmd(cmd *cobra.Command, args []string) {
 
 func runUpdateFilterCmd(cmd *cobra.Command, args []string) {
 	conf := config.AppConfig()
-	srv := api.NewGmailClient(api.FiltersScope)
+	srv := api.NewGmailClientForOps(filterModifyOps...)
 	gHelper := NewGmailHelper(srv, api.DefaultUser, conf)
 	filters, err := gHelper.GetFilters()
 	if err != nil {
@@ -186,7 +195,7 @@ func runListFilterCmd(cmd *cobra.Command, args []string) {
 	}
 
 	conf := config.AppConfig()
-	srv := api.NewGmailClient(api.ModifyScope)
+	srv := api.NewGmailClientForOps(api.ReadLabelsOp, api.ReadSettingsOp)
 	gHelper := NewGmailHelper(srv, api.DefaultUser, conf)
 	filters, err := gHelper.GetFilters()
 	if err != nil {
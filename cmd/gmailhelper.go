@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	gm "google.golang.org/api/gmail/v1"
 
@@ -60,9 +61,21 @@ type MessageJson struct {
 	Timestamp int64    `json:"timestamp"`
 	Subject   string   `json:"subject"`
 	From      string   `json:"from"`
+	To        []string `json:"to,omitempty"`
+	Cc        []string `json:"cc,omitempty"`
+	Date      string   `json:"date,omitempty"`
+	ListId    string   `json:"listId,omitempty"`
 	Labels    []string `json:"labels"`
 }
 
+func emailAddressStrings(emails []api.EmailAddress) []string {
+	strs := make([]string, 0, len(emails))
+	for _, email := range emails {
+		strs = append(strs, email.String())
+	}
+	return strs
+}
+
 func (h *GmailHelper) GetMessageJson(m *gm.Message) *MessageJson {
 	msgJson := &MessageJson{}
 
@@ -70,15 +83,15 @@ func (h *GmailHelper) GetMessageJson(m *gm.Message) *MessageJson {
 	msgJson.ThreadId = m.ThreadId
 	msgJson.Timestamp = m.InternalDate
 
-	if m.Payload != nil && m.Payload.Headers != nil {
-		for _, hdr := range m.Payload.Headers {
-			if hdr.Name == "Subject" {
-				msgJson.Subject = hdr.Value
-			}
-			if hdr.Name == "From" {
-				msgJson.From = hdr.Value
-			}
+	if headers, err := api.GetMsgHeaders(m); err == nil {
+		msgJson.Subject = headers.Subject
+		msgJson.From = headers.From.String()
+		msgJson.To = emailAddressStrings(headers.To)
+		msgJson.Cc = emailAddressStrings(headers.Cc)
+		if !headers.Date.IsZero() {
+			msgJson.Date = headers.Date.Format(time.RFC3339)
 		}
+		msgJson.ListId = headers.ListId
 	}
 
 	labelNames := h.Msgs.MessageLabelNames(m)
@@ -101,6 +114,36 @@ func (h *GmailHelper) PrintMessagesJson(msgs []*gm.Message) {
 	fmt.Printf("%s", string(bytes))
 }
 
+// labelsToShow filters out labels which are not worth printing, and colors
+// the rest.
+func (h *GmailHelper) labelsToShow(labels []string, addThreadMarker bool) []string {
+	var labelsToShow []string
+	for _, l := range labels {
+		if !util.DebugMode &&
+			(strings.HasPrefix(l, "CATEGORY_") ||
+				l == "INBOX") {
+			continue
+		}
+
+		preColor := ""
+		if color, ok := h.conf.LabelColors[l]; ok {
+			colorCode, ok := util.Colors[color]
+			if ok {
+				preColor = colorCode + util.Bold
+			} else {
+				prnt.StderrLog.Fatalf("'%s' is not a valid color\n", color)
+			}
+		}
+
+		if addThreadMarker {
+			l = "(+ " + l + ")"
+		}
+
+		labelsToShow = append(labelsToShow, preColor+l+util.ResetC)
+	}
+	return labelsToShow
+}
+
 func (h *GmailHelper) PrintMessage(m *gm.Message, indent int) {
 	var subject string
 	var from string
@@ -138,45 +181,80 @@ func (h *GmailHelper) PrintMessage(m *gm.Message, indent int) {
 		}
 	}
 
-	// Filter out some labels here
-	var labelsToShow []string
-	addLabelsToShow := func(labels []string, addThreadMarker bool) {
-		for _, l := range labels {
-			if !util.DebugMode &&
-				(strings.HasPrefix(l, "CATEGORY_") ||
-					l == "INBOX") {
-				continue
-			}
+	labelsToShow := h.labelsToShow(labelNames, false)
+	labelsToShow = append(labelsToShow, h.labelsToShow(otherThreadLabels, true)...)
 
-			preColor := ""
-			if color, ok := h.conf.LabelColors[l]; ok {
-				colorCode, ok := util.Colors[color]
-				if ok {
-					preColor = colorCode + util.Bold
-				} else {
-					prnt.StderrLog.Fatalf("'%s' is not a valid color\n", color)
-				}
-			}
+	maybeId := ""
+	if util.DebugMode {
+		maybeId = m.Id + " "
+	}
 
-			if addThreadMarker {
-				l = "(+ " + l + ")"
-			}
+	indentStr := strings.Repeat(" ", indent)
 
-			labelsToShow = append(labelsToShow, preColor+l+util.ResetC)
+	fmt.Printf("%s%s- %s [%s] %s\n", indentStr, maybeId, from, strings.Join(labelsToShow, ", "), subject)
+}
+
+// PrintThread prints a one line summary of a thread: its participants,
+// message count, labels, subject and latest date.
+func (h *GmailHelper) PrintThread(t *api.ThreadSummary) {
+	var participants []string
+	for _, p := range t.Participants {
+		if p.Name != "" {
+			participants = append(participants, p.Name)
+		} else {
+			participants = append(participants, p.Address)
 		}
 	}
-
-	addLabelsToShow(labelNames, false)
-	addLabelsToShow(otherThreadLabels, true)
+	from := strings.Join(participants, ", ")
+	if from == "" {
+		from = "<unknown sender>"
+	}
+	subject := t.Subject
+	if subject == "" {
+		subject = "<No subject>"
+	}
 
 	maybeId := ""
 	if util.DebugMode {
-		maybeId = m.Id + " "
+		maybeId = t.Id + " "
 	}
 
-	indentStr := strings.Repeat(" ", indent)
+	labelsToShow := h.labelsToShow(h.Msgs.LabelNames(t.LabelIds), false)
+	fmt.Printf("%s- %s (%d) [%s] %s  %s\n", maybeId, from, t.MessageCount,
+		strings.Join(labelsToShow, ", "), subject, t.LatestDate.Format("2006-01-02 15:04"))
+}
 
-	fmt.Printf("%s%s- %s [%s] %s\n", indentStr, maybeId, from, strings.Join(labelsToShow, ", "), subject)
+type ThreadJson struct {
+	ThreadId     string   `json:"threadId"`
+	Subject      string   `json:"subject"`
+	MessageCount int      `json:"messageCount"`
+	Participants []string `json:"participants"`
+	LatestDate   string   `json:"latestDate,omitempty"`
+	Labels       []string `json:"labels"`
+}
+
+func (h *GmailHelper) PrintThreadsJson(threads []*api.ThreadSummary) {
+	var threadsJson []*ThreadJson
+	for _, t := range threads {
+		tJson := &ThreadJson{
+			ThreadId:     t.Id,
+			Subject:      t.Subject,
+			MessageCount: t.MessageCount,
+			Participants: emailAddressStrings(t.Participants),
+			Labels:       h.Msgs.LabelNames(t.LabelIds),
+		}
+		if !t.LatestDate.IsZero() {
+			tJson.LatestDate = t.LatestDate.Format(time.RFC3339)
+		}
+		threadsJson = append(threadsJson, tJson)
+	}
+
+	bytes, err := json.MarshalIndent(threadsJson, "", "  ")
+	if err != nil {
+		prnt.StderrLog.Printf("Failed to martial threads: %v", err)
+		return
+	}
+	fmt.Printf("%s", string(bytes))
 }
 
 func (h *GmailHelper) PrintMessagesByCategory(msgs []*gm.Message) {
@@ -393,7 +471,7 @@ func (h *GmailHelper) FindOutdatedMessages(baseQuery string, maxMsgs int64) []*g
 	for _, plug := range h.GetPlugins() {
 		if plug.OutdatedMessages != nil {
 			prnt.Deb.Ln("Getting outdated messages from", plug.Name, "plugin.")
-			pluginOutdated := plug.OutdatedMessages(baseQuery, h.Msgs, maxMsgs)
+			pluginOutdated := plug.OutdatedMessages(plug.Ctx, baseQuery, maxMsgs)
 			for _, m := range pluginOutdated {
 				outdatedMsgsSet[m.Id] = true
 			}
@@ -418,16 +496,47 @@ func (h *GmailHelper) GetPlugins() []*plugin.Plugin {
 	defer h.mutex.Unlock()
 
 	if h.plugins == nil {
-		h.plugins = plugin.LoadPlugins()
+		loaded := plugin.LoadPlugins(&h.conf.Plugins, NewPluginEnv(h.Msgs))
+		for _, lp := range loaded {
+			if lp.Err != nil {
+				prnt.StderrLog.Printf("Error loading plugin %s: %s\n", lp.Id, lp.Err)
+			}
+		}
+		h.plugins = plugin.EnabledPlugins(loaded)
 	}
 	return h.plugins
 }
 
-func (h *GmailHelper) MsgPlugInterest(m *gm.Message) plugin.InterestLevel {
-	interest := plugin.UnknownInterest
+// NewPluginEnv returns the Env for plugins' Contexts. msgs may be nil if
+// plugins will not be used with Gmail. The Contexts are cancelled when
+// gmailcli is interrupted, or the command finishes.
+func NewPluginEnv(msgs *api.MsgHelper) *plugin.Env {
+	return &plugin.Env{
+		Msgs:       msgs,
+		Ctx:        rootCtx,
+		LoadConfig: config.LoadPluginConfigInto,
+		LoadGlobalConfig: func(out interface{}) error {
+			config.LoadConfigInto(out)
+			return nil
+		},
+		StoreDir: plugin.StoreDir(),
+	}
+}
+
+// MsgInterestVerdicts returns the interest which each plugin gives m.
+func (h *GmailHelper) MsgInterestVerdicts(m *gm.Message) []plugin.Verdict {
+	var verdicts []plugin.Verdict
 	for _, plug := range h.GetPlugins() {
-		interest = interest.Combine(plug.MessageInterest(m, h.Msgs))
+		if plug.MessageInterest != nil {
+			verdicts = append(verdicts,
+				plugin.Verdict{Plugin: plug.Name, Interest: plug.MessageInterest(plug.Ctx, m)})
+		}
 	}
+	return verdicts
+}
+
+func (h *GmailHelper) MsgPlugInterest(m *gm.Message) plugin.InterestLevel {
+	interest, _ := plugin.CombineVerdicts(h.MsgInterestVerdicts(m))
 	return interest
 }
 
@@ -439,18 +548,17 @@ const (
 	Interesting
 )
 
-func (h *GmailHelper) RequiredDetailForPluginInterest() api.MessageDetailLevel {
-	detail := api.LabelsOnly
-	for _, plug := range h.GetPlugins() {
-		detail = api.MoreDetailedLevel(
-			detail,
-			plug.DetailRequiredForInterest())
+func (c InterestCategory) String() string {
+	switch c {
+	case Uninteresting:
+		return "uninteresting"
+	case Interesting:
+		return "interesting"
 	}
-	return detail
+	return "maybe-interesting"
 }
 
-func (h *GmailHelper) MsgInterest(m *gm.Message) InterestCategory {
-	i := h.MsgPlugInterest(m)
+func interestCategory(i plugin.InterestLevel) InterestCategory {
 	if i == plugin.StronglyInteresting || i == plugin.WeaklyInteresting {
 		return Interesting
 	} else if i == plugin.StronglyUninteresting || i == plugin.WeaklyUninteresting {
@@ -459,6 +567,22 @@ func (h *GmailHelper) MsgInterest(m *gm.Message) InterestCategory {
 	return MaybeInteresting
 }
 
+func (h *GmailHelper) RequiredDetailForPluginInterest() api.MessageDetailLevel {
+	detail := api.LabelsOnly
+	for _, plug := range h.GetPlugins() {
+		if plug.DetailRequiredForInterest != nil {
+			detail = api.MoreDetailedLevel(
+				detail,
+				plug.DetailRequiredForInterest())
+		}
+	}
+	return detail
+}
+
+func (h *GmailHelper) MsgInterest(m *gm.Message) InterestCategory {
+	return interestCategory(h.MsgPlugInterest(m))
+}
+
 // ---------- Filter methods ----------------
 
 // Initialized in init()
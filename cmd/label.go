@@ -0,0 +1,490 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+var labelListAll = false
+var labelDeleteChildren = false
+var labelColorClear = false
+
+var labelModifyOps = []api.Operation{api.ReadLabelsOp, api.ModifyLabelsOp}
+
+func newLabelGmailHelper(ops ...api.Operation) *GmailHelper {
+	conf := config.AppConfig()
+	srv := api.NewGmailClientForOps(ops...)
+	return NewGmailHelper(srv, api.DefaultUser, conf)
+}
+
+// labelAndChildren returns the label named name and all labels nested under
+// it, parents first.
+func labelAndChildren(labels []*gm.Label, name string) []*gm.Label {
+	var matched []*gm.Label
+	for _, l := range labels {
+		if api.IsLabelOrChild(l.Name, name) {
+			matched = append(matched, l)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Name < matched[j].Name })
+	return matched
+}
+
+func findLabel(labels []*gm.Label, name string) (*gm.Label, error) {
+	for _, l := range labels {
+		if l.Name == name {
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("No label named %s found", name)
+}
+
+// ---------- list ----------------
+
+func loadLabelCounts(gHelper *GmailHelper, labels []*gm.Label) ([]*gm.Label, error) {
+	querySem := make(chan bool, api.MaxConcurrentRequests)
+	labelChan := make(chan *gm.Label)
+	errChan := make(chan error)
+
+	for _, l_ := range labels {
+		go func(l *gm.Label) {
+			querySem <- true
+			defer func() { <-querySem }()
+			detailed, err := gHelper.Msgs.GetLabel(l.Id)
+			if err != nil {
+				errChan <- fmt.Errorf("Failed to get label %s: %v", l.Name, err)
+			} else {
+				labelChan <- detailed
+			}
+		}(l_)
+	}
+
+	var detailedLabels []*gm.Label
+	var errs []error
+	for i := 0; i < len(labels); i++ {
+		select {
+		case l := <-labelChan:
+			detailedLabels = append(detailedLabels, l)
+		case err := <-errChan:
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return detailedLabels, nil
+}
+
+func runLabelListCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	gHelper := newLabelGmailHelper(api.ReadLabelsOp)
+
+	labels, err := gHelper.Msgs.ListLabels()
+	if err != nil {
+		return err
+	}
+	var toShow []*gm.Label
+	for _, l := range labels {
+		if labelListAll || !api.IsSystemLabel(l) {
+			toShow = append(toShow, l)
+		}
+	}
+	toShow, err = loadLabelCounts(gHelper, toShow)
+	if err != nil {
+		return err
+	}
+	sort.Slice(toShow, func(i, j int) bool { return toShow[i].Name < toShow[j].Name })
+
+	prnt.Hum.Always.F("%-40s %10s %8s %10s  %s\n", "LABEL", "MESSAGES", "UNREAD", "THREADS", "COLOR")
+	for _, l := range toShow {
+		color := ""
+		if l.Color != nil {
+			color = l.Color.BackgroundColor + "/" + l.Color.TextColor
+		}
+		prnt.Printf("%-40s %10d %8d %10d  %s\n",
+			l.Name, l.MessagesTotal, l.MessagesUnread, l.ThreadsTotal, color)
+	}
+	return nil
+}
+
+// ---------- create ----------------
+
+func runLabelCreateCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	gHelper := newLabelGmailHelper(labelModifyOps...)
+
+	for _, name := range args {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("Invalid label name '%s'", name)
+		}
+		if _, ok := gHelper.Msgs.LabelIdByName(name); ok {
+			prnt.HPrintf(prnt.Quietable, "Label %s already exists\n", name)
+			continue
+		}
+		if DryRun {
+			prnt.HPrintf(prnt.Quietable, "Would create label %s\n", name)
+			continue
+		}
+		label, err := gHelper.Msgs.CreateLabel(name)
+		if err != nil {
+			return fmt.Errorf("Failed to create label %s: %v", name, err)
+		}
+		prnt.HPrintf(prnt.Quietable, "Created label %s\n", label.Name)
+	}
+	return nil
+}
+
+// ---------- rename ----------------
+
+// filtersWithRenamedLabels returns updated copies of the filters whose
+// queries reference renamed labels.
+func filtersWithRenamedLabels(filters []*gm.Filter, renames map[string]string,
+) (oldFilters []*gm.Filter, newFilters []*gm.Filter) {
+	for _, fltr := range filters {
+		if fltr.Criteria == nil {
+			continue
+		}
+		query := api.RenameLabelsInQuery(fltr.Criteria.Query, renames)
+		negQuery := api.RenameLabelsInQuery(fltr.Criteria.NegatedQuery, renames)
+		if query == fltr.Criteria.Query && negQuery == fltr.Criteria.NegatedQuery {
+			continue
+		}
+		updated := copyFilterAndCriteria(fltr)
+		updated.Criteria.Query = query
+		updated.Criteria.NegatedQuery = negQuery
+		oldFilters = append(oldFilters, fltr)
+		newFilters = append(newFilters, updated)
+	}
+	return oldFilters, newFilters
+}
+
+func runLabelRenameCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	oldName, newName := args[0], args[1]
+	if strings.TrimSpace(newName) == "" {
+		return fmt.Errorf("Invalid label name '%s'", newName)
+	}
+	if api.IsLabelOrChild(newName, oldName) {
+		return fmt.Errorf("A label cannot be moved under itself")
+	}
+
+	conf := config.AppConfig()
+	gHelper := newLabelGmailHelper(labelModifyOps...)
+	labels, err := gHelper.Msgs.ListLabels()
+	if err != nil {
+		return err
+	}
+	if _, err = findLabel(labels, oldName); err != nil {
+		return err
+	}
+
+	// Plan all renames, including children
+	toRename := labelAndChildren(labels, oldName)
+	renames := make(map[string]string)
+	for _, l := range toRename {
+		renamed := api.RenamedLabel(l.Name, oldName, newName)
+		if _, exists := gHelper.Msgs.LabelIdByName(renamed); exists {
+			return fmt.Errorf("Cannot rename %s: label %s already exists", l.Name, renamed)
+		}
+		renames[l.Name] = renamed
+	}
+
+	prnt.LPrintln(prnt.Quietable, prnt.Colorize("Labels to rename:", "bold"))
+	for _, l := range toRename {
+		prnt.LPrintf(prnt.Quietable, "  %s -> %s\n", l.Name, renames[l.Name])
+	}
+
+	renameQuery := func(q string) string { return api.RenameLabelsInQuery(q, renames) }
+	configChanges, err := config.RenameLabelInConfigFile(
+		conf.ConfigFile, oldName, newName, renameQuery, true)
+	if err != nil {
+		return err
+	}
+	if len(configChanges) > 0 {
+		prnt.LPrintf(prnt.Quietable, "%s\n",
+			prnt.Colorize("Changes to "+conf.ConfigFile+":", "bold"))
+		for _, change := range configChanges {
+			prnt.LPrintf(prnt.Quietable, "  %s\n", change)
+		}
+	}
+
+	// Filters need a separate scope from labels
+	fltrHelper := newLabelGmailHelper(filterModifyOps...)
+	filters, err := fltrHelper.GetFilters()
+	if err != nil {
+		return fmt.Errorf("Error getting filters: %v", err)
+	}
+	oldFilters, newFilters := filtersWithRenamedLabels(filters, renames)
+	if len(newFilters) > 0 {
+		prnt.LPrintln(prnt.Quietable, prnt.Colorize("Filters to update:", "bold"))
+		for i := range newFilters {
+			fltrHelper.PrintFilterDiff(oldFilters[i], newFilters[i])
+			prnt.LPrintln(prnt.Quietable, "")
+		}
+	}
+
+	if DryRun {
+		prnt.LPrintln(prnt.Quietable, "Skipping committing changes (--dry provided)")
+		return nil
+	}
+	if !MaybeConfirmFromInput("Make these changes?", false) {
+		return nil
+	}
+
+	// Make sure the new location exists, so the label stays nested
+	for _, parent := range api.LabelParentNames(newName) {
+		if _, ok := gHelper.Msgs.LabelIdByName(parent); !ok {
+			if _, err = gHelper.Msgs.CreateLabel(parent); err != nil {
+				return fmt.Errorf("Failed to create label %s: %v", parent, err)
+			}
+			prnt.HPrintf(prnt.Quietable, "Created label %s\n", parent)
+		}
+	}
+	for _, l := range toRename {
+		_, err = gHelper.Msgs.PatchLabel(l.Id, &gm.Label{Name: renames[l.Name]})
+		if err != nil {
+			return fmt.Errorf("Failed to rename label %s: %v", l.Name, err)
+		}
+		prnt.HPrintf(prnt.Quietable, "Renamed %s to %s\n", l.Name, renames[l.Name])
+	}
+
+	if len(configChanges) > 0 {
+		_, err = config.RenameLabelInConfigFile(
+			conf.ConfigFile, oldName, newName, renameQuery, false)
+		if err != nil {
+			return fmt.Errorf("Failed to update %s: %v", conf.ConfigFile, err)
+		}
+		prnt.HPrintf(prnt.Quietable, "Updated %s\n", conf.ConfigFile)
+	}
+	replaceFilters(fltrHelper, newFilters)
+	return nil
+}
+
+// ---------- delete ----------------
+
+// filtersReferencingLabel returns filters which apply or remove the label, or
+// search for it.
+func filtersReferencingLabel(filters []*gm.Filter, label *gm.Label) []*gm.Filter {
+	var matched []*gm.Filter
+	for _, fltr := range filters {
+		refs := false
+		if fltr.Action != nil {
+			refs = util.StringSliceContains(label.Id, fltr.Action.AddLabelIds) ||
+				util.StringSliceContains(label.Id, fltr.Action.RemoveLabelIds)
+		}
+		if fltr.Criteria != nil {
+			refs = refs ||
+				api.QueryReferencesLabel(fltr.Criteria.Query, label.Name) ||
+				api.QueryReferencesLabel(fltr.Criteria.NegatedQuery, label.Name)
+		}
+		if refs {
+			matched = append(matched, fltr)
+		}
+	}
+	return matched
+}
+
+func runLabelDeleteCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	name := args[0]
+	gHelper := newLabelGmailHelper(labelModifyOps...)
+	labels, err := gHelper.Msgs.ListLabels()
+	if err != nil {
+		return err
+	}
+	label, err := findLabel(labels, name)
+	if err != nil {
+		return err
+	}
+	if api.IsSystemLabel(label) {
+		return fmt.Errorf("%s is a system label, and cannot be deleted", name)
+	}
+
+	toDelete := []*gm.Label{label}
+	if labelDeleteChildren {
+		toDelete = labelAndChildren(labels, name)
+	}
+
+	fltrHelper := newLabelGmailHelper(api.ReadLabelsOp, api.ReadSettingsOp)
+	filters, err := fltrHelper.GetFilters()
+	if err != nil {
+		return fmt.Errorf("Error getting filters: %v", err)
+	}
+
+	prnt.LPrintln(prnt.Quietable, prnt.Colorize("Labels to delete:", "bold"))
+	for _, l := range toDelete {
+		detailed, err := gHelper.Msgs.GetLabel(l.Id)
+		if err != nil {
+			return err
+		}
+		prnt.LPrintf(prnt.Quietable, "  %s (%d messages)\n", l.Name, detailed.MessagesTotal)
+	}
+
+	var referencing []*gm.Filter
+	for _, l := range toDelete {
+		referencing = append(referencing, filtersReferencingLabel(filters, l)...)
+	}
+	if len(referencing) > 0 {
+		prnt.LPrintln(prnt.Quietable, prnt.Colorize(
+			"Filters referencing these labels (they will not be changed):", "bold"))
+		for _, fltr := range referencing {
+			fltrHelper.PrintFilter(fltr)
+			prnt.LPrintln(prnt.Quietable, "")
+		}
+	}
+
+	if DryRun {
+		prnt.LPrintln(prnt.Quietable, "Skipping committing changes (--dry provided)")
+		return nil
+	}
+	if !MaybeConfirmFromInput("Delete these labels? Messages will not be deleted.", false) {
+		return nil
+	}
+	// Children first, so a failure never leaves orphans behind
+	for i := len(toDelete) - 1; i >= 0; i-- {
+		l := toDelete[i]
+		if err = gHelper.Msgs.DeleteLabel(l.Id); err != nil {
+			return fmt.Errorf("Failed to delete label %s: %v", l.Name, err)
+		}
+		prnt.HPrintf(prnt.Quietable, "Deleted label %s\n", l.Name)
+	}
+	return nil
+}
+
+// ---------- color ----------------
+
+func runLabelColorCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	name := args[0]
+	patch := &gm.Label{}
+	if labelColorClear {
+		if len(args) > 1 {
+			return fmt.Errorf("Colors cannot be given with --clear")
+		}
+		// The color must be explicitly sent as null to remove it
+		patch.NullFields = []string{"Color"}
+	} else {
+		if len(args) < 2 {
+			return fmt.Errorf("A BACKGROUND color is required")
+		}
+		bg, err := api.ValidateLabelColor(args[1])
+		if err != nil {
+			return err
+		}
+		text := api.ContrastingTextColor(bg)
+		if len(args) > 2 {
+			if text, err = api.ValidateLabelColor(args[2]); err != nil {
+				return err
+			}
+		}
+		patch.Color = &gm.LabelColor{BackgroundColor: bg, TextColor: text}
+	}
+
+	gHelper := newLabelGmailHelper(labelModifyOps...)
+	id, ok := gHelper.Msgs.LabelIdByName(name)
+	if !ok {
+		return fmt.Errorf("No label named %s found", name)
+	}
+	if DryRun {
+		prnt.LPrintln(prnt.Quietable, "Skipping committing changes (--dry provided)")
+		return nil
+	}
+	if _, err := gHelper.Msgs.PatchLabel(id, patch); err != nil {
+		return fmt.Errorf("Failed to set color of %s: %v", name, err)
+	}
+	prnt.HPrintf(prnt.Quietable, "Updated color of %s\n", name)
+	return nil
+}
+
+// labelCmd represents the label command tree
+var labelCmd = &cobra.Command{
+	Use:     "label",
+	Short:   "Label related commands",
+	Aliases: []string{"labels", "lb"},
+}
+
+var labelListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "Lists labels, with message and thread counts",
+	Aliases: []string{"ls"},
+	RunE:    runLabelListCmd,
+	Args:    cobra.NoArgs,
+}
+
+var labelCreateCmd = &cobra.Command{
+	Use:   "create NAME...",
+	Short: "Creates labels",
+	Long: `Creates labels. Nested labels may be created with Parent/Child names, and
+any missing parents are created as well.`,
+	RunE: runLabelCreateCmd,
+	Args: cobra.MinimumNArgs(1),
+}
+
+var labelRenameCmd = &cobra.Command{
+	Use:   "rename OLD_NAME NEW_NAME",
+	Short: "Renames (or moves) a label and its children",
+	Long: `Renames a label. Nested labels are moved along with it, so this can also be
+used to move a label under a different parent.
+
+References to the label in the config file (LabelColors, ApplyLabelOnTouch,
+label patterns and InterestingMessageQuery) and in filter queries are updated
+too. All changes are shown before anything is modified.`,
+	Aliases: []string{"mv"},
+	RunE:    runLabelRenameCmd,
+	Args:    cobra.ExactArgs(2),
+}
+
+var labelDeleteCmd = &cobra.Command{
+	Use:   "delete NAME",
+	Short: "Deletes a label",
+	Long: `Deletes a label. Messages with the label are not deleted. Filters which
+reference the label are shown before deleting.`,
+	Aliases: []string{"rm"},
+	RunE:    runLabelDeleteCmd,
+	Args:    cobra.ExactArgs(1),
+}
+
+var labelColorCmd = &cobra.Command{
+	Use:   "color NAME [BACKGROUND [TEXT]]",
+	Short: "Sets the Gmail color of a label",
+	Long: `Sets the color of a label in Gmail. Colors are hex values (e.g. #fb4c2f), and
+must be from the palette Gmail allows. If TEXT is not given, black or white is
+chosen to contrast with BACKGROUND.
+
+This is separate from LabelColors in the config file, which only affects the
+terminal output of this tool.`,
+	RunE: runLabelColorCmd,
+	Args: cobra.RangeArgs(1, 3),
+}
+
+func init() {
+	RootCmd.AddCommand(labelCmd)
+	labelCmd.AddCommand(labelListCmd)
+	labelCmd.AddCommand(labelCreateCmd)
+	labelCmd.AddCommand(labelRenameCmd)
+	labelCmd.AddCommand(labelDeleteCmd)
+	labelCmd.AddCommand(labelColorCmd)
+
+	labelListCmd.Flags().BoolVarP(&labelListAll, "all", "a", false,
+		"Include system labels (INBOX, CATEGORY_*, etc.)")
+	labelDeleteCmd.Flags().BoolVarP(&labelDeleteChildren, "recursive", "r", false,
+		"Also delete all labels nested under the label")
+	labelColorCmd.Flags().BoolVar(&labelColorClear, "clear", false,
+		"Remove the label's color")
+
+	for _, c := range []*cobra.Command{
+		labelCreateCmd, labelRenameCmd, labelDeleteCmd, labelColorCmd} {
+		addDryFlag(c)
+	}
+	addAssumeYesFlag(labelRenameCmd)
+	addAssumeYesFlag(labelDeleteCmd)
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/plugin"
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+// ---------- list ----------------
+
+func runPluginsListCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	conf := config.AppConfig()
+	loaded := plugin.LoadPlugins(&conf.Plugins, NewPluginEnv(nil))
+
+	ids := make([]string, 0, len(loaded))
+	for _, lp := range loaded {
+		ids = append(ids, lp.Id)
+		prnt.Hum.Always.F("%s\n", prnt.Colorize(lp.Id, "bold"))
+		prnt.Hum.Always.F("  Source: %s\n", lp.Source)
+		switch {
+		case lp.Disabled:
+			prnt.Hum.Always.F("  Disabled\n")
+		case lp.Err != nil:
+			prnt.Hum.Always.F("  Error: %s\n", prnt.Colorize(lp.Err.Error(), "red"))
+		default:
+			prnt.Hum.Always.F("  Name: %s\n", lp.Plugin.Name)
+			caps := lp.Plugin.Capabilities()
+			if len(caps) == 0 {
+				caps = []string{"none"}
+			}
+			prnt.Hum.Always.F("  Capabilities: %s\n", strings.Join(caps, ", "))
+		}
+	}
+	if len(loaded) == 0 {
+		prnt.Hum.Always.Ln("No plugins found")
+	}
+
+	pConf := &conf.Plugins
+	for _, names := range [][]string{pConf.Enabled, pConf.Disabled, pConf.Order} {
+		for _, name := range names {
+			if !util.StringSliceContains(name, ids) {
+				prnt.StderrLog.Printf("Plugins in %s refers to unknown plugin %s\n",
+					conf.ConfigFile, name)
+			}
+		}
+	}
+	return nil
+}
+
+// ---------- plugin commands ----------------
+
+// addPluginCommands adds the commands registered by builtin plugins to
+// RootCmd. Their plugins are only built once one of the commands is run.
+func addPluginCommands() {
+	commands := plugin.BuiltinCommands()
+	ids := make([]string, 0, len(commands))
+	for id := range commands {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		for _, pc := range commands[id] {
+			addPluginCommand(id, pc)
+		}
+	}
+}
+
+func addPluginCommand(pluginId string, pc *plugin.Command) {
+	for _, c := range RootCmd.Commands() {
+		if c.Name() == pc.Cobra.Name() {
+			prnt.StderrLog.Printf("Plugin %s: command %s already exists\n",
+				pluginId, pc.Cobra.Name())
+			return
+		}
+	}
+	pc.Cobra.Run = nil
+	pc.Cobra.RunE = func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		ops := msgOps(pc.Modifies)
+		if pc.Modifies {
+			ops = append(ops, api.ModifyLabelsOp)
+		}
+		conf := config.AppConfig()
+		if !conf.Plugins.IsEnabled(pluginId) {
+			return fmt.Errorf("Plugin %s is disabled in %s", pluginId, conf.ConfigFile)
+		}
+		srv := api.NewGmailClientForOps(ops...)
+		gHelper := NewGmailHelper(srv, api.DefaultUser, conf)
+		lp := plugin.LoadBuiltinPlugin(pluginId, &conf.Plugins, NewPluginEnv(gHelper.Msgs))
+		if lp.Err != nil {
+			return fmt.Errorf("Plugin %s could not be loaded: %v", pluginId, lp.Err)
+		}
+		return pc.Run(lp.Plugin.Ctx, cmd, args)
+	}
+	RootCmd.AddCommand(pc.Cobra)
+}
+
+var pluginsCmd = &cobra.Command{
+	Use:   "plugins",
+	Short: "Manage plugins",
+	Long: `Plugins are either compiled into gmailcli, or are executables in
+~/.gmailcli/plugins (see plugin/PROTOCOL.md). They are loaded in the order set by
+the Plugins section of config.yaml, e.g.
+
+Plugins:
+  Disabled: [core]
+  Order: [myplugin]
+
+If Enabled is set, only the plugins listed in it are loaded.`,
+}
+
+var pluginsListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "Lists plugins, with their source, capabilities and any load errors",
+	Aliases: []string{"ls"},
+	RunE:    runPluginsListCmd,
+	Args:    cobra.NoArgs,
+}
+
+func init() {
+	RootCmd.AddCommand(pluginsCmd)
+	pluginsCmd.AddCommand(pluginsListCmd)
+}
@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/retention"
+	"github.com/tsiemens/gmail-tools/searchutil"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+const retentionReportFileName = "retention-report.json"
+
+var retentionReportFile string
+var retentionMaxMsgs int64
+
+func loadRetentionPolicies(names []string) ([]*retention.Policy, error) {
+	conf := config.AppConfig()
+	if err := retention.ValidatePolicies(conf.Retention); err != nil {
+		return nil, fmt.Errorf("Invalid Retention in %s: %v", conf.ConfigFile, err)
+	}
+	selected, err := retention.SelectPolicies(conf.Retention, names)
+	if err != nil {
+		return nil, err
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("No Retention policies found in %s", conf.ConfigFile)
+	}
+	return selected, nil
+}
+
+// checkPolicyLabel returns an error if the policy's label is a user label
+// which does not exist, since the query would then silently match nothing.
+func checkPolicyLabel(gHelper *GmailHelper, p *retention.Policy) error {
+	if p.HasSystemLabel() {
+		return nil
+	}
+	_, err := gHelper.Msgs.MissingLabelNames(
+		[]api.Label{api.NewLabelWithName(p.Label)}, false)
+	return err
+}
+
+// retentionModifyRequest returns the change which applies the policy's action
+func retentionModifyRequest(p *retention.Policy) *gm.BatchModifyMessagesRequest {
+	if p.EffectiveAction() == retention.ArchiveAction {
+		return &gm.BatchModifyMessagesRequest{
+			RemoveLabelIds: []string{"INBOX"}}
+	}
+	return &gm.BatchModifyMessagesRequest{AddLabelIds: []string{"TRASH"}}
+}
+
+// runRetentionPolicy finds the messages the policy applies to, previews them,
+// and (if apply is set) applies its action after confirmation.
+func runRetentionPolicy(gHelper *GmailHelper, p *retention.Policy, apply bool,
+) *retention.PolicyReport {
+	rep := &retention.PolicyReport{
+		Policy: p.Name, Query: p.SearchQuery(), Action: p.EffectiveAction()}
+	fail := func(err error) *retention.PolicyReport {
+		prnt.StderrLog.Printf("Policy %s failed: %v\n", p.Name, err)
+		rep.Error = err.Error()
+		return rep
+	}
+
+	prnt.HPrintf(prnt.Always, "\n%s: %s\n", prnt.Colorize(p.Name, "bold"), rep.Query)
+	if err := checkPolicyLabel(gHelper, p); err != nil {
+		return fail(err)
+	}
+	exemptRegexps, err := p.ExemptLabelRegexps()
+	if err != nil {
+		return fail(err)
+	}
+	if p.ExemptInteresting {
+		exemptRegexps = append(exemptRegexps, gHelper.conf.InterLabelRegexps...)
+	}
+
+	msgs, err := gHelper.Msgs.QueryMessages(
+		rep.Query, false, false, retentionMaxMsgs, api.LabelsOnly)
+	if err != nil {
+		return fail(err)
+	}
+	rep.Matched = len(msgs)
+
+	var toApply []*gm.Message
+	labelCounts := searchutil.NewCountedStringDefaultMap()
+	senderCounts := searchutil.NewCountedStringDefaultMap()
+	for _, msg := range msgs {
+		labelNames := gHelper.Msgs.MessageLabelNames(msg)
+		if retention.IsExempt(labelNames, exemptRegexps) {
+			rep.Exempt++
+			continue
+		}
+		toApply = append(toApply, msg)
+		for _, label := range labelNames {
+			labelCounts.Inc(label)
+		}
+		if headers, err := api.GetMsgHeaders(msg); err == nil {
+			senderCounts.Inc(headers.From.Address)
+		}
+	}
+	rep.ByLabel = labelCounts.Map
+	rep.BySender = senderCounts.Map
+
+	prnt.HPrintf(prnt.Always, "%d messages to %s (%d matched, %d exempt)\n",
+		len(toApply), rep.Action, rep.Matched, rep.Exempt)
+	if len(toApply) == 0 {
+		return rep
+	}
+	if !Quiet {
+		searchutil.PrintCountsWithThresholdOfMax(
+			"\nMessages per label:\n-------------------------------",
+			"labels", 10, 20, labelCounts.Map)
+		searchutil.PrintCountsWithThresholdOfMax(
+			"\nMessages sent by:\n-------------------------------",
+			"senders", 10, 20, senderCounts.Map)
+	}
+
+	if !apply {
+		return rep
+	}
+	if DryRun {
+		prnt.HPrintf(prnt.Always, "Skipping %s of %d messages (--dry provided)\n",
+			rep.Action, len(toApply))
+		return rep
+	}
+	if !MaybeConfirmFromInput(
+		fmt.Sprintf("%s%s %d messages?", strings.ToUpper(rep.Action[:1]), rep.Action[1:],
+			len(toApply)), false) {
+		return rep
+	}
+	err = gHelper.Msgs.BatchModifyByIdIter(
+		api.SizedMessageIdIteratorFromMsgs(toApply), retentionModifyRequest(p))
+	if err != nil {
+		return fail(err)
+	}
+	rep.Applied = len(toApply)
+	return rep
+}
+
+func runRetention(args []string, apply bool) error {
+	policies, err := loadRetentionPolicies(args)
+	if err != nil {
+		return err
+	}
+	reportFname := retentionReportFile
+	if reportFname == "" {
+		reportFname, err = util.HomeDirAndFile(util.UserAppDirName, retentionReportFileName)
+		if err != nil {
+			return err
+		}
+	}
+
+	srv := api.NewGmailClientForOps(msgOps(apply && !DryRun)...)
+	gHelper := NewGmailHelper(srv, api.DefaultUser, config.AppConfig())
+
+	report := &retention.Report{Time: time.Now(), DryRun: DryRun || !apply}
+	nFailed := 0
+	for _, p := range policies {
+		rep := runRetentionPolicy(gHelper, p, apply)
+		if rep.Error != "" {
+			nFailed++
+		}
+		report.Policies = append(report.Policies, rep)
+	}
+
+	if err = report.Write(reportFname); err != nil {
+		return fmt.Errorf("Failed to write report: %v", err)
+	}
+	prnt.HPrintf(prnt.Quietable, "\nReport written to %s\n", reportFname)
+	if nFailed > 0 {
+		return fmt.Errorf("%d of %d policies failed", nFailed, len(policies))
+	}
+	return nil
+}
+
+func runRetentionRunCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	return runRetention(args, true)
+}
+
+func runRetentionReportCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	return runRetention(args, false)
+}
+
+// retentionCmd represents the retention command tree
+var retentionCmd = &cobra.Command{
+	Use:   "retention",
+	Short: "Trash or archive messages by age, per the Retention section of config.yaml",
+	Long: `Retention policies trash (or archive) messages with a label once they
+reach an age. They are configured in the Retention section of
+~/.gmailcli/config.yaml. For example:
+
+Retention:
+  - Name: promotions
+    Label: CATEGORY_PROMOTIONS
+    OlderThan: 30d
+    ExemptInteresting: true
+  - Name: old-ci
+    Label: Notifications/CI
+    OlderThan: 7d
+    Query: -is:starred
+
+Label may be a label name, or a system label (INBOX, CATEGORY_*, etc.).
+OlderThan is as for older_than: in queries (e.g. 30d, 6m, 1y). Query adds search
+terms. Action is "trash" (the default) or "archive". Messages with labels matched
+by InterestingLabelPatterns (with ExemptInteresting) or by ExemptLabelPatterns
+are kept. Gmail deletes messages which have been in the trash for 30 days.`,
+	Aliases: []string{"ret"},
+}
+
+var retentionRunCmd = &cobra.Command{
+	Use:   "run [NAME...]",
+	Short: "Applies the retention policies",
+	Long: `Applies the named (or all) retention policies, after previewing the
+messages each will affect, grouped by label and sender. A report of the run is
+written to ~/.gmailcli/` + retentionReportFileName + ` (see --report).`,
+	RunE: runRetentionRunCmd,
+}
+
+var retentionReportCmd = &cobra.Command{
+	Use:   "report [NAME...]",
+	Short: "Previews the retention policies, and writes a report, without applying them",
+	RunE:  runRetentionReportCmd,
+}
+
+func init() {
+	RootCmd.AddCommand(retentionCmd)
+	retentionCmd.AddCommand(retentionRunCmd)
+	retentionCmd.AddCommand(retentionReportCmd)
+
+	for _, c := range []*cobra.Command{retentionRunCmd, retentionReportCmd} {
+		c.Flags().StringVar(&retentionReportFile, "report", "",
+			"Write the report to this file")
+		c.Flags().Int64VarP(&retentionMaxMsgs, "max", "m", -1,
+			"Set a max on how many messages are queried per policy.")
+	}
+	addDryFlag(retentionRunCmd)
+	addAssumeYesFlag(retentionRunCmd)
+}
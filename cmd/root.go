@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sync/atomic"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	// "github.com/spf13/viper"
@@ -58,14 +62,56 @@ a gmail account, via the provided Google APIs.`,
 	//	Run: func(cmd *cobra.Command, args []string) { },
 }
 
+// rootCtx is cancelled when gmailcli is interrupted (SIGINT or SIGTERM), or
+// the command finishes.
+var rootCtx, cancelRootCtx = context.WithCancel(context.Background())
+
+// handlingInterrupts is set by commands which stop by themselves once
+// interrupted, rather than gmailcli exiting.
+var handlingInterrupts atomic.Bool
+
+// interrupted returns a channel which is closed when gmailcli is interrupted.
+// Commands which use it must return soon after it is closed.
+func interrupted() <-chan struct{} {
+	handlingInterrupts.Store(true)
+	return rootCtx.Done()
+}
+
+// exitOnInterrupt cancels rootCtx on the first signal from sigs. Unless the
+// command handles interrupts itself, the cleanup handlers are then run and
+// gmailcli exits, as it does on a second signal.
+func exitOnInterrupt(sigs <-chan os.Signal) {
+	for sig := range sigs {
+		if rootCtx.Err() == nil {
+			cancelRootCtx()
+			if handlingInterrupts.Load() {
+				continue
+			}
+		}
+		util.RunCleanupHandlers()
+		code := 1
+		if s, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(s)
+		}
+		os.Exit(code)
+	}
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := RootCmd.Execute(); err != nil {
+	addPluginCommands()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go exitOnInterrupt(sigs)
+
+	err := RootCmd.Execute()
+	cancelRootCtx()
+	util.RunCleanupHandlers()
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	util.RunCleanupHandlers()
 }
 
 func init() {
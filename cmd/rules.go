@@ -0,0 +1,469 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/rules"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+const (
+	rulesLogFileName  = "rules.log"
+	rulesLockFileName = "rules.lock"
+)
+
+// ---------- Logging ----------------
+
+type rulesLogEntry struct {
+	Time     time.Time `json:"time"`
+	Rule     string    `json:"rule"`
+	Matched  int       `json:"matched"`
+	Modified int       `json:"modified"`
+	DryRun   bool      `json:"dryRun,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// rulesLog appends a JSON line to ~/.gmailcli/rules.log for every rule run.
+type rulesLog struct {
+	f *os.File
+}
+
+func openRulesLog() (*rulesLog, error) {
+	fname, err := util.HomeDirAndFile(util.UserAppDirName, rulesLogFileName)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &rulesLog{f: f}, nil
+}
+
+func (l *rulesLog) Record(entry rulesLogEntry) {
+	entry.Time = time.Now()
+	data, err := json.Marshal(entry)
+	util.CheckErr(err)
+	if _, err = fmt.Fprintf(l.f, "%s\n", data); err != nil {
+		prnt.StderrLog.Println("Failed to write rules log:", err)
+	}
+}
+
+func (l *rulesLog) Close() error {
+	return l.f.Close()
+}
+
+// ---------- Running rules ----------------
+
+func loadRules(names []string) ([]*rules.Rule, error) {
+	conf := config.AppConfig()
+	if err := rules.ValidateRules(conf.Rules); err != nil {
+		return nil, fmt.Errorf("Invalid Rules in %s: %v", conf.ConfigFile, err)
+	}
+	selected, err := rules.SelectRules(conf.Rules, names)
+	if err != nil {
+		return nil, err
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("No Rules found in %s", conf.ConfigFile)
+	}
+	return selected, nil
+}
+
+// rulesOps returns the API operations needed to run the rules.
+func rulesOps(rs []*rules.Rule) []api.Operation {
+	ops := msgOps(!DryRun)
+	for _, rule := range rs {
+		if rule.Actions.CreateLabels && !DryRun {
+			return append(ops, api.ModifyLabelsOp)
+		}
+	}
+	return ops
+}
+
+func ruleLabelModOptions(rule *rules.Rule) *MsgLabelModOptions {
+	return &MsgLabelModOptions{
+		LabelNamesToAdd:     rule.Actions.AddLabels,
+		LabelNamesToRemove:  rule.Actions.RemoveLabels,
+		Touch:               rule.Actions.Touch,
+		Trash:               rule.Actions.Trash,
+		Archive:             rule.Actions.Archive,
+		CreateMissingLabels: rule.Actions.CreateLabels,
+	}
+}
+
+// ruleScope restricts rules to particular messages (e.g. those which just
+// arrived), rather than everything their queries match.
+type ruleScope struct {
+	// Only messages received after this are queried
+	After time.Time
+	Ids   map[string]bool
+}
+
+// findRuleMessages runs the rule's query and filters, as search would.
+func findRuleMessages(gHelper *GmailHelper, rule *rules.Rule, scope *ruleScope,
+) ([]*gm.Message, error) {
+	detail := api.IdsOnly
+	if len(rule.LabelPatterns) > 0 {
+		detail = api.LabelsOnly
+	}
+	query := rule.Query
+	if scope != nil {
+		query = fmt.Sprintf("(%s) after:%d", rule.Query, scope.After.Unix())
+	}
+	msgs, err := gHelper.Msgs.QueryMessages(query, false, false, rule.Max, detail)
+	if err != nil {
+		return nil, err
+	}
+	if scope != nil {
+		var scopedMsgs []*gm.Message
+		for _, msg := range msgs {
+			if scope.Ids[msg.Id] {
+				scopedMsgs = append(scopedMsgs, msg)
+			}
+		}
+		msgs = scopedMsgs
+	}
+
+	if len(rule.LabelPatterns) > 0 && len(msgs) > 0 {
+		regexps := gHelper.MustCompileLabelRegexps(rule.LabelPatterns)
+		if msgs, err = gHelper.FilterMessagesByLabelRegexps(regexps, msgs); err != nil {
+			return nil, err
+		}
+	}
+	if rule.Interest != rules.AnyInterest && len(msgs) > 0 {
+		interest := Interesting
+		if rule.Interest == rules.Uninteresting {
+			interest = Uninteresting
+		}
+		if msgs, err = gHelper.FilterMessagesByInterest(interest, msgs); err != nil {
+			return nil, err
+		}
+	}
+	if (len(rule.XFilters) > 0 || len(rule.NotXFilters) > 0) && len(msgs) > 0 {
+		msgs = applyCustomFilters(msgs, gHelper, rule.XFilters, rule.NotXFilters)
+	}
+	return msgs, nil
+}
+
+// runRule finds the messages matched by rule (within scope, if not nil), and
+// applies its actions to them. Returns the number of messages matched and
+// modified.
+func runRule(gHelper *GmailHelper, rule *rules.Rule, scope *ruleScope) (int, int, error) {
+	opts := ruleLabelModOptions(rule)
+	if opts.Touch && gHelper.conf.ApplyLabelOnTouch == "" {
+		return 0, 0, fmt.Errorf("Touch requires ApplyLabelOnTouch in %s",
+			gHelper.conf.ConfigFile)
+	}
+	// Check everything possible before the query runs
+	if err := validateLabelModOptions(gHelper, opts); err != nil {
+		return 0, 0, err
+	}
+	if err := checkCustomFilterNames(gHelper, rule.XFilters, rule.NotXFilters); err != nil {
+		return 0, 0, err
+	}
+
+	msgs, err := findRuleMessages(gHelper, rule, scope)
+	if err != nil {
+		return 0, 0, err
+	}
+	if scope != nil && len(msgs) == 0 {
+		// Not worth reporting for every batch of new messages
+		return 0, 0, nil
+	}
+	prnt.HPrintf(prnt.Always, "Rule %s matched %d messages\n",
+		prnt.Colorize(rule.Name, "bold"), len(msgs))
+	if len(msgs) == 0 {
+		return 0, 0, nil
+	}
+
+	labelsToAdd, labelsToRemove := labelChangesFromOptions(gHelper, opts)
+	if DryRun {
+		if !Quiet {
+			msgs, err = gHelper.Msgs.LoadMessages(msgs, api.LabelsAndPayload)
+			if err != nil {
+				return len(msgs), 0, err
+			}
+			for _, msg := range msgs {
+				gHelper.PrintMessage(msg, 2)
+			}
+		}
+		prnt.HPrintf(prnt.Always, "Would add %v, remove %v (--dry provided)\n",
+			labelsToAdd, labelsToRemove)
+		return len(msgs), 0, nil
+	}
+
+	if !MaybeConfirmFromInput(
+		fmt.Sprintf("Apply rule %s to %d messages?", rule.Name, len(msgs)), true) {
+		return len(msgs), 0, nil
+	}
+	if err = gHelper.Msgs.ApplyLabels(msgs, labelsToAdd, labelsToRemove); err != nil {
+		return len(msgs), 0, err
+	}
+	return len(msgs), len(msgs), nil
+}
+
+// runRules runs each rule in order, logging the result of each. A failed rule
+// does not prevent the rest from running. Returns the number that failed.
+func runRules(gHelper *GmailHelper, rs []*rules.Rule, scope *ruleScope, rlog *rulesLog) int {
+	nFailed := 0
+	for _, rule := range rs {
+		matched, modified, err := runRule(gHelper, rule, scope)
+		entry := rulesLogEntry{
+			Rule: rule.Name, Matched: matched, Modified: modified, DryRun: DryRun}
+		if err != nil {
+			prnt.StderrLog.Printf("Rule %s failed: %v\n", rule.Name, err)
+			entry.Error = err.Error()
+			nFailed++
+		}
+		if rlog != nil && (scope == nil || matched > 0 || err != nil) {
+			rlog.Record(entry)
+		}
+	}
+	return nFailed
+}
+
+func acquireRulesLock() (*rules.LockFile, error) {
+	fname, err := util.HomeDirAndFile(util.UserAppDirName, rulesLockFileName)
+	if err != nil {
+		return nil, err
+	}
+	return rules.AcquireLock(fname)
+}
+
+// ---------- list ----------------
+
+func describeRuleActions(a *rules.Actions) string {
+	var descs []string
+	if len(a.AddLabels) > 0 {
+		descs = append(descs, fmt.Sprintf("add label(s) %v", a.AddLabels))
+	}
+	if len(a.RemoveLabels) > 0 {
+		descs = append(descs, fmt.Sprintf("remove label(s) %v", a.RemoveLabels))
+	}
+	for _, flag := range []struct {
+		set  bool
+		desc string
+	}{{a.Archive, "archive"}, {a.Trash, "trash"}, {a.Touch, "touch"},
+		{a.CreateLabels, "create labels"}} {
+		if flag.set {
+			descs = append(descs, flag.desc)
+		}
+	}
+	return strings.Join(descs, ", ")
+}
+
+func runRulesListCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	rs, err := loadRules(nil)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, rule := range rs {
+		prnt.Hum.Always.F("%s\n", prnt.Colorize(rule.Name, "bold"))
+		prnt.Hum.Always.F("  Query: %s\n", rule.Query)
+		if len(rule.LabelPatterns) > 0 {
+			prnt.Hum.Always.F("  Label patterns: %s\n", strings.Join(rule.LabelPatterns, ", "))
+		}
+		if rule.Interest != rules.AnyInterest {
+			prnt.Hum.Always.F("  Interest: %s\n", rule.Interest)
+		}
+		if len(rule.XFilters) > 0 || len(rule.NotXFilters) > 0 {
+			prnt.Hum.Always.F("  Xfilters: %v, not: %v\n", rule.XFilters, rule.NotXFilters)
+		}
+		prnt.Hum.Always.F("  Actions: %s\n", describeRuleActions(&rule.Actions))
+		if sched, _ := rule.ParsedSchedule(); sched != nil {
+			prnt.Hum.Always.F("  Schedule: %s (next %s)\n",
+				sched, sched.Next(now).Format("2006-01-02 15:04"))
+		}
+	}
+	return nil
+}
+
+// ---------- run ----------------
+
+func runRulesRunCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	rs, err := loadRules(args)
+	if err != nil {
+		return err
+	}
+
+	if !DryRun {
+		lock, err := acquireRulesLock()
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+
+	rlog, err := openRulesLog()
+	if err != nil {
+		return fmt.Errorf("Failed to open rules log: %v", err)
+	}
+	defer rlog.Close()
+
+	srv := api.NewGmailClientForOps(rulesOps(rs)...)
+	gHelper := NewGmailHelper(srv, api.DefaultUser, config.AppConfig())
+
+	if nFailed := runRules(gHelper, rs, nil, rlog); nFailed > 0 {
+		return fmt.Errorf("%d of %d rules failed", nFailed, len(rs))
+	}
+	return nil
+}
+
+// ---------- daemon ----------------
+
+func runRulesDaemonCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	rs, err := loadRules(args)
+	if err != nil {
+		return err
+	}
+	schedules := make(map[*rules.Rule]*rules.Schedule)
+	var scheduled []*rules.Rule
+	for _, rule := range rs {
+		if sched, _ := rule.ParsedSchedule(); sched != nil {
+			schedules[rule] = sched
+			scheduled = append(scheduled, rule)
+		}
+	}
+	if len(scheduled) == 0 {
+		return fmt.Errorf("None of the rules have a Schedule")
+	}
+
+	lock, err := acquireRulesLock()
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	rlog, err := openRulesLog()
+	if err != nil {
+		return fmt.Errorf("Failed to open rules log: %v", err)
+	}
+	defer rlog.Close()
+
+	// Nobody is around to answer prompts
+	AssumeYes = true
+
+	srv := api.NewGmailClientForOps(rulesOps(scheduled)...)
+	gHelper := NewGmailHelper(srv, api.DefaultUser, config.AppConfig())
+
+	done := interrupted()
+
+	nextRuns := make(map[*rules.Rule]time.Time)
+	now := time.Now()
+	for _, rule := range scheduled {
+		nextRuns[rule] = schedules[rule].Next(now)
+	}
+
+	for {
+		var next time.Time
+		for _, rule := range scheduled {
+			if t := nextRuns[rule]; !t.IsZero() && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+		if next.IsZero() {
+			return fmt.Errorf("No rules are scheduled to run again")
+		}
+		prnt.LPrintf(prnt.Verbose, "Next run at %s\n", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-done:
+			timer.Stop()
+			prnt.HPrintln(prnt.Quietable, "Interrupted, exiting")
+			return nil
+		case <-timer.C:
+		}
+
+		now = time.Now()
+		var due []*rules.Rule
+		for _, rule := range scheduled {
+			if !nextRuns[rule].After(now) {
+				due = append(due, rule)
+				nextRuns[rule] = schedules[rule].Next(now)
+			}
+		}
+		prnt.HPrintf(prnt.Always, "%s: running %v\n", now.Format(time.RFC3339), due)
+		// Labels and messages may have changed since the last run
+		gHelper.Msgs.Forget()
+		runRules(gHelper, due, nil, rlog)
+	}
+}
+
+// rulesCmd represents the rules command tree
+var rulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "Run the saved searches in the Rules section of config.yaml",
+	Long: `Rules are saved searches, with label changes to apply to the messages
+they match. They are configured in the Rules section of ~/.gmailcli/config.yaml.
+For example:
+
+Rules:
+  - Name: archive-updates
+    Query: in:inbox category:{updates forums}
+    Interest: uninteresting
+    Actions:
+      AddLabels: [MyArchiveLabel]
+      Archive: true
+    Schedule: "0 * * * *"
+
+Each rule may also have LabelPatterns, XFilters, NotXFilters and Max, which
+correspond to the search options. Actions may contain AddLabels, RemoveLabels,
+Archive, Trash, Touch and CreateLabels. Schedule is a cron schedule (five fields,
+or @hourly, @daily, @weekly, @monthly, or "@every <duration>"), used by
+'rules daemon'.
+
+Every rule run is recorded in ~/.gmailcli/` + rulesLogFileName + `.`,
+}
+
+var rulesListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "Lists the configured rules",
+	Aliases: []string{"ls"},
+	RunE:    runRulesListCmd,
+	Args:    cobra.NoArgs,
+}
+
+var rulesRunCmd = &cobra.Command{
+	Use:   "run [NAME...]",
+	Short: "Runs rules now",
+	Long: `Runs the named rules (or all rules), in the order they are configured.
+A rule which fails does not stop the rest from running.`,
+	RunE: runRulesRunCmd,
+}
+
+var rulesDaemonCmd = &cobra.Command{
+	Use:   "daemon [NAME...]",
+	Short: "Runs rules on their schedules",
+	Long: `Runs the named rules (or all rules) which have a Schedule, each time
+their schedule fires, until interrupted. Only one 'rules run', 'rules daemon' or
+'watch' (with rules) may run at a time, which is enforced with
+~/.gmailcli/` + rulesLockFileName + `.`,
+	RunE: runRulesDaemonCmd,
+}
+
+func init() {
+	RootCmd.AddCommand(rulesCmd)
+	rulesCmd.AddCommand(rulesListCmd)
+	rulesCmd.AddCommand(rulesRunCmd)
+	rulesCmd.AddCommand(rulesDaemonCmd)
+
+	addDryFlag(rulesRunCmd)
+	addAssumeYesFlag(rulesRunCmd)
+	addDryFlag(rulesDaemonCmd)
+}
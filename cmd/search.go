@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
 
@@ -15,6 +16,7 @@ import (
 	"github.com/tsiemens/gmail-tools/prnt"
 	"github.com/tsiemens/gmail-tools/searchutil"
 	"github.com/tsiemens/gmail-tools/util"
+	"github.com/tsiemens/gmail-tools/xfilter"
 )
 
 var searchLabelRegexps []string
@@ -24,10 +26,14 @@ var searchUninteresting = false
 var searchDumpCustomFilters = false
 var searchCustomFilterNames []string
 var searchInverseCustomFilterNames []string
+var searchXFilterExpr string
 var searchPrintIdsOnly = false
 var searchPrintJson = false
 var searchMaxMsgs int64
 var searchShowSummary = false
+var searchExplain = false
+var searchDumpActions = false
+var searchActionNames []string
 
 func showSummary(msgs []*gm.Message, gHelper *GmailHelper) {
 	prnt.Hum.Always.Ln("\nMESSAGE SUMMARY\n")
@@ -62,10 +68,7 @@ func showSummary(msgs []*gm.Message, gHelper *GmailHelper) {
 
 		senderCounts.Inc(headers.From.Address)
 
-		for _, email := range headers.To {
-			recipientCounts.Inc(email.Address)
-		}
-		for _, email := range headers.Cc {
+		for _, email := range headers.AllRecipients() {
 			recipientCounts.Inc(email.Address)
 		}
 	}
@@ -90,7 +93,7 @@ func showSummary(msgs []*gm.Message, gHelper *GmailHelper) {
 	plugins := gHelper.GetPlugins()
 	for _, plug := range plugins {
 		if plug.PrintMessageSummary != nil {
-			plug.PrintMessageSummary(msgs, gHelper.Msgs)
+			plug.PrintMessageSummary(plug.Ctx, msgs)
 		}
 	}
 }
@@ -102,47 +105,101 @@ func dumpExtraFilters(gHelper *GmailHelper) {
 			prnt.Hum.Always.F("From %s:\n", plug.Name)
 			for name := range plug.MessageFilters {
 				filter := plug.MessageFilters[name]
-				prnt.Hum.Always.F("%-30s %s\n", name, filter.Desc)
+				prnt.Hum.Always.F("%-30s %s\n", filter.Usage(name), filter.Desc)
 			}
 		}
 	}
 }
 
-func applyCustomFilters(msgs []*gm.Message, gHelper *GmailHelper) []*gm.Message {
-	allFilters := make(map[string]*plugin.MessageFilter)
+// customFilter is an xfilter, and the Context of the plugin which provides it
+type customFilter struct {
+	*plugin.MessageFilter
+	Ctx *plugin.Context
+}
+
+func allCustomFilters(gHelper *GmailHelper) map[string]customFilter {
+	allFilters := make(map[string]customFilter)
 	plugins := gHelper.GetPlugins()
 	for _, plug := range plugins {
 		if plug.MessageFilters != nil {
 			for name := range plug.MessageFilters {
-				allFilters[name] = plug.MessageFilters[name]
+				allFilters[name] = customFilter{plug.MessageFilters[name], plug.Ctx}
 			}
 		}
 	}
+	return allFilters
+}
 
-	type filterAndDirection struct {
-		Filter *plugin.MessageFilter
-		Invert bool
+// checkCustomFilterNames returns an error if any of names is not an xfilter.
+func checkCustomFilterNames(gHelper *GmailHelper, names ...[]string) error {
+	allFilters := allCustomFilters(gHelper)
+	for _, nameList := range names {
+		for _, name := range nameList {
+			if _, ok := allFilters[name]; !ok {
+				return fmt.Errorf("'%s' is not an available xfilter. "+
+					"Run search --list-xfilters for available filters.", name)
+			}
+		}
 	}
+	return nil
+}
 
-	filtersToApply := make([]filterAndDirection, 0, len(searchCustomFilterNames))
-	for _, name := range searchCustomFilterNames {
-		if filter, ok := allFilters[name]; ok {
-			prnt.Deb.Ln("Will apply filter", name)
-			filtersToApply = append(filtersToApply, filterAndDirection{filter, false})
-		} else {
-			prnt.StderrLog.Fatalf(
-				"'%s' is not an available xfilter. Run search --list-xfilters for available filters.\n", name)
-		}
+// xfilterExprSource returns an xfilter expression which matches all of
+// filterNames, none of inverseFilterNames, and expr (if not empty).
+func xfilterExprSource(filterNames []string, inverseFilterNames []string,
+	expr string) string {
+
+	terms := append([]string{}, filterNames...)
+	for _, name := range inverseFilterNames {
+		terms = append(terms, "not "+name)
+	}
+	if expr != "" {
+		terms = append(terms, "("+expr+")")
 	}
+	return strings.Join(terms, " and ")
+}
 
-	for _, name := range searchInverseCustomFilterNames {
-		if filter, ok := allFilters[name]; ok {
-			prnt.Deb.Ln("Will inversely apply filter", name)
-			filtersToApply = append(filtersToApply, filterAndDirection{filter, true})
-		} else {
-			prnt.StderrLog.Fatalf(
-				"'%s' is not an available xfilter. Run search --list-xfilters for available filters.\n", name)
-		}
+// parseXFilterExpr parses an xfilter expression, using the filters of the
+// loaded plugins.
+func parseXFilterExpr(gHelper *GmailHelper, src string) (*xfilter.Expr, error) {
+	allFilters := allCustomFilters(gHelper)
+	expr, err := xfilter.Parse(src, func(name string,
+	) (*plugin.MessageFilter, *plugin.Context, bool) {
+		f, ok := allFilters[name]
+		return f.MessageFilter, f.Ctx, ok
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%v. Run search --list-xfilters for available filters.",
+			err)
+	}
+	return expr, nil
+}
+
+// applyCustomFilters returns the messages which match all of filterNames and
+// none of inverseFilterNames.
+func applyCustomFilters(msgs []*gm.Message, gHelper *GmailHelper,
+	filterNames []string, inverseFilterNames []string) []*gm.Message {
+
+	if err := checkCustomFilterNames(gHelper, filterNames, inverseFilterNames); err != nil {
+		prnt.StderrLog.Fatalln(err)
+	}
+	expr, err := parseXFilterExpr(gHelper,
+		xfilterExprSource(filterNames, inverseFilterNames, ""))
+	if err != nil {
+		prnt.StderrLog.Fatalln(err)
+	}
+	return applyXFilterExpr(msgs, gHelper, expr)
+}
+
+// applyXFilterExpr returns the messages which match expr. Messages are only
+// loaded with more detail as the filters evaluated on them require, and are
+// returned as loaded.
+func applyXFilterExpr(msgs []*gm.Message, gHelper *GmailHelper,
+	expr *xfilter.Expr) []*gm.Message {
+
+	prnt.Deb.Ln("Will apply xfilter expression", expr)
+	load := func(m *gm.Message, detail api.MessageDetailLevel) (*gm.Message, error) {
+		return gHelper.Msgs.GetMessage(m.Id, detail)
 	}
 
 	prnt.Hum.Always.P("Running extra filters on messages ")
@@ -156,14 +213,15 @@ func applyCustomFilters(msgs []*gm.Message, gHelper *GmailHelper) []*gm.Message
 		go func(msg *gm.Message) {
 			querySem <- true
 			defer func() { <-querySem }()
-			for _, fAndD := range filtersToApply {
-				if fAndD.Filter.Matches(msg, gHelper.Msgs) == fAndD.Invert {
-					excludeMsgChan <- msg
-					return
-				}
+			matched, loaded, err := expr.Matches(msg, load)
+			if err != nil {
+				prnt.StderrLog.Printf("Failed to filter message %s: %v\n", msg.Id, err)
+			}
+			if !matched {
+				excludeMsgChan <- msg
+				return
 			}
-			// Matched all filters
-			includeMsgChan <- msg
+			includeMsgChan <- loaded
 		}(msg_)
 	}
 
@@ -181,16 +239,74 @@ func applyCustomFilters(msgs []*gm.Message, gHelper *GmailHelper) []*gm.Message
 	return filteredMsgs
 }
 
+// searchThreads is search in --threads mode, which lists and modifies whole
+// threads rather than individual messages.
+func searchThreads(gHelper *GmailHelper, query string) error {
+	threads, err := gHelper.Msgs.QueryThreads(query, false, false, searchMaxMsgs, api.IdsOnly)
+	if err != nil {
+		return err
+	}
+	if len(threads) == 0 {
+		return errors.New("Query matched no threads")
+	}
+	prnt.HPrintf(prnt.Always, "Query matched %d threads\n", len(threads))
+
+	threadIds := make([]string, 0, len(threads))
+	for _, t := range threads {
+		threadIds = append(threadIds, t.Id)
+	}
+
+	if !Quiet && MaybeConfirmFromInput("Show threads?", true) {
+		if searchPrintIdsOnly {
+			for _, id := range threadIds {
+				prnt.Printf("%s\n", id)
+			}
+		} else {
+			summaries := make([]*api.ThreadSummary, 0, len(threads))
+			for _, t := range threads {
+				summaries = append(summaries, api.SummarizeThread(t))
+			}
+			if searchPrintJson {
+				gHelper.PrintThreadsJson(summaries)
+			} else {
+				for _, summary := range summaries {
+					gHelper.PrintThread(summary)
+				}
+			}
+		}
+	}
+
+	modifyThreadLabels(gHelper, threadIds, &CmdMsgLabelModOptions)
+	return nil
+}
+
 func runSearchCmd(cmd *cobra.Command, args []string) error {
 	cmd.SilenceUsage = true
 	if searchInteresting && searchUninteresting {
 		prnt.StderrLog.Fatalln("-u and -i options are mutually exclusive")
 	}
+	if ThreadMode && (searchOutdated || searchInteresting || searchUninteresting ||
+		searchShowSummary || len(searchLabelRegexps) > 0 ||
+		len(searchCustomFilterNames) > 0 || len(searchInverseCustomFilterNames) > 0 ||
+		searchXFilterExpr != "") {
+		return errors.New(
+			"--threads cannot be used with -l, -o, -i, -u, -f, -F, -X or --summary")
+	}
+	if ThreadMode && len(searchActionNames) > 0 {
+		return errors.New("--threads cannot be used with --action")
+	}
+	if searchExplain && (ThreadMode || searchShowSummary || searchPrintIdsOnly) {
+		return errors.New("--explain cannot be used with --threads, --summary or --ids-only")
+	}
 
 	conf := config.AppConfig()
 	ValidateTouchOption(conf)
 
-	srv := api.NewGmailClient(api.ModifyScope)
+	ops := CmdMsgLabelModOptions.Ops()
+	if len(searchActionNames) > 0 {
+		ops = append(ops, api.ModifyMessagesOp, api.ModifyLabelsOp)
+	}
+	srv := api.NewGmailClientForOps(ops...)
 	gHelper := NewGmailHelper(srv, api.DefaultUser, conf)
 
 	// Special options, which don't search
@@ -198,6 +314,31 @@ func runSearchCmd(cmd *cobra.Command, args []string) error {
 		dumpExtraFilters(gHelper)
 		return nil
 	}
+	if searchDumpActions {
+		dumpMessageActions(gHelper)
+		return nil
+	}
+
+	if err := validateLabelModOptions(gHelper, &CmdMsgLabelModOptions); err != nil {
+		return err
+	}
+	if err := checkMessageActionNames(gHelper, searchActionNames); err != nil {
+		return err
+	}
+	var xfilterExpr *xfilter.Expr
+	if len(searchCustomFilterNames) > 0 || len(searchInverseCustomFilterNames) > 0 ||
+		searchXFilterExpr != "" {
+		err := checkCustomFilterNames(
+			gHelper, searchCustomFilterNames, searchInverseCustomFilterNames)
+		if err != nil {
+			return err
+		}
+		xfilterExpr, err = parseXFilterExpr(gHelper, xfilterExprSource(
+			searchCustomFilterNames, searchInverseCustomFilterNames, searchXFilterExpr))
+		if err != nil {
+			return err
+		}
+	}
 
 	// Proceed with normal command
 	query := ""
@@ -209,6 +350,10 @@ func runSearchCmd(cmd *cobra.Command, args []string) error {
 		prnt.StderrLog.Println("No query provided")
 	}
 
+	if ThreadMode {
+		return searchThreads(gHelper, query)
+	}
+
 	var msgs []*gm.Message = nil
 	var err error = nil
 
@@ -252,8 +397,8 @@ func runSearchCmd(cmd *cobra.Command, args []string) error {
 		hasLoadedMsgDetails = true
 	}
 
-	if len(searchCustomFilterNames) > 0 || len(searchInverseCustomFilterNames) > 0 {
-		msgs = applyCustomFilters(msgs, gHelper)
+	if xfilterExpr != nil {
+		msgs = applyXFilterExpr(msgs, gHelper, xfilterExpr)
 	}
 
 	if len(msgs) == 0 {
@@ -281,7 +426,10 @@ func runSearchCmd(cmd *cobra.Command, args []string) error {
 				hasLoadedMsgDetails = true
 			}
 
-			if searchPrintJson {
+			if searchExplain {
+				gHelper.PrintInterestExplanations(
+					gHelper.ExplainMessagesInterest(msgs), searchPrintJson)
+			} else if searchPrintJson {
 				gHelper.PrintMessagesJson(msgs)
 			} else {
 				gHelper.PrintMessagesByCategory(msgs)
@@ -289,6 +437,9 @@ func runSearchCmd(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if err := maybeRunMessageActions(gHelper, msgs, searchActionNames); err != nil {
+		return err
+	}
 	modifyMsgLabels(gHelper, msgs, &CmdMsgLabelModOptions)
 
 	return nil
@@ -323,15 +474,31 @@ func init() {
 		[]string{},
 		"Extra filters to apply inversely. May be loaded from plugins. "+
 			"(may be provided multiple times)")
+	command.Flags().StringVarP(&searchXFilterExpr, "xfilter-expr", "X", "",
+		"Extra filter expression to apply, combining filters with and, or, not and "+
+			"parentheses, e.g. 'sender-domain(github.com) and not subject(^re:)'. "+
+			"Applied with any -f and -F filters")
 	command.Flags().BoolVar(&searchPrintIdsOnly, "ids-only", false,
-		"Only prints out only messageId,threadId (does not prompt)")
+		"Only prints out only messageId,threadId (does not prompt). "+
+			"With --threads, only threadId")
 	command.Flags().BoolVar(&searchPrintJson, "json", false,
 		"Print message details formatted as json")
 	command.Flags().BoolVar(&searchShowSummary, "summary", false,
 		"Print a statistical summary of the matched messages")
+	command.Flags().BoolVar(&searchExplain, "explain", false,
+		"Print each plugin's interest categorization of the messages, and why. "+
+			"With --json, print it as json")
+	command.Flags().BoolVar(&searchDumpActions, "list-actions", false,
+		"List the names of all available message actions")
+	command.Flags().StringArrayVar(&searchActionNames, "action", []string{},
+		"Plugin action to run on the matched messages, before any label changes "+
+			"(may be provided multiple times)")
 	command.Flags().Int64VarP(&searchMaxMsgs, "max", "m", -1,
 		"Set a max on how many results are queried.")
 
+	addThreadsFlag(command,
+		"List whole threads rather than messages, and apply label changes to threads")
+
 	addLabelModFlags(command)
 	addDryFlag(command)
 	addAssumeYesFlag(command)
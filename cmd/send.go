@@ -0,0 +1,401 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/compose"
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/mime"
+	"github.com/tsiemens/gmail-tools/prnt"
+)
+
+type ComposeOptions struct {
+	To       []string
+	Cc       []string
+	Bcc      []string
+	Subject  string
+	Body     string
+	BodyFile string
+	HtmlFile string
+	Attach   []string
+	Vars     []string
+	Draft    bool
+}
+
+var CmdComposeOptions = ComposeOptions{}
+
+// ops returns the API operations needed to deliver the message (not including
+// reading any originals).
+func (o *ComposeOptions) ops() []api.Operation {
+	if o.Draft {
+		return []api.Operation{api.ComposeDraftsOp}
+	}
+	return []api.Operation{api.SendMessagesOp}
+}
+
+func readFileOrStdin(fname string) (string, error) {
+	var data []byte
+	var err error
+	if fname == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(fname)
+	}
+	return string(data), err
+}
+
+// bodyTemplate returns the body template text, from --body or --body-file.
+func (o *ComposeOptions) bodyTemplate() (string, error) {
+	if o.BodyFile != "" {
+		if o.Body != "" {
+			return "", fmt.Errorf("--body and --body-file cannot both be provided")
+		}
+		return readFileOrStdin(o.BodyFile)
+	}
+	return o.Body, nil
+}
+
+// ComposeTemplates are the parsed templates of ComposeOptions. Subject and
+// Html are nil if they were not provided.
+type ComposeTemplates struct {
+	Subject *compose.Template
+	Body    *compose.Template
+	Html    *compose.Template
+}
+
+// ParseTemplates reads and parses the templates. Files (or stdin) are only
+// read here, so the templates can be applied to any number of messages.
+func (o *ComposeOptions) ParseTemplates() (*ComposeTemplates, error) {
+	tmpls := &ComposeTemplates{}
+	var err error
+	if o.Subject != "" {
+		if tmpls.Subject, err = compose.ParseTemplate("subject", o.Subject); err != nil {
+			return nil, err
+		}
+	}
+	bodyTmpl, err := o.bodyTemplate()
+	if err != nil {
+		return nil, err
+	}
+	if tmpls.Body, err = compose.ParseTemplate("body", bodyTmpl); err != nil {
+		return nil, err
+	}
+	if o.HtmlFile != "" {
+		htmlTmpl, err := readFileOrStdin(o.HtmlFile)
+		if err != nil {
+			return nil, err
+		}
+		if tmpls.Html, err = compose.ParseTemplate("html", htmlTmpl); err != nil {
+			return nil, err
+		}
+	}
+	return tmpls, nil
+}
+
+// Apply renders tmpls with data, and sets the rendered content and the extra
+// recipients and attachments on msg.
+func (o *ComposeOptions) Apply(msg *compose.Message, tmpls *ComposeTemplates,
+	data *compose.TemplateData) error {
+
+	var err error
+	if tmpls.Subject != nil {
+		if msg.Subject, err = tmpls.Subject.Render(data); err != nil {
+			return err
+		}
+	}
+	if msg.Body, err = tmpls.Body.Render(data); err != nil {
+		return err
+	}
+	if tmpls.Html != nil {
+		if msg.HtmlBody, err = tmpls.Html.Render(data); err != nil {
+			return err
+		}
+	}
+
+	msg.To = append(msg.To, o.To...)
+	msg.Cc = append(msg.Cc, o.Cc...)
+	msg.Bcc = append(msg.Bcc, o.Bcc...)
+	for _, fname := range o.Attach {
+		if err = msg.AttachFile(fname); err != nil {
+			return fmt.Errorf("Failed to attach %s: %v", fname, err)
+		}
+	}
+	return nil
+}
+
+func printComposedMessage(msg *compose.Message) {
+	prnt.Hum.Always.F("To: %s\n", strings.Join(msg.To, ", "))
+	if len(msg.Cc) > 0 {
+		prnt.Hum.Always.F("Cc: %s\n", strings.Join(msg.Cc, ", "))
+	}
+	if len(msg.Bcc) > 0 {
+		prnt.Hum.Always.F("Bcc: %s\n", strings.Join(msg.Bcc, ", "))
+	}
+	prnt.Hum.Always.F("Subject: %s\n", msg.Subject)
+	for _, att := range msg.Attachments {
+		prnt.Hum.Always.F("Attachment: %s\n", att.Filename)
+	}
+	prnt.Hum.Always.F("\n%s\n", msg.Body)
+}
+
+// deliverMessage sends msg, or saves it as a draft, after confirmation.
+func deliverMessage(msgs *api.MsgHelper, msg *compose.Message, opts *ComposeOptions) error {
+	raw, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	printComposedMessage(msg)
+	if DryRun {
+		prnt.LPrintln(prnt.Quietable, "Skipping sending (--dry provided)")
+		return nil
+	}
+
+	if opts.Draft {
+		if !MaybeConfirmFromInput("Save draft?", true) {
+			return nil
+		}
+		draft, err := msgs.CreateDraft(raw, msg.ThreadId)
+		if err != nil {
+			return fmt.Errorf("Failed to save draft: %v", err)
+		}
+		prnt.HPrintf(prnt.Quietable, "Saved draft %s\n", draft.Id)
+		return nil
+	}
+
+	if !MaybeConfirmFromInput("Send message?", false) {
+		return nil
+	}
+	sent, err := msgs.SendMessage(raw, msg.ThreadId)
+	if err != nil {
+		return fmt.Errorf("Failed to send message: %v", err)
+	}
+	prnt.HPrintf(prnt.Quietable, "Sent message %s\n", sent.Id)
+	return nil
+}
+
+func origTemplateData(msg *gm.Message, headers *api.Headers) *compose.OrigData {
+	orig := &compose.OrigData{
+		MessageId:   msg.Id,
+		ThreadId:    msg.ThreadId,
+		Subject:     headers.Subject,
+		From:        headers.From.String(),
+		FromName:    headers.From.Name,
+		FromAddress: headers.From.Address,
+	}
+	if !headers.Date.IsZero() {
+		orig.Date = headers.Date.Format(time.RFC1123Z)
+	}
+	if msg.Payload != nil {
+		if mimeMsg, err := mime.Parse(msg.Payload); err == nil {
+			orig.Body = mimeMsg.PreferredText()
+		}
+	}
+	return orig
+}
+
+// ---------- send ----------------
+
+func runSendCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	opts := &CmdComposeOptions
+	if len(opts.To)+len(opts.Cc)+len(opts.Bcc) == 0 {
+		return fmt.Errorf("At least one of --to, --cc or --bcc is required")
+	}
+	vars, err := compose.ParseVars(opts.Vars)
+	if err != nil {
+		return err
+	}
+
+	tmpls, err := opts.ParseTemplates()
+	if err != nil {
+		return err
+	}
+	msg := &compose.Message{}
+	if err = opts.Apply(msg, tmpls, &compose.TemplateData{Vars: vars}); err != nil {
+		return err
+	}
+
+	// Sending alone does not allow reading the account profile, so GmailHelper
+	// cannot be used here.
+	srv := api.NewGmailClientForOps(opts.ops()...)
+	return deliverMessage(api.NewMsgHelper(api.DefaultUser, srv, false), msg, opts)
+}
+
+// ---------- reply ----------------
+
+var replyAll = false
+
+func runReplyCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	opts := &CmdComposeOptions
+	vars, err := compose.ParseVars(opts.Vars)
+	if err != nil {
+		return err
+	}
+	tmpls, err := opts.ParseTemplates()
+	if err != nil {
+		return err
+	}
+
+	conf := config.AppConfig()
+	ops := append([]api.Operation{api.ReadMessagesOp}, opts.ops()...)
+	srv := api.NewGmailClientForOps(ops...)
+	gHelper := NewGmailHelper(srv, api.DefaultUser, conf)
+	self, err := gHelper.Account.GetEmailAddress()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range args {
+		orig, err := gHelper.Msgs.GetMessage(id, api.LabelsAndPayload)
+		if err != nil {
+			return fmt.Errorf("Failed to get message %s: %v", id, err)
+		}
+		headers, err := api.GetMsgHeaders(orig)
+		if err != nil {
+			return fmt.Errorf("Message %s: %v", id, err)
+		}
+
+		msg := compose.NewReply(headers, orig.ThreadId, self, replyAll)
+		data := &compose.TemplateData{Vars: vars, Orig: origTemplateData(orig, headers)}
+		if err = opts.Apply(msg, tmpls, data); err != nil {
+			return err
+		}
+		if err = deliverMessage(gHelper.Msgs, msg, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ---------- forward ----------------
+
+func runForwardCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	opts := &CmdComposeOptions
+	if len(opts.To)+len(opts.Cc)+len(opts.Bcc) == 0 {
+		return fmt.Errorf("At least one of --to, --cc or --bcc is required")
+	}
+	vars, err := compose.ParseVars(opts.Vars)
+	if err != nil {
+		return err
+	}
+	tmpls, err := opts.ParseTemplates()
+	if err != nil {
+		return err
+	}
+
+	conf := config.AppConfig()
+	ops := append([]api.Operation{api.ReadMessagesOp}, opts.ops()...)
+	srv := api.NewGmailClientForOps(ops...)
+	gHelper := NewGmailHelper(srv, api.DefaultUser, conf)
+
+	id := args[0]
+	orig, err := gHelper.Msgs.GetMessage(id, api.LabelsAndPayload)
+	if err != nil {
+		return fmt.Errorf("Failed to get message %s: %v", id, err)
+	}
+	headers, err := api.GetMsgHeaders(orig)
+	if err != nil {
+		return fmt.Errorf("Message %s: %v", id, err)
+	}
+	_, raw, err := gHelper.Msgs.GetRawMessage(id)
+	if err != nil {
+		return fmt.Errorf("Failed to get message %s: %v", id, err)
+	}
+
+	msg := compose.NewForward(headers, raw)
+	data := &compose.TemplateData{Vars: vars, Orig: origTemplateData(orig, headers)}
+	if err = opts.Apply(msg, tmpls, data); err != nil {
+		return err
+	}
+	return deliverMessage(gHelper.Msgs, msg, opts)
+}
+
+const composeTemplateHelp = `
+--subject, --body, --body-file and --html are Go templates. Variables given with
+--var name=value are available as {{.Vars.name}}, or {{var . "name" "default"}}
+to allow them to be missing. For replies and forwards, the original message is
+available as {{.Orig.Subject}}, {{.Orig.From}}, {{.Orig.FromName}},
+{{.Orig.FromAddress}}, {{.Orig.Date}} and {{.Orig.Body}}. {{quote .Orig.Body}}
+quotes the original body.
+
+With --draft, the message is saved as a draft rather than sent.`
+
+var sendCmd = &cobra.Command{
+	Use:   "send",
+	Short: "Sends a new message",
+	Long:  "Composes and sends a new message.\n" + composeTemplateHelp,
+	RunE:  runSendCmd,
+	Args:  cobra.NoArgs,
+}
+
+var replyCmd = &cobra.Command{
+	Use:   "reply MSG_ID...",
+	Short: "Replies to messages",
+	Long: `Replies to each of the given messages, in their threads. The reply goes to
+the sender (or Reply-To address) of the original, and with --all, to all other
+recipients as well. Threading headers are set from the original.
+
+The templates are rendered separately for each message.
+` + composeTemplateHelp,
+	RunE: runReplyCmd,
+	Args: cobra.MinimumNArgs(1),
+}
+
+var forwardCmd = &cobra.Command{
+	Use:   "forward MSG_ID",
+	Short: "Forwards a message",
+	Long: `Forwards a message, with the original attached in full.
+` + composeTemplateHelp,
+	RunE: runForwardCmd,
+	Args: cobra.ExactArgs(1),
+}
+
+// hasOrig should be true for commands which act on an original message.
+func addComposeFlags(cmd *cobra.Command, hasOrig bool) {
+	opts := &CmdComposeOptions
+	cmd.Flags().StringArrayVar(&opts.To, "to", []string{},
+		"Add a To recipient (may be provided multiple times)")
+	cmd.Flags().StringArrayVar(&opts.Cc, "cc", []string{},
+		"Add a Cc recipient (may be provided multiple times)")
+	cmd.Flags().StringArrayVar(&opts.Bcc, "bcc", []string{},
+		"Add a Bcc recipient (may be provided multiple times)")
+	subjectHelp := "Subject template"
+	if hasOrig {
+		subjectHelp += " (defaults to the original subject, prefixed)"
+	}
+	cmd.Flags().StringVarP(&opts.Subject, "subject", "s", "", subjectHelp)
+	cmd.Flags().StringVarP(&opts.Body, "body", "b", "", "Plain text body template")
+	cmd.Flags().StringVar(&opts.BodyFile, "body-file", "",
+		"Read the plain text body template from a file ('-' for stdin)")
+	cmd.Flags().StringVar(&opts.HtmlFile, "html", "",
+		"Read an HTML body template from a file, sent as an alternative to the text")
+	cmd.Flags().StringArrayVarP(&opts.Attach, "attach", "a", []string{},
+		"Attach a file (may be provided multiple times)")
+	cmd.Flags().StringArrayVar(&opts.Vars, "var", []string{},
+		"Set a template variable, as name=value (may be provided multiple times)")
+	cmd.Flags().BoolVar(&opts.Draft, "draft", false,
+		"Save as a draft instead of sending")
+	addDryFlag(cmd)
+	addAssumeYesFlag(cmd)
+}
+
+func init() {
+	RootCmd.AddCommand(sendCmd)
+	RootCmd.AddCommand(replyCmd)
+	RootCmd.AddCommand(forwardCmd)
+
+	addComposeFlags(sendCmd, false)
+	replyCmd.Flags().BoolVar(&replyAll, "all", false, "Reply to all recipients")
+	addComposeFlags(replyCmd, true)
+	addComposeFlags(forwardCmd, true)
+}
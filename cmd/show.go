@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	gm "google.golang.org/api/gmail/v1"
 
@@ -10,17 +11,118 @@ import (
 	"github.com/tsiemens/gmail-tools/api"
 	"github.com/tsiemens/gmail-tools/config"
 	_ "github.com/tsiemens/gmail-tools/filter"
+	"github.com/tsiemens/gmail-tools/mime"
 	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/util"
 )
 
 var showTouch = false
 var showHeadersOnly = false
 var showBrief = false
+var showHtml = false
+var showRaw = false
+var showPartIndex = 0
+var showExplain = false
+var showExplainJson = false
+
+func printPartList(msg *mime.Message) {
+	var others []*mime.Part
+	for _, part := range msg.Parts {
+		if !part.IsBody() {
+			others = append(others, part)
+		}
+	}
+	if len(others) == 0 {
+		return
+	}
+	fmt.Println()
+	for _, part := range others {
+		name := part.Filename
+		if name == "" {
+			name = "<unnamed>"
+		}
+		fmt.Printf("[%d] %s %s (%s, %s)\n", part.Index, part.Kind, name, part.MimeType,
+			util.HumanReadableSize(part.Size))
+	}
+}
+
+// printPart writes the decoded content of a single part. Non-text parts are
+// written as-is, so they may be redirected to a file.
+func printPart(gHelper *GmailHelper, msgId string, part *mime.Part) {
+	if part.IsBody() {
+		fmt.Println(part.Text)
+		return
+	}
+	data := part.Data
+	if data == nil {
+		att := api.NewAttachmentInfo(msgId, part.PartId, part.AttachmentId)
+		var err error
+		data, err = gHelper.Msgs.GetAttachmentData(att)
+		if err != nil {
+			prnt.StderrLog.Fatalf("Failed to load part %d: %v\n", part.Index, err)
+		}
+	}
+	os.Stdout.Write(data)
+}
+
+// printMessageContent prints the headers and body of msg (which must be loaded
+// with its payload), or only part partIndex if it is greater than 0.
+func printMessageContent(gHelper *GmailHelper, msg *gm.Message, partIndex int,
+	headersOnly bool, html bool) {
+
+	mimeMsg, err := mime.Parse(msg.Payload)
+	if err != nil {
+		prnt.StderrLog.Fatalf("%v\n", err)
+	}
+
+	if partIndex > 0 {
+		part, ok := mimeMsg.Part(partIndex)
+		if !ok {
+			prnt.StderrLog.Fatalf("Message has no part %d (it has %d)\n",
+				partIndex, len(mimeMsg.Parts))
+		}
+		printPart(gHelper, msg.Id, part)
+		return
+	}
+
+	for _, hdr := range msg.Payload.Headers {
+		fmt.Printf("%s: %s\n", hdr.Name, hdr.Value)
+	}
+	if headersOnly {
+		return
+	}
+	fmt.Println()
+	if html {
+		htmlBody, ok := mimeMsg.PreferredHtml()
+		if !ok {
+			prnt.StderrLog.Fatalln("Message has no HTML body")
+		}
+		fmt.Println(htmlBody)
+	} else {
+		fmt.Println(mimeMsg.PreferredText())
+	}
+	printPartList(mimeMsg)
+}
 
 func runShowCmd(cmd *cobra.Command, args []string) {
 	if showHeadersOnly && showBrief {
 		prnt.StderrLog.Fatalln("-b and -H are mutually exclusive")
 	}
+	if showHeadersOnly && showRaw {
+		prnt.StderrLog.Fatalln("--raw and -H are mutually exclusive")
+	}
+	nBodyModes := 0
+	for _, b := range []bool{showHtml, showRaw, showPartIndex > 0, showBrief, showExplain} {
+		if b {
+			nBodyModes++
+		}
+	}
+	if nBodyModes > 1 {
+		prnt.StderrLog.Fatalln("--html, --raw, --part, -b and --explain are mutually exclusive")
+	}
+	if showExplainJson && !showExplain {
+		prnt.StderrLog.Fatalln("--json requires --explain")
+	}
 
 	msgId := args[0]
 	if msgId == "" {
@@ -28,26 +130,34 @@ func runShowCmd(cmd *cobra.Command, args []string) {
 	}
 
 	conf := config.AppConfig()
-	srv := api.NewGmailClient(api.ModifyScope)
+	srv := api.NewGmailClientForOps(msgOps(showTouch)...)
 	gHelper := NewGmailHelper(srv, api.DefaultUser, conf)
 
-	msg, err := gHelper.Msgs.GetMessage(msgId, api.LabelsAndPayload)
-	if err != nil {
-		prnt.StderrLog.Fatalf("%v\n", err)
+	var msg *gm.Message
+	var err error
+	if showRaw {
+		var raw []byte
+		msg, raw, err = gHelper.Msgs.GetRawMessage(msgId)
+		if err != nil {
+			prnt.StderrLog.Fatalf("%v\n", err)
+		}
+		os.Stdout.Write(raw)
+	} else {
+		msg, err = gHelper.Msgs.GetMessage(msgId, api.LabelsAndPayload)
+		if err != nil {
+			prnt.StderrLog.Fatalf("%v\n", err)
+		}
 	}
 
-	if showBrief {
+	if showRaw {
+		// Already printed
+	} else if showBrief {
 		gHelper.PrintMessage(msg, 0)
+	} else if showExplain {
+		gHelper.PrintInterestExplanations(
+			[]*InterestExplanationJson{gHelper.ExplainMsgInterest(msg)}, showExplainJson)
 	} else {
-		for _, hdr := range msg.Payload.Headers {
-			fmt.Printf("%s: %s\n", hdr.Name, hdr.Value)
-		}
-
-		if !showHeadersOnly {
-			for _, part := range api.GetMessageBody(msg) {
-				fmt.Println(part)
-			}
-		}
+		printMessageContent(gHelper, msg, showPartIndex, showHeadersOnly, showHtml)
 	}
 
 	if showTouch {
@@ -58,8 +168,13 @@ func runShowCmd(cmd *cobra.Command, args []string) {
 }
 
 var showCmd = &cobra.Command{
-	Use:     "show [MESSAGE_ID]",
-	Short:   "Shows details for the message ID",
+	Use:   "show [MESSAGE_ID]",
+	Short: "Shows details for the message ID",
+	Long: `Shows the headers and body of the message.
+
+The body is shown as plain text, rendering the HTML body if there is no plain
+text version. Other parts (attachments, inline images) are listed by number, and
+may be printed with --part.`,
 	Aliases: []string{"sh"},
 	Run:     runShowCmd,
 	Args:    cobra.ExactArgs(1),
@@ -74,6 +189,16 @@ func init() {
 		"Don't print the message body")
 	showCmd.Flags().BoolVarP(&showBrief, "brief", "b", false,
 		"Print only a brief summary of the message")
+	showCmd.Flags().BoolVar(&showHtml, "html", false,
+		"Print the HTML body rather than the plain text")
+	showCmd.Flags().BoolVar(&showRaw, "raw", false,
+		"Print the full raw message source")
+	showCmd.Flags().IntVar(&showPartIndex, "part", 0,
+		"Print only the decoded content of part N")
+	showCmd.Flags().BoolVar(&showExplain, "explain", false,
+		"Print each plugin's interest categorization of the message, and why")
+	showCmd.Flags().BoolVar(&showExplainJson, "json", false,
+		"With --explain, print the categorization as json")
 	addDryFlag(showCmd)
 	addAssumeYesFlag(showCmd)
 }
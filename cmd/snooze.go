@@ -0,0 +1,350 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/spf13/cobra"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/rules"
+	"github.com/tsiemens/gmail-tools/snooze"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+const (
+	snoozeDbFileName   = "snooze.json"
+	snoozeLockFileName = "snooze.lock"
+	// How long to wait for another process to finish with the snooze database
+	snoozeLockTimeout = 30 * time.Second
+)
+
+var snoozeUntil string
+var snoozeMaxMsgs int64
+
+// Snoozing creates and deletes Snoozed/ labels, as well as modifying threads.
+var snoozeOps = []api.Operation{
+	api.ReadMessagesOp, api.ReadLabelsOp, api.ModifyMessagesOp, api.ModifyLabelsOp}
+
+var msgIdRegexp = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+func loadSnoozeDb() (*snooze.DB, error) {
+	fname, err := util.HomeDirAndFile(util.UserAppDirName, snoozeDbFileName)
+	if err != nil {
+		return nil, err
+	}
+	return snooze.LoadDB(fname)
+}
+
+// lockSnoozeDb locks the snooze database while it is loaded, modified and
+// saved, so that snooze and 'watch --wake-snoozed' do not overwrite each other's
+// changes. Other processes only hold the lock briefly, so it is waited for.
+func lockSnoozeDb() (*rules.LockFile, error) {
+	fname, err := util.HomeDirAndFile(util.UserAppDirName, snoozeLockFileName)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(snoozeLockTimeout)
+	for {
+		lock, err := rules.AcquireLock(fname)
+		var lockedErr *rules.LockedError
+		if !errors.As(err, &lockedErr) {
+			return lock, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is in use by process %d (lock file %s)",
+				snoozeDbFileName, lockedErr.Pid, fname)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func newSnoozeGmailHelper() *GmailHelper {
+	ops := snoozeOps
+	if DryRun {
+		ops = msgOps(false)
+	}
+	srv := api.NewGmailClientForOps(ops...)
+	return NewGmailHelper(srv, api.DefaultUser, config.AppConfig())
+}
+
+// snoozeTargetMsgs returns one message from each thread to snooze. target is
+// either a message ID, or a query.
+func snoozeTargetMsgs(gHelper *GmailHelper, target string) ([]*gm.Message, error) {
+	if msgIdRegexp.MatchString(target) {
+		msg, err := gHelper.Msgs.GetMessage(target, api.LabelsAndPayload)
+		if err == nil {
+			return []*gm.Message{msg}, nil
+		} else if !api.IsNotFound(err) {
+			return nil, err
+		}
+		// Not a message. Try it as a query.
+	}
+
+	msgs, err := gHelper.Msgs.QueryMessages(
+		target, false, false, snoozeMaxMsgs, api.LabelsAndPayload)
+	if err != nil {
+		return nil, err
+	}
+	var threadMsgs []*gm.Message
+	seenThreads := make(map[string]bool)
+	for _, msg := range msgs {
+		if !seenThreads[msg.ThreadId] {
+			seenThreads[msg.ThreadId] = true
+			threadMsgs = append(threadMsgs, msg)
+		}
+	}
+	return threadMsgs, nil
+}
+
+// ---------- snooze ----------------
+
+func runSnoozeCmd(cmd *cobra.Command, args []string) error {
+	if snoozeUntil == "" {
+		return fmt.Errorf("--until is required")
+	}
+	until, err := snooze.ParseUntil(snoozeUntil, time.Now())
+	if err != nil {
+		return err
+	}
+	if !until.After(time.Now()) {
+		return fmt.Errorf("%s is not in the future", until.Format(time.RFC3339))
+	}
+	cmd.SilenceUsage = true
+	gHelper := newSnoozeGmailHelper()
+
+	msgs, err := snoozeTargetMsgs(gHelper, args[0])
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 0 {
+		prnt.HPrintln(prnt.Always, "No messages found")
+		return nil
+	}
+	for _, msg := range msgs {
+		gHelper.PrintMessage(msg, 0)
+	}
+
+	label := snooze.LabelForTime(until)
+	actionStr := fmt.Sprintf("Snooze %d threads until %s (label %s)",
+		len(msgs), until.Format("2006-01-02 15:04"), label)
+	if DryRun {
+		prnt.HPrintf(prnt.Always, "Skipping: %s (--dry provided)\n", actionStr)
+		return nil
+	}
+	if !MaybeConfirmFromInput(actionStr+"?", true) {
+		return nil
+	}
+
+	if _, err = gHelper.Msgs.CreateMissingLabels([]string{label}); err != nil {
+		return err
+	}
+	lock, err := lockSnoozeDb()
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	db, err := loadSnoozeDb()
+	if err != nil {
+		return err
+	}
+
+	// Each thread is recorded once it is snoozed, so that threads which were
+	// snoozed before a failure are still woken.
+	now := time.Now()
+	nSnoozed := 0
+	var firstErr error
+	for _, msg := range msgs {
+		err := gHelper.Msgs.ModifyThreads([]string{msg.ThreadId},
+			[]api.Label{api.NewLabelWithName(label)}, []api.Label{api.InboxLabel})
+		if err != nil {
+			prnt.StderrLog.Printf("Failed to snooze thread %s: %v\n", msg.ThreadId, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		nSnoozed++
+		entry := &snooze.Entry{
+			ThreadId: msg.ThreadId, Until: until, Label: label, Created: now}
+		if headers, err := api.GetMsgHeaders(msg); err == nil {
+			entry.Subject = headers.Subject
+		}
+		old := db.Add(entry)
+		if old != nil && old.Label != label {
+			removeSnoozeLabel(gHelper, db, old)
+		}
+	}
+	if nSnoozed > 0 {
+		if err = db.Save(); err != nil {
+			return fmt.Errorf("%d threads were snoozed, but could not be saved: %v",
+				nSnoozed, err)
+		}
+		prnt.HPrintf(prnt.Quietable, "Snoozed %d threads\n", nSnoozed)
+	}
+	if firstErr != nil {
+		return fmt.Errorf("%d of %d threads failed to snooze: %v",
+			len(msgs)-nSnoozed, len(msgs), firstErr)
+	}
+	return nil
+}
+
+// removeSnoozeLabel removes the entry's label from its thread, and deletes the
+// label once no other snoozed thread uses it.
+func removeSnoozeLabel(gHelper *GmailHelper, db *snooze.DB, entry *snooze.Entry) {
+	labelId, ok := gHelper.Msgs.LabelIdByName(entry.Label)
+	if !ok {
+		return
+	}
+	if db.LabelInUse(entry.Label) {
+		err := gHelper.Msgs.ModifyThreads([]string{entry.ThreadId}, nil,
+			[]api.Label{api.NewLabelWithId(labelId)})
+		if err != nil && !api.IsNotFound(err) {
+			prnt.StderrLog.Printf("Failed to remove %s from thread %s: %v\n",
+				entry.Label, entry.ThreadId, err)
+		}
+		return
+	}
+	// Deleting the label removes it from the thread as well
+	if err := gHelper.Msgs.DeleteLabel(labelId); err != nil {
+		prnt.StderrLog.Printf("Failed to delete label %s: %v\n", entry.Label, err)
+	}
+}
+
+// ---------- wake ----------------
+
+// wakeSnoozedThreads moves snoozed threads which are due back to the inbox,
+// marks them unread, and removes their snooze labels. Returns the number of
+// threads woken.
+func wakeSnoozedThreads(gHelper *GmailHelper, now time.Time) (int, error) {
+	lock, err := lockSnoozeDb()
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Release()
+	db, err := loadSnoozeDb()
+	if err != nil {
+		return 0, err
+	}
+	due := db.Due(now)
+	if len(due) == 0 {
+		return 0, nil
+	}
+	if DryRun {
+		for _, entry := range due {
+			prnt.HPrintf(prnt.Always, "Would wake %s %s\n", entry.ThreadId, entry.Subject)
+		}
+		return 0, nil
+	}
+
+	nWoken := 0
+	var firstErr error
+	for _, entry := range due {
+		err := gHelper.Msgs.ModifyThreads([]string{entry.ThreadId},
+			[]api.Label{api.InboxLabel, api.UnreadLabel}, nil)
+		if err != nil && !api.IsNotFound(err) {
+			// Left in the database, to be tried again
+			prnt.StderrLog.Printf("Failed to wake thread %s: %v\n", entry.ThreadId, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if err == nil {
+			prnt.HPrintf(prnt.Quietable, "Woke %s %s\n", entry.ThreadId, entry.Subject)
+			nWoken++
+		}
+		db.Remove(entry.ThreadId)
+		removeSnoozeLabel(gHelper, db, entry)
+	}
+	if err = db.Save(); err != nil {
+		return nWoken, err
+	}
+	return nWoken, firstErr
+}
+
+func runSnoozeWakeCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	gHelper := newSnoozeGmailHelper()
+	nWoken, err := wakeSnoozedThreads(gHelper, time.Now())
+	if nWoken > 0 {
+		prnt.HPrintf(prnt.Quietable, "Woke %d threads\n", nWoken)
+	}
+	return err
+}
+
+// ---------- list ----------------
+
+func runSnoozeListCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	db, err := loadSnoozeDb()
+	if err != nil {
+		return err
+	}
+	if len(db.Entries) == 0 {
+		prnt.HPrintln(prnt.Always, "No snoozed threads")
+		return nil
+	}
+	now := time.Now()
+	for _, entry := range db.Entries {
+		due := ""
+		if !entry.Until.After(now) {
+			due = prnt.Colorize(" (due)", "bold")
+		}
+		subject := entry.Subject
+		if subject == "" {
+			subject = "<No subject>"
+		}
+		prnt.Printf("%s%s %s %s\n", entry.Until.Format("2006-01-02 15:04"), due,
+			entry.ThreadId, subject)
+	}
+	return nil
+}
+
+var snoozeCmd = &cobra.Command{
+	Use:   "snooze MSG_ID|QUERY",
+	Short: "Archives threads until a later time",
+	Long: `Archives the thread of MSG_ID (or of every message matching QUERY), and
+labels it Snoozed/<date>, until the time given by --until. Snoozed threads are
+recorded in ~/.gmailcli/` + snoozeDbFileName + `.
+
+'snooze wake' moves threads which are due back to the inbox. Run it regularly
+(e.g. from cron), or use 'watch --wake-snoozed'.`,
+	RunE: runSnoozeCmd,
+	Args: cobra.ExactArgs(1),
+}
+
+var snoozeWakeCmd = &cobra.Command{
+	Use:   "wake",
+	Short: "Returns snoozed threads which are due to the inbox, as unread",
+	RunE:  runSnoozeWakeCmd,
+	Args:  cobra.NoArgs,
+}
+
+var snoozeListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "Lists snoozed threads",
+	Aliases: []string{"ls"},
+	RunE:    runSnoozeListCmd,
+	Args:    cobra.NoArgs,
+}
+
+func init() {
+	RootCmd.AddCommand(snoozeCmd)
+	snoozeCmd.AddCommand(snoozeWakeCmd)
+	snoozeCmd.AddCommand(snoozeListCmd)
+
+	snoozeCmd.Flags().StringVarP(&snoozeUntil, "until", "u", "",
+		"When to return the threads to the inbox (e.g. 2006-01-02T15:04, "+
+			"2006-01-02 for 08:00, 3h or 2d)")
+	snoozeCmd.Flags().Int64VarP(&snoozeMaxMsgs, "max", "m", -1,
+		"Set a max on how many messages a QUERY matches.")
+	addDryFlag(snoozeCmd)
+	addAssumeYesFlag(snoozeCmd)
+	addDryFlag(snoozeWakeCmd)
+}
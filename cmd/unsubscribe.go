@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/compose"
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+const unsubscribeLogFileName = "unsubscribe.log"
+
+var unsubscribeMaxMsgs int64
+
+// unsubGroup is the set of matching messages from a single list (or sender, for
+// messages without a List-Id).
+type unsubGroup struct {
+	ListId string
+	Sender string
+	Msgs   []*gm.Message
+	// From the most recent message, since older options may be stale
+	Options []api.UnsubscribeOption
+}
+
+func (g *unsubGroup) Name() string {
+	if g.ListId != "" {
+		return g.ListId
+	}
+	return g.Sender
+}
+
+// archiveFilter returns a filter which archives future mail for the group.
+func (g *unsubGroup) archiveFilter() *gm.Filter {
+	crit := &gm.FilterCriteria{}
+	if g.ListId != "" {
+		crit.Query = "list:" + g.ListId
+	} else {
+		crit.From = g.Sender
+	}
+	return &gm.Filter{
+		Criteria: crit,
+		Action:   &gm.FilterAction{RemoveLabelIds: []string{"INBOX"}},
+	}
+}
+
+func groupUnsubscribeMsgs(msgs []*gm.Message) []*unsubGroup {
+	groups := make(map[string]*unsubGroup)
+	var groupList []*unsubGroup
+	// Latest first, so the first message seen in each group is the newest
+	for _, msg := range api.MessagesLatestFirst(msgs) {
+		headers, err := api.GetMsgHeaders(msg)
+		if err != nil {
+			prnt.StderrLog.Printf("Skipping message %s: %v\n", msg.Id, err)
+			continue
+		}
+		key := "list:" + strings.ToLower(headers.ListId)
+		if headers.ListId == "" {
+			if headers.From.Address == "" {
+				continue
+			}
+			key = "from:" + strings.ToLower(headers.From.Address)
+		}
+		group, ok := groups[key]
+		if !ok {
+			group = &unsubGroup{
+				ListId:  headers.ListId,
+				Sender:  headers.From.Address,
+				Options: api.UnsubscribeOptions(headers),
+			}
+			groups[key] = group
+			groupList = append(groupList, group)
+		}
+		group.Msgs = append(group.Msgs, msg)
+	}
+	sort.SliceStable(groupList, func(i, j int) bool {
+		return len(groupList[i].Msgs) > len(groupList[j].Msgs)
+	})
+	return groupList
+}
+
+// ---------- Attempt log ----------------
+
+type unsubLogEntry struct {
+	Time     time.Time `json:"time"`
+	Group    string    `json:"group"`
+	Method   string    `json:"method,omitempty"`
+	Uri      string    `json:"uri,omitempty"`
+	Result   string    `json:"result"`
+	Error    string    `json:"error,omitempty"`
+	FilterId string    `json:"filterId,omitempty"`
+}
+
+// unsubLog appends a JSON line to ~/.gmailcli/unsubscribe.log for every attempt.
+type unsubLog struct {
+	f *os.File
+}
+
+func openUnsubLog() (*unsubLog, error) {
+	fname, err := util.HomeDirAndFile(util.UserAppDirName, unsubscribeLogFileName)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &unsubLog{f: f}, nil
+}
+
+func (l *unsubLog) Record(entry unsubLogEntry) {
+	entry.Time = time.Now()
+	data, err := json.Marshal(entry)
+	util.CheckErr(err)
+	if _, err = fmt.Fprintf(l.f, "%s\n", data); err != nil {
+		prnt.StderrLog.Println("Failed to write unsubscribe log:", err)
+	}
+}
+
+func (l *unsubLog) Close() error {
+	return l.f.Close()
+}
+
+// ---------- Unsubscribing ----------------
+
+// unsubscriber performs unsubscribes and filter creation, creating clients
+// for the extra scopes only when they are first needed.
+type unsubscriber struct {
+	conf       *config.Config
+	log        *unsubLog
+	sendHelper *api.MsgHelper
+	fltrHelper *GmailHelper
+}
+
+func (u *unsubscriber) sender() *api.MsgHelper {
+	if u.sendHelper == nil {
+		srv := api.NewGmailClientForOps(api.SendMessagesOp)
+		u.sendHelper = api.NewMsgHelper(api.DefaultUser, srv, false)
+	}
+	return u.sendHelper
+}
+
+func (u *unsubscriber) filterHelper() *GmailHelper {
+	if u.fltrHelper == nil {
+		srv := api.NewGmailClientForOps(filterModifyOps...)
+		u.fltrHelper = NewGmailHelper(srv, api.DefaultUser, u.conf)
+	}
+	return u.fltrHelper
+}
+
+func (u *unsubscriber) sendMailto(uri string) error {
+	msg, err := compose.FromMailto(uri)
+	if err != nil {
+		return err
+	}
+	raw, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	_, err = u.sender().SendMessage(raw, "")
+	return err
+}
+
+// Unsubscribe tries the group's options in order of preference, until one
+// succeeds. Returns true if the unsubscribe was (as far as we can tell) done.
+func (u *unsubscriber) Unsubscribe(group *unsubGroup) bool {
+	for _, opt := range group.Options {
+		entry := unsubLogEntry{
+			Group: group.Name(), Method: string(opt.Method), Uri: opt.Uri}
+		var err error
+		switch opt.Method {
+		case api.OneClickUnsubscribe:
+			err = api.PostOneClickUnsubscribe(opt.Uri)
+		case api.MailtoUnsubscribe:
+			err = u.sendMailto(opt.Uri)
+		case api.ManualUnsubscribe:
+			prnt.Hum.Always.F("Visit to unsubscribe manually: %s\n", opt.Uri)
+			entry.Result = "manual"
+			u.log.Record(entry)
+			return false
+		}
+		if err != nil {
+			prnt.StderrLog.Printf("%s unsubscribe failed: %v\n", opt.Method, err)
+			entry.Result = "failed"
+			entry.Error = err.Error()
+			u.log.Record(entry)
+			continue
+		}
+		prnt.Hum.Always.F("Unsubscribed (%s)\n", opt.Method)
+		entry.Result = "ok"
+		u.log.Record(entry)
+		return true
+	}
+	return false
+}
+
+func (u *unsubscriber) CreateArchiveFilter(group *unsubGroup) {
+	gHelper := u.filterHelper()
+	fltr := group.archiveFilter()
+	entry := unsubLogEntry{Group: group.Name(), Method: "filter"}
+	created, err := gHelper.CreateFilter(fltr)
+	if err != nil {
+		prnt.StderrLog.Println("Failed to create filter:", err)
+		entry.Result = "failed"
+		entry.Error = err.Error()
+	} else {
+		prnt.Printf("Created filter %s\n", created.Id)
+		entry.Result = "ok"
+		entry.FilterId = created.Id
+	}
+	u.log.Record(entry)
+}
+
+func printUnsubGroup(gHelper *GmailHelper, group *unsubGroup) {
+	prnt.Hum.Always.F("\n%s (%d messages)\n", group.Name(), len(group.Msgs))
+	gHelper.PrintMessage(group.Msgs[0], 3)
+	if len(group.Options) == 0 {
+		prnt.Hum.Always.Ln("   No unsubscribe options")
+	}
+	for _, opt := range group.Options {
+		prnt.Hum.Always.F("   %-9s %s\n", opt.Method, opt.Uri)
+	}
+}
+
+func runUnsubscribeCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	conf := config.AppConfig()
+
+	srv := api.NewGmailClientForOps(msgOps(false)...)
+	gHelper := NewGmailHelper(srv, api.DefaultUser, conf)
+
+	msgs, err := gHelper.Msgs.QueryMessages(
+		args[0], false, false, unsubscribeMaxMsgs, api.LabelsOnly)
+	if err != nil {
+		return err
+	}
+	groups := groupUnsubscribeMsgs(msgs)
+	if len(groups) == 0 {
+		prnt.HPrintln(prnt.Always, "No messages found")
+		return nil
+	}
+
+	ulog, err := openUnsubLog()
+	if err != nil {
+		return fmt.Errorf("Failed to open unsubscribe log: %v", err)
+	}
+	defer ulog.Close()
+	unsub := &unsubscriber{conf: conf, log: ulog}
+
+	for _, group := range groups {
+		printUnsubGroup(gHelper, group)
+		if DryRun {
+			continue
+		}
+		if len(group.Options) > 0 &&
+			MaybeConfirmFromInput(fmt.Sprintf("Unsubscribe from %s?", group.Name()), false) {
+			unsub.Unsubscribe(group)
+		}
+		if MaybeConfirmFromInput(
+			fmt.Sprintf("Create a filter to archive new mail from %s?", group.Name()), false) {
+			unsub.CreateArchiveFilter(group)
+		}
+	}
+	if DryRun {
+		prnt.LPrintln(prnt.Quietable, "\nSkipping unsubscribing (--dry provided)")
+	}
+	return nil
+}
+
+var unsubscribeCmd = &cobra.Command{
+	Use:   "unsubscribe QUERY",
+	Short: "Unsubscribes from mailing lists of messages matching the query",
+	Long: `Groups messages matching QUERY by mailing list (List-Id), or by sender for
+messages without one, and shows the List-Unsubscribe options for each group.
+
+For each confirmed group, an RFC 8058 one-click unsubscribe is used if the list
+supports it. Otherwise a mailto unsubscribe email is sent. Lists which only
+provide a web link are printed, to be visited manually.
+
+A filter which archives any further mail from the group may also be created.
+Every attempt is recorded in ~/.gmailcli/` + unsubscribeLogFileName + `.`,
+	RunE: runUnsubscribeCmd,
+	Args: cobra.ExactArgs(1),
+}
+
+func init() {
+	RootCmd.AddCommand(unsubscribeCmd)
+
+	unsubscribeCmd.Flags().Int64VarP(&unsubscribeMaxMsgs, "max", "m", -1,
+		"Set a max on how many results are queried.")
+
+	addDryFlag(unsubscribeCmd)
+	addAssumeYesFlag(unsubscribeCmd)
+}
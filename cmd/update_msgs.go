@@ -11,15 +11,23 @@ import (
 func runUpdateMsgsCmd(cmd *cobra.Command, args []string) error {
 	msgIds := args
 	if len(msgIds) == 0 {
-		fmt.Errorf("No message IDs provided")
+		return fmt.Errorf("No message IDs provided")
 	}
+	cmd.SilenceUsage = true
 
 	conf := config.AppConfig()
 	ValidateTouchOption(conf)
 
-	srv := api.NewGmailClient(api.ModifyScope)
+	srv := api.NewGmailClientForOps(CmdMsgLabelModOptions.Ops()...)
 	gHelper := NewGmailHelper(srv, api.DefaultUser, conf)
+	if err := validateLabelModOptions(gHelper, &CmdMsgLabelModOptions); err != nil {
+		return err
+	}
 
+	if ThreadMode {
+		modifyThreadLabels(gHelper, msgIds, &CmdMsgLabelModOptions)
+		return nil
+	}
 	msgIdIter := api.SizedMessageIdIteratorFromIds(msgIds)
 	modifyMsgLabelsByMsgIdIter(gHelper, msgIdIter, &CmdMsgLabelModOptions)
 
@@ -27,8 +35,11 @@ func runUpdateMsgsCmd(cmd *cobra.Command, args []string) error {
 }
 
 var updateMsgsCmd = &cobra.Command{
-	Use:     "update-msgs MSG_IDS...",
-	Short:   "Updates messages based on ID",
+	Use:   "update-msgs MSG_IDS...",
+	Short: "Updates messages based on ID",
+	Long: `Updates messages based on ID. With --threads, the IDs are thread IDs
+(as printed by 'search --threads --ids-only'), and every message in each
+thread is updated.`,
 	Aliases: []string{},
 	RunE:    runUpdateMsgsCmd,
 	Args:    cobra.MinimumNArgs(1),
@@ -37,6 +48,7 @@ var updateMsgsCmd = &cobra.Command{
 func init() {
 	RootCmd.AddCommand(updateMsgsCmd)
 
+	addThreadsFlag(updateMsgsCmd, "Treat the IDs as thread IDs, and update whole threads")
 	addLabelModFlags(updateMsgsCmd)
 	addDryFlag(updateMsgsCmd)
 	addAssumeYesFlag(updateMsgsCmd)
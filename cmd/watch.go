@@ -0,0 +1,369 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/rules"
+	"github.com/tsiemens/gmail-tools/util"
+	"github.com/tsiemens/gmail-tools/watch"
+)
+
+const (
+	watchCheckpointFileName = "watch.checkpoint"
+	watchLockFileName       = "watch.lock"
+	// How long new messages are retried for, until they can be found by search
+	watchSearchTimeout = 10 * time.Minute
+)
+
+var watchInterval time.Duration
+var watchSubscription string
+var watchReset = false
+var watchWakeSnoozed = false
+
+// watcher runs rules on messages as they arrive.
+type watcher struct {
+	gHelper *GmailHelper
+	rules   []*rules.Rule
+	cp      *watch.Checkpoint
+	rlog    *rulesLog
+}
+
+// loadNewMessages loads the messages which were added to the mailbox.
+// Messages sent or drafted by the user are skipped, as are messages which no
+// longer exist.
+func (w *watcher) loadNewMessages(ids []string) ([]*gm.Message, error) {
+	var msgs []*gm.Message
+	for _, id := range ids {
+		msg, err := w.gHelper.Msgs.GetMessage(id, api.LabelsAndPayload)
+		if api.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if util.StringSliceContains("SENT", msg.LabelIds) ||
+			util.StringSliceContains("DRAFT", msg.LabelIds) {
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// newRuleScope returns the scope which contains msgs.
+func newRuleScope(msgs []*gm.Message) *ruleScope {
+	scope := &ruleScope{Ids: make(map[string]bool)}
+	for _, msg := range msgs {
+		scope.Ids[msg.Id] = true
+		received := util.TimeFromMillis(msg.InternalDate)
+		if scope.After.IsZero() || received.Before(scope.After) {
+			scope.After = received
+		}
+	}
+	// after: is exclusive, and only has second granularity
+	scope.After = scope.After.Add(-time.Minute)
+	return scope
+}
+
+// searchableMessages splits msgs into those which can be found by search, and
+// the IDs of those which cannot yet. Rules are matched with queries, and new
+// messages may take a few seconds to be indexed.
+func (w *watcher) searchableMessages(msgs []*gm.Message,
+) ([]*gm.Message, []string, error) {
+	scope := newRuleScope(msgs)
+	found, err := w.gHelper.Msgs.QueryMessages(
+		fmt.Sprintf("in:anywhere after:%d", scope.After.Unix()),
+		false, false, -1, api.IdsOnly)
+	if err != nil {
+		return nil, nil, err
+	}
+	foundIds := make(map[string]bool)
+	for _, msg := range found {
+		foundIds[msg.Id] = true
+	}
+	var searchable []*gm.Message
+	var notFound []string
+	for _, msg := range msgs {
+		if foundIds[msg.Id] {
+			searchable = append(searchable, msg)
+		} else {
+			notFound = append(notFound, msg.Id)
+		}
+	}
+	return searchable, notFound, nil
+}
+
+// processNewMessages runs the rules on messages which arrived since the
+// checkpoint, and then advances the checkpoint. Messages which cannot be found
+// by search yet are kept pending in the checkpoint, and retried next time.
+func (w *watcher) processNewMessages() error {
+	ids, historyId, err := w.gHelper.Msgs.AddedMessageIdsSince(w.cp.HistoryId)
+	if err == api.ErrHistoryExpired {
+		historyId, err = w.gHelper.Msgs.CurrentHistoryId()
+		if err != nil {
+			return err
+		}
+		prnt.StderrLog.Printf("History since %s is no longer available. "+
+			"Messages which arrived before now will not be processed.\n",
+			w.cp.Time.Format(time.RFC3339))
+		return w.cp.Update(historyId)
+	} else if err != nil {
+		return err
+	}
+
+	for _, id := range w.cp.PendingIds() {
+		if !util.StringSliceContains(id, ids) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		if historyId != w.cp.HistoryId {
+			return w.cp.Update(historyId)
+		}
+		return nil
+	}
+
+	// Labels and messages may have changed since the last batch
+	w.gHelper.Msgs.Forget()
+	msgs, err := w.loadNewMessages(ids)
+	if err != nil {
+		return err
+	}
+	var notFound []string
+	if len(msgs) > 0 {
+		if msgs, notFound, err = w.searchableMessages(msgs); err != nil {
+			return err
+		}
+	}
+	if len(msgs) > 0 {
+		w.handleMessages(msgs)
+	}
+	expired := w.cp.SetPending(notFound, time.Now(), watchSearchTimeout)
+	if len(expired) > 0 {
+		prnt.StderrLog.Printf("Messages %v could not be found by search after %v, "+
+			"and will not be processed\n", expired, watchSearchTimeout)
+	}
+	return w.cp.Update(historyId)
+}
+
+func (w *watcher) handleMessages(msgs []*gm.Message) {
+	prnt.HPrintf(prnt.Quietable, "%s: %d new messages\n",
+		time.Now().Format(time.RFC3339), len(msgs))
+	if !Quiet {
+		for _, msg := range msgs {
+			w.gHelper.PrintMessage(msg, 2)
+		}
+	}
+	if len(w.rules) > 0 {
+		runRules(w.gHelper, w.rules, newRuleScope(msgs), w.rlog)
+	}
+}
+
+// pullNotifications triggers processing whenever a Gmail push notification is
+// received from the Pub/Sub subscription.
+func pullNotifications(puller *watch.PubSubPuller, trigger func()) {
+	backoff := watch.Backoff{Min: 5 * time.Second, Max: 5 * time.Minute}
+	for {
+		msgs, err := puller.Pull(10)
+		if err != nil {
+			wait := backoff.Next()
+			prnt.StderrLog.Printf("%v (retrying in %v)\n", err, wait)
+			time.Sleep(wait)
+			continue
+		}
+		backoff.Reset()
+		for _, m := range msgs {
+			if n, err := watch.ParseGmailNotification(m.Data); err == nil {
+				prnt.Deb.Ln("Notification for history ID", n.HistoryId)
+			} else {
+				prnt.StderrLog.Println(err)
+			}
+		}
+		if len(msgs) > 0 {
+			trigger()
+		}
+		// New messages are found from the checkpoint, so the notifications
+		// are no longer needed, even if processing fails.
+		if err = puller.Ack(msgs); err != nil {
+			prnt.StderrLog.Println("Failed to acknowledge notifications:", err)
+		}
+	}
+}
+
+func runWatchCmd(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	if watchInterval < time.Second {
+		return fmt.Errorf("--interval must be at least 1s")
+	}
+
+	conf := config.AppConfig()
+	var rs []*rules.Rule
+	if len(args) > 0 || len(conf.Rules) > 0 {
+		var err error
+		if rs, err = loadRules(args); err != nil {
+			return err
+		}
+	}
+
+	var puller *watch.PubSubPuller
+	if watchSubscription != "" {
+		var err error
+		puller, err = watch.NewPubSubPuller(
+			os.Getenv(watch.PubSubEmulatorHostEnv), watchSubscription)
+		if err != nil {
+			return err
+		}
+	}
+
+	lockFname, err := util.HomeDirAndFile(util.UserAppDirName, watchLockFileName)
+	if err != nil {
+		return err
+	}
+	lock, err := rules.AcquireLock(lockFname)
+	if err != nil {
+		return err
+	}
+	util.RegisterCleanupHandler(lock, func() { lock.Release() })
+	if len(rs) > 0 && !DryRun {
+		// Rules must not be run by 'rules run' or 'rules daemon' at the same time
+		rulesLock, err := acquireRulesLock()
+		if err != nil {
+			return err
+		}
+		util.RegisterCleanupHandler(rulesLock, func() { rulesLock.Release() })
+	}
+
+	cpFname, err := util.HomeDirAndFile(util.UserAppDirName, watchCheckpointFileName)
+	if err != nil {
+		return err
+	}
+	cp, err := watch.LoadCheckpoint(cpFname)
+	if err != nil {
+		return fmt.Errorf("Failed to load %s: %v", cpFname, err)
+	}
+
+	rlog, err := openRulesLog()
+	if err != nil {
+		return fmt.Errorf("Failed to open rules log: %v", err)
+	}
+	util.RegisterCleanupHandler(rlog, func() { rlog.Close() })
+
+	// Nobody is around to answer prompts
+	AssumeYes = true
+
+	ops := rulesOps(rs)
+	if watchWakeSnoozed && !DryRun {
+		ops = append(ops, snoozeOps...)
+	}
+	srv := api.NewGmailClientForOps(ops...)
+	gHelper := NewGmailHelper(srv, api.DefaultUser, conf)
+
+	if cp.HistoryId == 0 || watchReset {
+		historyId, err := gHelper.Msgs.CurrentHistoryId()
+		if err != nil {
+			return err
+		}
+		if err = cp.Update(historyId); err != nil {
+			return err
+		}
+		prnt.HPrintln(prnt.Quietable, "Watching for messages from now")
+	} else {
+		prnt.HPrintf(prnt.Quietable, "Watching for messages since %s\n",
+			cp.Time.Format(time.RFC3339))
+	}
+
+	w := &watcher{gHelper: gHelper, rules: rs, cp: cp, rlog: rlog}
+
+	done := interrupted()
+
+	triggers := make(chan bool, 1)
+	trigger := func() {
+		select {
+		case triggers <- true:
+		default:
+			// Already pending
+		}
+	}
+	if puller != nil {
+		go pullNotifications(puller, trigger)
+	}
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	backoff := watch.Backoff{Min: 5 * time.Second, Max: 5 * time.Minute}
+	trigger()
+	for {
+		select {
+		case <-done:
+			// Cleanup handlers are run once the command returns
+			prnt.HPrintln(prnt.Quietable, "Interrupted, exiting")
+			return nil
+		case <-triggers:
+		case <-ticker.C:
+		}
+
+		if err := w.processNewMessages(); err != nil {
+			wait := backoff.Next()
+			prnt.StderrLog.Printf("%v (retrying in %v)\n", err, wait)
+			select {
+			case <-done:
+				prnt.HPrintln(prnt.Quietable, "Interrupted, exiting")
+				return nil
+			case <-time.After(wait):
+			}
+			trigger()
+			continue
+		}
+		backoff.Reset()
+
+		if watchWakeSnoozed {
+			if _, err := wakeSnoozedThreads(gHelper, time.Now()); err != nil {
+				prnt.StderrLog.Println("Failed to wake snoozed threads:", err)
+			}
+		}
+	}
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [RULE...]",
+	Short: "Runs rules on new messages as they arrive",
+	Long: `Watches the mailbox history for new messages, and runs the named rules
+(or all rules) from config.yaml on them as they arrive. Rule Schedules are
+ignored. Rules are matched with their queries, so each message is handled once
+search can find it, which may take a few seconds after it arrives. Messages
+which search cannot find within 10 minutes are skipped.
+
+The mailbox is polled every --interval. With --subscription, Gmail push
+notifications are also pulled from a Pub/Sub subscription on the emulator at
+$` + watch.PubSubEmulatorHostEnv + `, so that new messages are handled as soon
+as they arrive.
+
+Progress is saved in ~/.gmailcli/` + watchCheckpointFileName + `, so that
+messages which arrive while watch is not running are handled when it restarts.
+
+While watch runs rules (other than with --dry), 'rules run' and 'rules daemon'
+cannot run, as with ~/.gmailcli/` + rulesLockFileName + `.`,
+	RunE: runWatchCmd,
+}
+
+func init() {
+	RootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 30*time.Second,
+		"How often to poll for new messages")
+	watchCmd.Flags().StringVar(&watchSubscription, "subscription", "",
+		"Pub/Sub subscription to pull notifications from "+
+			"(projects/PROJECT/subscriptions/NAME)")
+	watchCmd.Flags().BoolVar(&watchReset, "reset", false,
+		"Ignore the saved checkpoint, and only watch for messages from now")
+	watchCmd.Flags().BoolVar(&watchWakeSnoozed, "wake-snoozed", false,
+		"Also return snoozed threads to the inbox when they are due (as 'snooze wake')")
+	addDryFlag(watchCmd)
+}
@@ -0,0 +1,305 @@
+// Package compose builds RFC 5322 messages to be sent through the API.
+package compose
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Header struct {
+	Name  string
+	Value string
+}
+
+type Attachment struct {
+	Filename string
+	// Detected from Filename or Data if empty
+	MimeType string
+	Data     []byte
+}
+
+type Message struct {
+	// Addresses may include display names, e.g. "Ann Smith <ann@x.com>"
+	From    string
+	To      []string
+	Cc      []string
+	Bcc     []string
+	Subject string
+	// Plain text body
+	Body string
+	// Optional HTML alternative to Body
+	HtmlBody    string
+	Attachments []*Attachment
+
+	// Message IDs, including angle brackets. Set these for replies so that
+	// clients can thread the message.
+	InReplyTo  []string
+	References []string
+	// Not a header. The API thread to add the message to, if any.
+	ThreadId string
+
+	// Defaults to the time the message is built
+	Date time.Time
+	// Extra headers, written after the standard ones
+	ExtraHeaders []Header
+}
+
+// AttachFile reads fname and adds it as an attachment.
+func (m *Message) AttachFile(fname string) error {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	m.Attachments = append(m.Attachments,
+		&Attachment{Filename: filepath.Base(fname), Data: data})
+	return nil
+}
+
+func (a *Attachment) mimeType() string {
+	if a.MimeType != "" {
+		return a.MimeType
+	}
+	if t := mime.TypeByExtension(filepath.Ext(a.Filename)); t != "" {
+		return t
+	}
+	return http.DetectContentType(a.Data)
+}
+
+// formatAddressList validates and encodes addresses for use in a header.
+func formatAddressList(addrs []string) (string, error) {
+	formatted := make([]string, 0, len(addrs))
+	for _, addrStr := range addrs {
+		list, err := mail.ParseAddressList(addrStr)
+		if err != nil {
+			return "", fmt.Errorf("Invalid address '%s': %v", addrStr, err)
+		}
+		for _, addr := range list {
+			formatted = append(formatted, addr.String())
+		}
+	}
+	return strings.Join(formatted, ", "), nil
+}
+
+// EncodeHeaderValue encodes val as RFC 2047 encoded-words if it is not plain
+// ASCII.
+func EncodeHeaderValue(val string) string {
+	return mime.QEncoding.Encode("utf-8", val)
+}
+
+func newMessageIdDomain(from string) string {
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndex(addr.Address, "@"); i >= 0 {
+			return addr.Address[i+1:]
+		}
+	}
+	return "gmailcli.local"
+}
+
+// NewMessageId generates a unique Message-ID, in angle brackets.
+func NewMessageId(from string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b),
+		newMessageIdDomain(from))
+}
+
+type headerWriter struct {
+	buf *bytes.Buffer
+	err error
+}
+
+func (w *headerWriter) write(name, value string) {
+	if value != "" {
+		fmt.Fprintf(w.buf, "%s: %s\r\n", name, value)
+	}
+}
+
+func (w *headerWriter) writeAddrs(name string, addrs []string) {
+	if w.err != nil || len(addrs) == 0 {
+		return
+	}
+	val, err := formatAddressList(addrs)
+	if err != nil {
+		w.err = fmt.Errorf("%s: %v", name, err)
+		return
+	}
+	w.write(name, val)
+}
+
+// writeHeaders writes the headers common to all message structures.
+func (m *Message) writeHeaders(buf *bytes.Buffer) error {
+	w := &headerWriter{buf: buf}
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	w.write("Date", date.Format(time.RFC1123Z))
+	if m.From != "" {
+		// Gmail fills in the account's address if From is missing
+		w.writeAddrs("From", []string{m.From})
+	}
+	w.writeAddrs("To", m.To)
+	w.writeAddrs("Cc", m.Cc)
+	w.writeAddrs("Bcc", m.Bcc)
+	w.write("Subject", EncodeHeaderValue(m.Subject))
+	w.write("Message-ID", NewMessageId(m.From))
+	w.write("In-Reply-To", strings.Join(m.InReplyTo, " "))
+	w.write("References", strings.Join(m.References, " "))
+	for _, hdr := range m.ExtraHeaders {
+		w.write(hdr.Name, hdr.Value)
+	}
+	w.write("MIME-Version", "1.0")
+	return w.err
+}
+
+func writeQuotedPrintable(buf *bytes.Buffer, text string) error {
+	qpw := quotedprintable.NewWriter(buf)
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	if _, err := qpw.Write([]byte(strings.Replace(text, "\n", "\r\n", -1))); err != nil {
+		return err
+	}
+	return qpw.Close()
+}
+
+func textPartHeader(contentType string) textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", contentType+"; charset=utf-8")
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	return h
+}
+
+// writeBase64 writes data in base64, wrapped at 76 characters.
+func writeBase64(buf *bytes.Buffer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76])
+		buf.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded)
+}
+
+// entity is a MIME entity: its headers, and a function to write its body.
+// Bodies should not end with a line break of their own, since within a
+// multipart body it would become part of the content.
+type entity struct {
+	header    textproto.MIMEHeader
+	writeBody func(buf *bytes.Buffer) error
+}
+
+func textEntity(contentType, text string) *entity {
+	return &entity{
+		header:    textPartHeader(contentType),
+		writeBody: func(buf *bytes.Buffer) error { return writeQuotedPrintable(buf, text) },
+	}
+}
+
+func attachmentEntity(att *Attachment) *entity {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", mime.FormatMediaType(att.mimeType(),
+		map[string]string{"name": att.Filename}))
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": att.Filename}))
+	if strings.HasPrefix(att.mimeType(), "message/") {
+		// message/* parts may not be base64 encoded (RFC 2046)
+		h.Set("Content-Transfer-Encoding", "8bit")
+		return &entity{header: h, writeBody: func(buf *bytes.Buffer) error {
+			buf.Write(att.Data)
+			return nil
+		}}
+	}
+	h.Set("Content-Transfer-Encoding", "base64")
+	return &entity{header: h, writeBody: func(buf *bytes.Buffer) error {
+		writeBase64(buf, att.Data)
+		return nil
+	}}
+}
+
+func multipartEntity(subtype string, parts []*entity) *entity {
+	// Only used for its random boundary
+	boundary := multipart.NewWriter(nil).Boundary()
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", mime.FormatMediaType("multipart/"+subtype,
+		map[string]string{"boundary": boundary}))
+	return &entity{header: h, writeBody: func(buf *bytes.Buffer) error {
+		mw := multipart.NewWriter(buf)
+		if err := mw.SetBoundary(boundary); err != nil {
+			return err
+		}
+		for _, part := range parts {
+			pw, err := mw.CreatePart(part.header)
+			if err != nil {
+				return err
+			}
+			var partBuf bytes.Buffer
+			if err = part.writeBody(&partBuf); err != nil {
+				return err
+			}
+			if _, err = pw.Write(partBuf.Bytes()); err != nil {
+				return err
+			}
+		}
+		return mw.Close()
+	}}
+}
+
+// writeTo writes the entity's headers and body.
+func (e *entity) writeTo(buf *bytes.Buffer) error {
+	for _, name := range []string{
+		"Content-Type", "Content-Disposition", "Content-Transfer-Encoding"} {
+		if val := e.header.Get(name); val != "" {
+			fmt.Fprintf(buf, "%s: %s\r\n", name, val)
+		}
+	}
+	buf.WriteString("\r\n")
+	return e.writeBody(buf)
+}
+
+// bodyEntity returns the entity for the full message body, according to what
+// content the message has.
+func (m *Message) bodyEntity() *entity {
+	body := textEntity("text/plain", m.Body)
+	if m.HtmlBody != "" {
+		body = multipartEntity("alternative",
+			[]*entity{body, textEntity("text/html", m.HtmlBody)})
+	}
+	if len(m.Attachments) == 0 {
+		return body
+	}
+	parts := []*entity{body}
+	for _, att := range m.Attachments {
+		parts = append(parts, attachmentEntity(att))
+	}
+	return multipartEntity("mixed", parts)
+}
+
+// Bytes renders the full message.
+func (m *Message) Bytes() ([]byte, error) {
+	if len(m.To) == 0 && len(m.Cc) == 0 && len(m.Bcc) == 0 {
+		return nil, fmt.Errorf("Message has no recipients")
+	}
+	var buf bytes.Buffer
+	if err := m.writeHeaders(&buf); err != nil {
+		return nil, err
+	}
+	if err := m.bodyEntity().writeTo(&buf); err != nil {
+		return nil, err
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\r\n")) {
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,51 @@
+package compose
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// FromMailto builds a message from a mailto URI (RFC 6068), such as those
+// found in List-Unsubscribe headers. The From address is left empty.
+func FromMailto(uri string) (*Message, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(u.Scheme, "mailto") {
+		return nil, fmt.Errorf("Not a mailto URI: %s", uri)
+	}
+
+	msg := &Message{}
+	if u.Opaque != "" {
+		to, err := url.PathUnescape(u.Opaque)
+		if err != nil {
+			return nil, err
+		}
+		msg.To = append(msg.To, to)
+	}
+	for key, vals := range u.Query() {
+		for _, val := range vals {
+			switch strings.ToLower(key) {
+			case "to":
+				msg.To = append(msg.To, val)
+			case "cc":
+				msg.Cc = append(msg.Cc, val)
+			case "bcc":
+				msg.Bcc = append(msg.Bcc, val)
+			case "subject":
+				msg.Subject = val
+			case "body":
+				msg.Body = val
+			}
+		}
+	}
+	if len(msg.To) == 0 {
+		return nil, fmt.Errorf("mailto URI has no recipient: %s", uri)
+	}
+	if msg.Subject == "" {
+		msg.Subject = "unsubscribe"
+	}
+	return msg, nil
+}
@@ -0,0 +1,108 @@
+package compose
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/tsiemens/gmail-tools/api"
+)
+
+var replyPrefixRegexp = regexp.MustCompile(`(?i)^\s*re\s*:`)
+var forwardPrefixRegexp = regexp.MustCompile(`(?i)^\s*(fwd?|fw)\s*:`)
+
+func ReplySubject(subject string) string {
+	if replyPrefixRegexp.MatchString(subject) {
+		return subject
+	}
+	return "Re: " + subject
+}
+
+func ForwardSubject(subject string) string {
+	if forwardPrefixRegexp.MatchString(subject) {
+		return subject
+	}
+	return "Fwd: " + subject
+}
+
+// ReplyReferences returns the References for a reply to a message with the
+// given headers: the original's references (or In-Reply-To, if it has none),
+// followed by its Message-ID.
+func ReplyReferences(orig *api.Headers) []string {
+	refs := orig.References
+	if len(refs) == 0 {
+		refs = orig.InReplyTo
+	}
+	refs = append([]string{}, refs...)
+	if orig.MessageId != "" {
+		refs = append(refs, orig.MessageId)
+	}
+	return refs
+}
+
+func addressStrings(addrs []api.EmailAddress, exclude map[string]bool) []string {
+	var strs []string
+	for _, addr := range addrs {
+		key := strings.ToLower(addr.Address)
+		if addr.Address == "" || exclude[key] {
+			continue
+		}
+		exclude[key] = true
+		if addr.Name == "" {
+			strs = append(strs, addr.Address)
+		} else {
+			// Quotes names with commas and other special characters
+			strs = append(strs,
+				(&mail.Address{Name: addr.Name, Address: addr.Address}).String())
+		}
+	}
+	return strs
+}
+
+// NewReply creates a reply to the message with headers orig, in thread
+// threadId. The reply goes to the original's Reply-To (or From) address. If
+// all is true, the original To and Cc recipients are copied as well, other
+// than self (the account's own address).
+func NewReply(orig *api.Headers, threadId string, self string, all bool) *Message {
+	exclude := map[string]bool{strings.ToLower(self): true}
+	replyTo := orig.ReplyTo
+	if len(replyTo) == 0 {
+		replyTo = []api.EmailAddress{orig.From}
+	}
+	msg := &Message{
+		Subject:    ReplySubject(orig.Subject),
+		ThreadId:   threadId,
+		References: ReplyReferences(orig),
+	}
+	if orig.MessageId != "" {
+		msg.InReplyTo = []string{orig.MessageId}
+	}
+	// Replying to one's own message goes to its original recipients, or back
+	// to self if it was only sent to self.
+	if len(replyTo) == 1 && strings.EqualFold(replyTo[0].Address, self) {
+		msg.To = addressStrings(orig.To, exclude)
+		if len(msg.To) == 0 {
+			msg.To = []string{self}
+		}
+	} else {
+		msg.To = addressStrings(replyTo, exclude)
+	}
+	if all {
+		msg.Cc = addressStrings(append(append([]api.EmailAddress{}, orig.To...),
+			orig.Cc...), exclude)
+	}
+	return msg
+}
+
+// NewForward creates a message forwarding the original message (in its raw,
+// RFC 2822 form) as a message/rfc822 attachment.
+func NewForward(orig *api.Headers, raw []byte) *Message {
+	return &Message{
+		Subject: ForwardSubject(orig.Subject),
+		Attachments: []*Attachment{{
+			Filename: "forwarded-message.eml",
+			MimeType: "message/rfc822",
+			Data:     raw,
+		}},
+	}
+}
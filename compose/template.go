@@ -0,0 +1,99 @@
+package compose
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// OrigData describes the message being replied to or forwarded, for templates.
+type OrigData struct {
+	MessageId   string
+	ThreadId    string
+	Subject     string
+	From        string
+	FromName    string
+	FromAddress string
+	// Formatted as RFC 1123Z
+	Date string
+	// The original plain text body
+	Body string
+}
+
+// TemplateData is passed to subject and body templates.
+type TemplateData struct {
+	// Variables given by the user (e.g. with --var name=value)
+	Vars map[string]string
+	// nil when composing a new message
+	Orig *OrigData
+}
+
+// QuoteText prefixes each line of text with "> ".
+func QuoteText(text string) string {
+	lines := strings.Split(strings.TrimRight(text, "\r\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "> " + strings.TrimRight(line, "\r")
+	}
+	return strings.Join(lines, "\n")
+}
+
+var templateFuncs = template.FuncMap{
+	"quote": QuoteText,
+	// Returns the variable, or def if it is not set
+	"var": func(data *TemplateData, name string, def string) string {
+		if val, ok := data.Vars[name]; ok {
+			return val
+		}
+		return def
+	},
+}
+
+// Template is a parsed subject or body template, which may be rendered for
+// any number of messages.
+type Template struct {
+	name string
+	tmpl *template.Template
+}
+
+// ParseTemplate parses tmplText as a Go text/template. Missing variables are
+// an error when it is rendered, rather than being silently left blank.
+func ParseTemplate(name string, tmplText string) (*Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).
+		Option("missingkey=error").Parse(tmplText)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s template: %v", name, err)
+	}
+	return &Template{name: name, tmpl: tmpl}, nil
+}
+
+// Render executes the template with data.
+func (t *Template) Render(data *TemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("Failed to render %s template: %v", t.name, err)
+	}
+	return buf.String(), nil
+}
+
+// RenderTemplate parses and executes tmplText with data (see ParseTemplate).
+func RenderTemplate(name string, tmplText string, data *TemplateData) (string, error) {
+	tmpl, err := ParseTemplate(name, tmplText)
+	if err != nil {
+		return "", err
+	}
+	return tmpl.Render(data)
+}
+
+// ParseVars parses "name=value" assignments into a map.
+func ParseVars(assignments []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, a := range assignments {
+		parts := strings.SplitN(a, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid variable '%s'. Expected name=value", a)
+		}
+		vars[parts[0]] = parts[1]
+	}
+	return vars, nil
+}
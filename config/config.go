@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
@@ -8,7 +9,10 @@ import (
 
 	"gopkg.in/yaml.v2"
 
+	"github.com/tsiemens/gmail-tools/plugin"
 	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/retention"
+	"github.com/tsiemens/gmail-tools/rules"
 	"github.com/tsiemens/gmail-tools/util"
 )
 
@@ -19,13 +23,16 @@ const (
 )
 
 type Config struct {
-	InterestingMessageQuery          string            `yaml:"InterestingMessageQuery"`
-	AlwaysUninterestingLabelPatterns []string          `yaml:"AlwaysUninterestingLabelPatterns"`
-	UninterestingLabelPatterns       []string          `yaml:"UninterestingLabelPatterns"`
-	InterestingLabelPatterns         []string          `yaml:"InterestingLabelPatterns"`
-	ApplyLabelOnTouch                string            `yaml:"ApplyLabelOnTouch"`
-	LabelColors                      map[string]string `yaml:"LabelColors"`
-	Aliases                          map[string]string `yaml:"Aliases"`
+	InterestingMessageQuery          string               `yaml:"InterestingMessageQuery"`
+	AlwaysUninterestingLabelPatterns []string             `yaml:"AlwaysUninterestingLabelPatterns"`
+	UninterestingLabelPatterns       []string             `yaml:"UninterestingLabelPatterns"`
+	InterestingLabelPatterns         []string             `yaml:"InterestingLabelPatterns"`
+	ApplyLabelOnTouch                string               `yaml:"ApplyLabelOnTouch"`
+	LabelColors                      map[string]string    `yaml:"LabelColors"`
+	Aliases                          map[string]string    `yaml:"Aliases"`
+	Rules                            []rules.Rule         `yaml:"Rules"`
+	Retention                        []retention.Policy   `yaml:"Retention"`
+	Plugins                          plugin.PluginsConfig `yaml:"Plugins"`
 
 	AlwaysUninterLabelRegexps []*regexp.Regexp
 	UninterLabelRegexps       []*regexp.Regexp
@@ -74,6 +81,32 @@ func LoadConfigInto(confOut interface{}) string {
 	return confFname
 }
 
+// The PluginConfig section of config.yaml, which has a section for each plugin
+// by its ID.
+type pluginConfigSection struct {
+	PluginConfig map[string]yaml.MapSlice `yaml:"PluginConfig"`
+}
+
+// LoadPluginConfigInto loads the section of PluginConfig for the plugin with
+// pluginId into confOut, which should be marked up for yaml unmarshaling.
+// confOut is unchanged if the plugin has no section.
+func LoadPluginConfigInto(pluginId string, confOut interface{}) error {
+	conf := &pluginConfigSection{}
+	LoadConfigInto(conf)
+	section, ok := conf.PluginConfig[pluginId]
+	if !ok {
+		return nil
+	}
+	data, err := yaml.Marshal(section)
+	if err != nil {
+		return err
+	}
+	if err = yaml.Unmarshal(data, confOut); err != nil {
+		return fmt.Errorf("Invalid PluginConfig for %s: %v", pluginId, err)
+	}
+	return nil
+}
+
 func UserFriendlyMustCompile(pattern string, attrName string, configComponent string) *regexp.Regexp {
 	re, err := regexp.Compile(pattern)
 	if err != nil {
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Config keys which hold label regexp patterns
+var labelPatternKeys = []string{
+	"AlwaysUninterestingLabelPatterns",
+	"UninterestingLabelPatterns",
+	"InterestingLabelPatterns",
+}
+
+// ConfigChange describes a single value changed in the config file.
+type ConfigChange struct {
+	Key string
+	Old string
+	New string
+}
+
+func (c ConfigChange) String() string {
+	return fmt.Sprintf("%s: %q -> %q", c.Key, c.Old, c.New)
+}
+
+type labelRenamer struct {
+	label    string
+	newLabel string
+	// Rewrites label: terms in queries
+	renameQuery func(string) string
+	changes     []ConfigChange
+}
+
+func (r *labelRenamer) renameLabel(name string) string {
+	if name == r.label || strings.HasPrefix(name, r.label+"/") {
+		return r.newLabel + strings.TrimPrefix(name, r.label)
+	}
+	return name
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || ('0' <= b && b <= '9') || ('a' <= b && b <= 'z') ||
+		('A' <= b && b <= 'Z')
+}
+
+// renamePattern replaces the label in a regexp pattern, where it appears as a
+// whole name (so "Work" is not replaced in "Workshop"). Patterns are matched
+// case-insensitively, so the label is found the same way.
+func (r *labelRenamer) renamePattern(pattern string) string {
+	quoted := regexp.QuoteMeta(r.label)
+	reStr := `(?i)` + regexp.QuoteMeta(quoted)
+	if isWordByte(r.label[0]) {
+		reStr = `\b` + reStr
+	}
+	if isWordByte(r.label[len(r.label)-1]) {
+		reStr += `\b`
+	}
+	re := regexp.MustCompile(reStr)
+	return re.ReplaceAllLiteralString(pattern, regexp.QuoteMeta(r.newLabel))
+}
+
+func (r *labelRenamer) setScalar(key string, node *yamlv3.Node, newVal string) {
+	if node.Value != newVal {
+		r.changes = append(r.changes, ConfigChange{Key: key, Old: node.Value, New: newVal})
+		node.Value = newVal
+	}
+}
+
+func (r *labelRenamer) renameInRoot(root *yamlv3.Node) {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key := root.Content[i].Value
+		val := root.Content[i+1]
+		switch {
+		case key == "LabelColors" && val.Kind == yamlv3.MappingNode:
+			for j := 0; j+1 < len(val.Content); j += 2 {
+				keyNode := val.Content[j]
+				r.setScalar(key, keyNode, r.renameLabel(keyNode.Value))
+			}
+		case key == "ApplyLabelOnTouch" && val.Kind == yamlv3.ScalarNode:
+			r.setScalar(key, val, r.renameLabel(val.Value))
+		case key == "InterestingMessageQuery" && val.Kind == yamlv3.ScalarNode:
+			if r.renameQuery != nil {
+				r.setScalar(key, val, r.renameQuery(val.Value))
+			}
+		case val.Kind == yamlv3.SequenceNode && isLabelPatternKey(key):
+			for _, item := range val.Content {
+				if item.Kind == yamlv3.ScalarNode {
+					r.setScalar(key, item, r.renamePattern(item.Value))
+				}
+			}
+		}
+	}
+}
+
+func isLabelPatternKey(key string) bool {
+	for _, k := range labelPatternKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// RenameLabelInConfigData rewrites references to label (and its children) in
+// config file content: LabelColors, ApplyLabelOnTouch, the label patterns,
+// and (with renameQuery) InterestingMessageQuery. Comments and ordering are
+// preserved. Returns the new content, and the changes made.
+func RenameLabelInConfigData(data []byte, label, newLabel string,
+	renameQuery func(string) string) ([]byte, []ConfigChange, error) {
+
+	if label == "" {
+		return nil, nil, fmt.Errorf("Empty label name")
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		// Empty config
+		return data, nil, nil
+	}
+
+	r := &labelRenamer{label: label, newLabel: newLabel, renameQuery: renameQuery}
+	r.renameInRoot(doc.Content[0])
+	if len(r.changes) == 0 {
+		return data, nil, nil
+	}
+
+	var buf bytes.Buffer
+	enc := yamlv3.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), r.changes, nil
+}
+
+// RenameLabelInConfigFile applies RenameLabelInConfigData to the config file.
+// If dryRun is true, the changes are returned but not written.
+func RenameLabelInConfigFile(fname, label, newLabel string,
+	renameQuery func(string) string, dryRun bool) ([]ConfigChange, error) {
+
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	newData, changes, err := RenameLabelInConfigData(data, label, newLabel, renameQuery)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %v", fname, err)
+	}
+	if len(changes) == 0 || dryRun {
+		return changes, nil
+	}
+
+	tmpName := fname + ".tmp"
+	if err = os.WriteFile(tmpName, newData, 0600); err != nil {
+		return nil, err
+	}
+	return changes, os.Rename(tmpName, fname)
+}
@@ -0,0 +1,233 @@
+// Package dedupe finds duplicate copies of messages, such as those received
+// through both a mailing list and an alias.
+package dedupe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/mime"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+// Policy chooses which message of a group of duplicates to keep
+type Policy string
+
+const (
+	KeepOldest     Policy = "oldest"
+	KeepMostLabels Policy = "most-labels"
+	KeepInbox      Policy = "inbox"
+)
+
+var Policies = []Policy{KeepOldest, KeepMostLabels, KeepInbox}
+
+const (
+	messageIdKeyPrefix = "id:"
+	contentKeyPrefix   = "body:"
+)
+
+// ParsePolicy parses the name of a policy. The default is KeepOldest.
+func ParsePolicy(s string) (Policy, error) {
+	if s == "" {
+		return KeepOldest, nil
+	}
+	for _, p := range Policies {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("Invalid keep policy '%s'. Expected one of %v", s, Policies)
+}
+
+// Config is the dedupe section of PluginConfig in config.yaml
+type Config struct {
+	// The default policy for which message of a group to keep
+	Keep string `yaml:"Keep"`
+}
+
+// MessageIdKey returns the key of m by its Message-ID header, or "" if it has
+// none. m must be loaded with at least api.LabelsOnly.
+func MessageIdKey(m *gm.Message) string {
+	headers, err := api.GetMsgHeaders(m)
+	if err != nil || headers.MessageId == "" {
+		return ""
+	}
+	return messageIdKeyPrefix + headers.MessageId
+}
+
+func normalizeText(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// ContentKey returns the key of m by a hash of its normalized subject and
+// body, or "" if it has no body. m must be loaded with api.LabelsAndPayload.
+func ContentKey(m *gm.Message) (string, error) {
+	if m.Payload == nil {
+		return "", fmt.Errorf("Message %s is not loaded with its payload", m.Id)
+	}
+	mimeMsg, err := mime.Parse(m.Payload)
+	if err != nil {
+		return "", err
+	}
+	body := normalizeText(mimeMsg.PreferredText())
+	if body == "" {
+		return "", nil
+	}
+	subject := ""
+	if headers, err := api.GetMsgHeaders(m); err == nil {
+		subject = normalizeText(headers.Subject)
+	}
+	sum := sha256.Sum256([]byte(subject + "\n" + body))
+	return contentKeyPrefix + hex.EncodeToString(sum[:16]), nil
+}
+
+// Group is a set of copies of the same message
+type Group struct {
+	Key        string
+	Keep       *gm.Message
+	Duplicates []*gm.Message
+}
+
+// Describe returns what the messages of the group have in common
+func (g *Group) Describe() string {
+	if strings.HasPrefix(g.Key, messageIdKeyPrefix) {
+		return "Message-ID " + strings.TrimPrefix(g.Key, messageIdKeyPrefix)
+	}
+	return "Content hash " + strings.TrimPrefix(g.Key, contentKeyPrefix)[:12]
+}
+
+// KeyFunc returns the key shared by copies of m, or "" if it has none.
+type KeyFunc func(m *gm.Message) (string, error)
+
+// preferred returns whether a should be kept over b
+func preferred(a, b *gm.Message, policy Policy) bool {
+	switch policy {
+	case KeepMostLabels:
+		if len(a.LabelIds) != len(b.LabelIds) {
+			return len(a.LabelIds) > len(b.LabelIds)
+		}
+	case KeepInbox:
+		aInbox := util.StringSliceContains("INBOX", a.LabelIds)
+		if aInbox != util.StringSliceContains("INBOX", b.LabelIds) {
+			return aInbox
+		}
+	}
+	if a.InternalDate != b.InternalDate {
+		return a.InternalDate < b.InternalDate
+	}
+	return a.Id < b.Id
+}
+
+// FindGroups groups msgs which share a key, and chooses the message to keep
+// in each with policy. Groups are in the order of their first message in
+// msgs. Messages without a key, or without copies, are not in any group.
+func FindGroups(msgs []*gm.Message, key KeyFunc, policy Policy) ([]*Group, error) {
+	var keys []string
+	byKey := make(map[string][]*gm.Message)
+	for _, m := range msgs {
+		k, err := key(m)
+		if err != nil {
+			return nil, err
+		}
+		if k == "" {
+			continue
+		}
+		if _, ok := byKey[k]; !ok {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], m)
+	}
+
+	var groups []*Group
+	for _, k := range keys {
+		copies := byKey[k]
+		if len(copies) < 2 {
+			continue
+		}
+		sorted := append([]*gm.Message{}, copies...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return preferred(sorted[i], sorted[j], policy)
+		})
+		g := &Group{Key: k, Keep: sorted[0]}
+		for _, m := range copies {
+			if m != g.Keep {
+				g.Duplicates = append(g.Duplicates, m)
+			}
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// AllDuplicates returns the messages of groups which are not kept
+func AllDuplicates(groups []*Group) []*gm.Message {
+	var dups []*gm.Message
+	for _, g := range groups {
+		dups = append(dups, g.Duplicates...)
+	}
+	return dups
+}
+
+// HelperKey returns a KeyFunc which keys messages by their Message-ID, or by
+// their content (loaded with helper) if they have none.
+func HelperKey(helper *api.MsgHelper) KeyFunc {
+	return func(m *gm.Message) (string, error) {
+		m, err := helper.GetMessage(m.Id, api.LabelsOnly)
+		if err != nil {
+			return "", err
+		}
+		if k := MessageIdKey(m); k != "" {
+			return k, nil
+		}
+		m, err = helper.GetMessage(m.Id, api.LabelsAndPayload)
+		if err != nil {
+			return "", err
+		}
+		return ContentKey(m)
+	}
+}
+
+// Find returns the groups of duplicates among the messages matched by query.
+// maxMsgs is -1 for unlimited.
+func Find(helper *api.MsgHelper, query string, maxMsgs int64, policy Policy,
+) ([]*Group, error) {
+	msgs, err := helper.QueryMessages(query, false, false, maxMsgs, api.LabelsOnly)
+	if err != nil {
+		return nil, err
+	}
+	return FindGroups(msgs, HelperKey(helper), policy)
+}
+
+// IsDuplicate returns true if there is another copy of m with the same
+// Message-ID, which policy keeps instead of m. Messages without a Message-ID
+// are never duplicates, since they can't be searched for. m must be loaded with
+// at least api.LabelsOnly.
+func IsDuplicate(m *gm.Message, helper *api.MsgHelper, policy Policy) (bool, error) {
+	key := MessageIdKey(m)
+	if key == "" {
+		return false, nil
+	}
+	query := "rfc822msgid:" + strings.Trim(strings.TrimPrefix(key, messageIdKeyPrefix), "<>")
+	copies, err := helper.QueryMessages(query, false, false, -1, api.LabelsOnly)
+	if err != nil {
+		return false, err
+	}
+	groups, err := FindGroups(copies, func(c *gm.Message) (string, error) {
+		return MessageIdKey(c), nil
+	}, policy)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range AllDuplicates(groups) {
+		if d.Id == m.Id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
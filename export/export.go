@@ -0,0 +1,377 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+const (
+	// Written into each exported message, so that labels survive the export.
+	LabelsHeader = "X-Gmail-Labels"
+
+	stateFileSuffix = ".gmailcli-export"
+)
+
+type Format string
+
+const (
+	EmlFormat     Format = "eml"
+	MboxFormat    Format = "mbox"
+	MaildirFormat Format = "maildir"
+)
+
+var Formats = []Format{EmlFormat, MboxFormat, MaildirFormat}
+
+func ParseFormat(str string) (Format, error) {
+	for _, f := range Formats {
+		if string(f) == strings.ToLower(str) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("Invalid export format '%s'", str)
+}
+
+// Message is a single message to be exported.
+type Message struct {
+	Id string
+	// The full RFC 2822 message
+	Raw    []byte
+	Labels []string
+	// Milliseconds since epoch, as provided by the API
+	InternalDate int64
+	Unread       bool
+	Starred      bool
+}
+
+// Writer writes messages to some export destination. Writers are not safe for
+// concurrent use.
+type Writer interface {
+	Write(msg *Message) error
+	Close() error
+}
+
+// NewWriter returns a Writer for format. If restart is true, an existing mbox
+// file is truncated rather than appended to. (EML and Maildir exports overwrite
+// messages by ID, so are not affected.)
+func NewWriter(format Format, path string, restart bool) (Writer, error) {
+	switch format {
+	case EmlFormat:
+		return NewEmlWriter(path)
+	case MboxFormat:
+		return NewMboxWriter(path, restart)
+	case MaildirFormat:
+		return NewMaildirWriter(path)
+	}
+	return nil, fmt.Errorf("Invalid export format '%s'", format)
+}
+
+// lineEnding returns the line ending used by the message headers.
+func lineEnding(raw []byte) string {
+	if i := bytes.IndexByte(raw, '\n'); i > 0 && raw[i-1] == '\r' {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// WithLabelsHeader returns a copy of the raw message with the labels header
+// prepended. Any existing labels header is left in place, since headers are
+// read top-down and ours will take precedence.
+func WithLabelsHeader(raw []byte, labels []string) []byte {
+	if len(labels) == 0 {
+		return raw
+	}
+	hdr := fmt.Sprintf("%s: %s%s", LabelsHeader, strings.Join(labels, ","),
+		lineEnding(raw))
+	out := make([]byte, 0, len(hdr)+len(raw))
+	out = append(out, hdr...)
+	return append(out, raw...)
+}
+
+// ---------- Resume state ----------------
+
+// State tracks which messages have already been exported to a destination, so
+// that an interrupted export can be resumed. It is backed by an append-only
+// file of message IDs.
+type State struct {
+	fname    string
+	exported map[string]bool
+	f        *os.File
+	mutex    sync.Mutex
+}
+
+// StateFileFor returns the name of the state file used for an export to path.
+// Directory exports keep the state inside the directory.
+func StateFileFor(format Format, path string) string {
+	if format == MboxFormat {
+		return path + stateFileSuffix
+	}
+	return filepath.Join(path, stateFileSuffix)
+}
+
+func LoadState(fname string) (*State, error) {
+	s := &State{fname: fname, exported: make(map[string]bool)}
+
+	if f, err := os.Open(fname); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			id := strings.TrimSpace(scanner.Text())
+			if id != "" {
+				s.exported[id] = true
+			}
+		}
+		f.Close()
+		if err = scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s.f = f
+	return s, nil
+}
+
+func (s *State) IsExported(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.exported[id]
+}
+
+func (s *State) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.exported)
+}
+
+// MarkExported records id. It should only be called once the message has been
+// fully written.
+func (s *State) MarkExported(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.exported[id] {
+		return nil
+	}
+	if _, err := fmt.Fprintln(s.f, id); err != nil {
+		return err
+	}
+	s.exported[id] = true
+	return nil
+}
+
+// Implements io.Closer interface
+func (s *State) Close() error {
+	return s.f.Close()
+}
+
+// ---------- EML ----------------
+
+type EmlWriter struct {
+	dir string
+}
+
+// NewEmlWriter writes each message to dir/<id>.eml
+func NewEmlWriter(dir string) (*EmlWriter, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &EmlWriter{dir: dir}, nil
+}
+
+func (w *EmlWriter) Write(msg *Message) error {
+	fname := filepath.Join(w.dir, msg.Id+".eml")
+	return writeFileAtomic(fname, WithLabelsHeader(msg.Raw, msg.Labels))
+}
+
+func (w *EmlWriter) Close() error {
+	return nil
+}
+
+// ---------- Maildir ----------------
+
+type MaildirWriter struct {
+	dir string
+	// Folders which have already had their cur/new/tmp dirs created
+	madeFolders map[string]bool
+}
+
+// NewMaildirWriter writes a Maildir++ tree rooted at dir. A copy of each
+// message is written into the folder for each of its labels. Messages in the
+// inbox, or with no user labels, go into the root folder.
+func NewMaildirWriter(dir string) (*MaildirWriter, error) {
+	w := &MaildirWriter{dir: dir, madeFolders: make(map[string]bool)}
+	if err := w.makeFolder(""); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// MaildirFolderName converts a label name to a Maildir++ folder name.
+// Nested labels (Parent/Child) become .Parent.Child
+func MaildirFolderName(label string) string {
+	if label == "" || label == "INBOX" {
+		return ""
+	}
+	name := strings.Replace(label, ".", "_", -1)
+	name = strings.Replace(name, "/", ".", -1)
+	return "." + name
+}
+
+// Labels which are represented as maildir flags, or which are not folders.
+var maildirNonFolderLabels = []string{
+	"UNREAD", "STARRED", "IMPORTANT", "SENT", "DRAFT", "SPAM", "TRASH",
+	"CATEGORY_PERSONAL", "CATEGORY_SOCIAL", "CATEGORY_PROMOTIONS",
+	"CATEGORY_UPDATES", "CATEGORY_FORUMS",
+}
+
+func (w *MaildirWriter) makeFolder(folder string) error {
+	if w.madeFolders[folder] {
+		return nil
+	}
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(w.dir, folder, sub), 0700); err != nil {
+			return err
+		}
+	}
+	w.madeFolders[folder] = true
+	return nil
+}
+
+func (w *MaildirWriter) folders(msg *Message) []string {
+	folderSet := make(map[string]bool)
+	var folders []string
+	for _, l := range msg.Labels {
+		if util.StringSliceContains(l, maildirNonFolderLabels) {
+			continue
+		}
+		folder := MaildirFolderName(l)
+		if !folderSet[folder] {
+			folderSet[folder] = true
+			folders = append(folders, folder)
+		}
+	}
+	if len(folders) == 0 {
+		folders = append(folders, "")
+	}
+	return folders
+}
+
+func (w *MaildirWriter) Write(msg *Message) error {
+	flags := ""
+	if msg.Starred {
+		flags += "F"
+	}
+	if !msg.Unread {
+		flags += "S"
+	}
+	// Use the message ID rather than a random unique part, so that re-exports
+	// overwrite rather than duplicate.
+	base := fmt.Sprintf("%d.%s.gmailcli:2,%s", msg.InternalDate/1000, msg.Id, flags)
+	data := WithLabelsHeader(msg.Raw, msg.Labels)
+
+	for _, folder := range w.folders(msg) {
+		if err := w.makeFolder(folder); err != nil {
+			return err
+		}
+		tmpName := filepath.Join(w.dir, folder, "tmp", base)
+		if err := os.WriteFile(tmpName, data, 0600); err != nil {
+			return err
+		}
+		err := os.Rename(tmpName, filepath.Join(w.dir, folder, "cur", base))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *MaildirWriter) Close() error {
+	return nil
+}
+
+// ---------- mbox ----------------
+
+type MboxWriter struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+// NewMboxWriter appends messages to the mbox file at path, in mboxrd format.
+// If truncate is true, any existing contents of the file are discarded first.
+func NewMboxWriter(path string, truncate bool) (*MboxWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if truncate {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &MboxWriter{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// MboxEntry formats a single message as an mboxrd entry, including the
+// leading From_ line and trailing blank line.
+func MboxEntry(msg *Message) []byte {
+	var buf bytes.Buffer
+	date := util.TimeFromMillis(msg.InternalDate).UTC()
+	fmt.Fprintf(&buf, "From %s@gmailcli %s\n", msg.Id, date.Format("Mon Jan _2 15:04:05 2006"))
+
+	data := WithLabelsHeader(msg.Raw, msg.Labels)
+	data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+	lines := bytes.Split(data, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	for _, line := range lines {
+		// mboxrd quoting: any line matching ^>*From  gets an extra >
+		if bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From ")) {
+			buf.WriteByte('>')
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func (w *MboxWriter) Write(msg *Message) error {
+	if _, err := w.w.Write(MboxEntry(msg)); err != nil {
+		return err
+	}
+	// Flush after every message, so the resume state never gets ahead of the
+	// file contents.
+	return w.w.Flush()
+}
+
+func (w *MboxWriter) Close() error {
+	if err := w.w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+func writeFileAtomic(fname string, data []byte) error {
+	tmpName := fname + ".tmp"
+	if err := os.WriteFile(tmpName, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, fname)
+}
@@ -1,6 +1,16 @@
 package main
 
-import "github.com/tsiemens/gmail-tools/cmd"
+import (
+	"github.com/tsiemens/gmail-tools/cmd"
+
+	// Builtin plugins
+	_ "github.com/tsiemens/gmail-tools/pluginsclassifier"
+	_ "github.com/tsiemens/gmail-tools/pluginscore"
+	_ "github.com/tsiemens/gmail-tools/pluginsdedupe"
+	_ "github.com/tsiemens/gmail-tools/pluginsoutdated"
+	_ "github.com/tsiemens/gmail-tools/pluginsrules"
+	_ "github.com/tsiemens/gmail-tools/pluginstracking"
+)
 
 func main() {
 	cmd.Execute()
@@ -0,0 +1,168 @@
+package mime
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Elements which start on a new line when rendered
+var blockElems = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"div": true, "dl": true, "dt": true, "dd": true, "fieldset": true,
+	"figure": true, "footer": true, "form": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true,
+	"li": true, "main": true, "nav": true, "ol": true, "p": true, "pre": true,
+	"section": true, "table": true, "tr": true, "ul": true,
+}
+
+// Elements whose content is never shown
+var hiddenElems = map[string]bool{
+	"head": true, "script": true, "style": true, "title": true,
+}
+
+type textRenderer struct {
+	sb strings.Builder
+	// Number of trailing newlines written
+	newlines     int
+	pendingSpace bool
+	preDepth     int
+}
+
+func (r *textRenderer) newline(max int) {
+	for r.newlines < max {
+		r.sb.WriteByte('\n')
+		r.newlines++
+	}
+	r.pendingSpace = false
+}
+
+func (r *textRenderer) write(text string) {
+	if r.preDepth > 0 {
+		r.sb.WriteString(text)
+		if strings.HasSuffix(text, "\n") {
+			r.newlines = 1
+		} else if text != "" {
+			r.newlines = 0
+		}
+		return
+	}
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		if text != "" {
+			r.pendingSpace = true
+		}
+		return
+	}
+	startsWithSpace := text[0] == ' ' || text[0] == '\t' || text[0] == '\n' ||
+		text[0] == '\r'
+	if (r.pendingSpace || startsWithSpace) && r.newlines == 0 && r.sb.Len() > 0 {
+		r.sb.WriteByte(' ')
+	}
+	r.sb.WriteString(strings.Join(words, " "))
+	r.newlines = 0
+	last := text[len(text)-1]
+	r.pendingSpace = last == ' ' || last == '\t' || last == '\n' || last == '\r'
+}
+
+func attrVal(t html.Token, name string) string {
+	for _, a := range t.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// HtmlToText renders an HTML document as plain text. Block elements are
+// separated by line breaks, list items are bulleted, and link targets are shown
+// after the link text when they differ from it.
+func HtmlToText(htmlStr string) string {
+	r := &textRenderer{}
+	z := html.NewTokenizer(strings.NewReader(htmlStr))
+	hiddenDepth := 0
+	var linkHrefs []string
+	var linkStarts []int
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		t := z.Token()
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if hiddenElems[t.Data] {
+				if tt == html.StartTagToken {
+					hiddenDepth++
+				}
+				continue
+			}
+			if hiddenDepth > 0 {
+				continue
+			}
+			switch {
+			case t.Data == "br":
+				r.sb.WriteByte('\n')
+				r.newlines++
+				r.pendingSpace = false
+			case t.Data == "li":
+				r.newline(1)
+				r.sb.WriteString("* ")
+				r.newlines = 0
+			case t.Data == "p" || strings.HasPrefix(t.Data, "h") && len(t.Data) == 2:
+				r.newline(2)
+			case t.Data == "pre":
+				r.newline(1)
+				r.preDepth++
+			case t.Data == "td" || t.Data == "th":
+				r.pendingSpace = true
+			case t.Data == "img":
+				if alt := attrVal(t, "alt"); alt != "" {
+					r.write("[" + alt + "]")
+				}
+			case t.Data == "a" && tt == html.StartTagToken:
+				linkHrefs = append(linkHrefs, attrVal(t, "href"))
+				linkStarts = append(linkStarts, r.sb.Len())
+			case blockElems[t.Data]:
+				r.newline(1)
+			}
+		case html.EndTagToken:
+			if hiddenElems[t.Data] {
+				if hiddenDepth > 0 {
+					hiddenDepth--
+				}
+				continue
+			}
+			if hiddenDepth > 0 {
+				continue
+			}
+			switch {
+			case t.Data == "a" && len(linkHrefs) > 0:
+				href := linkHrefs[len(linkHrefs)-1]
+				start := linkStarts[len(linkStarts)-1]
+				linkHrefs = linkHrefs[:len(linkHrefs)-1]
+				linkStarts = linkStarts[:len(linkStarts)-1]
+				linkText := strings.TrimSpace(r.sb.String()[start:])
+				if href != "" && !strings.HasPrefix(href, "#") &&
+					strings.TrimPrefix(href, "mailto:") != linkText {
+					r.write(" (" + href + ")")
+				}
+			case t.Data == "pre":
+				if r.preDepth > 0 {
+					r.preDepth--
+				}
+				r.newline(1)
+			case t.Data == "p" || strings.HasPrefix(t.Data, "h") && len(t.Data) == 2:
+				r.newline(2)
+			case blockElems[t.Data]:
+				r.newline(1)
+			}
+		case html.TextToken:
+			if hiddenDepth == 0 {
+				r.write(t.Data)
+			}
+		}
+	}
+	return strings.TrimSpace(r.sb.String())
+}
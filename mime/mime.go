@@ -0,0 +1,378 @@
+// Package mime decodes message MIME trees into typed parts, with transfer
+// encodings and charsets resolved. It may be used with messages from the API
+// (gm.MessagePart trees), or with raw RFC 2822 messages.
+package mime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	stdmime "mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+	gm "google.golang.org/api/gmail/v1"
+)
+
+type PartKind int
+
+const (
+	// multipart/* parts, which only hold other parts
+	ContainerPart PartKind = iota
+	// text/plain body text
+	TextPart
+	// text/html body text
+	HtmlPart
+	// Images (or other content) referenced from the HTML body by Content-ID
+	InlinePart
+	AttachmentPart
+)
+
+var partKindNames = map[PartKind]string{
+	ContainerPart:  "container",
+	TextPart:       "text",
+	HtmlPart:       "html",
+	InlinePart:     "inline",
+	AttachmentPart: "attachment",
+}
+
+func (k PartKind) String() string {
+	return partKindNames[k]
+}
+
+type Part struct {
+	// Position of the part among all non-container parts, starting at 1.
+	// 0 for container parts.
+	Index int
+	// Same format as the API's PartId (e.g. "0.1")
+	PartId    string
+	Kind      PartKind
+	MimeType  string
+	Charset   string
+	Filename  string
+	ContentId string
+	Headers   textproto.MIMEHeader
+	// Size of the decoded content in bytes
+	Size int64
+
+	// Decoded content. nil if the content is not included in the message (it
+	// must be fetched separately with AttachmentId)
+	Data         []byte
+	AttachmentId string
+	// Set for Text and Html parts: the content decoded from Charset
+	Text string
+
+	Children []*Part
+}
+
+// IsBody returns true for parts which hold message body text.
+func (p *Part) IsBody() bool {
+	return p.Kind == TextPart || p.Kind == HtmlPart
+}
+
+type Message struct {
+	Root *Part
+	// All non-container parts, in message order. Parts[i].Index == i+1
+	Parts []*Part
+}
+
+// Part returns the part with the given Index.
+func (m *Message) Part(index int) (*Part, bool) {
+	if index < 1 || index > len(m.Parts) {
+		return nil, false
+	}
+	return m.Parts[index-1], true
+}
+
+func (m *Message) partsOfKind(kind PartKind) []*Part {
+	var parts []*Part
+	for _, p := range m.Parts {
+		if p.Kind == kind {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+func (m *Message) TextParts() []*Part   { return m.partsOfKind(TextPart) }
+func (m *Message) HtmlParts() []*Part   { return m.partsOfKind(HtmlPart) }
+func (m *Message) InlineParts() []*Part { return m.partsOfKind(InlinePart) }
+func (m *Message) Attachments() []*Part { return m.partsOfKind(AttachmentPart) }
+
+// PreferredText returns the body as plain text. text/plain parts are used if
+// there are any, otherwise the HTML parts are rendered to text.
+func (m *Message) PreferredText() string {
+	var texts []string
+	for _, p := range m.TextParts() {
+		texts = append(texts, p.Text)
+	}
+	if len(texts) == 0 {
+		for _, p := range m.HtmlParts() {
+			texts = append(texts, HtmlToText(p.Text))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// PreferredHtml returns the HTML body, if the message has one.
+func (m *Message) PreferredHtml() (string, bool) {
+	var htmls []string
+	for _, p := range m.HtmlParts() {
+		htmls = append(htmls, p.Text)
+	}
+	return strings.Join(htmls, "\n"), len(htmls) > 0
+}
+
+// ---------- Decoding ----------------
+
+// DecodeCharset converts data in the given charset to a UTF-8 string.
+// Unknown charsets are treated as UTF-8, and an error is returned with the
+// best-effort result.
+func DecodeCharset(data []byte, charset string) (string, error) {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if charset == "" || charset == "utf-8" || charset == "us-ascii" || charset == "utf8" {
+		return string(data), nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return string(data), fmt.Errorf("Unknown charset '%s'", charset)
+	}
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data), err
+	}
+	return string(decoded), nil
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	str, err := DecodeCharset(data, charset)
+	return strings.NewReader(str), err
+}
+
+// WordDecoder decodes RFC 2047 encoded-words in any charset DecodeCharset
+// supports.
+var WordDecoder = &stdmime.WordDecoder{CharsetReader: charsetReader}
+
+// DecodeHeader decodes any RFC 2047 encoded-words in a header value. If the
+// value cannot be decoded, it is returned as-is.
+func DecodeHeader(value string) string {
+	decoded, err := WordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// DecodeTransferEncoding reverses the Content-Transfer-Encoding of a part.
+func DecodeTransferEncoding(data []byte, encoding string) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		// Encoded lines are wrapped, and may have stray whitespace.
+		cleaned := bytes.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+				return -1
+			}
+			return r
+		}, data)
+		return base64.RawStdEncoding.DecodeString(
+			strings.TrimRight(string(cleaned), "="))
+	case "quoted-printable":
+		return io.ReadAll(quotedprintable.NewReader(bytes.NewReader(data)))
+	}
+	// 7bit, 8bit, binary
+	return data, nil
+}
+
+// ---------- Tree building ----------------
+
+type partBuilder struct {
+	msg *Message
+}
+
+// classify fills in the type info of p from its headers, and the Content-Type
+// mimeType fallback.
+func (b *partBuilder) classify(p *Part, mimeType string, filename string) {
+	ctype := p.Headers.Get("Content-Type")
+	params := map[string]string{}
+	if ctype != "" {
+		if mt, ps, err := stdmime.ParseMediaType(ctype); err == nil {
+			mimeType = mt
+			params = ps
+		}
+	}
+	p.MimeType = strings.ToLower(mimeType)
+	if p.MimeType == "" {
+		p.MimeType = "text/plain"
+	}
+	p.Charset = params["charset"]
+
+	disposition := ""
+	if cd := p.Headers.Get("Content-Disposition"); cd != "" {
+		if d, dps, err := stdmime.ParseMediaType(cd); err == nil {
+			disposition = d
+			if filename == "" {
+				filename = dps["filename"]
+			}
+		}
+	}
+	if filename == "" {
+		filename = params["name"]
+	}
+	p.Filename = DecodeHeader(filename)
+	p.ContentId = strings.Trim(p.Headers.Get("Content-Id"), "<> ")
+
+	switch {
+	case strings.HasPrefix(p.MimeType, "multipart/"):
+		p.Kind = ContainerPart
+	case disposition == "attachment":
+		p.Kind = AttachmentPart
+	case p.MimeType == "text/plain" && p.Filename == "":
+		p.Kind = TextPart
+	case p.MimeType == "text/html" && p.Filename == "":
+		p.Kind = HtmlPart
+	case p.ContentId != "" || disposition == "inline":
+		p.Kind = InlinePart
+	default:
+		p.Kind = AttachmentPart
+	}
+}
+
+func (b *partBuilder) setData(p *Part, data []byte) {
+	p.Data = data
+	p.Size = int64(len(data))
+	if p.IsBody() {
+		// Keep the best-effort decoding even on error.
+		p.Text, _ = DecodeCharset(data, p.Charset)
+	}
+}
+
+func (b *partBuilder) register(p *Part) {
+	if p.Kind != ContainerPart {
+		b.msg.Parts = append(b.msg.Parts, p)
+		p.Index = len(b.msg.Parts)
+	}
+}
+
+func headersFromApi(hdrs []*gm.MessagePartHeader) textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	for _, hdr := range hdrs {
+		h.Add(hdr.Name, hdr.Value)
+	}
+	return h
+}
+
+func (b *partBuilder) fromApiPart(apiPart *gm.MessagePart) (*Part, error) {
+	p := &Part{PartId: apiPart.PartId, Headers: headersFromApi(apiPart.Headers)}
+	b.classify(p, apiPart.MimeType, apiPart.Filename)
+	b.register(p)
+
+	if apiPart.Body != nil {
+		p.AttachmentId = apiPart.Body.AttachmentId
+		p.Size = apiPart.Body.Size
+		if apiPart.Body.Data != "" {
+			// The API has already reversed the transfer encoding.
+			data, err := base64.RawURLEncoding.DecodeString(
+				strings.TrimRight(apiPart.Body.Data, "="))
+			if err != nil {
+				return nil, fmt.Errorf("Failed to decode part %s: %v", p.PartId, err)
+			}
+			b.setData(p, data)
+		}
+	}
+
+	for _, apiChild := range apiPart.Parts {
+		child, err := b.fromApiPart(apiChild)
+		if err != nil {
+			return nil, err
+		}
+		p.Children = append(p.Children, child)
+	}
+	return p, nil
+}
+
+// Parse builds the typed part tree of a message loaded with its payload
+// (i.e. api.LabelsAndPayload detail).
+func Parse(payload *gm.MessagePart) (*Message, error) {
+	if payload == nil {
+		return nil, fmt.Errorf("Message has no payload")
+	}
+	b := &partBuilder{msg: &Message{}}
+	root, err := b.fromApiPart(payload)
+	if err != nil {
+		return nil, err
+	}
+	b.msg.Root = root
+	return b.msg, nil
+}
+
+func childPartId(parentId string, i int) string {
+	if parentId == "" {
+		return fmt.Sprintf("%d", i)
+	}
+	return fmt.Sprintf("%s.%d", parentId, i)
+}
+
+func (b *partBuilder) fromRawEntity(partId string, header textproto.MIMEHeader,
+	body io.Reader) (*Part, error) {
+
+	p := &Part{PartId: partId, Headers: header}
+	b.classify(p, "", "")
+	b.register(p)
+
+	if p.Kind == ContainerPart {
+		_, params, _ := stdmime.ParseMediaType(header.Get("Content-Type"))
+		mr := multipart.NewReader(body, params["boundary"])
+		for i := 0; ; i++ {
+			// Unlike NextPart, this leaves quoted-printable content encoded, so
+			// that all transfer encodings are handled the same way below.
+			rawPart, err := mr.NextRawPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("Failed to read part of %s: %v", p.MimeType, err)
+			}
+			child, err := b.fromRawEntity(childPartId(partId, i), rawPart.Header, rawPart)
+			if err != nil {
+				return nil, err
+			}
+			p.Children = append(p.Children, child)
+		}
+		return p, nil
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	data, err = DecodeTransferEncoding(data, header.Get("Content-Transfer-Encoding"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode part %s: %v", partId, err)
+	}
+	b.setData(p, data)
+	return p, nil
+}
+
+// ParseRaw builds the typed part tree of a full RFC 2822 message, as returned
+// by api.MsgHelper.GetRawMessage.
+func ParseRaw(raw []byte) (*Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	b := &partBuilder{msg: &Message{}}
+	root, err := b.fromRawEntity("", textproto.MIMEHeader(m.Header), m.Body)
+	if err != nil {
+		return nil, err
+	}
+	b.msg.Root = root
+	return b.msg, nil
+}
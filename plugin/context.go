@@ -0,0 +1,236 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+// APIVersion is the version of the API for builtin plugins: the Context, and
+// the hooks of Plugin. It is incremented when either changes incompatibly.
+const APIVersion = 3
+
+const storeDir = "plugin-data"
+
+// Env is what the host provides to the Contexts of loaded plugins.
+type Env struct {
+	// Nil if plugins are loaded without access to Gmail (e.g. to be listed)
+	Msgs *api.MsgHelper
+	// Cancelled when the command finishes, or is interrupted (SIGINT or
+	// SIGTERM). Defaults to context.Background().
+	Ctx context.Context
+	// Decodes the plugin's section of the config file into out
+	LoadConfig func(pluginId string, out interface{}) error
+	// Decodes the whole config file into out
+	LoadGlobalConfig func(out interface{}) error
+	// Where plugin Stores are kept. If empty, plugins' Stores are not saved.
+	StoreDir string
+}
+
+// StoreDir returns the directory which plugin Stores are kept in.
+func StoreDir() string {
+	return util.RequiredHomeBasedDir(filepath.Join(util.UserAppDirName, storeDir))
+}
+
+// Context is passed to each of a plugin's hooks, and gives it access to the
+// host.
+type Context struct {
+	// The plugin's ID, as in the Plugins section of config.yaml
+	Id string
+	// Cancelled when the command finishes, or is interrupted (SIGINT or SIGTERM)
+	Ctx context.Context
+	// Nil when plugins are loaded without access to Gmail
+	Msgs *api.MsgHelper
+	// Logs to stderr, prefixed by the plugin's ID
+	Log   *log.Logger
+	Store *Store
+
+	env *Env
+}
+
+// NewContext returns the Context of the plugin with id, in env.
+func NewContext(id string, env *Env) *Context {
+	if env == nil {
+		env = &Env{}
+	}
+	ctx := env.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	storeFile := ""
+	if env.StoreDir != "" {
+		storeFile = filepath.Join(env.StoreDir, id+".json")
+	}
+	return &Context{
+		Id:    id,
+		Ctx:   ctx,
+		Msgs:  env.Msgs,
+		Log:   log.New(os.Stderr, id+": ", 0),
+		Store: &Store{fname: storeFile},
+		env:   env,
+	}
+}
+
+// LoadConfig decodes the plugin's section of the config file into out, which
+// should be marked up for yaml unmarshaling. e.g. for the plugin myplugin:
+//
+//	PluginConfig:
+//	  myplugin:
+//	    Threshold: 3
+//
+// out is unchanged if there is no section for the plugin.
+func (c *Context) LoadConfig(out interface{}) error {
+	if c.env.LoadConfig == nil {
+		return nil
+	}
+	return c.env.LoadConfig(c.Id, out)
+}
+
+// LoadGlobalConfig decodes settings shared with gmailcli, such as
+// InterestingLabelPatterns, from the config file into out.
+func (c *Context) LoadGlobalConfig(out interface{}) error {
+	if c.env.LoadGlobalConfig == nil {
+		return nil
+	}
+	return c.env.LoadGlobalConfig(out)
+}
+
+// Debug prints a debug line, prefixed by the plugin's ID
+func (c *Context) Debug(v ...interface{}) {
+	prnt.Deb.Ln(append([]interface{}{c.Id + ":"}, v...)...)
+}
+
+// Cancelled returns true once the plugin should stop its work
+func (c *Context) Cancelled() bool {
+	return c.Ctx.Err() != nil
+}
+
+func (c *Context) requireMsgs() error {
+	if c.Msgs == nil {
+		return fmt.Errorf("Plugin %s: Gmail is not available", c.Id)
+	}
+	return nil
+}
+
+// LabelName returns the name of the label with ID id
+func (c *Context) LabelName(id string) (string, error) {
+	if err := c.requireMsgs(); err != nil {
+		return "", err
+	}
+	return c.Msgs.LabelName(id), nil
+}
+
+// LabelNames returns the names of the labels with ids
+func (c *Context) LabelNames(ids []string) ([]string, error) {
+	if err := c.requireMsgs(); err != nil {
+		return nil, err
+	}
+	return c.Msgs.LabelNames(ids), nil
+}
+
+// LabelId returns the ID of the label named name, if it exists.
+func (c *Context) LabelId(name string) (string, bool, error) {
+	if err := c.requireMsgs(); err != nil {
+		return "", false, err
+	}
+	id, ok := c.Msgs.LabelIdByName(name)
+	return id, ok, nil
+}
+
+// Store is a persistent key/value store for a plugin's state, kept as JSON
+// in ~/.gmailcli/plugin-data. Values may be anything which can be encoded as
+// JSON.
+type Store struct {
+	fname  string
+	mutex  sync.Mutex
+	values map[string]json.RawMessage
+}
+
+func (s *Store) load() error {
+	if s.values != nil {
+		return nil
+	}
+	s.values = make(map[string]json.RawMessage)
+	if s.fname == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.fname)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, &s.values); err != nil {
+		return fmt.Errorf("Failed to parse %s: %v", s.fname, err)
+	}
+	return nil
+}
+
+func (s *Store) save() error {
+	if s.fname == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.values, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(s.fname), 0700); err != nil {
+		return err
+	}
+	tmpName := s.fname + ".tmp"
+	if err = os.WriteFile(tmpName, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, s.fname)
+}
+
+// Get decodes the value of key into out. ok is false if there is no value.
+func (s *Store) Get(key string, out interface{}) (ok bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err = s.load(); err != nil {
+		return false, err
+	}
+	data, ok := s.values[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, out)
+}
+
+// Set stores value under key, and saves the store.
+func (s *Store) Set(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err = s.load(); err != nil {
+		return err
+	}
+	s.values[key] = data
+	return s.save()
+}
+
+// Delete removes key, and saves the store.
+func (s *Store) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, ok := s.values[key]; !ok {
+		return nil
+	}
+	delete(s.values, key)
+	return s.save()
+}
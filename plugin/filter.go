@@ -0,0 +1,145 @@
+package plugin
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+)
+
+// ParamType is the type of a MessageFilter parameter
+type ParamType int
+
+const (
+	StringParam ParamType = iota
+	IntParam
+	// A case-insensitive regular expression
+	RegexpParam
+)
+
+func (t ParamType) String() string {
+	switch t {
+	case IntParam:
+		return "int"
+	case RegexpParam:
+		return "regexp"
+	}
+	return "string"
+}
+
+// ParseParamType parses the name of a ParamType, as returned by String.
+func ParseParamType(name string) (ParamType, error) {
+	for _, t := range []ParamType{StringParam, IntParam, RegexpParam} {
+		if name == t.String() {
+			return t, nil
+		}
+	}
+	return StringParam, fmt.Errorf("Invalid parameter type '%s'", name)
+}
+
+// Parse parses arg as a value of type t
+func (t ParamType) Parse(arg string) (interface{}, error) {
+	switch t {
+	case IntParam:
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not an int", arg)
+		}
+		return n, nil
+	case RegexpParam:
+		re, err := regexp.Compile("(?i)" + arg)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a valid regexp: %v", arg, err)
+		}
+		return re, nil
+	}
+	return arg, nil
+}
+
+// FilterParam is a parameter of a MessageFilter, whose argument is given in
+// xfilter expressions, e.g. sender-domain(github.com)
+type FilterParam struct {
+	Name string
+	Type ParamType
+}
+
+// FilterArgs are the arguments passed to a MessageFilter, parsed as the types
+// of its Params.
+type FilterArgs []interface{}
+
+func (a FilterArgs) String(i int) string {
+	return a[i].(string)
+}
+
+func (a FilterArgs) Int(i int) int64 {
+	return a[i].(int64)
+}
+
+func (a FilterArgs) Regexp(i int) *regexp.Regexp {
+	return a[i].(*regexp.Regexp)
+}
+
+// Strings returns the arguments as they were given, before being parsed.
+func (a FilterArgs) Strings() []string {
+	strs := make([]string, 0, len(a))
+	for _, arg := range a {
+		switch arg := arg.(type) {
+		case int64:
+			strs = append(strs, strconv.FormatInt(arg, 10))
+		case *regexp.Regexp:
+			strs = append(strs, strings.TrimPrefix(arg.String(), "(?i)"))
+		default:
+			strs = append(strs, arg.(string))
+		}
+	}
+	return strs
+}
+
+func parseFilterArgs(params []FilterParam, args []string) (FilterArgs, error) {
+	if len(args) != len(params) {
+		return nil, fmt.Errorf("takes %d arguments, but %d were given",
+			len(params), len(args))
+	}
+	parsed := make(FilterArgs, 0, len(args))
+	for i, arg := range args {
+		val, err := params[i].Type.Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %s: %v", params[i].Name, err)
+		}
+		parsed = append(parsed, val)
+	}
+	return parsed, nil
+}
+
+// MessageFilter is an xfilter, which search and rules can filter messages
+// with.
+type MessageFilter struct {
+	Desc   string
+	Params []FilterParam
+	// The detail which messages are loaded with before Matches is called
+	Detail api.MessageDetailLevel
+	// Returns an error if the filter could not be evaluated on the message
+	Matches func(*Context, *gm.Message, FilterArgs) (bool, error)
+}
+
+// Usage returns how the filter is called in xfilter expressions, e.g.
+// "sender-domain(domain string)"
+func (f *MessageFilter) Usage(name string) string {
+	if len(f.Params) == 0 {
+		return name
+	}
+	params := make([]string, 0, len(f.Params))
+	for _, p := range f.Params {
+		params = append(params, p.Name+" "+p.Type.String())
+	}
+	return name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// ParseArgs parses args as the filter's Params
+func (f *MessageFilter) ParseArgs(args []string) (FilterArgs, error) {
+	return parseFilterArgs(f.Params, args)
+}
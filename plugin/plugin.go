@@ -1,15 +1,12 @@
 package plugin
 
 import (
-	"fmt"
-	"path/filepath"
-	pluginlib "plugin"
+	"sort"
 
+	"github.com/spf13/cobra"
 	gm "google.golang.org/api/gmail/v1"
 
 	"github.com/tsiemens/gmail-tools/api"
-	"github.com/tsiemens/gmail-tools/prnt"
-	"github.com/tsiemens/gmail-tools/util"
 )
 
 const (
@@ -52,63 +49,119 @@ func (i1 InterestLevel) InverseCombine(i2 InterestLevel) InterestLevel {
 	return i2
 }
 
-type MessageFilter struct {
-	Desc    string
-	Matches func(*gm.Message, *api.MsgHelper) bool
+// Interest is a plugin's categorization of a message's interest.
+type Interest struct {
+	Level InterestLevel
+	// Why the plugin chose Level, e.g. the rule or label pattern which matched.
+	// May be empty.
+	Reason string
 }
 
-type Plugin struct {
-	Name string
+// Verdict is the Interest which a plugin gave a message.
+type Verdict struct {
+	Plugin string
+	Interest
+}
 
-	MessageInterest           func(*gm.Message, *api.MsgHelper) InterestLevel
-	DetailRequiredForInterest func() api.MessageDetailLevel
+// CombineVerdicts combines the levels of verdicts, and returns the index of
+// the first verdict which gave the combined level, or -1 if no plugin had an
+// opinion.
+func CombineVerdicts(verdicts []Verdict) (InterestLevel, int) {
+	interest := UnknownInterest
+	decider := -1
+	for i, v := range verdicts {
+		if combined := interest.Combine(v.Level); combined != interest {
+			interest = combined
+			decider = i
+		}
+	}
+	return interest, decider
+}
 
-	// int64 is maxMsgs and will be -1 for unlimited
-	OutdatedMessages func(string, *api.MsgHelper, int64) []*gm.Message
+// ActionResult is the outcome of a MessageAction on one message
+type ActionResult struct {
+	// Whether the message was changed (or with dryRun, would have been)
+	Changed bool
+	// What was done, or would be done, e.g. "Labelled Tracking/UPS"
+	Desc string
+}
 
-	PrintMessageSummary func([]*gm.Message, *api.MsgHelper)
+// MessageAction is a named action which a plugin takes on messages, run by
+// search --action. It is run concurrently on each message.
+type MessageAction struct {
+	Desc string
+	// If dryRun, the action must not change anything, but should describe what
+	// it would do.
+	Run func(ctx *Context, m *gm.Message, dryRun bool) (ActionResult, error)
+}
 
-	MessageFilters map[string]*MessageFilter
+// Command is a gmailcli subcommand provided by a plugin.
+type Command struct {
+	// The command's usage, help, args and flags. Its Run functions are set by
+	// gmailcli.
+	Cobra *cobra.Command
+	// Whether the command modifies messages or labels, so needs permission to
+	// do so
+	Modifies bool
+	// Runs the command. ctx.Msgs is available.
+	Run func(ctx *Context, cmd *cobra.Command, args []string) error
 }
 
-type PluginBuilder func() *Plugin
+// Plugin is the set of hooks a plugin provides. Hooks may be nil if the plugin
+// does not implement them. Each hook is passed the plugin's Context.
+type Plugin struct {
+	Name string
 
-func LoadPlugins() []*Plugin {
-	dirName := filepath.Join(util.UserAppDirName, pluginDir)
-	dirName = util.RequiredHomeBasedDir(dirName)
+	MessageInterest           func(*Context, *gm.Message) Interest
+	DetailRequiredForInterest func() api.MessageDetailLevel
 
-	files, err := filepath.Glob(filepath.Join(dirName, "*"))
-	if err != nil {
-		fmt.Println(err)
-		prnt.StderrLog.Printf("Failed to retrieve plugin list: %s\n", err)
-	}
+	// int64 is maxMsgs and will be -1 for unlimited
+	OutdatedMessages func(*Context, string, int64) []*gm.Message
 
-	loadedPlugins := make([]*Plugin, 0)
+	PrintMessageSummary func(*Context, []*gm.Message)
 
-	prnt.LPrintln(prnt.Debug, "debug: Loading plugins:")
-	for _, file := range files {
-		prnt.LPrintln(prnt.Debug, "debug:", file)
-		plg, err := pluginlib.Open(file)
-		if err != nil {
-			prnt.StderrLog.Printf("Error loading plugin %s: %s\n", file, err)
-			continue
-		}
+	MessageFilters map[string]*MessageFilter
 
-		builderSym, err := plg.Lookup("Builder")
-		if err != nil {
-			prnt.StderrLog.Printf("Error loading plugin %s: %s\n", file, err)
-			continue
-		}
+	MessageActions map[string]*MessageAction
 
-		builderPtr, ok := builderSym.(*PluginBuilder)
-		if !ok {
-			prnt.StderrLog.Printf(
-				"Error loading plugin %s: Builder was of type PluginBuilder\n", file)
-			continue
-		}
+	// The commands registered by a compiled in plugin with
+	// RegisterBuiltinCommand. Set when the plugin is loaded.
+	Commands []*Command
 
-		loadedPlugins = append(loadedPlugins, (*builderPtr)())
-	}
+	// Set when the plugin is loaded, to be passed to its hooks
+	Ctx *Context
+}
 
-	return loadedPlugins
+// Capabilities describes the hooks which the plugin implements.
+func (p *Plugin) Capabilities() []string {
+	var caps []string
+	if p.MessageInterest != nil {
+		caps = append(caps, "interest")
+	}
+	if p.OutdatedMessages != nil {
+		caps = append(caps, "outdated")
+	}
+	if p.PrintMessageSummary != nil {
+		caps = append(caps, "summary")
+	}
+	filterNames := make([]string, 0, len(p.MessageFilters))
+	for name := range p.MessageFilters {
+		filterNames = append(filterNames, name)
+	}
+	sort.Strings(filterNames)
+	for _, name := range filterNames {
+		caps = append(caps, "xfilter:"+name)
+	}
+	actionNames := make([]string, 0, len(p.MessageActions))
+	for name := range p.MessageActions {
+		actionNames = append(actionNames, name)
+	}
+	sort.Strings(actionNames)
+	for _, name := range actionNames {
+		caps = append(caps, "action:"+name)
+	}
+	for _, c := range p.Commands {
+		caps = append(caps, "command:"+c.Cobra.Name())
+	}
+	return caps
 }
@@ -0,0 +1,169 @@
+package plugin
+
+import (
+	"fmt"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+)
+
+// ProtocolVersion is the version of the plugin protocol. Plugins reply to
+// initialize with the version they implement, and are not loaded if it
+// differs.
+const ProtocolVersion = 2
+
+// Methods which gmailcli calls on plugins
+const (
+	InitializeMethod          = "initialize"
+	MessageInterestMethod     = "messageInterest"
+	OutdatedMessagesMethod    = "outdatedMessages"
+	PrintMessageSummaryMethod = "printMessageSummary"
+	MessageFilterMethod       = "messageFilter"
+)
+
+// Methods which plugins may call on gmailcli, while handling a request.
+// getLabels returns a map of label ID -> name.
+const (
+	GetMessageMethod    = "getMessage"
+	GetThreadMethod     = "getThread"
+	GetLabelsMethod     = "getLabels"
+	QueryMessagesMethod = "queryMessages"
+)
+
+type InitializeParams struct {
+	ProtocolVersion int  `json:"protocolVersion"`
+	Debug           bool `json:"debug"`
+}
+
+type InitializeResult struct {
+	ProtocolVersion int    `json:"protocolVersion"`
+	Name            string `json:"name"`
+	// Which of the optional methods the plugin implements
+	MessageInterest     bool `json:"messageInterest"`
+	OutdatedMessages    bool `json:"outdatedMessages"`
+	PrintMessageSummary bool `json:"printMessageSummary"`
+	// Detail level (see DetailLevelName) which messages need for
+	// messageInterest
+	DetailRequiredForInterest string `json:"detailRequiredForInterest"`
+	// Filter name -> filter
+	MessageFilters map[string]MessageFilterInfo `json:"messageFilters"`
+}
+
+// MessageFilterInfo describes a filter of a plugin, in InitializeResult.
+type MessageFilterInfo struct {
+	// Shown by search --list-xfilters
+	Desc string `json:"desc"`
+	// Detail level (see DetailLevelName) which messages are loaded with before
+	// the filter is called
+	Detail string            `json:"detail"`
+	Params []FilterParamInfo `json:"params,omitempty"`
+}
+
+type FilterParamInfo struct {
+	Name string `json:"name"`
+	// See ParamType.String
+	Type string `json:"type"`
+}
+
+type MessageParams struct {
+	Message *gm.Message `json:"message"`
+}
+
+type MessageInterestResult struct {
+	// See InterestLevel.String
+	Interest string `json:"interest"`
+	// Why the plugin chose the level. Shown by --explain.
+	Reason string `json:"reason,omitempty"`
+}
+
+type OutdatedMessagesParams struct {
+	Query string `json:"query"`
+	// -1 for unlimited
+	MaxMsgs int64 `json:"maxMsgs"`
+}
+
+type OutdatedMessagesResult struct {
+	MessageIds []string `json:"messageIds"`
+}
+
+type PrintMessageSummaryParams struct {
+	Messages []*gm.Message `json:"messages"`
+}
+
+type PrintMessageSummaryResult struct {
+	// Printed by gmailcli, since plugins' stdout is used for the protocol
+	Output string `json:"output"`
+}
+
+type MessageFilterParams struct {
+	Filter  string      `json:"filter"`
+	Message *gm.Message `json:"message"`
+	// The filter's arguments, as given in the xfilter expression
+	Args []string `json:"args,omitempty"`
+}
+
+type MessageFilterResult struct {
+	Matches bool `json:"matches"`
+}
+
+type GetParams struct {
+	Id     string `json:"id"`
+	Detail string `json:"detail"`
+}
+
+type QueryMessagesParams struct {
+	Query   string `json:"query"`
+	MaxMsgs int64  `json:"maxMsgs"`
+	Detail  string `json:"detail"`
+}
+
+var detailLevelNames = map[api.MessageDetailLevel]string{
+	api.IdsOnly:          "ids",
+	api.LabelsOnly:       "labels",
+	api.LabelsAndPayload: "full",
+}
+
+// DetailLevelName returns the protocol name of a detail level.
+func DetailLevelName(d api.MessageDetailLevel) string {
+	return detailLevelNames[d]
+}
+
+// ParseDetailLevel parses a detail level name. An empty name is LabelsOnly.
+func ParseDetailLevel(name string) (api.MessageDetailLevel, error) {
+	if name == "" {
+		return api.LabelsOnly, nil
+	}
+	for d, dName := range detailLevelNames {
+		if name == dName {
+			return d, nil
+		}
+	}
+	return api.IdsOnly, fmt.Errorf("Invalid detail level '%s'", name)
+}
+
+var interestLevelNames = map[InterestLevel]string{
+	StronglyInteresting:   "strongly-interesting",
+	StronglyUninteresting: "strongly-uninteresting",
+	WeaklyInteresting:     "weakly-interesting",
+	WeaklyUninteresting:   "weakly-uninteresting",
+	UnknownInterest:       "unknown",
+}
+
+func (i InterestLevel) String() string {
+	return interestLevelNames[i]
+}
+
+// ParseInterestLevel parses the name of an interest level. An empty name is
+// UnknownInterest.
+func ParseInterestLevel(name string) (InterestLevel, error) {
+	if name == "" {
+		return UnknownInterest, nil
+	}
+	for i, iName := range interestLevelNames {
+		if name == iName {
+			return i, nil
+		}
+	}
+	return UnknownInterest, fmt.Errorf("Invalid interest level '%s'", name)
+}
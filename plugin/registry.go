@@ -0,0 +1,273 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+// BuiltinSource is the Source of plugins compiled into gmailcli.
+const BuiltinSource = "builtin"
+
+// PluginBuilder builds a builtin plugin. ctx is the Context which will be
+// passed to the plugin's hooks, from which it may load its config. An error is
+// shown by 'plugins list', e.g. if the plugin's config is invalid.
+type PluginBuilder func(ctx *Context) (*Plugin, error)
+
+type builtinPlugin struct {
+	id         string
+	apiVersion int
+	builder    PluginBuilder
+	commands   []*Command
+}
+
+var builtinMutex sync.Mutex
+var builtins []builtinPlugin
+
+// RegisterBuiltin registers a plugin compiled into gmailcli, under the ID used
+// for it in the Plugins section of config.yaml. apiVersion is the APIVersion
+// which the plugin was written for, and it will fail to load if this differs,
+// so it should be a literal number rather than APIVersion itself. It should be
+// called from an init function.
+func RegisterBuiltin(id string, apiVersion int, builder PluginBuilder) {
+	builtinMutex.Lock()
+	defer builtinMutex.Unlock()
+	for _, b := range builtins {
+		if b.id == id {
+			panic(fmt.Sprintf("Plugin %s is already registered", id))
+		}
+	}
+	builtins = append(builtins, builtinPlugin{id, apiVersion, builder, nil})
+}
+
+// RegisterBuiltinCommand registers a subcommand of gmailcli provided by the
+// builtin plugin with pluginId, which must already be registered. Commands are
+// added to gmailcli without building their plugins, which are only built when
+// the command is run. It should be called from an init function.
+func RegisterBuiltinCommand(pluginId string, c *Command) {
+	builtinMutex.Lock()
+	defer builtinMutex.Unlock()
+	for i := range builtins {
+		if builtins[i].id == pluginId {
+			builtins[i].commands = append(builtins[i].commands, c)
+			return
+		}
+	}
+	panic(fmt.Sprintf("Plugin %s is not registered", pluginId))
+}
+
+// BuiltinCommands returns the commands registered by builtin plugins, by
+// plugin ID.
+func BuiltinCommands() map[string][]*Command {
+	builtinMutex.Lock()
+	defer builtinMutex.Unlock()
+	commands := make(map[string][]*Command)
+	for _, b := range builtins {
+		if len(b.commands) > 0 {
+			commands[b.id] = b.commands
+		}
+	}
+	return commands
+}
+
+// PluginsConfig is the Plugins section of config.yaml, e.g.
+//
+//	Disabled: [core]
+//	Order: [myplugin, core]
+//
+// Plugins are identified by their builtin ID, or by the file name of their
+// executable in ~/.gmailcli/plugins.
+type PluginsConfig struct {
+	// If set, only these plugins are loaded
+	Enabled []string `yaml:"Enabled"`
+	// Plugins not to load
+	Disabled []string `yaml:"Disabled"`
+	// Plugins to load first, in this order. The rest are loaded after them,
+	// builtin plugins first.
+	Order []string `yaml:"Order"`
+}
+
+// IsEnabled returns true if the plugin with id should be loaded.
+func (c *PluginsConfig) IsEnabled(id string) bool {
+	if len(c.Enabled) > 0 && !util.StringSliceContains(id, c.Enabled) {
+		return false
+	}
+	return !util.StringSliceContains(id, c.Disabled)
+}
+
+// LoadedPlugin is a plugin found by LoadPlugins, whether or not it could be
+// loaded.
+type LoadedPlugin struct {
+	Id string
+	// BuiltinSource, or the path of the plugin's executable
+	Source   string
+	Disabled bool
+	// Why the plugin could not be loaded
+	Err error
+	// Nil if the plugin is disabled or could not be loaded
+	Plugin *Plugin
+}
+
+// PluginDir returns the directory which plugin executables are loaded from.
+func PluginDir() string {
+	return util.RequiredHomeBasedDir(filepath.Join(util.UserAppDirName, pluginDir))
+}
+
+func findPlugins(dir string) []*LoadedPlugin {
+	var found []*LoadedPlugin
+	builtinMutex.Lock()
+	for _, b := range builtins {
+		found = append(found, &LoadedPlugin{Id: b.id, Source: BuiltinSource})
+	}
+	builtinMutex.Unlock()
+
+	if dir == "" {
+		return found
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		prnt.StderrLog.Printf("Failed to retrieve plugin list: %s\n", err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		found = append(found, &LoadedPlugin{Id: filepath.Base(file), Source: file})
+	}
+	return found
+}
+
+// orderPlugins moves the plugins named in order to the front, in that order.
+func orderPlugins(found []*LoadedPlugin, order []string) []*LoadedPlugin {
+	ordered := make([]*LoadedPlugin, 0, len(found))
+	for _, id := range order {
+		for _, lp := range found {
+			if lp.Id == id {
+				ordered = append(ordered, lp)
+			}
+		}
+	}
+	for _, lp := range found {
+		if !util.StringSliceContains(lp.Id, order) {
+			ordered = append(ordered, lp)
+		}
+	}
+	return ordered
+}
+
+// LoadPlugins builds the builtin plugins, and starts each plugin executable
+// in ~/.gmailcli/plugins, as configured by conf. Plugin executables
+// communicate with gmailcli over stdin and stdout, using the protocol in
+// plugin/PROTOCOL.md. Each plugin is given a Context in env.
+func LoadPlugins(conf *PluginsConfig, env *Env) []*LoadedPlugin {
+	return LoadPluginsFromDir(PluginDir(), conf, env)
+}
+
+// LoadBuiltinPlugins is LoadPlugins, without plugin executables.
+func LoadBuiltinPlugins(conf *PluginsConfig, env *Env) []*LoadedPlugin {
+	return LoadPluginsFromDir("", conf, env)
+}
+
+// LoadPluginsFromDir is LoadPlugins, with plugin executables from dir, or
+// none if dir is empty.
+func LoadPluginsFromDir(dir string, conf *PluginsConfig, env *Env) []*LoadedPlugin {
+	found := orderPlugins(findPlugins(dir), conf.Order)
+
+	builtinMutex.Lock()
+	builders := make(map[string]builtinPlugin)
+	for _, b := range builtins {
+		builders[b.id] = b
+	}
+	builtinMutex.Unlock()
+
+	var loaded []*LoadedPlugin
+	prnt.LPrintln(prnt.Debug, "debug: Loading plugins:")
+	for _, lp := range found {
+		if lp.Source != BuiltinSource {
+			info, err := os.Stat(lp.Source)
+			if err == nil && info.IsDir() {
+				continue
+			}
+			if err == nil && info.Mode()&0111 == 0 && filepath.Ext(lp.Source) != ".so" {
+				prnt.LPrintln(prnt.Debug, "debug: Skipping non-executable", lp.Source)
+				continue
+			}
+		}
+		loaded = append(loaded, lp)
+
+		if !conf.IsEnabled(lp.Id) {
+			lp.Disabled = true
+			continue
+		}
+		prnt.LPrintln(prnt.Debug, "debug:", lp.Id, lp.Source)
+		if lp.Source == BuiltinSource {
+			loadBuiltin(lp, builders[lp.Id], env)
+			continue
+		}
+		ctx := NewContext(lp.Id, env)
+		if filepath.Ext(lp.Source) == ".so" {
+			lp.Err = fmt.Errorf("Shared library plugins are no longer supported. " +
+				"Plugins must be executables.")
+		} else {
+			lp.Plugin, lp.Err = StartRemotePlugin(lp.Source)
+		}
+		if lp.Plugin != nil {
+			lp.Plugin.Ctx = ctx
+		}
+	}
+	return loaded
+}
+
+// LoadBuiltinPlugin is LoadBuiltinPlugins, for only the builtin plugin with id.
+func LoadBuiltinPlugin(id string, conf *PluginsConfig, env *Env) *LoadedPlugin {
+	lp := &LoadedPlugin{Id: id, Source: BuiltinSource}
+	if !conf.IsEnabled(id) {
+		lp.Disabled = true
+		return lp
+	}
+	builtinMutex.Lock()
+	var found *builtinPlugin
+	for _, b := range builtins {
+		if b.id == id {
+			found = &b
+		}
+	}
+	builtinMutex.Unlock()
+	if found == nil {
+		lp.Err = fmt.Errorf("No builtin plugin %s", id)
+		return lp
+	}
+	loadBuiltin(lp, *found, env)
+	return lp
+}
+
+func loadBuiltin(lp *LoadedPlugin, b builtinPlugin, env *Env) {
+	ctx := NewContext(lp.Id, env)
+	lp.Plugin, lp.Err = buildBuiltin(b, ctx)
+	if lp.Plugin != nil {
+		lp.Plugin.Commands = b.commands
+		lp.Plugin.Ctx = ctx
+	}
+}
+
+func buildBuiltin(b builtinPlugin, ctx *Context) (*Plugin, error) {
+	if b.apiVersion != APIVersion {
+		return nil, fmt.Errorf("Plugin was built for plugin API version %d. "+
+			"Version %d is required", b.apiVersion, APIVersion)
+	}
+	return b.builder(ctx)
+}
+
+// EnabledPlugins returns the plugins which were loaded successfully.
+func EnabledPlugins(loaded []*LoadedPlugin) []*Plugin {
+	plugins := make([]*Plugin, 0, len(loaded))
+	for _, lp := range loaded {
+		if lp.Plugin != nil {
+			plugins = append(plugins, lp.Plugin)
+		}
+	}
+	return plugins
+}
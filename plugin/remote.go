@@ -0,0 +1,295 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+const (
+	initializeTimeout = 10 * time.Second
+	callTimeout       = time.Minute
+	exitTimeout       = 5 * time.Second
+)
+
+// remotePlugin is a plugin executable, run as a subprocess which speaks the
+// plugin protocol on its stdin and stdout.
+type remotePlugin struct {
+	file  string
+	name  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	conn  *Conn
+
+	mutex sync.Mutex
+	// The helper passed to the hook being called, for callbacks
+	helper *api.MsgHelper
+	failed bool
+}
+
+// StartRemotePlugin runs the plugin executable at file, and returns a Plugin
+// whose hooks call it. The process is stopped by the cleanup handlers.
+func StartRemotePlugin(file string) (*Plugin, error) {
+	rp := &remotePlugin{file: file, name: filepath.Base(file)}
+	rp.cmd = exec.Command(file)
+	rp.cmd.Stderr = os.Stderr
+	var err error
+	if rp.stdin, err = rp.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	stdout, err := rp.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = rp.cmd.Start(); err != nil {
+		return nil, err
+	}
+	rp.conn = NewConn(stdout, rp.stdin, rp.handleCallback)
+
+	rp.conn.Timeout = initializeTimeout
+	res := &InitializeResult{}
+	err = rp.conn.Call(InitializeMethod,
+		&InitializeParams{ProtocolVersion: ProtocolVersion, Debug: util.DebugModeEnabled()},
+		res)
+	if err == nil && res.ProtocolVersion != ProtocolVersion {
+		err = fmt.Errorf("Plugin uses protocol version %d. Version %d is required",
+			res.ProtocolVersion, ProtocolVersion)
+	}
+	var detail api.MessageDetailLevel
+	if err == nil {
+		detail, err = ParseDetailLevel(res.DetailRequiredForInterest)
+	}
+	var filters map[string]*MessageFilter
+	if err == nil {
+		filters, err = rp.messageFilters(res.MessageFilters)
+	}
+	if err != nil {
+		rp.kill()
+		return nil, err
+	}
+	rp.conn.Timeout = callTimeout
+	util.RegisterCleanupHandler(rp, rp.stop)
+
+	if res.Name != "" {
+		rp.name = res.Name
+	}
+	plug := &Plugin{Name: rp.name}
+	if res.MessageInterest {
+		plug.MessageInterest = rp.messageInterest
+		plug.DetailRequiredForInterest = func() api.MessageDetailLevel { return detail }
+	}
+	if res.OutdatedMessages {
+		plug.OutdatedMessages = rp.outdatedMessages
+	}
+	if res.PrintMessageSummary {
+		plug.PrintMessageSummary = rp.printMessageSummary
+	}
+	if len(filters) > 0 {
+		plug.MessageFilters = filters
+	}
+	return plug, nil
+}
+
+// messageFilters returns the plugin's filters, as described by infos.
+func (rp *remotePlugin) messageFilters(infos map[string]MessageFilterInfo,
+) (map[string]*MessageFilter, error) {
+	filters := make(map[string]*MessageFilter)
+	for name, info := range infos {
+		detail, err := ParseDetailLevel(info.Detail)
+		if err != nil {
+			return nil, fmt.Errorf("Filter %s: %v", name, err)
+		}
+		params := make([]FilterParam, 0, len(info.Params))
+		for _, p := range info.Params {
+			paramType, err := ParseParamType(p.Type)
+			if err != nil {
+				return nil, fmt.Errorf("Filter %s: %v", name, err)
+			}
+			params = append(params, FilterParam{Name: p.Name, Type: paramType})
+		}
+		filters[name] = &MessageFilter{
+			Desc:    info.Desc,
+			Params:  params,
+			Detail:  detail,
+			Matches: rp.messageFilter(name),
+		}
+	}
+	return filters, nil
+}
+
+// call calls method on the plugin, and returns false if it failed or ctx is
+// cancelled.
+func (rp *remotePlugin) call(ctx *Context, method string,
+	params, result interface{}) bool {
+
+	err := rp.tryCall(ctx, method, params, result)
+	if _, ok := err.(*RPCError); ok {
+		prnt.StderrLog.Printf("Plugin %s: %s failed: %v\n", rp.name, method, err)
+	}
+	return err == nil
+}
+
+// tryCall calls method on the plugin, and returns why it failed, if it did. If
+// the plugin has exited or stopped responding, it is not called again.
+func (rp *remotePlugin) tryCall(ctx *Context, method string,
+	params, result interface{}) error {
+
+	if err := ctx.Ctx.Err(); err != nil {
+		return err
+	}
+	rp.mutex.Lock()
+	if rp.failed {
+		rp.mutex.Unlock()
+		return errors.New("The plugin has already failed")
+	}
+	rp.helper = ctx.Msgs
+	rp.mutex.Unlock()
+
+	err := rp.conn.Call(method, params, result)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*RPCError); ok {
+		return err
+	}
+
+	rp.mutex.Lock()
+	alreadyFailed := rp.failed
+	rp.failed = true
+	rp.mutex.Unlock()
+	if !alreadyFailed {
+		prnt.StderrLog.Printf("Plugin %s failed, and will not be used further: %v\n",
+			rp.name, err)
+		rp.kill()
+	}
+	return err
+}
+
+func (rp *remotePlugin) messageInterest(ctx *Context, m *gm.Message) Interest {
+	res := &MessageInterestResult{}
+	if !rp.call(ctx, MessageInterestMethod, &MessageParams{Message: m}, res) {
+		return Interest{Level: UnknownInterest, Reason: "Plugin call failed"}
+	}
+	level, err := ParseInterestLevel(res.Interest)
+	if err != nil {
+		prnt.StderrLog.Printf("Plugin %s: %v\n", rp.name, err)
+		return Interest{Level: UnknownInterest, Reason: err.Error()}
+	}
+	return Interest{Level: level, Reason: res.Reason}
+}
+
+func (rp *remotePlugin) outdatedMessages(ctx *Context, query string,
+	maxMsgs int64) []*gm.Message {
+
+	res := &OutdatedMessagesResult{}
+	params := &OutdatedMessagesParams{Query: query, MaxMsgs: maxMsgs}
+	if !rp.call(ctx, OutdatedMessagesMethod, params, res) {
+		return nil
+	}
+	msgs := make([]*gm.Message, 0, len(res.MessageIds))
+	for _, id := range res.MessageIds {
+		msgs = append(msgs, &gm.Message{Id: id})
+	}
+	return msgs
+}
+
+func (rp *remotePlugin) printMessageSummary(ctx *Context, msgs []*gm.Message) {
+	res := &PrintMessageSummaryResult{}
+	params := &PrintMessageSummaryParams{Messages: msgs}
+	if rp.call(ctx, PrintMessageSummaryMethod, params, res) {
+		prnt.Hum.Always.P(res.Output)
+	}
+}
+
+// messageFilter returns the Matches function of a filter.
+func (rp *remotePlugin) messageFilter(name string,
+) func(*Context, *gm.Message, FilterArgs) (bool, error) {
+	return func(ctx *Context, m *gm.Message, args FilterArgs) (bool, error) {
+		res := &MessageFilterResult{}
+		params := &MessageFilterParams{Filter: name, Message: m, Args: args.Strings()}
+		if err := rp.tryCall(ctx, MessageFilterMethod, params, res); err != nil {
+			return false, fmt.Errorf("Plugin %s: %s failed: %v", rp.name, name, err)
+		}
+		return res.Matches, nil
+	}
+}
+
+// handleCallback handles requests from the plugin
+func (rp *remotePlugin) handleCallback(method string, params json.RawMessage,
+) (interface{}, error) {
+	rp.mutex.Lock()
+	helper := rp.helper
+	rp.mutex.Unlock()
+	if helper == nil {
+		return nil, fmt.Errorf("%s may only be called while handling a request", method)
+	}
+
+	switch method {
+	case GetMessageMethod, GetThreadMethod:
+		p := &GetParams{}
+		if err := unmarshalParams(params, p); err != nil {
+			return nil, err
+		}
+		detail, err := ParseDetailLevel(p.Detail)
+		if err != nil {
+			return nil, &RPCError{InvalidParamsCode, err.Error()}
+		}
+		if method == GetMessageMethod {
+			return helper.GetMessage(p.Id, detail)
+		}
+		return helper.GetThread(p.Id, detail)
+	case GetLabelsMethod:
+		return helper.LabelNamesById(), nil
+	case QueryMessagesMethod:
+		p := &QueryMessagesParams{}
+		if err := unmarshalParams(params, p); err != nil {
+			return nil, err
+		}
+		detail, err := ParseDetailLevel(p.Detail)
+		if err != nil {
+			return nil, &RPCError{InvalidParamsCode, err.Error()}
+		}
+		maxMsgs := p.MaxMsgs
+		if maxMsgs == 0 {
+			maxMsgs = -1
+		}
+		return helper.QueryMessages(p.Query, false, false, maxMsgs, detail)
+	}
+	return nil, &RPCError{MethodNotFoundCode, "Method not found: " + method}
+}
+
+// stop asks the plugin to exit, by closing its stdin, and kills it if it does
+// not.
+func (rp *remotePlugin) stop() {
+	rp.stdin.Close()
+	exited := make(chan bool, 1)
+	go func() {
+		rp.cmd.Wait()
+		exited <- true
+	}()
+	select {
+	case <-exited:
+	case <-time.After(exitTimeout):
+		prnt.Deb.Ln("Killing plugin", rp.name)
+		rp.cmd.Process.Kill()
+	}
+}
+
+func (rp *remotePlugin) kill() {
+	util.UnregisterCleanupHandler(rp)
+	rp.stdin.Close()
+	rp.cmd.Process.Kill()
+	go rp.cmd.Wait()
+}
@@ -0,0 +1,252 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// JSON-RPC error codes
+const (
+	ParseErrorCode     = -32700
+	MethodNotFoundCode = -32601
+	InvalidParamsCode  = -32602
+	InternalErrorCode  = -32603
+)
+
+// RPCError is an error returned by the other end of a Conn.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// ErrConnClosed is returned by calls on a Conn which has been closed, or
+// whose peer has exited.
+var ErrConnClosed = fmt.Errorf("Connection closed")
+
+// rpcMessage is a JSON-RPC 2.0 request, notification or response.
+type rpcMessage struct {
+	JsonRpc string           `json:"jsonrpc"`
+	Id      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *RPCError        `json:"error,omitempty"`
+}
+
+// Handler handles requests made by the peer of a Conn. The result is
+// marshalled as JSON. Errors which are not RPCErrors are returned to the
+// peer as internal errors.
+type Handler func(method string, params json.RawMessage) (interface{}, error)
+
+// Conn is a bidirectional JSON-RPC 2.0 connection, with one message per line.
+// Either end may make requests of the other, and requests are handled
+// concurrently, so that a handler may itself make calls on the Conn.
+type Conn struct {
+	// Calls fail if no response is received in this time. 0 for no limit.
+	Timeout time.Duration
+
+	w       io.Writer
+	wMutex  sync.Mutex
+	handler Handler
+
+	mutex   sync.Mutex
+	nextId  uint64
+	pending map[string]chan *rpcMessage
+	err     error
+	done    chan struct{}
+}
+
+// NewConn creates a Conn which reads messages from r and writes them to w,
+// and starts reading. handler may be nil if the peer makes no requests.
+func NewConn(r io.Reader, w io.Writer, handler Handler) *Conn {
+	c := newConn(w, handler)
+	c.start(r)
+	return c
+}
+
+func newConn(w io.Writer, handler Handler) *Conn {
+	return &Conn{
+		w:       w,
+		handler: handler,
+		pending: make(map[string]chan *rpcMessage),
+		done:    make(chan struct{}),
+	}
+}
+
+func (c *Conn) start(r io.Reader) {
+	go c.readLoop(bufio.NewReader(r))
+}
+
+// Done is closed once the Conn can no longer be read from.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the Conn was closed, once Done is closed.
+func (c *Conn) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+func (c *Conn) write(msg *rpcMessage) error {
+	msg.JsonRpc = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.wMutex.Lock()
+	defer c.wMutex.Unlock()
+	_, err = c.w.Write(append(data, '\n'))
+	return err
+}
+
+// Call makes a request of the peer, and unmarshals its result into result
+// (unless result is nil).
+func (c *Conn) Call(method string, params, result interface{}) error {
+	paramData, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	if c.err != nil {
+		c.mutex.Unlock()
+		return c.err
+	}
+	c.nextId++
+	idStr := strconv.FormatUint(c.nextId, 10)
+	respChan := make(chan *rpcMessage, 1)
+	c.pending[idStr] = respChan
+	c.mutex.Unlock()
+	defer func() {
+		c.mutex.Lock()
+		delete(c.pending, idStr)
+		c.mutex.Unlock()
+	}()
+
+	id := json.RawMessage(idStr)
+	err = c.write(&rpcMessage{Id: &id, Method: method, Params: paramData})
+	if err != nil {
+		return err
+	}
+
+	var timeout <-chan time.Time
+	if c.Timeout > 0 {
+		timer := time.NewTimer(c.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var resp *rpcMessage
+	select {
+	case resp = <-respChan:
+	case <-c.done:
+		return c.Err()
+	case <-timeout:
+		return fmt.Errorf("No response to %s after %v", method, c.Timeout)
+	}
+
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result != nil {
+		if err = json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("Invalid result for %s: %v", method, err)
+		}
+	}
+	return nil
+}
+
+func (c *Conn) readLoop(r *bufio.Reader) {
+	var err error
+	for {
+		var line []byte
+		line, err = r.ReadBytes('\n')
+		if len(line) > 0 {
+			c.handleLine(line)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == io.EOF {
+		err = ErrConnClosed
+	}
+	c.mutex.Lock()
+	c.err = err
+	c.mutex.Unlock()
+	close(c.done)
+}
+
+func (c *Conn) handleLine(line []byte) {
+	msg := &rpcMessage{}
+	if err := json.Unmarshal(line, msg); err != nil {
+		c.write(&rpcMessage{Error: &RPCError{ParseErrorCode, err.Error()}})
+		return
+	}
+
+	if msg.Method == "" {
+		// A response
+		if msg.Id == nil {
+			return
+		}
+		c.mutex.Lock()
+		respChan, ok := c.pending[string(*msg.Id)]
+		c.mutex.Unlock()
+		if ok {
+			respChan <- msg
+		}
+		return
+	}
+
+	go c.handleRequest(msg)
+}
+
+func (c *Conn) handleRequest(req *rpcMessage) {
+	var result interface{}
+	var err error
+	if c.handler == nil {
+		err = &RPCError{MethodNotFoundCode, "Method not found: " + req.Method}
+	} else {
+		result, err = c.handler(req.Method, req.Params)
+	}
+	if req.Id == nil {
+		// Notification
+		return
+	}
+
+	resp := &rpcMessage{Id: req.Id}
+	if err == nil {
+		resp.Result, err = json.Marshal(result)
+	}
+	if err != nil {
+		rpcErr, ok := err.(*RPCError)
+		if !ok {
+			rpcErr = &RPCError{InternalErrorCode, err.Error()}
+		}
+		resp.Result = nil
+		resp.Error = rpcErr
+	}
+	c.write(resp)
+}
+
+// unmarshalParams decodes a request's params, returning an RPCError if they
+// are invalid.
+func unmarshalParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &RPCError{InvalidParamsCode, err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+// Host is a plugin's connection back to gmailcli. Its methods may only be
+// called while handling a request.
+type Host struct {
+	conn *Conn
+
+	mutex  sync.Mutex
+	labels map[string]string
+}
+
+func (h *Host) GetMessage(id string, detail api.MessageDetailLevel) (*gm.Message, error) {
+	msg := &gm.Message{}
+	err := h.conn.Call(GetMessageMethod,
+		&GetParams{Id: id, Detail: DetailLevelName(detail)}, msg)
+	return msg, err
+}
+
+func (h *Host) GetThread(id string, detail api.MessageDetailLevel) (*gm.Thread, error) {
+	thread := &gm.Thread{}
+	err := h.conn.Call(GetThreadMethod,
+		&GetParams{Id: id, Detail: DetailLevelName(detail)}, thread)
+	return thread, err
+}
+
+// QueryMessages returns the messages matching query. maxMsgs is -1 for
+// unlimited.
+func (h *Host) QueryMessages(query string, maxMsgs int64, detail api.MessageDetailLevel,
+) ([]*gm.Message, error) {
+	var msgs []*gm.Message
+	params := &QueryMessagesParams{
+		Query: query, MaxMsgs: maxMsgs, Detail: DetailLevelName(detail)}
+	err := h.conn.Call(QueryMessagesMethod, params, &msgs)
+	return msgs, err
+}
+
+// LabelNames returns the names of the labels with ids. Labels are loaded from
+// gmailcli on first use.
+func (h *Host) LabelNames(ids []string) ([]string, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.labels == nil {
+		labels := make(map[string]string)
+		if err := h.conn.Call(GetLabelsMethod, nil, &labels); err != nil {
+			return nil, err
+		}
+		h.labels = labels
+	}
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, h.labels[id])
+	}
+	return names, nil
+}
+
+// ThreadLabelNames returns the names of the labels on any of the messages of
+// a thread.
+func (h *Host) ThreadLabelNames(threadId string) ([]string, error) {
+	thread, err := h.GetThread(threadId, api.LabelsOnly)
+	if err != nil {
+		return nil, err
+	}
+	var labelIds []string
+	for _, msg := range thread.Messages {
+		for _, id := range msg.LabelIds {
+			if !util.StringSliceContains(id, labelIds) {
+				labelIds = append(labelIds, id)
+			}
+		}
+	}
+	return h.LabelNames(labelIds)
+}
+
+// ServerMessageFilter is a filter of a plugin executable, as MessageFilter is
+// for builtin plugins.
+type ServerMessageFilter struct {
+	Desc   string
+	Params []FilterParam
+	// The detail which messages are loaded with before Matches is called
+	Detail api.MessageDetailLevel
+	// Returns an error if the filter could not be evaluated on the message
+	Matches func(*gm.Message, FilterArgs, *Host) (bool, error)
+}
+
+// Server implements the plugin side of the plugin protocol, for plugins
+// written in Go. Hooks which are nil are not advertised to gmailcli.
+type Server struct {
+	Name string
+
+	MessageInterest           func(*gm.Message, *Host) Interest
+	DetailRequiredForInterest api.MessageDetailLevel
+
+	// int64 is maxMsgs and will be -1 for unlimited. Returns message IDs.
+	OutdatedMessages func(string, *Host, int64) []string
+
+	// Returns the summary to print
+	PrintMessageSummary func([]*gm.Message, *Host) string
+
+	MessageFilters map[string]*ServerMessageFilter
+}
+
+// Serve handles requests from gmailcli on r, writing responses to w, until r
+// is closed.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	host := &Host{}
+	conn := newConn(w, func(method string, params json.RawMessage) (interface{}, error) {
+		return s.handle(host, method, params)
+	})
+	host.conn = conn
+	conn.start(r)
+	<-conn.Done()
+	if err := conn.Err(); err != ErrConnClosed {
+		return err
+	}
+	return nil
+}
+
+// Run serves requests on stdin and stdout, and should be called from the
+// plugin's main. Anything else printed to stdout is sent to stderr instead.
+func (s *Server) Run() {
+	out := os.Stdout
+	os.Stdout = os.Stderr
+	if err := s.Serve(os.Stdin, out); err != nil {
+		prnt.StderrLog.Fatalf("Plugin %s: %v\n", s.Name, err)
+	}
+}
+
+func (s *Server) initializeResult() *InitializeResult {
+	res := &InitializeResult{
+		ProtocolVersion:     ProtocolVersion,
+		Name:                s.Name,
+		MessageInterest:     s.MessageInterest != nil,
+		OutdatedMessages:    s.OutdatedMessages != nil,
+		PrintMessageSummary: s.PrintMessageSummary != nil,
+		MessageFilters:      make(map[string]MessageFilterInfo),
+	}
+	if s.MessageInterest != nil {
+		res.DetailRequiredForInterest = DetailLevelName(s.DetailRequiredForInterest)
+	}
+	for name, filter := range s.MessageFilters {
+		info := MessageFilterInfo{Desc: filter.Desc, Detail: DetailLevelName(filter.Detail)}
+		for _, p := range filter.Params {
+			info.Params = append(info.Params,
+				FilterParamInfo{Name: p.Name, Type: p.Type.String()})
+		}
+		res.MessageFilters[name] = info
+	}
+	return res
+}
+
+func (s *Server) handle(host *Host, method string, params json.RawMessage,
+) (interface{}, error) {
+	notFound := &RPCError{MethodNotFoundCode, "Method not found: " + method}
+
+	switch method {
+	case InitializeMethod:
+		p := &InitializeParams{}
+		if err := unmarshalParams(params, p); err != nil {
+			return nil, err
+		}
+		if p.Debug {
+			util.DebugMode = true
+			prnt.DebugMode = true
+		}
+		return s.initializeResult(), nil
+	case MessageInterestMethod:
+		if s.MessageInterest == nil {
+			return nil, notFound
+		}
+		p := &MessageParams{}
+		if err := unmarshalParams(params, p); err != nil {
+			return nil, err
+		}
+		interest := s.MessageInterest(p.Message, host)
+		return &MessageInterestResult{
+			Interest: interest.Level.String(), Reason: interest.Reason}, nil
+	case OutdatedMessagesMethod:
+		if s.OutdatedMessages == nil {
+			return nil, notFound
+		}
+		p := &OutdatedMessagesParams{}
+		if err := unmarshalParams(params, p); err != nil {
+			return nil, err
+		}
+		ids := s.OutdatedMessages(p.Query, host, p.MaxMsgs)
+		return &OutdatedMessagesResult{MessageIds: ids}, nil
+	case PrintMessageSummaryMethod:
+		if s.PrintMessageSummary == nil {
+			return nil, notFound
+		}
+		p := &PrintMessageSummaryParams{}
+		if err := unmarshalParams(params, p); err != nil {
+			return nil, err
+		}
+		return &PrintMessageSummaryResult{
+			Output: s.PrintMessageSummary(p.Messages, host)}, nil
+	case MessageFilterMethod:
+		p := &MessageFilterParams{}
+		if err := unmarshalParams(params, p); err != nil {
+			return nil, err
+		}
+		filter, ok := s.MessageFilters[p.Filter]
+		if !ok {
+			return nil, &RPCError{InvalidParamsCode, "No filter named " + p.Filter}
+		}
+		args, err := parseFilterArgs(filter.Params, p.Args)
+		if err != nil {
+			return nil, &RPCError{InvalidParamsCode,
+				fmt.Sprintf("Filter %s %v", p.Filter, err)}
+		}
+		matches, err := filter.Matches(p.Message, args, host)
+		if err != nil {
+			return nil, err
+		}
+		return &MessageFilterResult{Matches: matches}, nil
+	}
+	return nil, notFound
+}
@@ -0,0 +1,88 @@
+// Package pluginsclassifier is the classifier plugin, which categorises
+// interest with the model trained by 'classifier train'. It is compiled into
+// gmailcli.
+package pluginsclassifier
+
+import (
+	"fmt"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/classifier"
+	"github.com/tsiemens/gmail-tools/plugin"
+)
+
+type classifierPlugin struct {
+	model     *classifier.Model
+	threshold float64
+}
+
+func (cp *classifierPlugin) messageInterest(ctx *plugin.Context, m *gm.Message,
+) plugin.Interest {
+	helper := ctx.Msgs
+	m, err := helper.GetMessage(m.Id, api.LabelsOnly)
+	if err != nil {
+		ctx.Log.Println("error:", err)
+		return plugin.Interest{Level: plugin.UnknownInterest, Reason: err.Error()}
+	}
+	thread, err := helper.GetThread(m.ThreadId, api.IdsOnly)
+	if err != nil {
+		ctx.Log.Println("error:", err)
+		return plugin.Interest{Level: plugin.UnknownInterest, Reason: err.Error()}
+	}
+
+	class, confidence, ok := cp.model.Predict(classifier.Features(m, thread), cp.threshold)
+	reason := fmt.Sprintf("%.0f%% confident the message is %s", confidence*100, class)
+	if !ok {
+		if confidence == 0 {
+			reason = "No known features"
+		} else {
+			reason = fmt.Sprintf("Only %.0f%% confident", confidence*100)
+		}
+		return plugin.Interest{Level: plugin.UnknownInterest, Reason: reason}
+	}
+	if class == classifier.Interesting {
+		return plugin.Interest{Level: plugin.WeaklyInteresting, Reason: reason}
+	}
+	return plugin.Interest{Level: plugin.WeaklyUninteresting, Reason: reason}
+}
+
+func detailRequiredForInterest() api.MessageDetailLevel {
+	return api.LabelsOnly
+}
+
+// NewPlugin returns the plugin for model. It only categorises interest if the
+// model is trained.
+func NewPlugin(model *classifier.Model, conf *classifier.Config) (*plugin.Plugin, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	plug := &plugin.Plugin{Name: "Classifier"}
+	if model.IsTrained() {
+		cp := &classifierPlugin{model: model, threshold: conf.GetThreshold()}
+		plug.MessageInterest = cp.messageInterest
+		plug.DetailRequiredForInterest = detailRequiredForInterest
+	}
+	return plug, nil
+}
+
+func builder(ctx *plugin.Context) (*plugin.Plugin, error) {
+	conf := &classifier.Config{}
+	if err := ctx.LoadConfig(conf); err != nil {
+		return nil, err
+	}
+	fname, err := classifier.ModelFile()
+	if err != nil {
+		return nil, err
+	}
+	model, err := classifier.LoadModel(fname)
+	if err != nil {
+		return nil, err
+	}
+	return NewPlugin(model, conf)
+}
+
+func init() {
+	plugin.RegisterBuiltin("classifier", 3, builder)
+}
@@ -1,26 +1,61 @@
-package main
+// Package pluginscore is the core plugin, which categorises interest by the
+// label patterns in config.yaml. It is compiled into gmailcli.
+package pluginscore
 
 import (
+	"fmt"
+	"regexp"
+	"strings"
+
 	gm "google.golang.org/api/gmail/v1"
 
 	"github.com/tsiemens/gmail-tools/api"
-	"github.com/tsiemens/gmail-tools/config"
 	"github.com/tsiemens/gmail-tools/plugin"
-	"github.com/tsiemens/gmail-tools/prnt"
 )
 
-func messageInterest(m *gm.Message, helper *api.MsgHelper) plugin.InterestLevel {
-	conf := config.AppConfig()
+const caseIgnore = "(?i)"
+
+// The label patterns of config.yaml, which are shared with gmailcli
+type coreConfig struct {
+	AlwaysUninterestingLabelPatterns []string `yaml:"AlwaysUninterestingLabelPatterns"`
+	UninterestingLabelPatterns       []string `yaml:"UninterestingLabelPatterns"`
+	InterestingLabelPatterns         []string `yaml:"InterestingLabelPatterns"`
+}
+
+type corePlugin struct {
+	alwaysUninterLabelRegexps []*regexp.Regexp
+	uninterLabelRegexps       []*regexp.Regexp
+	interLabelRegexps         []*regexp.Regexp
+}
 
+func compilePatterns(patterns []string, attrName string) ([]*regexp.Regexp, error) {
+	regexps := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pat := range patterns {
+		re, err := regexp.Compile(caseIgnore + pat)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s pattern '%s': %v", attrName, pat, err)
+		}
+		regexps = append(regexps, re)
+	}
+	return regexps, nil
+}
+
+func (cp *corePlugin) messageInterest(ctx *plugin.Context, m *gm.Message) plugin.Interest {
+	helper := ctx.Msgs
 	m, err := helper.GetMessage(m.Id, api.LabelsOnly)
 	if err != nil {
-		prnt.StderrLog.Println("core.messageInterest error:", err)
-		return plugin.UnknownInterest
+		ctx.Log.Println("messageInterest error:", err)
+		return plugin.Interest{Level: plugin.UnknownInterest, Reason: err.Error()}
 	}
 	threadLabelNames, err := helper.ThreadLabelNames(m.ThreadId)
 	if err != nil {
-		prnt.StderrLog.Println("core.messageInterest error:", err)
-		return plugin.UnknownInterest
+		ctx.Log.Println("messageInterest error:", err)
+		return plugin.Interest{Level: plugin.UnknownInterest, Reason: err.Error()}
+	}
+	matched := func(level plugin.InterestLevel, lName, kind string, labRe fmt.Stringer,
+	) plugin.Interest {
+		return plugin.Interest{Level: level, Reason: fmt.Sprintf(
+			"Thread label '%s' matched %s pattern '%s'", lName, kind, labRe)}
 	}
 
 	// Go through labels and determine their interest.
@@ -28,11 +63,12 @@ func messageInterest(m *gm.Message, helper *api.MsgHelper) plugin.InterestLevel
 	// StronglyUninteresting. This is generally reserved for labels manually
 	// applied, similar to the mute label.
 	for _, lName := range threadLabelNames {
-		for _, labRe := range conf.AlwaysUninterLabelRegexps {
+		for _, labRe := range cp.alwaysUninterLabelRegexps {
 			idxSlice := labRe.FindStringIndex(lName)
 			if idxSlice != nil {
-				prnt.Deb.Ln("label matched always uninteresting pattern", labRe)
-				return plugin.StronglyUninteresting
+				ctx.Debug("label matched always uninteresting pattern", labRe)
+				return matched(plugin.StronglyUninteresting, lName,
+					"always uninteresting", labRe)
 			}
 		}
 	}
@@ -41,13 +77,18 @@ func messageInterest(m *gm.Message, helper *api.MsgHelper) plugin.InterestLevel
 	// interest.
 	// If any label is marked interesting however, then the message as a whole
 	// is categorized as interesting.
+	var uninteresting plugin.Interest
 	matchedUninteresting := false
 	for _, lName := range threadLabelNames {
 		labelIsUninteresting := false
-		for _, labRe := range conf.UninterLabelRegexps {
+		for _, labRe := range cp.uninterLabelRegexps {
 			idxSlice := labRe.FindStringIndex(lName)
 			if idxSlice != nil {
-				prnt.Deb.Ln("label matched uninteresting pattern", labRe)
+				ctx.Debug("label matched uninteresting pattern", labRe)
+				if !matchedUninteresting {
+					uninteresting = matched(plugin.WeaklyUninteresting, lName,
+						"uninteresting", labRe)
+				}
 				labelIsUninteresting = true
 				break
 			}
@@ -58,93 +99,160 @@ func messageInterest(m *gm.Message, helper *api.MsgHelper) plugin.InterestLevel
 			matchedUninteresting = true
 			continue
 		}
-		for _, labRe := range conf.InterLabelRegexps {
+		for _, labRe := range cp.interLabelRegexps {
 			idxSlice := labRe.FindStringIndex(lName)
 			if idxSlice != nil {
-				prnt.Deb.Ln("label matched interesting pattern", labRe)
-				return plugin.WeaklyInteresting
+				ctx.Debug("label matched interesting pattern", labRe)
+				return matched(plugin.WeaklyInteresting, lName, "interesting", labRe)
 			}
 		}
 	}
 
 	if matchedUninteresting {
-		return plugin.WeaklyUninteresting
+		return uninteresting
 	}
-	return plugin.UnknownInterest
+	return plugin.Interest{
+		Level: plugin.UnknownInterest, Reason: "No thread label matched a pattern"}
 }
 
 func detailRequiredForInterest() api.MessageDetailLevel {
 	return api.LabelsOnly
 }
 
-func threadHasMultipleSenders(m *gm.Message, helper *api.MsgHelper) bool {
-	var err error
-	m, err = helper.GetMessage(m.Id, api.LabelsOnly)
-	if err != nil {
-		prnt.StderrLog.Println("Error retrieving message details:", err)
-		return false
-
-	}
-
+// threadHasMultipleSenders requires m to be loaded with api.LabelsOnly
+func threadHasMultipleSenders(ctx *plugin.Context, m *gm.Message, args plugin.FilterArgs,
+) (bool, error) {
 	headers, err := api.GetMsgHeaders(m)
 	if err != nil {
-		prnt.StderrLog.Println("Error retrieving message header:", err)
-		return false
+		return false, fmt.Errorf("Error retrieving message header: %v", err)
 	}
 
 	from0 := headers.From.Address
 
-	thread, err := helper.GetThread(m.ThreadId, api.LabelsOnly)
+	thread, err := ctx.Msgs.GetThread(m.ThreadId, api.LabelsOnly)
 	if err != nil {
-		prnt.StderrLog.Println("Error retrieving thread:", err)
-		return false
+		return false, fmt.Errorf("Error retrieving thread: %v", err)
 	}
 	if len(thread.Messages) == 1 {
-		return false
+		return false, nil
 	}
 	for _, tMsg := range thread.Messages {
 		headers, err := api.GetMsgHeaders(tMsg)
 		if err != nil {
-			prnt.StderrLog.Println("Error retrieving thread message header:", err)
-			return false
+			return false, fmt.Errorf("Error retrieving thread message header: %v", err)
 		}
 
 		if headers.From.Address != from0 {
-			return true
+			return true, nil
 		}
 	}
 
-	return false
+	return false, nil
+}
+
+func threadMessageCount(ctx *plugin.Context, m *gm.Message) (int, error) {
+	thread, err := ctx.Msgs.GetThread(m.ThreadId, api.IdsOnly)
+	if err != nil {
+		return 0, fmt.Errorf("Error retrieving thread: %v", err)
+	}
+	ctx.Debug("thread for msg", m.Id, "has", len(thread.Messages), "messages")
+	return len(thread.Messages), nil
+}
+
+func threadHasMultipleMessages(ctx *plugin.Context, m *gm.Message, args plugin.FilterArgs,
+) (bool, error) {
+	n, err := threadMessageCount(ctx, m)
+	return err == nil && n > 1, err
 }
 
-func threadHasMultipleMessages(m *gm.Message, helper *api.MsgHelper) bool {
-	thread, err := helper.GetThread(m.ThreadId, api.LabelsOnly)
+func threadHasAtLeast(ctx *plugin.Context, m *gm.Message, args plugin.FilterArgs,
+) (bool, error) {
+	n, err := threadMessageCount(ctx, m)
+	return err == nil && int64(n) >= args.Int(0), err
+}
+
+// senderDomain requires m to be loaded with api.LabelsOnly
+func senderDomain(ctx *plugin.Context, m *gm.Message, args plugin.FilterArgs,
+) (bool, error) {
+	headers, err := api.GetMsgHeaders(m)
 	if err != nil {
-		prnt.StderrLog.Println("Error retrieving thread:", err)
-		return false
+		return false, fmt.Errorf("Error retrieving message header: %v", err)
 	}
-	prnt.Deb.Ln("code.threadHasMultipleSenders thread for msg", m.Id, "has",
-		len(thread.Messages), "messages")
-	return len(thread.Messages) > 1
+	addr := strings.ToLower(headers.From.Address)
+	domain := addr[strings.LastIndex(addr, "@")+1:]
+	want := strings.ToLower(strings.TrimPrefix(args.String(0), "@"))
+	return domain == want || strings.HasSuffix(domain, "."+want), nil
 }
 
-func builder() *plugin.Plugin {
+// subjectMatches requires m to be loaded with api.LabelsOnly
+func subjectMatches(ctx *plugin.Context, m *gm.Message, args plugin.FilterArgs,
+) (bool, error) {
+	headers, err := api.GetMsgHeaders(m)
+	if err != nil {
+		return false, fmt.Errorf("Error retrieving message header: %v", err)
+	}
+	return args.Regexp(0).MatchString(headers.Subject), nil
+}
+
+func builder(ctx *plugin.Context) (*plugin.Plugin, error) {
+	conf := &coreConfig{}
+	if err := ctx.LoadGlobalConfig(conf); err != nil {
+		return nil, err
+	}
+	cp := &corePlugin{}
+	var err error
+	cp.alwaysUninterLabelRegexps, err = compilePatterns(
+		conf.AlwaysUninterestingLabelPatterns, "AlwaysUninterestingLabelPatterns")
+	if err != nil {
+		return nil, err
+	}
+	cp.uninterLabelRegexps, err = compilePatterns(
+		conf.UninterestingLabelPatterns, "UninterestingLabelPatterns")
+	if err != nil {
+		return nil, err
+	}
+	cp.interLabelRegexps, err = compilePatterns(
+		conf.InterestingLabelPatterns, "InterestingLabelPatterns")
+	if err != nil {
+		return nil, err
+	}
+
 	filters := make(map[string]*plugin.MessageFilter)
 	filters["thread-has-multiple-senders"] = &plugin.MessageFilter{
 		Desc:    "Match if there are messages in a message's thread, not all from the same address.",
+		Detail:  api.LabelsOnly,
 		Matches: threadHasMultipleSenders,
 	}
 	filters["thread-has-multiple-messages"] = &plugin.MessageFilter{
 		Desc:    "Match if there is more than one message in a message's thread (includes messages in trash).",
 		Matches: threadHasMultipleMessages,
 	}
+	filters["thread-has-at-least"] = &plugin.MessageFilter{
+		Desc:    "Match if there are at least n messages in a message's thread (includes messages in trash).",
+		Params:  []plugin.FilterParam{{Name: "n", Type: plugin.IntParam}},
+		Matches: threadHasAtLeast,
+	}
+	filters["sender-domain"] = &plugin.MessageFilter{
+		Desc:    "Match if the sender's address is in the domain, or a subdomain of it.",
+		Params:  []plugin.FilterParam{{Name: "domain", Type: plugin.StringParam}},
+		Detail:  api.LabelsOnly,
+		Matches: senderDomain,
+	}
+	filters["subject"] = &plugin.MessageFilter{
+		Desc:    "Match if the subject matches the (case-insensitive) pattern.",
+		Params:  []plugin.FilterParam{{Name: "pattern", Type: plugin.RegexpParam}},
+		Detail:  api.LabelsOnly,
+		Matches: subjectMatches,
+	}
 
 	return &plugin.Plugin{
 		Name:                      "Core",
-		MessageInterest:           messageInterest,
+		MessageInterest:           cp.messageInterest,
 		DetailRequiredForInterest: detailRequiredForInterest,
 		MessageFilters:            filters,
-	}
+	}, nil
 }
 
-var Builder plugin.PluginBuilder = builder
+func init() {
+	plugin.RegisterBuiltin("core", 3, builder)
+}
@@ -0,0 +1,65 @@
+// Package pluginsdedupe is the dedupe plugin, which finds duplicate copies of
+// messages for search --outdated and the 'duplicate' xfilter. It is compiled
+// into gmailcli.
+package pluginsdedupe
+
+import (
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/dedupe"
+	"github.com/tsiemens/gmail-tools/plugin"
+)
+
+type dedupePlugin struct {
+	policy dedupe.Policy
+}
+
+func (dp *dedupePlugin) outdatedMessages(ctx *plugin.Context, baseQuery string,
+	maxMsgs int64) []*gm.Message {
+
+	groups, err := dedupe.Find(ctx.Msgs, baseQuery, maxMsgs, dp.policy)
+	if err != nil {
+		ctx.Log.Println("error:", err)
+		return nil
+	}
+	return dedupe.AllDuplicates(groups)
+}
+
+func (dp *dedupePlugin) isDuplicate(ctx *plugin.Context, m *gm.Message,
+	args plugin.FilterArgs) (bool, error) {
+	return dedupe.IsDuplicate(m, ctx.Msgs, dp.policy)
+}
+
+// NewPlugin returns the plugin, which keeps messages by policy.
+func NewPlugin(policy dedupe.Policy) *plugin.Plugin {
+	dp := &dedupePlugin{policy: policy}
+	filters := make(map[string]*plugin.MessageFilter)
+	filters["duplicate"] = &plugin.MessageFilter{
+		Desc: "Match if another message has the same Message-ID, and is kept " +
+			"instead by the dedupe Keep policy.",
+		Detail:  api.LabelsOnly,
+		Matches: dp.isDuplicate,
+	}
+	return &plugin.Plugin{
+		Name:             "Dedupe",
+		OutdatedMessages: dp.outdatedMessages,
+		MessageFilters:   filters,
+	}
+}
+
+func builder(ctx *plugin.Context) (*plugin.Plugin, error) {
+	conf := &dedupe.Config{}
+	if err := ctx.LoadConfig(conf); err != nil {
+		return nil, err
+	}
+	policy, err := dedupe.ParsePolicy(conf.Keep)
+	if err != nil {
+		return nil, err
+	}
+	return NewPlugin(policy), nil
+}
+
+func init() {
+	plugin.RegisterBuiltin("dedupe", 3, builder)
+}
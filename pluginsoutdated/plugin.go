@@ -0,0 +1,55 @@
+package pluginsoutdated
+
+import (
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/plugin"
+)
+
+// The plugin's section of PluginConfig in config.yaml
+type outdatedConfig struct {
+	Rules []Rule `yaml:"Rules"`
+}
+
+// OutdatedMessages returns the messages matched by baseQuery which are
+// outdated according to the rules.
+func (rs *RuleSet) OutdatedMessages(ctx *plugin.Context, baseQuery string,
+	maxMsgs int64) []*gm.Message {
+
+	query := func(q string, maxMsgs int64) ([]*gm.Message, error) {
+		ctx.Debug("query:", q)
+		return ctx.Msgs.QueryMessages(q, false, false, maxMsgs, api.LabelsOnly)
+	}
+	msgs, err := rs.Outdated(baseQuery, maxMsgs, query)
+	if err != nil {
+		ctx.Log.Println("error:", err)
+		return nil
+	}
+	return msgs
+}
+
+// NewPlugin returns the plugin for rules.
+func NewPlugin(rules []Rule) (*plugin.Plugin, error) {
+	rs, err := Compile(rules)
+	if err != nil {
+		return nil, err
+	}
+	plug := &plugin.Plugin{Name: "OutdatedRules"}
+	if rs.Len() > 0 {
+		plug.OutdatedMessages = rs.OutdatedMessages
+	}
+	return plug, nil
+}
+
+func builder(ctx *plugin.Context) (*plugin.Plugin, error) {
+	conf := &outdatedConfig{}
+	if err := ctx.LoadConfig(conf); err != nil {
+		return nil, err
+	}
+	return NewPlugin(conf.Rules)
+}
+
+func init() {
+	plugin.RegisterBuiltin("outdated-rules", 3, builder)
+}
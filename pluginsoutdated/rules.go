@@ -0,0 +1,219 @@
+// Package pluginsoutdated is the outdated messages plugin, which finds
+// notifications superseded by newer ones, according to the rules in its
+// PluginConfig section. It is compiled into gmailcli.
+package pluginsoutdated
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+)
+
+const caseIgnore = "(?i)"
+
+const (
+	// Messages from the same sender with the same subject key supersede each
+	// other
+	SenderScope = "sender"
+	// Messages in the same thread supersede each other
+	ThreadScope = "thread"
+)
+
+var replyPrefixRegexp = regexp.MustCompile(`(?i)^((re|fwd?)\s*:\s*)+`)
+var spaceRegexp = regexp.MustCompile(`\s+`)
+
+// Rule describes a stream of notifications in which only the newest message
+// is current, and older ones are outdated. Patterns are case-insensitive
+// regular expressions. e.g.
+//
+//	Name: ci-builds
+//	Query: from:ci@example.com
+//	SubjectKey: '^Build #\d+ of (\S+)'
+type Rule struct {
+	Name string `yaml:"Name"`
+	// Search terms for the messages the rule applies to
+	Query string `yaml:"Query"`
+	// Matched against the sender, as "Name <address>"
+	From    string `yaml:"From"`
+	Subject string `yaml:"Subject"`
+	// SenderScope (the default) or ThreadScope
+	Scope string `yaml:"Scope"`
+	// With SenderScope, the key is the subject's matches of the capture groups
+	// in this pattern (or the whole match, if it has none). Messages which
+	// don't match are not outdated by the rule. By default, the key is the
+	// whole subject, without Re: and Fwd: prefixes.
+	SubjectKey string `yaml:"SubjectKey"`
+}
+
+type compiledRule struct {
+	*Rule
+	from       *regexp.Regexp
+	subject    *regexp.Regexp
+	subjectKey *regexp.Regexp
+}
+
+func compileRule(r *Rule) (*compiledRule, error) {
+	if r.Name == "" {
+		return nil, fmt.Errorf("Outdated rule has no Name")
+	}
+	if r.Query == "" && r.From == "" && r.Subject == "" {
+		return nil, fmt.Errorf("Outdated rule %s needs a Query, From or Subject", r.Name)
+	}
+	if r.Scope != "" && r.Scope != SenderScope && r.Scope != ThreadScope {
+		return nil, fmt.Errorf("Outdated rule %s: Scope must be %s or %s",
+			r.Name, SenderScope, ThreadScope)
+	}
+	if r.Scope == ThreadScope && r.SubjectKey != "" {
+		return nil, fmt.Errorf("Outdated rule %s: SubjectKey is not used with Scope %s",
+			r.Name, ThreadScope)
+	}
+
+	cr := &compiledRule{Rule: r}
+	var err error
+	compile := func(pat, attr string) *regexp.Regexp {
+		if pat == "" || err != nil {
+			return nil
+		}
+		var re *regexp.Regexp
+		re, err = regexp.Compile(caseIgnore + pat)
+		if err != nil {
+			err = fmt.Errorf("Outdated rule %s: invalid %s: %v", r.Name, attr, err)
+		}
+		return re
+	}
+	cr.from = compile(r.From, "From")
+	cr.subject = compile(r.Subject, "Subject")
+	cr.subjectKey = compile(r.SubjectKey, "SubjectKey")
+	if err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// NormalizeSubject removes Re: and Fwd: prefixes from subject, and
+// normalizes its case and spacing.
+func NormalizeSubject(subject string) string {
+	subject = replyPrefixRegexp.ReplaceAllString(strings.TrimSpace(subject), "")
+	return strings.ToLower(spaceRegexp.ReplaceAllString(subject, " "))
+}
+
+// key returns the key of m, which messages that supersede each other share.
+// ok is false if the rule does not apply to m.
+func (cr *compiledRule) key(m *gm.Message) (key string, ok bool) {
+	headers, err := api.GetMsgHeaders(m)
+	if err != nil {
+		return "", false
+	}
+	if cr.from != nil && !cr.from.MatchString(headers.From.String()) {
+		return "", false
+	}
+	if cr.subject != nil && !cr.subject.MatchString(headers.Subject) {
+		return "", false
+	}
+	if cr.Scope == ThreadScope {
+		return m.ThreadId, true
+	}
+
+	subject := NormalizeSubject(headers.Subject)
+	if cr.subjectKey != nil {
+		match := cr.subjectKey.FindStringSubmatch(subject)
+		if match == nil {
+			return "", false
+		}
+		if len(match) > 1 {
+			match = match[1:]
+		}
+		subject = strings.Join(match, "\x00")
+	}
+	return strings.ToLower(headers.From.Address) + "\x00" + subject, true
+}
+
+// Outdated returns the messages of msgs which are superseded by a newer
+// message in msgs. msgs must be loaded with at least api.LabelsOnly.
+func (cr *compiledRule) Outdated(msgs []*gm.Message) []*gm.Message {
+	newest := make(map[string]int64)
+	keys := make([]string, len(msgs))
+	for i, m := range msgs {
+		key, ok := cr.key(m)
+		if !ok {
+			continue
+		}
+		keys[i] = key
+		if latest, seen := newest[key]; !seen || m.InternalDate > latest {
+			newest[key] = m.InternalDate
+		}
+	}
+
+	var outdated []*gm.Message
+	for i, m := range msgs {
+		if keys[i] != "" && m.InternalDate < newest[keys[i]] {
+			outdated = append(outdated, m)
+		}
+	}
+	return outdated
+}
+
+// RuleSet is a list of validated rules.
+type RuleSet struct {
+	rules []*compiledRule
+}
+
+// Compile validates rules, and prepares them to be matched.
+func Compile(rules []Rule) (*RuleSet, error) {
+	rs := &RuleSet{}
+	names := make(map[string]bool)
+	for i := range rules {
+		cr, err := compileRule(&rules[i])
+		if err != nil {
+			return nil, err
+		}
+		if names[cr.Name] {
+			return nil, fmt.Errorf("Multiple outdated rules named %s", cr.Name)
+		}
+		names[cr.Name] = true
+		rs.rules = append(rs.rules, cr)
+	}
+	return rs, nil
+}
+
+func (rs *RuleSet) Len() int {
+	return len(rs.rules)
+}
+
+// QueryFunc queries for messages, loaded with at least api.LabelsOnly.
+// maxMsgs is -1 for unlimited.
+type QueryFunc func(query string, maxMsgs int64) ([]*gm.Message, error)
+
+// Outdated returns the messages matched by baseQuery which any rule finds
+// outdated, newest first, and at most maxMsgs of them (-1 for unlimited).
+// Each rule queries for at most the newest maxMsgs messages.
+func (rs *RuleSet) Outdated(baseQuery string, maxMsgs int64, query QueryFunc,
+) ([]*gm.Message, error) {
+	seen := make(map[string]bool)
+	var outdated []*gm.Message
+	for _, cr := range rs.rules {
+		msgs, err := query(strings.TrimSpace(baseQuery+" "+cr.Query), maxMsgs)
+		if err != nil {
+			return nil, fmt.Errorf("Outdated rule %s: %v", cr.Name, err)
+		}
+		for _, m := range cr.Outdated(msgs) {
+			if !seen[m.Id] {
+				seen[m.Id] = true
+				outdated = append(outdated, m)
+			}
+		}
+	}
+
+	sort.SliceStable(outdated, func(i, j int) bool {
+		return outdated[i].InternalDate > outdated[j].InternalDate
+	})
+	if maxMsgs > 0 && int64(len(outdated)) > maxMsgs {
+		outdated = outdated[:maxMsgs]
+	}
+	return outdated, nil
+}
@@ -0,0 +1,77 @@
+package pluginsrules
+
+import (
+	"time"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/plugin"
+)
+
+// The plugin's section of PluginConfig in config.yaml
+type rulesConfig struct {
+	Rules []Rule `yaml:"Rules"`
+}
+
+// MessageInterest returns the interest of a message according to the rules.
+func (rs *RuleSet) MessageInterest(ctx *plugin.Context, m *gm.Message) plugin.Interest {
+	helper := ctx.Msgs
+	m, err := helper.GetMessage(m.Id, api.LabelsOnly)
+	if err != nil {
+		ctx.Log.Println("error:", err)
+		return plugin.Interest{Level: plugin.UnknownInterest, Reason: err.Error()}
+	}
+	msg := &Message{
+		Msg:        m,
+		LabelNames: helper.MessageLabelNames(m),
+		Now:        time.Now(),
+		ThreadSize: func() (int, error) {
+			thread, err := helper.GetThread(m.ThreadId, api.IdsOnly)
+			if err != nil {
+				return 0, err
+			}
+			return len(thread.Messages), nil
+		},
+	}
+	interest, rule, err := rs.Evaluate(msg)
+	if err != nil {
+		ctx.Log.Println("error:", err)
+		return plugin.Interest{Level: plugin.UnknownInterest, Reason: err.Error()}
+	}
+	if rule == nil {
+		return plugin.Interest{Level: interest, Reason: "No rule matched"}
+	}
+	ctx.Debug("message", m.Id, "matched interest rule", rule.Name)
+	return plugin.Interest{Level: interest, Reason: "Rule " + rule.Name + " matched"}
+}
+
+func detailRequiredForInterest() api.MessageDetailLevel {
+	return api.LabelsOnly
+}
+
+// NewPlugin returns the plugin for rules.
+func NewPlugin(rules []Rule) (*plugin.Plugin, error) {
+	rs, err := Compile(rules)
+	if err != nil {
+		return nil, err
+	}
+	plug := &plugin.Plugin{Name: "InterestRules"}
+	if rs.Len() > 0 {
+		plug.MessageInterest = rs.MessageInterest
+		plug.DetailRequiredForInterest = detailRequiredForInterest
+	}
+	return plug, nil
+}
+
+func builder(ctx *plugin.Context) (*plugin.Plugin, error) {
+	conf := &rulesConfig{}
+	if err := ctx.LoadConfig(conf); err != nil {
+		return nil, err
+	}
+	return NewPlugin(conf.Rules)
+}
+
+func init() {
+	plugin.RegisterBuiltin("interest-rules", 3, builder)
+}
@@ -0,0 +1,306 @@
+// Package pluginsrules is the interest rules plugin, which categorises interest
+// by the declarative rules in its PluginConfig section. It is compiled into
+// gmailcli.
+package pluginsrules
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/plugin"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+const caseIgnore = "(?i)"
+
+// Rule assigns an interest level to messages which match all of its
+// conditions. Patterns are case-insensitive regular expressions. e.g.
+//
+//	Name: github-mentions
+//	Interest: strongly-interesting
+//	Domain: github.com
+//	Headers: {X-GitHub-Reason: mention}
+type Rule struct {
+	Name string `yaml:"Name"`
+	// An interest level, e.g. weakly-uninteresting
+	Interest string `yaml:"Interest"`
+
+	// Matched against the sender, as "Name <address>"
+	From string `yaml:"From"`
+	// The sender's domain, or a parent domain of it
+	Domain  string `yaml:"Domain"`
+	Subject string `yaml:"Subject"`
+	ListId  string `yaml:"ListId"`
+	// Header name -> pattern for its value
+	Headers map[string]string `yaml:"Headers"`
+	// Matched against each of the message's label names
+	Label string `yaml:"Label"`
+	// Number of messages in the message's thread. 0 for no limit.
+	MinThreadSize int `yaml:"MinThreadSize"`
+	MaxThreadSize int `yaml:"MaxThreadSize"`
+	// Age of the message, e.g. 12h, 30d or 2w
+	OlderThan string `yaml:"OlderThan"`
+	NewerThan string `yaml:"NewerThan"`
+}
+
+type compiledRule struct {
+	*Rule
+	interest  plugin.InterestLevel
+	from      *regexp.Regexp
+	domain    string
+	subject   *regexp.Regexp
+	listId    *regexp.Regexp
+	headers   map[string]*regexp.Regexp
+	label     *regexp.Regexp
+	olderThan time.Duration
+	newerThan time.Duration
+}
+
+// ParseAge parses an age such as 30d or 2w, or a Go duration such as 12h.
+func ParseAge(s string) (time.Duration, error) {
+	if len(s) > 1 {
+		unit := time.Duration(0)
+		switch s[len(s)-1] {
+		case 'd':
+			unit = 24 * time.Hour
+		case 'w':
+			unit = 7 * 24 * time.Hour
+		}
+		if unit != 0 {
+			if n, err := strconv.Atoi(s[:len(s)-1]); err == nil && n >= 0 {
+				return time.Duration(n) * unit, nil
+			}
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("Invalid age '%s'. Expected e.g. 12h, 30d or 2w", s)
+	}
+	return d, nil
+}
+
+func compileRule(r *Rule) (*compiledRule, error) {
+	if r.Name == "" {
+		return nil, fmt.Errorf("Interest rule has no Name")
+	}
+	cr := &compiledRule{Rule: r, domain: strings.ToLower(strings.TrimPrefix(r.Domain, "@"))}
+	var err error
+	cr.interest, err = plugin.ParseInterestLevel(r.Interest)
+	if err == nil && cr.interest == plugin.UnknownInterest {
+		err = fmt.Errorf("Interest is required")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Interest rule %s: %v", r.Name, err)
+	}
+
+	compile := func(pat, attr string) *regexp.Regexp {
+		if pat == "" || err != nil {
+			return nil
+		}
+		var re *regexp.Regexp
+		re, err = regexp.Compile(caseIgnore + pat)
+		if err != nil {
+			err = fmt.Errorf("Interest rule %s: invalid %s: %v", r.Name, attr, err)
+		}
+		return re
+	}
+	cr.from = compile(r.From, "From")
+	cr.subject = compile(r.Subject, "Subject")
+	cr.listId = compile(r.ListId, "ListId")
+	cr.label = compile(r.Label, "Label")
+	if len(r.Headers) > 0 {
+		cr.headers = make(map[string]*regexp.Regexp)
+		for name, pat := range r.Headers {
+			cr.headers[strings.ToLower(name)] = compile(pat, "Headers: "+name)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if r.OlderThan != "" {
+		if cr.olderThan, err = ParseAge(r.OlderThan); err != nil {
+			return nil, fmt.Errorf("Interest rule %s: %v", r.Name, err)
+		}
+	}
+	if r.NewerThan != "" {
+		if cr.newerThan, err = ParseAge(r.NewerThan); err != nil {
+			return nil, fmt.Errorf("Interest rule %s: %v", r.Name, err)
+		}
+	}
+	if r.MinThreadSize < 0 || r.MaxThreadSize < 0 ||
+		(r.MaxThreadSize > 0 && r.MaxThreadSize < r.MinThreadSize) {
+		return nil, fmt.Errorf("Interest rule %s: invalid thread size limits", r.Name)
+	}
+
+	if cr.from == nil && cr.domain == "" && cr.subject == nil && cr.listId == nil &&
+		cr.headers == nil && cr.label == nil && !cr.needsThreadSize() &&
+		r.OlderThan == "" && r.NewerThan == "" {
+		return nil, fmt.Errorf("Interest rule %s has no conditions", r.Name)
+	}
+	return cr, nil
+}
+
+func (cr *compiledRule) needsThreadSize() bool {
+	return cr.MinThreadSize > 0 || cr.MaxThreadSize > 0
+}
+
+// Message is a message for rules to be matched against.
+type Message struct {
+	Msg        *gm.Message
+	LabelNames []string
+	Now        time.Time
+	// Returns the number of messages in the message's thread. Only called if
+	// a rule needs it.
+	ThreadSize func() (int, error)
+
+	headers    *api.Headers
+	threadSize *int
+}
+
+func (m *Message) getHeaders() *api.Headers {
+	if m.headers == nil {
+		var err error
+		if m.headers, err = api.GetMsgHeaders(m.Msg); err != nil {
+			m.headers = &api.Headers{}
+		}
+	}
+	return m.headers
+}
+
+func (m *Message) getThreadSize() (int, error) {
+	if m.threadSize == nil {
+		size, err := m.ThreadSize()
+		if err != nil {
+			return 0, err
+		}
+		m.threadSize = &size
+	}
+	return *m.threadSize, nil
+}
+
+func (m *Message) headerMatches(name string, re *regexp.Regexp) bool {
+	if m.Msg.Payload == nil {
+		return false
+	}
+	for _, hdr := range m.Msg.Payload.Headers {
+		if strings.ToLower(hdr.Name) == name && re.MatchString(hdr.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cr *compiledRule) matches(m *Message) (bool, error) {
+	if cr.from != nil || cr.domain != "" || cr.subject != nil || cr.listId != nil {
+		headers := m.getHeaders()
+		if cr.from != nil && !cr.from.MatchString(headers.From.String()) {
+			return false, nil
+		}
+		if cr.domain != "" {
+			addr := strings.ToLower(headers.From.Address)
+			domain := addr[strings.LastIndex(addr, "@")+1:]
+			if domain != cr.domain && !strings.HasSuffix(domain, "."+cr.domain) {
+				return false, nil
+			}
+		}
+		if cr.subject != nil && !cr.subject.MatchString(headers.Subject) {
+			return false, nil
+		}
+		if cr.listId != nil && (headers.ListId == "" || !cr.listId.MatchString(headers.ListId)) {
+			return false, nil
+		}
+	}
+	for name, re := range cr.headers {
+		if !m.headerMatches(name, re) {
+			return false, nil
+		}
+	}
+	if cr.label != nil {
+		matched := false
+		for _, name := range m.LabelNames {
+			if cr.label.MatchString(name) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	if cr.olderThan > 0 || cr.newerThan > 0 {
+		age := m.Now.Sub(util.TimeFromMillis(m.Msg.InternalDate))
+		if (cr.olderThan > 0 && age < cr.olderThan) ||
+			(cr.newerThan > 0 && age >= cr.newerThan) {
+			return false, nil
+		}
+	}
+	if cr.needsThreadSize() {
+		size, err := m.getThreadSize()
+		if err != nil {
+			return false, err
+		}
+		if size < cr.MinThreadSize || (cr.MaxThreadSize > 0 && size > cr.MaxThreadSize) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// RuleSet is a list of validated rules.
+type RuleSet struct {
+	rules []*compiledRule
+}
+
+// Compile validates rules, and prepares them to be matched.
+func Compile(rules []Rule) (*RuleSet, error) {
+	rs := &RuleSet{}
+	names := make(map[string]bool)
+	for i := range rules {
+		cr, err := compileRule(&rules[i])
+		if err != nil {
+			return nil, err
+		}
+		if names[cr.Name] {
+			return nil, fmt.Errorf("Multiple interest rules named %s", cr.Name)
+		}
+		names[cr.Name] = true
+		rs.rules = append(rs.rules, cr)
+	}
+	return rs, nil
+}
+
+func (rs *RuleSet) Len() int {
+	return len(rs.rules)
+}
+
+// Evaluate returns the interest of the message, combined (as by
+// InterestLevel.Combine) from each rule it matches, and the first rule which
+// gave that interest. The rule is nil if none matched.
+func (rs *RuleSet) Evaluate(m *Message) (plugin.InterestLevel, *Rule, error) {
+	interest := plugin.UnknownInterest
+	var decider *Rule
+	for _, cr := range rs.rules {
+		if interest.Combine(cr.interest) == interest && decider != nil {
+			// Can't change the result
+			continue
+		}
+		matched, err := cr.matches(m)
+		if err != nil {
+			return plugin.UnknownInterest, nil, fmt.Errorf("Interest rule %s: %v", cr.Name, err)
+		}
+		if matched {
+			interest = interest.Combine(cr.interest)
+			if interest == cr.interest {
+				decider = cr.Rule
+			}
+		}
+	}
+	return interest, decider, nil
+}
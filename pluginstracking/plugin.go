@@ -0,0 +1,164 @@
+package pluginstracking
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/spf13/cobra"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/mime"
+	"github.com/tsiemens/gmail-tools/plugin"
+	"github.com/tsiemens/gmail-tools/prnt"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+const (
+	defaultLabel = "Tracking"
+	// The Store key of the numbers found, by message ID
+	numbersKey = "numbers"
+)
+
+// Config is the tracking section of PluginConfig in config.yaml
+type Config struct {
+	// The label applied by the track action. Defaults to Tracking.
+	Label string `yaml:"Label"`
+}
+
+func (c *Config) GetLabel() string {
+	if c.Label == "" {
+		return defaultLabel
+	}
+	return c.Label
+}
+
+// Tracked is a tracking number found by the track action
+type Tracked struct {
+	Number
+	Subject string `json:"subject"`
+}
+
+type trackingPlugin struct {
+	label string
+	// Guards creating the label, and updating the Store
+	mutex sync.Mutex
+}
+
+func (tp *trackingPlugin) createLabel(ctx *plugin.Context) error {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+	_, err := ctx.Msgs.CreateMissingLabels([]string{tp.label})
+	return err
+}
+
+func (tp *trackingPlugin) store(ctx *plugin.Context, msgId string, t Tracked) error {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+	tracked := make(map[string]Tracked)
+	if _, err := ctx.Store.Get(numbersKey, &tracked); err != nil {
+		return err
+	}
+	tracked[msgId] = t
+	return ctx.Store.Set(numbersKey, tracked)
+}
+
+func (tp *trackingPlugin) track(ctx *plugin.Context, m *gm.Message, dryRun bool,
+) (plugin.ActionResult, error) {
+	m, err := ctx.Msgs.GetMessage(m.Id, api.LabelsAndPayload)
+	if err != nil {
+		return plugin.ActionResult{}, err
+	}
+	mimeMsg, err := mime.Parse(m.Payload)
+	if err != nil {
+		return plugin.ActionResult{}, err
+	}
+	subject := ""
+	if headers, err := api.GetMsgHeaders(m); err == nil {
+		subject = headers.Subject
+	}
+	num, ok := FindNumber(subject + "\n" + mimeMsg.PreferredText())
+	if !ok {
+		return plugin.ActionResult{Desc: "No tracking number found"}, nil
+	}
+	found := fmt.Sprintf("%s %s", num.Carrier, num.Number)
+	if util.StringSliceContains(tp.label, ctx.Msgs.MessageLabelNames(m)) {
+		return plugin.ActionResult{Desc: found + ", already labelled " + tp.label}, nil
+	}
+	if dryRun {
+		return plugin.ActionResult{
+			Changed: true, Desc: found + ", would label " + tp.label}, nil
+	}
+
+	if err = tp.createLabel(ctx); err != nil {
+		return plugin.ActionResult{}, err
+	}
+	err = ctx.Msgs.ApplyLabels([]*gm.Message{m},
+		[]api.Label{api.NewLabelWithName(tp.label)}, nil)
+	if err != nil {
+		return plugin.ActionResult{}, err
+	}
+	if err = tp.store(ctx, m.Id, Tracked{Number: num, Subject: subject}); err != nil {
+		return plugin.ActionResult{}, err
+	}
+	return plugin.ActionResult{Changed: true, Desc: found + ", labelled " + tp.label}, nil
+}
+
+func runTrackingCmd(ctx *plugin.Context, cmd *cobra.Command, args []string) error {
+	tracked := make(map[string]Tracked)
+	if _, err := ctx.Store.Get(numbersKey, &tracked); err != nil {
+		return err
+	}
+	if len(tracked) == 0 {
+		prnt.HPrintln(prnt.Always, "No tracking numbers found yet. "+
+			"Use search --action track to find them.")
+		return nil
+	}
+	ids := make([]string, 0, len(tracked))
+	for id := range tracked {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	prnt.Hum.Always.F("%-18s %-8s %-24s %s\n", "MESSAGE", "CARRIER", "NUMBER", "SUBJECT")
+	for _, id := range ids {
+		t := tracked[id]
+		prnt.Hum.Always.F("%-18s %-8s %-24s %s\n", id, t.Carrier, t.Number, t.Subject)
+	}
+	return nil
+}
+
+// NewPlugin returns the plugin, which applies label to tracked messages.
+func NewPlugin(label string) *plugin.Plugin {
+	tp := &trackingPlugin{label: label}
+	actions := make(map[string]*plugin.MessageAction)
+	actions["track"] = &plugin.MessageAction{
+		Desc: "Find a UPS, USPS or FedEx tracking number in the message, and " +
+			"label it " + label,
+		Run: tp.track,
+	}
+	return &plugin.Plugin{
+		Name:           "Tracking",
+		MessageActions: actions,
+	}
+}
+
+func builder(ctx *plugin.Context) (*plugin.Plugin, error) {
+	conf := &Config{}
+	if err := ctx.LoadConfig(conf); err != nil {
+		return nil, err
+	}
+	return NewPlugin(conf.GetLabel()), nil
+}
+
+func init() {
+	plugin.RegisterBuiltin("tracking", 3, builder)
+	plugin.RegisterBuiltinCommand("tracking", &plugin.Command{
+		Cobra: &cobra.Command{
+			Use:   "tracking",
+			Short: "Lists the tracking numbers found by search --action track",
+			Args:  cobra.NoArgs,
+		},
+		Run: runTrackingCmd,
+	})
+}
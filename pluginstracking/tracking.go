@@ -0,0 +1,52 @@
+// Package pluginstracking is the tracking plugin, which provides the 'track'
+// message action to find shipment tracking numbers in messages and label them,
+// and the 'tracking' command to list the numbers found. It is compiled into
+// gmailcli.
+package pluginstracking
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Carrier is a shipping carrier, and the form of its tracking numbers
+type Carrier struct {
+	Name    string
+	pattern *regexp.Regexp
+	// If set, the text must also match this, since the numbers are ambiguous
+	mention *regexp.Regexp
+}
+
+// Carriers are checked in order
+var Carriers = []*Carrier{
+	{Name: "UPS", pattern: regexp.MustCompile(`\b1Z[0-9A-Z]{16}\b`)},
+	{Name: "USPS", pattern: regexp.MustCompile(`\b(9[2-5]\d{20}|[A-Z]{2}\d{9}US)\b`)},
+	{Name: "FedEx", pattern: regexp.MustCompile(`\b(\d{12}|\d{15})\b`),
+		mention: regexp.MustCompile(`(?i)\bfed\s?ex\b`)},
+}
+
+// Numbers are often split into groups for readability
+var groupSeparatorRe = regexp.MustCompile(`(\w) (\w)`)
+
+// Number is a tracking number found in a message
+type Number struct {
+	Carrier string `json:"carrier"`
+	Number  string `json:"number"`
+}
+
+// FindNumber returns the first tracking number in text, and false if there is
+// none.
+func FindNumber(text string) (Number, bool) {
+	compact := groupSeparatorRe.ReplaceAllString(text, "$1$2")
+	for _, c := range Carriers {
+		if c.mention != nil && !c.mention.MatchString(text) {
+			continue
+		}
+		for _, t := range []string{text, compact} {
+			if num := c.pattern.FindString(strings.ToUpper(t)); num != "" {
+				return Number{Carrier: c.Name, Number: num}, true
+			}
+		}
+	}
+	return Number{}, false
+}
@@ -0,0 +1,39 @@
+package retention
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// PolicyReport is the result of applying one policy.
+type PolicyReport struct {
+	Policy string `json:"policy"`
+	Query  string `json:"query"`
+	Action string `json:"action"`
+	// Messages matching the query, and which of those were exempt
+	Matched int `json:"matched"`
+	Exempt  int `json:"exempt"`
+	// Messages the action was applied to
+	Applied int    `json:"applied"`
+	Error   string `json:"error,omitempty"`
+	// Counts of the non-exempt messages
+	ByLabel  map[string]int `json:"byLabel,omitempty"`
+	BySender map[string]int `json:"bySender,omitempty"`
+}
+
+// Report records a run of the retention policies.
+type Report struct {
+	Time     time.Time       `json:"time"`
+	DryRun   bool            `json:"dryRun"`
+	Policies []*PolicyReport `json:"policies"`
+}
+
+// Write saves the report as JSON to fname, replacing any existing file.
+func (r *Report) Write(fname string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fname, append(data, '\n'), 0600)
+}
@@ -0,0 +1,181 @@
+// Package retention defines retention policies, which trash (or archive)
+// messages once they reach a certain age.
+package retention
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+// Values for Policy.Action
+const (
+	TrashAction   = "trash"
+	ArchiveAction = "archive"
+)
+
+var olderThanRegexp = regexp.MustCompile(`^\d+[dmy]$`)
+
+// Policy is a retention rule, as configured in the Retention section of
+// config.yaml. e.g.
+//
+//	Name: old-ci
+//	Label: Notifications/CI
+//	OlderThan: 7d
+//	Query: -is:starred
+type Policy struct {
+	Name string `yaml:"Name"`
+	// A label name, or a system label such as CATEGORY_PROMOTIONS or INBOX
+	Label string `yaml:"Label"`
+	// Age, as for older_than: in queries (e.g. 30d, 6m, 1y)
+	OlderThan string `yaml:"OlderThan"`
+	// Extra query terms, e.g. -is:starred
+	Query string `yaml:"Query"`
+	// "trash" (the default) or "archive". Gmail deletes messages which have
+	// been in the trash for 30 days.
+	Action string `yaml:"Action"`
+	// Keep messages with labels matched by InterestingLabelPatterns
+	ExemptInteresting bool `yaml:"ExemptInteresting"`
+	// Keep messages with labels matching any of these (case-insensitive)
+	ExemptLabelPatterns []string `yaml:"ExemptLabelPatterns"`
+}
+
+func (p *Policy) String() string {
+	return p.Name
+}
+
+// EffectiveAction returns Action, or the default if it is not set.
+func (p *Policy) EffectiveAction() string {
+	if p.Action == "" {
+		return TrashAction
+	}
+	return p.Action
+}
+
+// HasExemptions returns true if messages need to be checked for exemptions
+// after the query.
+func (p *Policy) HasExemptions() bool {
+	return p.ExemptInteresting || len(p.ExemptLabelPatterns) > 0
+}
+
+// ExemptLabelRegexps compiles ExemptLabelPatterns.
+func (p *Policy) ExemptLabelRegexps() ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, pat := range p.ExemptLabelPatterns {
+		re, err := regexp.Compile("(?i)" + pat)
+		if err != nil {
+			return nil, fmt.Errorf("Policy %s: invalid exempt label pattern: %v", p.Name, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// systemLabelIds are the IDs of the system labels which policies may use, other
+// than the CATEGORY_ labels.
+var systemLabelIds = []string{
+	"INBOX", "SPAM", "TRASH", "UNREAD", "STARRED", "IMPORTANT", "SENT", "DRAFT",
+}
+
+// HasSystemLabel returns true if Label is a system label (INBOX,
+// CATEGORY_SOCIAL, etc.) rather than a user label name.
+func (p *Policy) HasSystemLabel() bool {
+	return util.StringSliceContains(p.Label, systemLabelIds) ||
+		strings.HasPrefix(p.Label, "CATEGORY_")
+}
+
+// labelTerm returns the query term for the policy's label
+func (p *Policy) labelTerm() string {
+	switch {
+	case !p.HasSystemLabel():
+		return fmt.Sprintf(`label:"%s"`, p.Label)
+	case strings.HasPrefix(p.Label, "CATEGORY_"):
+		return "category:" + strings.ToLower(strings.TrimPrefix(p.Label, "CATEGORY_"))
+	}
+	return "in:" + strings.ToLower(p.Label)
+}
+
+// SearchQuery returns the query for the messages which the policy applies to
+// (before exemptions).
+func (p *Policy) SearchQuery() string {
+	terms := []string{p.labelTerm(), "older_than:" + p.OlderThan}
+	if p.EffectiveAction() == ArchiveAction {
+		terms = append(terms, "in:inbox")
+	}
+	if p.Query != "" {
+		terms = append(terms, "("+p.Query+")")
+	}
+	return strings.Join(terms, " ")
+}
+
+// Validate checks that the policy is complete and well formed.
+func (p *Policy) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("Retention policy has no Name")
+	}
+	if p.Label == "" {
+		return fmt.Errorf("Policy %s has no Label", p.Name)
+	}
+	if !olderThanRegexp.MatchString(p.OlderThan) {
+		return fmt.Errorf("Policy %s: OlderThan must be a number of days, months or "+
+			"years, e.g. 30d, 6m or 1y", p.Name)
+	}
+	if a := p.EffectiveAction(); a != TrashAction && a != ArchiveAction {
+		return fmt.Errorf("Policy %s: Action must be '%s' or '%s'",
+			p.Name, TrashAction, ArchiveAction)
+	}
+	_, err := p.ExemptLabelRegexps()
+	return err
+}
+
+// ValidatePolicies validates each policy, and checks that their names are
+// unique.
+func ValidatePolicies(policies []Policy) error {
+	names := make(map[string]bool)
+	for i := range policies {
+		if err := policies[i].Validate(); err != nil {
+			return err
+		}
+		if names[policies[i].Name] {
+			return fmt.Errorf("Multiple retention policies named %s", policies[i].Name)
+		}
+		names[policies[i].Name] = true
+	}
+	return nil
+}
+
+// SelectPolicies returns the policies with the given names, in config order,
+// or all policies if names is empty.
+func SelectPolicies(policies []Policy, names []string) ([]*Policy, error) {
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var selected []*Policy
+	for i := range policies {
+		if len(names) == 0 || wanted[policies[i].Name] {
+			selected = append(selected, &policies[i])
+			delete(wanted, policies[i].Name)
+		}
+	}
+	for _, name := range names {
+		if wanted[name] {
+			return nil, fmt.Errorf("No retention policy named %s", name)
+		}
+	}
+	return selected, nil
+}
+
+// IsExempt returns true if any of labelNames matches one of the regexps.
+func IsExempt(labelNames []string, exemptRegexps []*regexp.Regexp) bool {
+	for _, name := range labelNames {
+		for _, re := range exemptRegexps {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package rules
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// LockFile prevents rules from being run by more than one process at a time.
+// It holds the PID of its owner, so that it can be taken over if the owner
+// died without removing it.
+type LockFile struct {
+	fname string
+}
+
+// LockedError is returned by AcquireLock when another process holds the lock.
+type LockedError struct {
+	Fname string
+	Pid   int
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("Rules are already being run by process %d (lock file %s)",
+		e.Pid, e.Fname)
+}
+
+func processIsAlive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return proc.Signal(syscall.Signal(0)) == nil
+}
+
+// AcquireLock creates the lock file fname. If it already exists and its owner
+// is still running, a *LockedError is returned.
+func AcquireLock(fname string) (*LockFile, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			if err != nil {
+				os.Remove(fname)
+				return nil, err
+			}
+			return &LockFile{fname: fname}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		data, err := os.ReadFile(fname)
+		if err != nil {
+			return nil, err
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err == nil && processIsAlive(pid) {
+			return nil, &LockedError{Fname: fname, Pid: pid}
+		}
+		// Stale lock
+		if err = os.Remove(fname); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("Failed to acquire lock %s", fname)
+}
+
+// Release removes the lock file.
+func (l *LockFile) Release() error {
+	return os.Remove(l.fname)
+}
@@ -0,0 +1,128 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Values for Rule.Interest
+const (
+	AnyInterest   = ""
+	Interesting   = "interesting"
+	Uninteresting = "uninteresting"
+)
+
+// Actions are the changes a rule makes to the messages it matches. They
+// correspond to the label modification flags of search.
+type Actions struct {
+	AddLabels    []string `yaml:"AddLabels"`
+	RemoveLabels []string `yaml:"RemoveLabels"`
+	Archive      bool     `yaml:"Archive"`
+	Trash        bool     `yaml:"Trash"`
+	Touch        bool     `yaml:"Touch"`
+	// Create labels in AddLabels if they don't exist
+	CreateLabels bool `yaml:"CreateLabels"`
+}
+
+// Modifies returns true if the actions would change any message.
+func (a *Actions) Modifies() bool {
+	return len(a.AddLabels) > 0 || len(a.RemoveLabels) > 0 ||
+		a.Archive || a.Trash || a.Touch
+}
+
+// Rule is a saved search, and the actions to apply to the messages it finds,
+// as configured in the Rules section of config.yaml.
+type Rule struct {
+	Name  string `yaml:"Name"`
+	Query string `yaml:"Query"`
+	// Messages must have a label matching each of these (as search -l)
+	LabelPatterns []string `yaml:"LabelPatterns"`
+	// One of "interesting" or "uninteresting" (as search -i/-u), or empty
+	Interest string `yaml:"Interest"`
+	// Names of xfilters to apply, and to apply inversely (as search -f/-F)
+	XFilters    []string `yaml:"XFilters"`
+	NotXFilters []string `yaml:"NotXFilters"`
+	// If greater than 0, a max on how many messages are queried
+	Max     int64   `yaml:"Max"`
+	Actions Actions `yaml:"Actions"`
+	// Cron schedule for 'rules daemon'. Rules without one are only run by
+	// 'rules run'.
+	Schedule string `yaml:"Schedule"`
+}
+
+func (r *Rule) String() string {
+	return r.Name
+}
+
+// ParsedSchedule returns the rule's schedule, or nil if it has none.
+func (r *Rule) ParsedSchedule() (*Schedule, error) {
+	if r.Schedule == "" {
+		return nil, nil
+	}
+	return ParseSchedule(r.Schedule)
+}
+
+// Validate checks the parts of the rule which can be checked without
+// reference to the account (label names and xfilters are checked when run).
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("Rule has no Name")
+	}
+	if r.Query == "" {
+		return fmt.Errorf("Rule %s has no Query", r.Name)
+	}
+	if r.Interest != AnyInterest && r.Interest != Interesting &&
+		r.Interest != Uninteresting {
+		return fmt.Errorf("Rule %s: Interest must be '%s' or '%s'",
+			r.Name, Interesting, Uninteresting)
+	}
+	for _, pat := range r.LabelPatterns {
+		if _, err := regexp.Compile(pat); err != nil {
+			return fmt.Errorf("Rule %s: invalid label pattern: %v", r.Name, err)
+		}
+	}
+	if !r.Actions.Modifies() {
+		return fmt.Errorf("Rule %s has no Actions", r.Name)
+	}
+	if _, err := r.ParsedSchedule(); err != nil {
+		return fmt.Errorf("Rule %s: %v", r.Name, err)
+	}
+	return nil
+}
+
+// ValidateRules validates each rule, and checks that their names are unique.
+func ValidateRules(rules []Rule) error {
+	names := make(map[string]bool)
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return err
+		}
+		if names[rules[i].Name] {
+			return fmt.Errorf("Multiple rules named %s", rules[i].Name)
+		}
+		names[rules[i].Name] = true
+	}
+	return nil
+}
+
+// SelectRules returns the rules with the given names, in config order, or all
+// rules if names is empty.
+func SelectRules(rules []Rule, names []string) ([]*Rule, error) {
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var selected []*Rule
+	for i := range rules {
+		if len(names) == 0 || wanted[rules[i].Name] {
+			selected = append(selected, &rules[i])
+			delete(wanted, rules[i].Name)
+		}
+	}
+	for _, name := range names {
+		if wanted[name] {
+			return nil, fmt.Errorf("No rule named %s", name)
+		}
+	}
+	return selected, nil
+}
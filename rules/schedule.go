@@ -0,0 +1,193 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron schedule. It supports the standard five fields
+// (minute, hour, day of month, month, day of week), with *, lists, ranges and
+// steps (e.g. "*/15 8-18 * * mon-fri"), and the shorthands @hourly, @daily,
+// @weekly, @monthly and "@every <duration>".
+type Schedule struct {
+	spec string
+
+	minute, hour, dom, month, dow uint64
+	// Whether dom or dow were *. Per cron, if both are restricted, a day
+	// matches if either matches.
+	domStar, dowStar bool
+
+	// For @every schedules, which are not aligned to the clock
+	every time.Duration
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun",
+		"jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 6, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+var cronShorthands = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// ParseSchedule parses a cron schedule spec.
+func ParseSchedule(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid schedule '%s': %v", spec, err)
+		}
+		if d < time.Minute {
+			return nil, fmt.Errorf("Invalid schedule '%s': must be at least 1m", spec)
+		}
+		return &Schedule{spec: spec, every: d}, nil
+	}
+
+	expanded := spec
+	if s, ok := cronShorthands[spec]; ok {
+		expanded = s
+	}
+	fields := strings.Fields(expanded)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("Invalid schedule '%s': expected %d fields",
+			spec, len(cronFields))
+	}
+
+	s := &Schedule{spec: spec}
+	sets := []*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, field := range fields {
+		set, err := parseCronField(field, &cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid schedule '%s': %v", spec, err)
+		}
+		*sets[i] = set
+	}
+	s.domStar = fields[2] == "*"
+	s.dowStar = fields[4] == "*"
+	// Sunday may also be given as 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func parseCronValue(str string, f *cronField) (int, error) {
+	for i, name := range f.names {
+		if strings.ToLower(str) == name {
+			return f.min + i, nil
+		}
+	}
+	return strconv.Atoi(str)
+}
+
+// parseCronField returns the set of values matched by field, as a bitset.
+func parseCronField(field string, f *cronField) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangeStr, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step '%s' in %s", stepStr, f.name)
+			}
+		}
+
+		max := f.max
+		if f.name == "day of week" {
+			max = 7
+		}
+		lo, hi := f.min, max
+		if rangeStr != "*" {
+			loStr, hiStr, isRange := strings.Cut(rangeStr, "-")
+			var err error
+			if lo, err = parseCronValue(loStr, f); err != nil {
+				return 0, fmt.Errorf("bad value '%s' in %s", loStr, f.name)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = parseCronValue(hiStr, f); err != nil {
+					return 0, fmt.Errorf("bad value '%s' in %s", hiStr, f.name)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		} else if f.name == "day of week" {
+			hi = f.max
+		}
+		if lo < f.min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%s out of range in %s", rangeStr, f.name)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the first time after t at which the schedule fires.
+// Returns the zero time if there is none (e.g. for Feb 30).
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	// Give up after several years, which covers every day of the week
+	// falling on every date.
+	limit := next.AddDate(5, 0, 0)
+	for next.Before(limit) {
+		if s.month&(1<<uint(next.Month())) == 0 {
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, next.Location())
+			continue
+		}
+		if !s.matchesDay(next) {
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0,
+				next.Location())
+			continue
+		}
+		if s.hour&(1<<uint(next.Hour())) == 0 {
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0,
+				next.Location())
+			continue
+		}
+		if s.minute&(1<<uint(next.Minute())) == 0 {
+			next = next.Add(time.Minute)
+			continue
+		}
+		return next
+	}
+	return time.Time{}
+}
@@ -0,0 +1,155 @@
+// Package snooze keeps the local database of snoozed threads.
+package snooze
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LabelPrefix is the parent of the labels applied to snoozed threads
+const LabelPrefix = "Snoozed/"
+
+const labelDateFormat = "2006-01-02"
+
+// A date alone in --until means this time of day
+const defaultWakeHour = 8
+
+// LabelForTime returns the label for threads snoozed until t, e.g.
+// Snoozed/2026-11-01
+func LabelForTime(t time.Time) string {
+	return LabelPrefix + t.Format(labelDateFormat)
+}
+
+var relativeDaysRegexp = regexp.MustCompile(`^(\d+)d$`)
+
+// ParseUntil parses the time to snooze until. Accepted forms are
+// 2006-01-02T15:04, "2006-01-02 15:04", 2006-01-02 (which means 08:00 on that
+// day), or a duration from now such as 3h or 2d. Times are local.
+func ParseUntil(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.ParseInLocation(labelDateFormat, s, now.Location()); err == nil {
+		// Not t.Add, which would be off by an hour on daylight saving changes
+		return time.Date(t.Year(), t.Month(), t.Day(), defaultWakeHour, 0, 0, 0,
+			now.Location()), nil
+	}
+	if m := relativeDaysRegexp.FindStringSubmatch(s); m != nil {
+		days, _ := strconv.Atoi(m[1])
+		return now.AddDate(0, 0, days), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return now.Add(d), nil
+	}
+	return time.Time{}, fmt.Errorf("Invalid time '%s'. Expected e.g. 2006-01-02T15:04, "+
+		"2006-01-02, 3h or 2d", s)
+}
+
+// Entry is a snoozed thread
+type Entry struct {
+	ThreadId string    `json:"threadId"`
+	Subject  string    `json:"subject,omitempty"`
+	Until    time.Time `json:"until"`
+	Label    string    `json:"label"`
+	Created  time.Time `json:"created"`
+}
+
+// DB is the set of snoozed threads, stored as JSON.
+type DB struct {
+	Entries []*Entry `json:"entries"`
+
+	fname string
+}
+
+// LoadDB reads the database file fname. If it does not exist, the database is
+// empty.
+func LoadDB(fname string) (*DB, error) {
+	db := &DB{fname: fname}
+	data, err := os.ReadFile(fname)
+	if os.IsNotExist(err) {
+		return db, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, db); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %v", fname, err)
+	}
+	return db, nil
+}
+
+// Save writes the database, replacing the file atomically.
+func (db *DB) Save() error {
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpName := db.fname + ".tmp"
+	if err = os.WriteFile(tmpName, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, db.fname)
+}
+
+// Get returns the entry for the thread, if it is snoozed.
+func (db *DB) Get(threadId string) (*Entry, bool) {
+	for _, e := range db.Entries {
+		if e.ThreadId == threadId {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// Add records a snoozed thread, replacing any existing snooze of it. Returns
+// the replaced entry, if there was one.
+func (db *DB) Add(entry *Entry) *Entry {
+	old, _ := db.Get(entry.ThreadId)
+	if old != nil {
+		db.Remove(old.ThreadId)
+	}
+	db.Entries = append(db.Entries, entry)
+	sort.SliceStable(db.Entries, func(i, j int) bool {
+		return db.Entries[i].Until.Before(db.Entries[j].Until)
+	})
+	return old
+}
+
+// Remove deletes the entry for the thread, if there is one.
+func (db *DB) Remove(threadId string) {
+	for i, e := range db.Entries {
+		if e.ThreadId == threadId {
+			db.Entries = append(db.Entries[:i], db.Entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// Due returns the entries which should be woken at now.
+func (db *DB) Due(now time.Time) []*Entry {
+	var due []*Entry
+	for _, e := range db.Entries {
+		if !e.Until.After(now) {
+			due = append(due, e)
+		}
+	}
+	return due
+}
+
+// LabelInUse returns true if any entry has the label.
+func (db *DB) LabelInUse(label string) bool {
+	for _, e := range db.Entries {
+		if e.Label == label {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+)
+
+func b64(str string) string {
+	return base64.URLEncoding.EncodeToString([]byte(str))
+}
+
+func nestedAttachmentMsg() *gm.Message {
+	return &gm.Message{
+		Id: "m1",
+		Payload: &gm.MessagePart{
+			PartId:   "",
+			MimeType: "multipart/mixed",
+			Body:     &gm.MessagePartBody{},
+			Parts: []*gm.MessagePart{
+				{
+					PartId:   "0",
+					MimeType: "multipart/alternative",
+					Body:     &gm.MessagePartBody{},
+					Parts: []*gm.MessagePart{
+						{PartId: "0.0", MimeType: "text/plain",
+							Body: &gm.MessagePartBody{Data: b64("plain"), Size: 5}},
+						{PartId: "0.1", MimeType: "text/html",
+							Body: &gm.MessagePartBody{Data: b64("<b>html</b>"), Size: 11}},
+					},
+				},
+				{PartId: "1", MimeType: "application/pdf", Filename: "doc.pdf",
+					Body: &gm.MessagePartBody{AttachmentId: "att1", Size: 2048}},
+				{PartId: "2", MimeType: "text/plain", Filename: "notes.txt",
+					Body: &gm.MessagePartBody{Data: b64("notes"), Size: 5}},
+			},
+		},
+	}
+}
+
+func TestMessageAttachments(t *testing.T) {
+	atts := api.MessageAttachments(nestedAttachmentMsg())
+	assert.Equal(t, 2, len(atts))
+	assert.Equal(t, "doc.pdf", atts[0].Filename)
+	assert.Equal(t, "application/pdf", atts[0].MimeType)
+	assert.Equal(t, int64(2048), atts[0].Size)
+	assert.Equal(t, "1", atts[0].PartId)
+	assert.Equal(t, "notes.txt", atts[1].Filename)
+	assert.Equal(t, "m1", atts[1].MessageId)
+}
+
+func TestGetMessageBodyNested(t *testing.T) {
+	parts := api.GetMessageBody(nestedAttachmentMsg())
+	assert.Equal(t, []string{"", "plain", "<b>html</b>"}, parts)
+}
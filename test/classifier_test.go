@@ -0,0 +1,162 @@
+package test
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/classifier"
+	"github.com/tsiemens/gmail-tools/pluginsclassifier"
+)
+
+func TestClassifierFeatures(t *testing.T) {
+	msg := ruleMsg("GitHub <Notifications@CI.GitHub.com>", "Re: The build failed for PR",
+		time.Hour, "List-Id", "Repo <repo.github.com>")
+	msg.Id = "m1"
+	assert.Equal(t, []string{
+		"from:notifications@ci.github.com", "domain:ci.github.com", "domain:github.com",
+		"list:repo.github.com", "subject:build", "subject:failed"},
+		classifier.Features(msg, nil))
+
+	// Messages sent by the user have the SENT label
+	thread := &gm.Thread{Messages: []*gm.Message{
+		threadMsg("a@example.com", "Hi", 1000, "SENT"),
+		msg,
+	}}
+	msg.InternalDate = 2000
+	features := classifier.Features(msg, thread)
+	assert.Contains(t, features, "thread:participated")
+
+	// Replies decide the training class, so are not features
+	thread.Messages = []*gm.Message{msg, threadMsg("a@example.com", "Hi", 3000, "SENT")}
+	features = classifier.Features(msg, thread)
+	assert.NotContains(t, features, "thread:participated")
+	assert.NotContains(t, features, "thread:replied")
+}
+
+func TestClassifierLabeler(t *testing.T) {
+	l := &classifier.Labeler{
+		InterestingLabels:   []*regexp.Regexp{regexp.MustCompile("^Work")},
+		UninterestingLabels: []*regexp.Regexp{regexp.MustCompile("^Muted$")},
+		TouchLabel:          "Touched",
+	}
+	check := func(labelIds []string, labelNames []string, thread *gm.Thread,
+		expected classifier.Class, expectedOk bool) {
+		msg := &gm.Message{Id: "m", InternalDate: 1000, LabelIds: labelIds}
+		class, ok := l.Class(msg, labelNames, thread)
+		assert.Equal(t, expectedOk, ok, fmt.Sprint(labelIds, labelNames))
+		if expectedOk {
+			assert.Equal(t, expected, class, fmt.Sprint(labelIds, labelNames))
+		}
+	}
+	check([]string{"INBOX"}, []string{"INBOX"}, nil, 0, false)
+	check([]string{"STARRED"}, []string{"STARRED"}, nil, classifier.Interesting, true)
+	check([]string{"Label_1"}, []string{"Work/Team"}, nil, classifier.Interesting, true)
+	check([]string{"Label_1"}, []string{"Muted"}, nil, classifier.Uninteresting, true)
+	check([]string{"Label_2"}, []string{"Touched"}, nil, classifier.Uninteresting, true)
+	// Touched, but still in the inbox
+	check([]string{"INBOX", "Label_2"}, []string{"INBOX", "Touched"}, nil, 0, false)
+	// Both interesting and uninteresting
+	check([]string{"STARRED", "Label_1"}, []string{"STARRED", "Muted"}, nil, 0, false)
+
+	replied := &gm.Thread{Messages: []*gm.Message{
+		{Id: "m", InternalDate: 1000}, {Id: "r", InternalDate: 2000, LabelIds: []string{"SENT"}}}}
+	check([]string{"Label_2"}, []string{"Touched"}, replied, 0, false)
+	check(nil, nil, replied, classifier.Interesting, true)
+}
+
+func classifierSamples() []*classifier.Sample {
+	var samples []*classifier.Sample
+	for i := 0; i < 50; i++ {
+		samples = append(samples,
+			&classifier.Sample{Id: fmt.Sprint("i", i), Class: classifier.Interesting,
+				Features: []string{"from:boss@work.com", "domain:work.com", "subject:review"}},
+			&classifier.Sample{Id: fmt.Sprint("u", i), Class: classifier.Uninteresting,
+				Features: []string{"from:deals@shop.com", "domain:shop.com", "subject:review"}})
+	}
+	return samples
+}
+
+func TestClassifierModel(t *testing.T) {
+	model := classifier.Train(classifierSamples(), time.Now())
+	assert.True(t, model.IsTrained())
+	assert.Equal(t, [2]int{50, 50}, model.Messages)
+	assert.Equal(t, [2]int{50, 50}, model.Features["subject:review"])
+
+	class, confidence, ok := model.Predict([]string{"from:boss@work.com", "subject:hi"}, 0.8)
+	assert.True(t, ok)
+	assert.Equal(t, classifier.Interesting, class)
+	assert.True(t, confidence > 0.95, confidence)
+
+	class, _, ok = model.Predict([]string{"domain:shop.com", "subject:review"}, 0.8)
+	assert.True(t, ok)
+	assert.Equal(t, classifier.Uninteresting, class)
+
+	// Evenly split features are undecided, and unknown features are ignored
+	_, confidence, ok = model.Predict([]string{"subject:review"}, 0.8)
+	assert.False(t, ok)
+	assert.InDelta(t, 0.5, confidence, 0.001)
+	_, confidence, ok = model.Predict([]string{"from:new@example.com"}, 0.8)
+	assert.False(t, ok)
+	assert.Equal(t, 0.0, confidence)
+
+	_, ok = classifier.Train(classifierSamples()[:1], time.Now()).Probability(nil)
+	assert.False(t, ok)
+
+	fname := filepath.Join(t.TempDir(), classifier.ModelFileName)
+	empty, err := classifier.LoadModel(fname)
+	assert.NoError(t, err)
+	assert.False(t, empty.IsTrained())
+	assert.NoError(t, model.Save(fname))
+	loaded, err := classifier.LoadModel(fname)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Messages, loaded.Messages)
+	assert.Equal(t, model.Features, loaded.Features)
+
+	plug, err := pluginsclassifier.NewPlugin(loaded, &classifier.Config{})
+	assert.NoError(t, err)
+	assert.NotNil(t, plug.MessageInterest)
+	plug, err = pluginsclassifier.NewPlugin(empty, &classifier.Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, plug.MessageInterest)
+	_, err = pluginsclassifier.NewPlugin(loaded, &classifier.Config{Threshold: 0.3})
+	assert.Error(t, err)
+}
+
+func TestClassifierEvaluate(t *testing.T) {
+	samples := classifierSamples()
+	train, test := classifier.SplitHoldout(samples, 20)
+	assert.Equal(t, len(samples), len(train)+len(test))
+	assert.NotEmpty(t, test)
+	train2, _ := classifier.SplitHoldout(samples, 20)
+	assert.Equal(t, train, train2)
+
+	model := classifier.Train(train, time.Now())
+	// A mislabelled message, and one which can't be decided
+	test = append(test,
+		&classifier.Sample{Id: "x", Class: classifier.Uninteresting,
+			Features: []string{"from:boss@work.com"}},
+		&classifier.Sample{Id: "y", Class: classifier.Interesting,
+			Features: []string{"subject:other"}})
+	ev := classifier.Evaluate(model, test, 0.8)
+	assert.Equal(t, len(test), ev.Samples)
+	assert.Equal(t, 1, ev.Undecided)
+
+	inter := ev.Classes[classifier.Interesting]
+	uninter := ev.Classes[classifier.Uninteresting]
+	assert.Equal(t, 1, inter.FalsePositives)
+	assert.Equal(t, 1, inter.FalseNegatives)
+	assert.Equal(t, 0, uninter.FalsePositives)
+	assert.Equal(t, 1, uninter.FalseNegatives)
+	assert.Equal(t, float64(inter.TruePositives)/float64(inter.TruePositives+1),
+		inter.Precision())
+	assert.Equal(t, 1.0, uninter.Precision())
+	assert.Equal(t, float64(uninter.TruePositives)/float64(uninter.TruePositives+1),
+		uninter.Recall())
+	assert.Equal(t, 0.0, (&classifier.ClassStats{}).Precision())
+}
@@ -0,0 +1,166 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/cmd"
+	"github.com/tsiemens/gmail-tools/compose"
+	"github.com/tsiemens/gmail-tools/mime"
+)
+
+func TestComposeMultipart(t *testing.T) {
+	msg := &compose.Message{
+		To:       []string{"bob@y.com"},
+		Subject:  "Files",
+		Body:     "See attached",
+		HtmlBody: "<p>See attached</p>",
+		Attachments: []*compose.Attachment{
+			{Filename: "notes.txt", Data: []byte("some notes")},
+		},
+		InReplyTo:  []string{"<a@x.com>"},
+		References: []string{"<r@x.com>", "<a@x.com>"},
+	}
+	raw, err := msg.Bytes()
+	assert.Nil(t, err)
+	assert.Contains(t, string(raw), "In-Reply-To: <a@x.com>\r\n")
+	assert.Contains(t, string(raw), "References: <r@x.com> <a@x.com>\r\n")
+
+	parsed, err := mime.ParseRaw(raw)
+	assert.Nil(t, err)
+	assert.Equal(t, "multipart/mixed", parsed.Root.MimeType)
+	assert.Equal(t, "See attached", parsed.PreferredText())
+	html, ok := parsed.PreferredHtml()
+	assert.True(t, ok)
+	assert.Equal(t, "<p>See attached</p>", html)
+	atts := parsed.Attachments()
+	assert.Equal(t, 1, len(atts))
+	assert.Equal(t, "notes.txt", atts[0].Filename)
+	assert.Equal(t, "text/plain", atts[0].MimeType)
+	assert.Equal(t, "some notes", string(atts[0].Data))
+}
+
+func TestNewReply(t *testing.T) {
+	orig := &api.Headers{
+		Subject:    "Plans",
+		From:       api.EmailAddress{Address: "ann@x.com", Name: "Ann"},
+		To:         []api.EmailAddress{{Address: "me@y.com"}, {Address: "bob@y.com"}},
+		Cc:         []api.EmailAddress{{Address: "ann@x.com"}, {Address: "cat@z.com"}},
+		MessageId:  "<3@x.com>",
+		References: []string{"<1@x.com>", "<2@x.com>"},
+	}
+	reply := compose.NewReply(orig, "thread1", "Me@y.com", false)
+	assert.Equal(t, "Re: Plans", reply.Subject)
+	assert.Equal(t, "thread1", reply.ThreadId)
+	assert.Equal(t, []string{"\"Ann\" <ann@x.com>"}, reply.To)
+	assert.Empty(t, reply.Cc)
+	assert.Equal(t, []string{"<3@x.com>"}, reply.InReplyTo)
+	assert.Equal(t, []string{"<1@x.com>", "<2@x.com>", "<3@x.com>"}, reply.References)
+
+	reply = compose.NewReply(orig, "thread1", "me@y.com", true)
+	assert.Equal(t, []string{"\"Ann\" <ann@x.com>"}, reply.To)
+	assert.Equal(t, []string{"bob@y.com", "cat@z.com"}, reply.Cc)
+
+	// Reply-To takes precedence, and existing prefixes are kept
+	orig.ReplyTo = []api.EmailAddress{{Address: "list@x.com"}}
+	orig.Subject = "RE: Plans"
+	orig.References = nil
+	orig.InReplyTo = []string{"<2@x.com>"}
+	reply = compose.NewReply(orig, "", "me@y.com", false)
+	assert.Equal(t, "RE: Plans", reply.Subject)
+	assert.Equal(t, []string{"list@x.com"}, reply.To)
+	assert.Equal(t, []string{"<2@x.com>", "<3@x.com>"}, reply.References)
+
+	// Display names with special characters are quoted
+	orig.ReplyTo = nil
+	orig.From = api.EmailAddress{Address: "ann@x.com", Name: "Smith, Ann"}
+	reply = compose.NewReply(orig, "", "me@y.com", false)
+	assert.Equal(t, []string{"\"Smith, Ann\" <ann@x.com>"}, reply.To)
+	reply.Body = "hi"
+	raw, err := reply.Bytes()
+	assert.Nil(t, err)
+	assert.Contains(t, string(raw), "To: \"Smith, Ann\" <ann@x.com>\r\n")
+
+	// Replying to one's own message goes to its recipients, and with all, the
+	// To recipients are not copied into Cc as well
+	self := &api.Headers{
+		Subject: "Plans",
+		From:    api.EmailAddress{Address: "me@y.com"},
+		To:      []api.EmailAddress{{Address: "bob@y.com"}, {Address: "ann@x.com"}},
+		Cc:      []api.EmailAddress{{Address: "Bob@y.com"}, {Address: "cat@z.com"}},
+	}
+	reply = compose.NewReply(self, "", "me@y.com", true)
+	assert.Equal(t, []string{"bob@y.com", "ann@x.com"}, reply.To)
+	assert.Equal(t, []string{"cat@z.com"}, reply.Cc)
+	reply = compose.NewReply(self, "", "me@y.com", false)
+	assert.Equal(t, []string{"bob@y.com", "ann@x.com"}, reply.To)
+	assert.Empty(t, reply.Cc)
+	self.To = []api.EmailAddress{{Address: "me@y.com"}}
+	self.Cc = nil
+	reply = compose.NewReply(self, "", "me@y.com", true)
+	assert.Equal(t, []string{"me@y.com"}, reply.To)
+	assert.Empty(t, reply.Cc)
+
+	assert.Equal(t, "Fwd: Plans", compose.ForwardSubject("Plans"))
+	assert.Equal(t, "FW: Plans", compose.ForwardSubject("FW: Plans"))
+}
+
+func TestRenderTemplate(t *testing.T) {
+	vars, err := compose.ParseVars([]string{"name=Bob", "eq=a=b"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"name": "Bob", "eq": "a=b"}, vars)
+	_, err = compose.ParseVars([]string{"novalue"})
+	assert.NotNil(t, err)
+
+	data := &compose.TemplateData{
+		Vars: vars,
+		Orig: &compose.OrigData{FromName: "Ann", Body: "line 1\nline 2\n"},
+	}
+	out, err := compose.RenderTemplate("body",
+		`Hi {{.Orig.FromName}}, from {{.Vars.name}}{{var . "sig" ""}}
+{{quote .Orig.Body}}`, data)
+	assert.Nil(t, err)
+	assert.Equal(t, "Hi Ann, from Bob\n> line 1\n> line 2", out)
+
+	_, err = compose.RenderTemplate("body", "{{.Vars.missing}}", data)
+	assert.NotNil(t, err)
+	_, err = compose.RenderTemplate("body", "{{.Vars.name", data)
+	assert.NotNil(t, err)
+}
+
+func TestComposeOptionsTemplates(t *testing.T) {
+	dir := t.TempDir()
+	bodyFile := filepath.Join(dir, "body.txt")
+	htmlFile := filepath.Join(dir, "body.html")
+	assert.Nil(t, os.WriteFile(bodyFile, []byte("Hi {{.Orig.FromName}}"), 0600))
+	assert.Nil(t, os.WriteFile(htmlFile, []byte("<p>Hi {{.Orig.FromName}}</p>"), 0600))
+	opts := &cmd.ComposeOptions{
+		Subject: "Re: {{.Orig.Subject}}", BodyFile: bodyFile, HtmlFile: htmlFile,
+		Cc: []string{"c@x.com"},
+	}
+	tmpls, err := opts.ParseTemplates()
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// The files are only read once, so the templates render for every message
+	assert.Nil(t, os.Remove(bodyFile))
+	assert.Nil(t, os.Remove(htmlFile))
+	for _, name := range []string{"Ann", "Bob"} {
+		msg := &compose.Message{To: []string{"a@x.com"}}
+		data := &compose.TemplateData{
+			Orig: &compose.OrigData{FromName: name, Subject: "Plans"}}
+		assert.Nil(t, opts.Apply(msg, tmpls, data))
+		assert.Equal(t, "Re: Plans", msg.Subject)
+		assert.Equal(t, "Hi "+name, msg.Body)
+		assert.Equal(t, "<p>Hi "+name+"</p>", msg.HtmlBody)
+		assert.Equal(t, []string{"c@x.com"}, msg.Cc)
+	}
+
+	_, err = (&cmd.ComposeOptions{Body: "x", BodyFile: "-"}).ParseTemplates()
+	assert.EqualError(t, err, "--body and --body-file cannot both be provided")
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/dedupe"
+	"github.com/tsiemens/gmail-tools/pluginsdedupe"
+)
+
+func dupMsg(id string, millis int64, messageId, body string, labelIds ...string) *gm.Message {
+	msg := threadMsg("list@example.com", "Weekly news", millis, labelIds...)
+	msg.Id = id
+	if messageId != "" {
+		msg.Payload.Headers = append(msg.Payload.Headers,
+			&gm.MessagePartHeader{Name: "Message-ID", Value: messageId})
+	}
+	msg.Payload.MimeType = "text/plain"
+	msg.Payload.Body = &gm.MessagePartBody{Data: b64(body), Size: int64(len(body))}
+	return msg
+}
+
+func TestDedupeKeys(t *testing.T) {
+	assert.Equal(t, "id:<a@example.com>",
+		dedupe.MessageIdKey(dupMsg("m1", 1000, "<a@example.com>", "Hi")))
+	assert.Equal(t, "", dedupe.MessageIdKey(dupMsg("m1", 1000, "", "Hi")))
+
+	key := func(body string) string {
+		k, err := dedupe.ContentKey(dupMsg("m", 1000, "", body))
+		assert.NoError(t, err)
+		return k
+	}
+	assert.NotEqual(t, "", key("Hello there"))
+	assert.Equal(t, key("Hello there"), key("  hello\n\tTHERE "))
+	assert.NotEqual(t, key("Hello there"), key("Hello where"))
+	assert.Equal(t, "", key(" \n"))
+
+	_, err := dedupe.ContentKey(&gm.Message{Id: "m"})
+	assert.Error(t, err)
+}
+
+func TestDedupeGroups(t *testing.T) {
+	msgs := []*gm.Message{
+		dupMsg("a3", 3000, "<a@example.com>", "A", "INBOX"),
+		dupMsg("b2", 2500, "", "B copy"),
+		dupMsg("a2", 2000, "<a@example.com>", "A", "Label_1", "Label_2"),
+		dupMsg("c1", 1800, "<c@example.com>", "C"),
+		dupMsg("a1", 1000, "<a@example.com>", "A"),
+		dupMsg("b1", 500, "", "B  COPY"),
+		dupMsg("e1", 400, "", ""),
+		dupMsg("e2", 300, "", ""),
+	}
+	key := func(m *gm.Message) (string, error) {
+		if k := dedupe.MessageIdKey(m); k != "" {
+			return k, nil
+		}
+		return dedupe.ContentKey(m)
+	}
+	describe := func(groups []*dedupe.Group) []string {
+		var res []string
+		for _, g := range groups {
+			s := g.Keep.Id + ":"
+			for _, d := range g.Duplicates {
+				s += " " + d.Id
+			}
+			res = append(res, s)
+		}
+		return res
+	}
+	check := func(policy dedupe.Policy, expected ...string) {
+		groups, err := dedupe.FindGroups(msgs, key, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, describe(groups), string(policy))
+	}
+
+	check(dedupe.KeepOldest, "a1: a3 a2", "b1: b2")
+	check(dedupe.KeepMostLabels, "a2: a3 a1", "b1: b2")
+	check(dedupe.KeepInbox, "a3: a2 a1", "b1: b2")
+
+	groups, _ := dedupe.FindGroups(msgs, key, dedupe.KeepOldest)
+	assert.Equal(t, "Message-ID <a@example.com>", groups[0].Describe())
+	assert.Regexp(t, "^Content hash [0-9a-f]{12}$", groups[1].Describe())
+	var dupIds []string
+	for _, m := range dedupe.AllDuplicates(groups) {
+		dupIds = append(dupIds, m.Id)
+	}
+	assert.Equal(t, []string{"a3", "a2", "b2"}, dupIds)
+
+	_, err := dedupe.FindGroups(msgs, func(m *gm.Message) (string, error) {
+		return "", fmt.Errorf("Failed")
+	}, dedupe.KeepOldest)
+	assert.Error(t, err)
+}
+
+func TestDedupePolicy(t *testing.T) {
+	for _, s := range []string{"oldest", "most-labels", "inbox"} {
+		p, err := dedupe.ParsePolicy(s)
+		assert.NoError(t, err)
+		assert.Equal(t, s, string(p))
+	}
+	p, err := dedupe.ParsePolicy("")
+	assert.NoError(t, err)
+	assert.Equal(t, dedupe.KeepOldest, p)
+	_, err = dedupe.ParsePolicy("newest")
+	assert.Error(t, err)
+
+	plug := pluginsdedupe.NewPlugin(dedupe.KeepOldest)
+	assert.Equal(t, []string{"outdated", "xfilter:duplicate"}, plug.Capabilities())
+	// The filter reads the Message-ID header
+	assert.Equal(t, api.LabelsOnly, plug.MessageFilters["duplicate"].Detail)
+}
@@ -0,0 +1,168 @@
+package test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	gm "google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/cmd"
+)
+
+// fakeDraftsServer serves the Gmail draft and message endpoints used by the
+// draft helpers, and records the requests made to it.
+type fakeDraftsServer struct {
+	mutex    sync.Mutex
+	requests []string
+	bodies   map[string]*gm.Draft
+}
+
+func (s *fakeDraftsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/")
+	s.mutex.Lock()
+	s.requests = append(s.requests, r.Method+" "+path)
+	s.mutex.Unlock()
+
+	var resp interface{}
+	switch {
+	case r.Method == "GET" && path == "drafts":
+		if r.URL.Query().Get("pageToken") == "" {
+			resp = &gm.ListDraftsResponse{
+				Drafts: []*gm.Draft{
+					{Id: "d1", Message: &gm.Message{Id: "m1"}},
+					{Id: "d2", Message: &gm.Message{Id: "m2"}},
+				},
+				NextPageToken: "p2",
+			}
+		} else {
+			resp = &gm.ListDraftsResponse{
+				Drafts: []*gm.Draft{{Id: "d3", Message: &gm.Message{Id: "m3"}}},
+			}
+		}
+	case r.Method == "GET" && strings.HasPrefix(path, "messages/"):
+		id := strings.TrimPrefix(path, "messages/")
+		resp = &gm.Message{Id: id, LabelIds: []string{"DRAFT"}}
+	case r.Method == "GET" && strings.HasPrefix(path, "drafts/"):
+		id := strings.TrimPrefix(path, "drafts/")
+		resp = &gm.Draft{Id: id, Message: &gm.Message{Id: "m-" + id, ThreadId: "t1"}}
+	case r.Method == "POST" && path == "drafts", r.Method == "PUT":
+		draft := &gm.Draft{}
+		json.NewDecoder(r.Body).Decode(draft)
+		if draft.Id == "" {
+			draft.Id = "new"
+		}
+		s.mutex.Lock()
+		s.bodies[draft.Id] = draft
+		s.mutex.Unlock()
+		resp = draft
+	case r.Method == "POST" && path == "drafts/send":
+		resp = &gm.Message{Id: "sent1"}
+	case r.Method == "DELETE":
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func newFakeDraftsHelper(t *testing.T) (*api.MsgHelper, *fakeDraftsServer) {
+	fake := &fakeDraftsServer{bodies: make(map[string]*gm.Draft)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	srv, err := gm.NewService(context.Background(),
+		option.WithEndpoint(server.URL+"/"), option.WithHTTPClient(server.Client()))
+	assert.Nil(t, err)
+	return api.NewMsgHelper(api.DefaultUser, srv, false), fake
+}
+
+func TestDraftHelpers(t *testing.T) {
+	helper, fake := newFakeDraftsHelper(t)
+	raw := []byte("To: a@x.com\r\nSubject: Hi\r\n\r\nbody\r\n")
+
+	draft, err := helper.CreateDraft(raw, "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, "new", draft.Id)
+	assert.Equal(t, base64.URLEncoding.EncodeToString(raw), fake.bodies["new"].Message.Raw)
+	assert.Equal(t, "t1", fake.bodies["new"].Message.ThreadId)
+
+	draft, err = helper.UpdateDraft("d1", raw, "t2")
+	assert.Nil(t, err)
+	assert.Equal(t, "d1", draft.Id)
+	assert.Equal(t, "t2", fake.bodies["d1"].Message.ThreadId)
+
+	draft, err = helper.GetDraft("d2", api.IdsOnly)
+	assert.Nil(t, err)
+	assert.Equal(t, "t1", draft.Message.ThreadId)
+
+	sent, err := helper.SendDraft("d1")
+	assert.Nil(t, err)
+	assert.Equal(t, "sent1", sent.Id)
+	assert.Nil(t, helper.DeleteDraft("d2"))
+
+	assert.Equal(t, []string{
+		"POST drafts", "PUT drafts/d1", "GET drafts/d2", "POST drafts/send",
+		"DELETE drafts/d2",
+	}, fake.requests)
+}
+
+func TestQueryDrafts(t *testing.T) {
+	helper, fake := newFakeDraftsHelper(t)
+
+	// All pages are listed
+	drafts, err := helper.QueryDrafts("older_than:1d", -1, api.IdsOnly)
+	assert.Nil(t, err)
+	ids := []string{}
+	for _, d := range drafts {
+		ids = append(ids, d.Id)
+	}
+	assert.Equal(t, []string{"d1", "d2", "d3"}, ids)
+	assert.Equal(t, []string{"GET drafts", "GET drafts"}, fake.requests)
+
+	// The max stops paging, and messages are loaded to the detail level
+	fake.requests = nil
+	drafts, err = helper.QueryDrafts("", 1, api.LabelsOnly)
+	assert.Nil(t, err)
+	if assert.Len(t, drafts, 1) {
+		assert.Equal(t, "d1", drafts[0].Id)
+		assert.Equal(t, []string{"DRAFT"}, drafts[0].Message.LabelIds)
+	}
+	assert.Equal(t, []string{"GET drafts", "GET messages/m1"}, fake.requests)
+}
+
+func TestDraftsCmdSelection(t *testing.T) {
+	// Drafts are selected by ID or by --query, checked before connecting
+	for _, args := range [][]string{
+		{"drafts", "send"},
+		{"drafts", "delete", "d1", "--query", "older_than:1d"},
+	} {
+		cmd.RootCmd.SetArgs(args)
+		err := cmd.RootCmd.Execute()
+		if assert.NotNil(t, err, args) {
+			assert.Contains(t, err.Error(), "Exactly one of DRAFT_IDs or --query", args)
+		}
+	}
+
+	c, _, err := cmd.RootCmd.Find([]string{"dr", "rm"})
+	assert.Nil(t, err)
+	assert.Equal(t, "delete", c.Name())
+	for _, flag := range []string{"query", "max", "dry", "assumeyes"} {
+		assert.NotNil(t, c.Flags().Lookup(flag), flag)
+	}
+	c, _, err = cmd.RootCmd.Find([]string{"drafts", "update"})
+	assert.Nil(t, err)
+	assert.NotNil(t, c.Args(c, []string{"d1"}))
+	assert.Nil(t, c.Args(c, []string{"d1", "msg.eml"}))
+	assert.NotNil(t, c.Flags().Lookup("thread"))
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tsiemens/gmail-tools/export"
+)
+
+var exportRaw = []byte("From: a@example.com\r\nSubject: Hi\r\n\r\nFrom the top\r\n>From here\r\nbye\r\n")
+
+func TestWithLabelsHeader(t *testing.T) {
+	out := export.WithLabelsHeader(exportRaw, []string{"INBOX", "Foo/Bar"})
+	assert.Equal(t,
+		"X-Gmail-Labels: INBOX,Foo/Bar\r\n"+string(exportRaw), string(out))
+
+	out = export.WithLabelsHeader([]byte("Subject: x\n\nbody\n"), []string{"A"})
+	assert.Equal(t, "X-Gmail-Labels: A\nSubject: x\n\nbody\n", string(out))
+
+	assert.Equal(t, exportRaw, export.WithLabelsHeader(exportRaw, nil))
+}
+
+func TestMboxEntry(t *testing.T) {
+	msg := &export.Message{Id: "abc", Raw: exportRaw, InternalDate: 0}
+	entry := string(export.MboxEntry(msg))
+	assert.Equal(t,
+		"From abc@gmailcli Thu Jan  1 00:00:00 1970\n"+
+			"From: a@example.com\n"+
+			"Subject: Hi\n"+
+			"\n"+
+			">From the top\n"+
+			">>From here\n"+
+			"bye\n"+
+			"\n",
+		entry)
+}
+
+func TestMaildirFolderName(t *testing.T) {
+	assert.Equal(t, "", export.MaildirFolderName("INBOX"))
+	assert.Equal(t, ".Foo", export.MaildirFolderName("Foo"))
+	assert.Equal(t, ".Foo.Bar_baz", export.MaildirFolderName("Foo/Bar.baz"))
+}
+
+func TestMaildirWriter(t *testing.T) {
+	dir := t.TempDir()
+	w, err := export.NewMaildirWriter(dir)
+	assert.Nil(t, err)
+
+	err = w.Write(&export.Message{
+		Id: "m1", Raw: exportRaw, InternalDate: 5000,
+		Labels: []string{"INBOX", "UNREAD", "Work/Team"}, Unread: true})
+	assert.Nil(t, err)
+	err = w.Write(&export.Message{
+		Id: "m2", Raw: exportRaw, InternalDate: 6000, Starred: true})
+	assert.Nil(t, err)
+
+	for _, fname := range []string{
+		"cur/5.m1.gmailcli:2,",
+		".Work.Team/cur/5.m1.gmailcli:2,",
+		"cur/6.m2.gmailcli:2,FS",
+	} {
+		_, err := os.Stat(filepath.Join(dir, fname))
+		assert.Nil(t, err, fname)
+	}
+}
+
+func TestMboxWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.mbox")
+	write := func(truncate bool, ids ...string) {
+		w, err := export.NewMboxWriter(path, truncate)
+		assert.Nil(t, err)
+		for _, id := range ids {
+			assert.Nil(t, w.Write(&export.Message{Id: id, Raw: exportRaw}))
+		}
+		assert.Nil(t, w.Close())
+	}
+	entries := func() string {
+		data, err := os.ReadFile(path)
+		assert.Nil(t, err)
+		return string(data)
+	}
+	m1 := string(export.MboxEntry(&export.Message{Id: "m1", Raw: exportRaw}))
+	m2 := string(export.MboxEntry(&export.Message{Id: "m2", Raw: exportRaw}))
+
+	write(false, "m1")
+	write(false, "m2")
+	assert.Equal(t, m1+m2, entries())
+
+	// A restarted export replaces the file's contents
+	write(true, "m1")
+	assert.Equal(t, m1, entries())
+}
+
+func TestExportState(t *testing.T) {
+	fname := export.StateFileFor(export.EmlFormat, t.TempDir())
+	state, err := export.LoadState(fname)
+	assert.Nil(t, err)
+	assert.False(t, state.IsExported("a"))
+	assert.Nil(t, state.MarkExported("a"))
+	assert.Nil(t, state.MarkExported("b"))
+	assert.Nil(t, state.Close())
+
+	state, err = export.LoadState(fname)
+	assert.Nil(t, err)
+	assert.True(t, state.IsExported("a"))
+	assert.True(t, state.IsExported("b"))
+	assert.Equal(t, 2, state.Len())
+	assert.Nil(t, state.Close())
+}
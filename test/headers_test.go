@@ -0,0 +1,86 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+)
+
+func TestGetEmailsInField(t *testing.T) {
+	emails := api.GetEmailsInField(`"Doe, John" <john@x.com>, bob@y.com`)
+	assert.Equal(t, []api.EmailAddress{
+		{Address: "john@x.com", Name: "Doe, John"},
+		{Address: "bob@y.com"},
+	}, emails)
+
+	emails = api.GetEmailsInField(`=?UTF-8?B?SsO2cmc=?= <j@x.com>`)
+	assert.Equal(t, []api.EmailAddress{{Address: "j@x.com", Name: "Jörg"}}, emails)
+
+	emails = api.GetEmailsInField(`=?ISO-8859-1?Q?Andr=E9?= <a@x.com>`)
+	assert.Equal(t, []api.EmailAddress{{Address: "a@x.com", Name: "André"}}, emails)
+
+	emails = api.GetEmailsInField(
+		`Team: a@x.com, "B, b" <b@x.com>;, c@z.com (Old style, name)`)
+	assert.Equal(t, []api.EmailAddress{
+		{Address: "a@x.com", Group: "Team"},
+		{Address: "b@x.com", Name: "B, b", Group: "Team"},
+		{Address: "c@z.com", Name: "Old style, name"},
+	}, emails)
+
+	emails = api.GetEmailsInField(`undisclosed-recipients:;`)
+	assert.Equal(t, []api.EmailAddress{}, emails)
+
+	// Malformed, but still readable
+	emails = api.GetEmailsInField(`Some One <some one@x.com>`)
+	assert.Equal(t, []api.EmailAddress{
+		{Address: "some one@x.com", Name: "Some One"}}, emails)
+}
+
+func TestGetMsgHeaders(t *testing.T) {
+	msg := &gm.Message{Payload: &gm.MessagePart{
+		Headers: []*gm.MessagePartHeader{
+			{Name: "Subject", Value: "=?UTF-8?Q?Caf=C3=A9?= time"},
+			{Name: "From", Value: `"Smith, Ann" <ann@x.com>`},
+			{Name: "To", Value: "a@x.com, b@x.com"},
+			{Name: "CC", Value: "c@x.com"},
+			{Name: "Bcc", Value: "d@x.com"},
+			{Name: "Reply-To", Value: "list@x.com"},
+			{Name: "Date", Value: "Mon, 02 Jan 2006 15:04:05 -0700"},
+			{Name: "Message-ID", Value: "<id1@x.com>"},
+			{Name: "In-Reply-To", Value: "<id0@x.com>"},
+			{Name: "References", Value: "<idA@x.com>\r\n <id0@x.com>"},
+			{Name: "List-Id", Value: `"My list" <mylist.x.com>`},
+			{Name: "List-Unsubscribe",
+				Value: "<mailto:unsub@x.com?subject=unsub>, <https://x.com/u?id=1>"},
+			{Name: "List-Unsubscribe-Post", Value: "List-Unsubscribe=One-Click"},
+		},
+	}}
+
+	headers, err := api.GetMsgHeaders(msg)
+	assert.Nil(t, err)
+	assert.Equal(t, "Café time", headers.Subject)
+	assert.Equal(t, api.EmailAddress{Address: "ann@x.com", Name: "Smith, Ann"}, headers.From)
+	assert.Equal(t, "\"Smith, Ann\" <ann@x.com>", headers.From.String())
+	assert.Equal(t, "c@x.com", headers.Cc[0].String())
+	assert.Equal(t, 2, len(headers.To))
+	assert.Equal(t, "c@x.com", headers.Cc[0].Address)
+	assert.Equal(t, "d@x.com", headers.Bcc[0].Address)
+	assert.Equal(t, 4, len(headers.AllRecipients()))
+	assert.Equal(t, "list@x.com", headers.ReplyTo[0].Address)
+	assert.Equal(t, time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC), headers.Date.UTC())
+	assert.Equal(t, "<id1@x.com>", headers.MessageId)
+	assert.Equal(t, []string{"<id0@x.com>"}, headers.InReplyTo)
+	assert.Equal(t, []string{"<idA@x.com>", "<id0@x.com>"}, headers.References)
+	assert.Equal(t, "mylist.x.com", headers.ListId)
+	assert.Equal(t,
+		[]string{"mailto:unsub@x.com?subject=unsub", "https://x.com/u?id=1"},
+		headers.ListUnsubscribe)
+	assert.Equal(t, "List-Unsubscribe=One-Click", headers.ListUnsubscribePost)
+
+	_, err = api.GetMsgHeaders(&gm.Message{})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,160 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	gm "google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v2"
+
+	"github.com/tsiemens/gmail-tools/plugin"
+	"github.com/tsiemens/gmail-tools/pluginsrules"
+)
+
+// The interest-rules section of PluginConfig
+const interestRulesYaml = `
+Rules:
+  - Name: github-mentions
+    Interest: strongly-interesting
+    Domain: github.com
+    Headers: {X-GitHub-Reason: mention}
+  - Name: github
+    Interest: weakly-uninteresting
+    Domain: github.com
+  - Name: newsletters
+    Interest: weakly-uninteresting
+    ListId: .
+  - Name: old-builds
+    Interest: strongly-uninteresting
+    Subject: ^build (failed|passed)
+    OlderThan: 7d
+  - Name: conversations
+    Interest: weakly-interesting
+    MinThreadSize: 3
+  - Name: keep
+    Interest: strongly-interesting
+    Label: ^keep$
+`
+
+func ruleMsg(from, subject string, age time.Duration, extraHeaders ...string) *gm.Message {
+	msg := threadMsg(from, subject, testNow.Add(-age).UnixMilli())
+	for i := 0; i+1 < len(extraHeaders); i += 2 {
+		msg.Payload.Headers = append(msg.Payload.Headers,
+			&gm.MessagePartHeader{Name: extraHeaders[i], Value: extraHeaders[i+1]})
+	}
+	return msg
+}
+
+var testNow = time.Date(2024, 1, 10, 10, 0, 0, 0, time.UTC)
+
+func loadInterestRules(t *testing.T, data string) []pluginsrules.Rule {
+	conf := &struct {
+		Rules []pluginsrules.Rule `yaml:"Rules"`
+	}{}
+	assert.NoError(t, yaml.Unmarshal([]byte(data), conf))
+	return conf.Rules
+}
+
+func TestInterestRules(t *testing.T) {
+	rs, err := pluginsrules.Compile(loadInterestRules(t, interestRulesYaml))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	threadSizeCalls := 0
+	check := func(msg *gm.Message, threadSize int, labels []string,
+		expected plugin.InterestLevel, expectedRule string) {
+
+		m := &pluginsrules.Message{Msg: msg, LabelNames: labels, Now: testNow,
+			ThreadSize: func() (int, error) {
+				threadSizeCalls++
+				return threadSize, nil
+			}}
+		interest, rule, err := rs.Evaluate(m)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, interest, expectedRule)
+		if expectedRule == "" {
+			assert.Nil(t, rule)
+		} else if assert.NotNil(t, rule, expectedRule) {
+			assert.Equal(t, expectedRule, rule.Name)
+		}
+	}
+
+	gh := "GitHub <notifications@github.com>"
+	check(ruleMsg(gh, "PR", time.Hour, "X-GitHub-Reason", "mention"), 1, nil,
+		plugin.StronglyInteresting, "github-mentions")
+	// Thread size isn't needed once the result can't change
+	assert.Equal(t, 0, threadSizeCalls)
+	check(ruleMsg(gh, "PR", time.Hour, "X-GitHub-Reason", "subscribed"), 1, nil,
+		plugin.WeaklyUninteresting, "github")
+	check(ruleMsg("Bot <bot@ci.github.com>", "PR", time.Hour), 1, nil,
+		plugin.WeaklyUninteresting, "github")
+	check(ruleMsg("Fake <a@notgithub.com>", "PR", time.Hour), 1, nil,
+		plugin.UnknownInterest, "")
+
+	// Weakly interesting is preferred to weakly uninteresting
+	check(ruleMsg(gh, "PR", time.Hour), 3, nil, plugin.WeaklyInteresting, "conversations")
+	check(ruleMsg("list@example.com", "News", time.Hour, "List-Id", "News <news.example.com>"),
+		1, nil, plugin.WeaklyUninteresting, "newsletters")
+
+	check(ruleMsg("ci@example.com", "Build failed: #12", 8*24*time.Hour), 1, nil,
+		plugin.StronglyUninteresting, "old-builds")
+	check(ruleMsg("ci@example.com", "Build failed: #12", 6*24*time.Hour), 1, nil,
+		plugin.UnknownInterest, "")
+	// Strongly interesting beats strongly uninteresting
+	check(ruleMsg("ci@example.com", "Build failed: #12", 8*24*time.Hour), 1,
+		[]string{"INBOX", "Keep"}, plugin.StronglyInteresting, "keep")
+}
+
+func TestInterestRulesThreadSizeError(t *testing.T) {
+	rs, err := pluginsrules.Compile(loadInterestRules(t, interestRulesYaml))
+	assert.NoError(t, err)
+	m := &pluginsrules.Message{Msg: ruleMsg("a@example.com", "Hi", time.Hour), Now: testNow,
+		ThreadSize: func() (int, error) { return 0, fmt.Errorf("Not found") }}
+	_, _, err = rs.Evaluate(m)
+	assert.Error(t, err)
+}
+
+func TestInterestRulesValidate(t *testing.T) {
+	invalid := func(r pluginsrules.Rule) {
+		_, err := pluginsrules.Compile([]pluginsrules.Rule{r})
+		assert.Error(t, err, fmt.Sprintf("%+v", r))
+	}
+	invalid(pluginsrules.Rule{Interest: "weakly-interesting", Subject: "x"})
+	invalid(pluginsrules.Rule{Name: "a", Subject: "x"})
+	invalid(pluginsrules.Rule{Name: "a", Interest: "unknown", Subject: "x"})
+	invalid(pluginsrules.Rule{Name: "a", Interest: "interesting", Subject: "x"})
+	invalid(pluginsrules.Rule{Name: "a", Interest: "weakly-interesting"})
+	invalid(pluginsrules.Rule{Name: "a", Interest: "weakly-interesting", Subject: "("})
+	invalid(pluginsrules.Rule{Name: "a", Interest: "weakly-interesting",
+		Headers: map[string]string{"X-A": "("}})
+	invalid(pluginsrules.Rule{Name: "a", Interest: "weakly-interesting", OlderThan: "3x"})
+	invalid(pluginsrules.Rule{Name: "a", Interest: "weakly-interesting",
+		MinThreadSize: 5, MaxThreadSize: 2})
+
+	r := pluginsrules.Rule{Name: "a", Interest: "weakly-interesting", Subject: "x"}
+	_, err := pluginsrules.Compile([]pluginsrules.Rule{r, r})
+	assert.Error(t, err)
+
+	plug, err := pluginsrules.NewPlugin(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, plug.MessageInterest)
+	plug, err = pluginsrules.NewPlugin([]pluginsrules.Rule{r})
+	assert.NoError(t, err)
+	assert.NotNil(t, plug.MessageInterest)
+}
+
+func TestParseAge(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour, "2w": 14 * 24 * time.Hour, "90m": 90 * time.Minute} {
+		d, err := pluginsrules.ParseAge(s)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, d)
+	}
+	for _, s := range []string{"", "d", "-1d", "1y", "soon"} {
+		_, err := pluginsrules.ParseAge(s)
+		assert.Error(t, err, s)
+	}
+}
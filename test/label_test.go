@@ -0,0 +1,116 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+func TestLabelNesting(t *testing.T) {
+	assert.Equal(t, []string{"A", "A/B"}, api.LabelParentNames("A/B/C"))
+	assert.Empty(t, api.LabelParentNames("A"))
+
+	assert.True(t, api.IsLabelOrChild("Work", "Work"))
+	assert.True(t, api.IsLabelOrChild("Work/Boss", "Work"))
+	assert.False(t, api.IsLabelOrChild("Workshop", "Work"))
+
+	assert.Equal(t, "Job/Boss", api.RenamedLabel("Work/Boss", "Work", "Job"))
+	assert.Equal(t, "Old/Work", api.RenamedLabel("Work", "Work", "Old/Work"))
+	assert.Equal(t, "Workshop", api.RenamedLabel("Workshop", "Work", "Job"))
+}
+
+func TestRenameLabelsInQuery(t *testing.T) {
+	renames := map[string]string{
+		"My Work":     "Job",
+		"My Work/Sub": "Job/Sub",
+	}
+	assert.Equal(t, "from:x label:job -label:job-sub",
+		api.RenameLabelsInQuery("from:x label:my-work -label:my-work-sub", renames))
+	assert.Equal(t, `(label:"Job" OR label:job)`,
+		api.RenameLabelsInQuery(`(label:"My Work" OR label:My-Work)`, renames))
+	// Other labels with the same prefix are left alone
+	assert.Equal(t, "label:my-workshop",
+		api.RenameLabelsInQuery("label:my-workshop", renames))
+
+	assert.True(t, api.QueryReferencesLabel("a -label:my-work", "My Work"))
+	assert.False(t, api.QueryReferencesLabel("a label:my-work-sub", "My Work"))
+}
+
+func TestValidateLabelColor(t *testing.T) {
+	color, err := api.ValidateLabelColor("FB4C2F")
+	assert.Nil(t, err)
+	assert.Equal(t, "#fb4c2f", color)
+	_, err = api.ValidateLabelColor("#123456")
+	assert.NotNil(t, err)
+
+	assert.Equal(t, "#ffffff", api.ContrastingTextColor("#000000"))
+	assert.Equal(t, "#000000", api.ContrastingTextColor("#fad165"))
+}
+
+const labelConfigYaml = `# My config
+InterestingMessageQuery: "label:work OR is:starred"
+ApplyLabelOnTouch: Work/Touched
+LabelColors:
+  # Bright
+  Work: red
+  Workshop: blue
+UninterestingLabelPatterns:
+  - ^work/.*$
+  - workshop
+`
+
+func TestRenameLabelInConfig(t *testing.T) {
+	renameQuery := func(q string) string {
+		return api.RenameLabelsInQuery(q, map[string]string{"Work": "Job"})
+	}
+	data, changes, err := config.RenameLabelInConfigData(
+		[]byte(labelConfigYaml), "Work", "Job", renameQuery)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(changes))
+	out := string(data)
+	assert.Contains(t, out, "# My config")
+	assert.Contains(t, out, "# Bright")
+	assert.Contains(t, out, `InterestingMessageQuery: "label:job OR is:starred"`)
+	assert.Contains(t, out, "ApplyLabelOnTouch: Job/Touched")
+	assert.Contains(t, out, "  Job: red\n")
+	assert.Contains(t, out, "  Workshop: blue\n")
+	assert.Contains(t, out, "  - ^Job/.*$\n")
+	assert.Contains(t, out, "  - workshop\n")
+	assert.True(t, strings.Index(out, "InterestingMessageQuery") <
+		strings.Index(out, "LabelColors"))
+
+	data, changes, err = config.RenameLabelInConfigData(
+		[]byte(labelConfigYaml), "Other", "Job", nil)
+	assert.Nil(t, err)
+	assert.Empty(t, changes)
+	assert.Equal(t, labelConfigYaml, string(data))
+}
+
+func TestClosestLabelName(t *testing.T) {
+	assert.Equal(t, 0, util.EditDistance("", ""))
+	assert.Equal(t, 3, util.EditDistance("kitten", "sitting"))
+	assert.Equal(t, 4, util.EditDistance("", "über"))
+
+	names := []string{"Receipts", "Work", "Work/Boss", "Newsletters"}
+	check := func(name, expected string) {
+		suggestion, ok := api.ClosestLabelName(name, names)
+		assert.Equal(t, expected != "", ok, name)
+		assert.Equal(t, expected, suggestion, name)
+	}
+	check("Reciepts", "Receipts")
+	check("work", "Work")
+	check("Work/Bos", "Work/Boss")
+	check("newsleter", "Newsletters")
+	check("Travel", "")
+	check("Personal/Finance", "")
+
+	err := &api.UnknownLabelError{Name: "Reciepts", Suggestion: "Receipts"}
+	assert.Equal(t, "No label named Reciepts found (did you mean Receipts?)", err.Error())
+	err = &api.UnknownLabelError{Name: "Travel"}
+	assert.Equal(t, "No label named Travel found", err.Error())
+}
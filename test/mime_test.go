@@ -0,0 +1,144 @@
+package test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/mime"
+)
+
+func TestDecodeCharset(t *testing.T) {
+	s, err := mime.DecodeCharset([]byte("caf\xe9"), "ISO-8859-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "café", s)
+
+	// "日本" in Shift_JIS
+	s, err = mime.DecodeCharset([]byte("\x93\xfa\x96\x7b"), "Shift_JIS")
+	assert.Nil(t, err)
+	assert.Equal(t, "日本", s)
+
+	s, err = mime.DecodeCharset([]byte("plain"), "")
+	assert.Nil(t, err)
+	assert.Equal(t, "plain", s)
+
+	s, err = mime.DecodeCharset([]byte("plain"), "x-bogus")
+	assert.NotNil(t, err)
+	assert.Equal(t, "plain", s)
+}
+
+func TestDecodeHeader(t *testing.T) {
+	assert.Equal(t, "¡Hola, señor!",
+		mime.DecodeHeader("=?ISO-8859-1?Q?=A1Hola,_se=F1or!?="))
+	assert.Equal(t, "Hello world", mime.DecodeHeader("=?UTF-8?B?SGVsbG8gd29ybGQ=?="))
+	assert.Equal(t, "not encoded", mime.DecodeHeader("not encoded"))
+}
+
+const rawMimeMsg = "From: a@example.com\r\n" +
+	"Subject: test\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Caf=E9 au lait\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>Caf&eacute; au lait</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: image/png\r\n" +
+	"Content-ID: <img1@x>\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"iVBO\r\nRw0K\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf; name=\"=?UTF-8?B?cmFwcG9ydMOpLnBkZg==?=\"\r\n" +
+	"Content-Disposition: attachment\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0=\r\n" +
+	"--outer--\r\n"
+
+func TestParseRaw(t *testing.T) {
+	msg, err := mime.ParseRaw([]byte(rawMimeMsg))
+	assert.Nil(t, err)
+	assert.Equal(t, mime.ContainerPart, msg.Root.Kind)
+	assert.Equal(t, 4, len(msg.Parts))
+
+	text := msg.TextParts()
+	assert.Equal(t, 1, len(text))
+	assert.Equal(t, "Café au lait", text[0].Text)
+	assert.Equal(t, "0.0", text[0].PartId)
+	assert.Equal(t, 1, text[0].Index)
+
+	assert.Equal(t, "Café au lait", msg.PreferredText())
+	html, ok := msg.PreferredHtml()
+	assert.True(t, ok)
+	assert.Equal(t, "<p>Caf&eacute; au lait</p>", html)
+
+	inline := msg.InlineParts()
+	assert.Equal(t, 1, len(inline))
+	assert.Equal(t, "img1@x", inline[0].ContentId)
+	assert.Equal(t, []byte("\x89PNG\r\n"), inline[0].Data)
+
+	atts := msg.Attachments()
+	assert.Equal(t, 1, len(atts))
+	assert.Equal(t, "rapporté.pdf", atts[0].Filename)
+	assert.Equal(t, []byte("%PDF-"), atts[0].Data)
+
+	part, ok := msg.Part(4)
+	assert.True(t, ok)
+	assert.Equal(t, atts[0], part)
+	_, ok = msg.Part(5)
+	assert.False(t, ok)
+}
+
+func TestParseApiPart(t *testing.T) {
+	payload := &gm.MessagePart{
+		MimeType: "multipart/alternative",
+		Headers: []*gm.MessagePartHeader{
+			{Name: "Content-Type", Value: "multipart/alternative; boundary=x"}},
+		Body: &gm.MessagePartBody{},
+		Parts: []*gm.MessagePart{
+			{PartId: "0", MimeType: "text/html",
+				Headers: []*gm.MessagePartHeader{
+					{Name: "Content-Type", Value: "text/html; charset=ISO-8859-1"}},
+				Body: &gm.MessagePartBody{
+					Data: base64.URLEncoding.EncodeToString([]byte("<b>caf\xe9</b>"))}},
+			{PartId: "1", MimeType: "application/zip", Filename: "a.zip",
+				Body: &gm.MessagePartBody{AttachmentId: "att", Size: 100}},
+		},
+	}
+	msg, err := mime.Parse(payload)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(msg.Parts))
+	assert.Equal(t, "<b>café</b>", msg.HtmlParts()[0].Text)
+	assert.Equal(t, "café", msg.PreferredText())
+	atts := msg.Attachments()
+	assert.Equal(t, "att", atts[0].AttachmentId)
+	assert.Nil(t, atts[0].Data)
+	assert.Equal(t, int64(100), atts[0].Size)
+}
+
+func TestHtmlToText(t *testing.T) {
+	assert.Equal(t, "Hello world", mime.HtmlToText("<p>Hello   <b>world</b></p>"))
+	assert.Equal(t,
+		"Title\n\nPara one.\n\n* a\n* b",
+		mime.HtmlToText("<html><head><style>p{}</style></head><body>"+
+			"<h1>Title</h1><p>Para one.</p><ul><li>a</li><li>b</li></ul></body></html>"))
+	assert.Equal(t, "line1\nline2", mime.HtmlToText("line1<br>line2"))
+	assert.Equal(t, "Click here (https://x.com)",
+		mime.HtmlToText(`<a href="https://x.com">Click here</a>`))
+	assert.Equal(t, "https://x.com",
+		mime.HtmlToText(`<a href="https://x.com">https://x.com</a>`))
+	assert.Equal(t, "a & b", mime.HtmlToText("a &amp; b<script>var x;</script>"))
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	gm "google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v2"
+
+	"github.com/tsiemens/gmail-tools/pluginsoutdated"
+)
+
+// The outdated-rules section of PluginConfig
+const outdatedRulesYaml = `
+Rules:
+  - Name: ci
+    Query: from:ci@example.com
+    SubjectKey: '^build #\d+ of (\S+)'
+  - Name: reviews
+    From: reviews@example.com
+    Scope: thread
+`
+
+func outdatedMsg(id, threadId, from, subject string, millis int64) *gm.Message {
+	msg := threadMsg(from, subject, millis)
+	msg.Id = id
+	msg.ThreadId = threadId
+	return msg
+}
+
+func TestOutdatedRules(t *testing.T) {
+	conf := &struct {
+		Rules []pluginsoutdated.Rule `yaml:"Rules"`
+	}{}
+	assert.NoError(t, yaml.Unmarshal([]byte(outdatedRulesYaml), conf))
+	rs, err := pluginsoutdated.Compile(conf.Rules)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ci := "CI <ci@example.com>"
+	msgs := map[string][]*gm.Message{
+		"in:inbox from:ci@example.com": {
+			outdatedMsg("c4", "t4", ci, "Build #14 of api passed", 4000),
+			outdatedMsg("c3", "t3", ci, "Build #13 of web failed", 3000),
+			outdatedMsg("c2", "t2", ci, "Re: Build #12 of api failed", 2000),
+			outdatedMsg("c1", "t1", ci, "Build #11 of api passed", 1000),
+			// Not matched by SubjectKey
+			outdatedMsg("c0", "t0", ci, "Weekly report", 500),
+		},
+		"in:inbox": {
+			outdatedMsg("r3", "rt1", "reviews@example.com", "Review: fix", 3500),
+			outdatedMsg("r2", "rt2", "reviews@example.com", "Review: feature", 2500),
+			outdatedMsg("r1", "rt1", "Reviews <reviews@example.com>", "Review: fix", 1500),
+			outdatedMsg("o1", "rt1", "someone@example.com", "Re: Review: fix", 1200),
+		},
+	}
+	var maxes []int64
+	query := func(q string, maxMsgs int64) ([]*gm.Message, error) {
+		maxes = append(maxes, maxMsgs)
+		res, ok := msgs[q]
+		if !ok {
+			return nil, fmt.Errorf("Unexpected query %s", q)
+		}
+		return res, nil
+	}
+	ids := func(msgs []*gm.Message) []string {
+		var res []string
+		for _, m := range msgs {
+			res = append(res, m.Id)
+		}
+		return res
+	}
+
+	outdated, err := rs.Outdated("in:inbox", -1, query)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c2", "r1", "c1"}, ids(outdated))
+	assert.Equal(t, []int64{-1, -1}, maxes)
+
+	maxes = nil
+	outdated, err = rs.Outdated("in:inbox", 2, query)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c2", "r1"}, ids(outdated))
+	assert.Equal(t, []int64{2, 2}, maxes)
+
+	_, err = rs.Outdated("in:trash", -1, query)
+	assert.Error(t, err)
+
+	// Without a SubjectKey, the whole subject is the key
+	rs, err = pluginsoutdated.Compile([]pluginsoutdated.Rule{{Name: "a", From: "ci@"}})
+	assert.NoError(t, err)
+	outdated, err = rs.Outdated("in:inbox from:ci@example.com", -1,
+		func(q string, maxMsgs int64) ([]*gm.Message, error) {
+			return []*gm.Message{
+				outdatedMsg("s2", "t2", ci, "Deploy  Done", 2000),
+				outdatedMsg("s1", "t1", ci, "RE: deploy done", 1000),
+				outdatedMsg("s0", "t0", ci, "Deploy started", 500),
+			}, nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"s1"}, ids(outdated))
+}
+
+func TestOutdatedRulesValidate(t *testing.T) {
+	invalid := func(r pluginsoutdated.Rule) {
+		_, err := pluginsoutdated.Compile([]pluginsoutdated.Rule{r})
+		assert.Error(t, err, fmt.Sprintf("%+v", r))
+	}
+	invalid(pluginsoutdated.Rule{Query: "from:a"})
+	invalid(pluginsoutdated.Rule{Name: "a"})
+	invalid(pluginsoutdated.Rule{Name: "a", Query: "from:a", Scope: "sender-thread"})
+	invalid(pluginsoutdated.Rule{Name: "a", Query: "from:a", Scope: "thread", SubjectKey: "x"})
+	invalid(pluginsoutdated.Rule{Name: "a", From: "("})
+	invalid(pluginsoutdated.Rule{Name: "a", Query: "from:a", SubjectKey: "("})
+
+	r := pluginsoutdated.Rule{Name: "a", Query: "from:a"}
+	_, err := pluginsoutdated.Compile([]pluginsoutdated.Rule{r, r})
+	assert.Error(t, err)
+
+	plug, err := pluginsoutdated.NewPlugin(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, plug.OutdatedMessages)
+	plug, err = pluginsoutdated.NewPlugin([]pluginsoutdated.Rule{r})
+	assert.NoError(t, err)
+	assert.NotNil(t, plug.OutdatedMessages)
+
+	assert.Equal(t, "build #12", pluginsoutdated.NormalizeSubject(" Re: FWD:re:Build   #12"))
+}
@@ -0,0 +1,429 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	gm "google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v2"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/plugin"
+	"github.com/tsiemens/gmail-tools/util"
+)
+
+// When set, the test binary runs as a plugin executable instead
+const testPluginEnv = "GMAILCLI_TEST_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testPluginEnv) != "" {
+		testPluginServer().Run()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func testPluginServer() *plugin.Server {
+	return &plugin.Server{
+		Name: "test",
+		MessageInterest: func(m *gm.Message, host *plugin.Host) plugin.Interest {
+			if m.Snippet == "spam" {
+				return plugin.Interest{Level: plugin.StronglyUninteresting, Reason: "Spam"}
+			}
+			return plugin.Interest{Level: plugin.UnknownInterest}
+		},
+		DetailRequiredForInterest: api.LabelsAndPayload,
+		MessageFilters: map[string]*plugin.ServerMessageFilter{
+			"is-short": {
+				Desc:   "Short snippet",
+				Detail: api.LabelsOnly,
+				Matches: func(m *gm.Message, _ plugin.FilterArgs, _ *plugin.Host) (bool, error) {
+					return len(m.Snippet) < 5, nil
+				},
+			},
+			"snippet-longer": {
+				Desc:   "Longer snippet than n",
+				Params: []plugin.FilterParam{{Name: "n", Type: plugin.IntParam}},
+				Matches: func(m *gm.Message, args plugin.FilterArgs, _ *plugin.Host) (bool, error) {
+					if m.Snippet == "" {
+						return false, errors.New("no snippet")
+					}
+					return int64(len(m.Snippet)) > args.Int(0), nil
+				},
+			},
+			"crash": {
+				Desc: "Exits",
+				Matches: func(*gm.Message, plugin.FilterArgs, *plugin.Host) (bool, error) {
+					os.Exit(3)
+					return false, nil
+				},
+			},
+		},
+	}
+}
+
+func TestPluginLevelNames(t *testing.T) {
+	for _, i := range []plugin.InterestLevel{plugin.StronglyInteresting,
+		plugin.StronglyUninteresting, plugin.WeaklyInteresting,
+		plugin.WeaklyUninteresting, plugin.UnknownInterest} {
+		parsed, err := plugin.ParseInterestLevel(i.String())
+		assert.NoError(t, err)
+		assert.Equal(t, i, parsed)
+	}
+	_, err := plugin.ParseInterestLevel("very-interesting")
+	assert.Error(t, err)
+
+	for _, d := range []api.MessageDetailLevel{api.IdsOnly, api.LabelsOnly, api.LabelsAndPayload} {
+		parsed, err := plugin.ParseDetailLevel(plugin.DetailLevelName(d))
+		assert.NoError(t, err)
+		assert.Equal(t, d, parsed)
+	}
+	_, err = plugin.ParseDetailLevel("raw")
+	assert.Error(t, err)
+
+	for _, pt := range []plugin.ParamType{plugin.StringParam, plugin.IntParam,
+		plugin.RegexpParam} {
+		parsed, err := plugin.ParseParamType(pt.String())
+		assert.NoError(t, err)
+		assert.Equal(t, pt, parsed)
+	}
+	_, err = plugin.ParseParamType("float")
+	assert.Error(t, err)
+
+	// Arguments are sent to plugin executables as they were given
+	filter := &plugin.MessageFilter{Params: []plugin.FilterParam{
+		{Name: "s", Type: plugin.StringParam},
+		{Name: "n", Type: plugin.IntParam},
+		{Name: "re", Type: plugin.RegexpParam},
+	}}
+	args, err := filter.ParseArgs([]string{"a b", "-3", "^re:"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a b", "-3", "^re:"}, args.Strings())
+}
+
+func TestCombineVerdicts(t *testing.T) {
+	verdict := func(name string, level plugin.InterestLevel) plugin.Verdict {
+		return plugin.Verdict{Plugin: name, Interest: plugin.Interest{Level: level}}
+	}
+	check := func(expected plugin.InterestLevel, expectedDecider int,
+		verdicts ...plugin.Verdict) {
+		level, decider := plugin.CombineVerdicts(verdicts)
+		assert.Equal(t, expected, level)
+		assert.Equal(t, expectedDecider, decider)
+	}
+	check(plugin.UnknownInterest, -1)
+	check(plugin.UnknownInterest, -1, verdict("a", plugin.UnknownInterest))
+	check(plugin.WeaklyInteresting, 1,
+		verdict("a", plugin.WeaklyUninteresting), verdict("b", plugin.WeaklyInteresting),
+		verdict("c", plugin.WeaklyUninteresting))
+	// The first plugin to give the combined level decides
+	check(plugin.StronglyUninteresting, 0,
+		verdict("a", plugin.StronglyUninteresting), verdict("b", plugin.WeaklyInteresting),
+		verdict("c", plugin.StronglyUninteresting))
+	check(plugin.StronglyInteresting, 2,
+		verdict("a", plugin.StronglyUninteresting), verdict("b", plugin.UnknownInterest),
+		verdict("c", plugin.StronglyInteresting))
+}
+
+func TestPluginServerCallbacks(t *testing.T) {
+	server := &plugin.Server{
+		Name: "labels",
+		MessageInterest: func(m *gm.Message, host *plugin.Host) plugin.Interest {
+			names, err := host.ThreadLabelNames(m.ThreadId)
+			if err == nil && util.StringSliceContains("Important", names) {
+				return plugin.Interest{Level: plugin.WeaklyInteresting}
+			}
+			return plugin.Interest{Level: plugin.UnknownInterest}
+		},
+	}
+
+	// gmailcli's side of the connection
+	hostHandler := func(method string, params json.RawMessage) (interface{}, error) {
+		switch method {
+		case plugin.GetLabelsMethod:
+			return map[string]string{"Label_1": "Important", "INBOX": "INBOX"}, nil
+		case plugin.GetThreadMethod:
+			p := &plugin.GetParams{}
+			assert.NoError(t, json.Unmarshal(params, p))
+			labelIds := []string{"INBOX"}
+			if p.Id == "t1" {
+				labelIds = append(labelIds, "Label_1")
+			}
+			return &gm.Thread{Id: p.Id, Messages: []*gm.Message{{Id: "m", LabelIds: labelIds}}}, nil
+		}
+		return nil, &plugin.RPCError{Code: plugin.MethodNotFoundCode, Message: method}
+	}
+	pluginIn, hostOut := io.Pipe()
+	hostIn, pluginOut := io.Pipe()
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(pluginIn, pluginOut) }()
+	conn := plugin.NewConn(hostIn, hostOut, hostHandler)
+
+	initRes := &plugin.InitializeResult{}
+	err := conn.Call(plugin.InitializeMethod,
+		&plugin.InitializeParams{ProtocolVersion: plugin.ProtocolVersion}, initRes)
+	assert.NoError(t, err)
+	assert.Equal(t, "labels", initRes.Name)
+	assert.Equal(t, plugin.ProtocolVersion, initRes.ProtocolVersion)
+	assert.True(t, initRes.MessageInterest)
+	assert.False(t, initRes.OutdatedMessages)
+	assert.Equal(t, "ids", initRes.DetailRequiredForInterest)
+
+	checkInterest := func(threadId string, expected plugin.InterestLevel) {
+		res := &plugin.MessageInterestResult{}
+		err := conn.Call(plugin.MessageInterestMethod,
+			&plugin.MessageParams{Message: &gm.Message{Id: "m", ThreadId: threadId}}, res)
+		assert.NoError(t, err)
+		assert.Equal(t, expected.String(), res.Interest)
+	}
+	checkInterest("t1", plugin.WeaklyInteresting)
+	checkInterest("t2", plugin.UnknownInterest)
+
+	err = conn.Call(plugin.OutdatedMessagesMethod, &plugin.OutdatedMessagesParams{}, nil)
+	if assert.IsType(t, &plugin.RPCError{}, err) {
+		assert.Equal(t, plugin.MethodNotFoundCode, err.(*plugin.RPCError).Code)
+	}
+
+	hostOut.Close()
+	assert.NoError(t, <-served)
+}
+
+// writeTestPlugin writes an executable to dir, which runs testPluginServer
+func writeTestPlugin(t *testing.T, dir, name string) string {
+	exe, err := os.Executable()
+	assert.NoError(t, err)
+	script := filepath.Join(dir, name)
+	err = os.WriteFile(script,
+		[]byte("#!/bin/sh\n"+testPluginEnv+"=1 exec '"+exe+"'\n"), 0755)
+	assert.NoError(t, err)
+	return script
+}
+
+func TestRemotePlugin(t *testing.T) {
+	script := writeTestPlugin(t, t.TempDir(), "test-plugin")
+	plug, err := plugin.StartRemotePlugin(script)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx := plugin.NewContext("test-plugin", nil)
+	assert.Equal(t, "test", plug.Name)
+	assert.Equal(t, api.LabelsAndPayload, plug.DetailRequiredForInterest())
+	assert.Equal(t, plugin.Interest{Level: plugin.StronglyUninteresting, Reason: "Spam"},
+		plug.MessageInterest(ctx, &gm.Message{Snippet: "spam"}))
+	assert.Equal(t, plugin.Interest{Level: plugin.UnknownInterest},
+		plug.MessageInterest(ctx, &gm.Message{Snippet: "hello"}))
+	assert.Nil(t, plug.OutdatedMessages)
+	assert.Nil(t, plug.PrintMessageSummary)
+
+	assert.Len(t, plug.MessageFilters, 3)
+	isShort := plug.MessageFilters["is-short"]
+	assert.Equal(t, "Short snippet", isShort.Desc)
+	assert.Equal(t, api.LabelsOnly, isShort.Detail)
+	assert.Empty(t, isShort.Params)
+	assert.Equal(t, api.IdsOnly, plug.MessageFilters["crash"].Detail)
+	matched, err := isShort.Matches(ctx, &gm.Message{Snippet: "hi"}, nil)
+	assert.NoError(t, err)
+	assert.True(t, matched)
+	matched, err = isShort.Matches(ctx, &gm.Message{Snippet: "hello"}, nil)
+	assert.NoError(t, err)
+	assert.False(t, matched)
+
+	// Filters may take arguments, and fail
+	longer := plug.MessageFilters["snippet-longer"]
+	assert.Equal(t, "snippet-longer(n int)", longer.Usage("snippet-longer"))
+	args, err := longer.ParseArgs([]string{"3"})
+	assert.NoError(t, err)
+	matched, err = longer.Matches(ctx, &gm.Message{Snippet: "hello"}, args)
+	assert.NoError(t, err)
+	assert.True(t, matched)
+	matched, err = longer.Matches(ctx, &gm.Message{Snippet: "hi"}, args)
+	assert.NoError(t, err)
+	assert.False(t, matched)
+	_, err = longer.Matches(ctx, &gm.Message{}, args)
+	assert.EqualError(t, err, "Plugin test: snippet-longer failed: no snippet (code -32603)")
+	_, err = longer.Matches(ctx, &gm.Message{Snippet: "hi"}, nil)
+	assert.EqualError(t, err, "Plugin test: snippet-longer failed: "+
+		"Filter snippet-longer takes 1 arguments, but 0 were given (code -32602)")
+
+	// Once the plugin has exited, it is no longer called, and its filters fail
+	matched, err = plug.MessageFilters["crash"].Matches(ctx, &gm.Message{}, nil)
+	assert.Error(t, err)
+	assert.False(t, matched)
+	matched, err = isShort.Matches(ctx, &gm.Message{Snippet: "hi"}, nil)
+	assert.EqualError(t, err, "Plugin test: is-short failed: The plugin has already failed")
+	assert.False(t, matched)
+	assert.Equal(t, plugin.UnknownInterest,
+		plug.MessageInterest(ctx, &gm.Message{Snippet: "spam"}).Level)
+
+	_, err = plugin.StartRemotePlugin(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestPluginRegistry(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPlugin(t, dir, "ext")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "old.so"), nil, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "README"), nil, 0644))
+
+	plugin.RegisterBuiltin("test-a", plugin.APIVersion, func(ctx *plugin.Context,
+	) (*plugin.Plugin, error) {
+		conf := &struct {
+			Name string `yaml:"Name"`
+		}{}
+		if err := ctx.LoadConfig(conf); err != nil {
+			return nil, err
+		}
+		return &plugin.Plugin{Name: conf.Name, OutdatedMessages: func(
+			*plugin.Context, string, int64) []*gm.Message {
+			return nil
+		}}, nil
+	})
+	plugin.RegisterBuiltin("test-b", plugin.APIVersion, func(*plugin.Context,
+	) (*plugin.Plugin, error) {
+		return &plugin.Plugin{Name: "B"}, nil
+	})
+	plugin.RegisterBuiltin("test-old", plugin.APIVersion-1, func(*plugin.Context,
+	) (*plugin.Plugin, error) {
+		return &plugin.Plugin{Name: "Old"}, nil
+	})
+	assert.Panics(t, func() {
+		plugin.RegisterBuiltin("test-a", plugin.APIVersion, func(*plugin.Context,
+		) (*plugin.Plugin, error) {
+			return nil, nil
+		})
+	})
+	env := &plugin.Env{
+		LoadConfig: func(id string, out interface{}) error {
+			if id == "test-a" {
+				return yaml.Unmarshal([]byte("Name: A"), out)
+			}
+			return nil
+		},
+	}
+
+	// Ignores builtins registered outside of this test
+	ours := func(loaded []*plugin.LoadedPlugin) []*plugin.LoadedPlugin {
+		var res []*plugin.LoadedPlugin
+		for _, lp := range loaded {
+			if lp.Source != plugin.BuiltinSource || strings.HasPrefix(lp.Id, "test-") {
+				res = append(res, lp)
+			}
+		}
+		return res
+	}
+	ids := func(loaded []*plugin.LoadedPlugin) []string {
+		var res []string
+		for _, lp := range loaded {
+			res = append(res, lp.Id)
+		}
+		return res
+	}
+
+	loaded := ours(plugin.LoadPluginsFromDir(dir, &plugin.PluginsConfig{
+		Enabled:  []string{"ext", "test-a", "test-b", "test-old", "old.so"},
+		Disabled: []string{"test-b"}, Order: []string{"ext"}}, env))
+	assert.Equal(t, []string{"ext", "test-a", "test-b", "test-old", "old.so"},
+		ids(loaded))
+	ext := loaded[0]
+	assert.Equal(t, filepath.Join(dir, "ext"), ext.Source)
+	if assert.NoError(t, ext.Err) {
+		assert.Equal(t, "test", ext.Plugin.Name)
+		assert.Equal(t, []string{"interest", "xfilter:crash", "xfilter:is-short",
+			"xfilter:snippet-longer"}, ext.Plugin.Capabilities())
+	}
+	assert.Equal(t, plugin.BuiltinSource, loaded[1].Source)
+	assert.Equal(t, []string{"outdated"}, loaded[1].Plugin.Capabilities())
+	assert.Equal(t, "test-a", loaded[1].Plugin.Ctx.Id)
+	assert.True(t, loaded[2].Disabled)
+	assert.Nil(t, loaded[2].Plugin)
+	// Built for an older plugin API
+	assert.Error(t, loaded[3].Err)
+	assert.Nil(t, loaded[3].Plugin)
+	assert.Error(t, loaded[4].Err)
+
+	plugins := plugin.EnabledPlugins(loaded)
+	if assert.Len(t, plugins, 2) {
+		assert.Equal(t, "test", plugins[0].Name)
+		assert.Equal(t, "A", plugins[1].Name)
+	}
+	util.RunCleanupHandlers()
+
+	loaded = ours(plugin.LoadPluginsFromDir(dir,
+		&plugin.PluginsConfig{Enabled: []string{"test-b"}, Order: []string{"test-b"}}, env))
+	assert.Equal(t, []string{"test-b", "test-a", "test-old", "ext", "old.so"}, ids(loaded))
+	plugins = plugin.EnabledPlugins(loaded)
+	if assert.Len(t, plugins, 1) {
+		assert.Equal(t, "B", plugins[0].Name)
+	}
+	assert.True(t, loaded[3].Disabled)
+
+	// Without executables
+	loaded = ours(plugin.LoadBuiltinPlugins(&plugin.PluginsConfig{}, env))
+	assert.Equal(t, []string{"test-a", "test-b", "test-old"}, ids(loaded))
+}
+
+func TestPluginContext(t *testing.T) {
+	dir := t.TempDir()
+	globalConf := "Shared: yes"
+	env := &plugin.Env{
+		LoadGlobalConfig: func(out interface{}) error {
+			return yaml.Unmarshal([]byte(globalConf), out)
+		},
+		StoreDir: dir,
+	}
+	ctx := plugin.NewContext("myplugin", env)
+	assert.Equal(t, "myplugin", ctx.Id)
+	assert.False(t, ctx.Cancelled())
+
+	// No section for the plugin
+	conf := &struct {
+		Shared string `yaml:"Shared"`
+	}{Shared: "default"}
+	assert.NoError(t, ctx.LoadConfig(conf))
+	assert.Equal(t, "default", conf.Shared)
+	assert.NoError(t, ctx.LoadGlobalConfig(conf))
+	assert.Equal(t, "yes", conf.Shared)
+
+	// Gmail is not available
+	_, err := ctx.LabelName("Label_1")
+	assert.Error(t, err)
+
+	var n int
+	ok, err := ctx.Store.Get("count", &n)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, ctx.Store.Set("count", 3))
+	assert.NoError(t, ctx.Store.Set("names", []string{"a", "b"}))
+	assert.NoError(t, ctx.Store.Delete("names"))
+	assert.NoError(t, ctx.Store.Delete("missing"))
+
+	// Values persist in a new Context
+	ctx = plugin.NewContext("myplugin", env)
+	ok, err = ctx.Store.Get("count", &n)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 3, n)
+	var names []string
+	ok, err = ctx.Store.Get("names", &names)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	_, err = os.Stat(filepath.Join(dir, "myplugin.json"))
+	assert.NoError(t, err)
+
+	// Stores are separate for each plugin
+	ok, err = plugin.NewContext("other", env).Store.Get("count", &n)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	ctx = plugin.NewContext("myplugin", &plugin.Env{Ctx: cancelCtx})
+	cancel()
+	assert.True(t, ctx.Cancelled())
+}
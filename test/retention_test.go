@@ -0,0 +1,114 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/retention"
+)
+
+func TestRetentionSearchQuery(t *testing.T) {
+	check := func(p retention.Policy, expected string) {
+		assert.Equal(t, expected, p.SearchQuery())
+	}
+	check(retention.Policy{Label: "CATEGORY_PROMOTIONS", OlderThan: "30d"},
+		"category:promotions older_than:30d")
+	check(retention.Policy{Label: "INBOX", OlderThan: "1y"}, "in:inbox older_than:1y")
+	check(retention.Policy{Label: "Notifications/CI", OlderThan: "7d", Query: "-is:starred"},
+		`label:"Notifications/CI" older_than:7d (-is:starred)`)
+	check(retention.Policy{Label: "News", OlderThan: "6m", Action: retention.ArchiveAction},
+		`label:"News" older_than:6m in:inbox`)
+	// All-caps user labels are not system labels
+	check(retention.Policy{Label: "CI", OlderThan: "7d"}, `label:"CI" older_than:7d`)
+	check(retention.Policy{Label: "SPAM", OlderThan: "7d"}, "in:spam older_than:7d")
+
+	assert.True(t, (&retention.Policy{Label: "STARRED"}).HasSystemLabel())
+	assert.True(t, (&retention.Policy{Label: "CATEGORY_SOCIAL"}).HasSystemLabel())
+	assert.False(t, (&retention.Policy{Label: "TODO"}).HasSystemLabel())
+	assert.False(t, (&retention.Policy{Label: "Inbox"}).HasSystemLabel())
+}
+
+func TestRetentionConfig(t *testing.T) {
+	data := `
+Retention:
+  - Name: promotions
+    Label: CATEGORY_PROMOTIONS
+    OlderThan: 30d
+    ExemptInteresting: true
+  - Name: old-ci
+    Label: Notifications/CI
+    OlderThan: 7d
+    Action: archive
+    ExemptLabelPatterns: [Keep.*]
+`
+	conf := &config.Config{}
+	assert.NoError(t, yaml.Unmarshal([]byte(data), conf))
+	assert.Len(t, conf.Retention, 2)
+	assert.NoError(t, retention.ValidatePolicies(conf.Retention))
+	assert.Equal(t, retention.TrashAction, conf.Retention[0].EffectiveAction())
+	assert.True(t, conf.Retention[0].ExemptInteresting)
+	assert.Equal(t, retention.ArchiveAction, conf.Retention[1].EffectiveAction())
+
+	selected, err := retention.SelectPolicies(conf.Retention, []string{"old-ci"})
+	assert.NoError(t, err)
+	assert.Equal(t, "old-ci", selected[0].Name)
+	selected, err = retention.SelectPolicies(conf.Retention, nil)
+	assert.NoError(t, err)
+	assert.Len(t, selected, 2)
+	_, err = retention.SelectPolicies(conf.Retention, []string{"nope"})
+	assert.Error(t, err)
+
+	invalid := func(mod func(p *retention.Policy)) error {
+		p := conf.Retention[1]
+		mod(&p)
+		return retention.ValidatePolicies([]retention.Policy{p})
+	}
+	assert.Error(t, invalid(func(p *retention.Policy) { p.Name = "" }))
+	assert.Error(t, invalid(func(p *retention.Policy) { p.Label = "" }))
+	assert.Error(t, invalid(func(p *retention.Policy) { p.OlderThan = "30" }))
+	assert.Error(t, invalid(func(p *retention.Policy) { p.OlderThan = "2w" }))
+	assert.Error(t, invalid(func(p *retention.Policy) { p.Action = "delete" }))
+	assert.Error(t, invalid(func(p *retention.Policy) { p.ExemptLabelPatterns = []string{"("} }))
+	assert.Error(t, retention.ValidatePolicies(
+		[]retention.Policy{conf.Retention[0], conf.Retention[0]}))
+}
+
+func TestRetentionExempt(t *testing.T) {
+	p := retention.Policy{Name: "p", ExemptLabelPatterns: []string{"^keep$"}}
+	res, err := p.ExemptLabelRegexps()
+	assert.NoError(t, err)
+	res = append(res, regexp.MustCompile("^Important/"))
+
+	assert.True(t, retention.IsExempt([]string{"INBOX", "Keep"}, res))
+	assert.True(t, retention.IsExempt([]string{"Important/Work"}, res))
+	assert.False(t, retention.IsExempt([]string{"INBOX", "Keeper"}, res))
+	assert.False(t, retention.IsExempt(nil, res))
+	assert.False(t, retention.IsExempt([]string{"Keep"}, nil))
+}
+
+func TestRetentionReportWrite(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "report.json")
+	report := &retention.Report{
+		Time: time.Date(2024, 1, 10, 10, 0, 0, 0, time.UTC),
+		Policies: []*retention.PolicyReport{{
+			Policy: "promotions", Query: "category:promotions older_than:30d",
+			Action: retention.TrashAction, Matched: 3, Exempt: 1, Applied: 2,
+			BySender: map[string]int{"a@example.com": 2},
+		}},
+	}
+	assert.NoError(t, report.Write(fname))
+
+	data, err := os.ReadFile(fname)
+	assert.NoError(t, err)
+	loaded := &retention.Report{}
+	assert.NoError(t, json.Unmarshal(data, loaded))
+	assert.Equal(t, report, loaded)
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+
+	"github.com/tsiemens/gmail-tools/config"
+	"github.com/tsiemens/gmail-tools/rules"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// A Wednesday
+	base := time.Date(2024, 1, 10, 10, 7, 30, 0, time.UTC)
+	check := func(spec string, expected time.Time) {
+		sched, err := rules.ParseSchedule(spec)
+		if assert.NoError(t, err, spec) {
+			assert.Equal(t, expected, sched.Next(base), spec)
+		}
+	}
+	check("* * * * *", time.Date(2024, 1, 10, 10, 8, 0, 0, time.UTC))
+	check("*/15 * * * *", time.Date(2024, 1, 10, 10, 15, 0, 0, time.UTC))
+	check("0 * * * *", time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC))
+	check("@hourly", time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC))
+	check("30 8 * * *", time.Date(2024, 1, 11, 8, 30, 0, 0, time.UTC))
+	check("0 9 * * mon-fri", time.Date(2024, 1, 11, 9, 0, 0, 0, time.UTC))
+	check("0 9 * * sat,7", time.Date(2024, 1, 13, 9, 0, 0, 0, time.UTC))
+	check("0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC))
+	check("0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC))
+	// Day of month or week, when both are given
+	check("0 0 15 * mon", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC))
+	check("0 0 20 * fri", time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC))
+	check("@every 90m", base.Add(90*time.Minute))
+
+	never, err := rules.ParseSchedule("0 0 30 2 *")
+	assert.NoError(t, err)
+	assert.True(t, never.Next(base).IsZero())
+
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* * * * 8",
+		"*/0 * * * *", "5-1 * * * *", "@every 10s", "@yearly", "x * * * *"} {
+		_, err := rules.ParseSchedule(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestRulesConfig(t *testing.T) {
+	data := `
+Rules:
+  - Name: archive-updates
+    Query: in:inbox category:updates
+    Interest: uninteresting
+    XFilters: [old]
+    Actions:
+      AddLabels: [Archived]
+      Archive: true
+    Schedule: "0 * * * *"
+  - Name: trash-spam
+    Query: from:spam@example.com
+    Actions:
+      Trash: true
+`
+	conf := &config.Config{}
+	assert.NoError(t, yaml.Unmarshal([]byte(data), conf))
+	assert.Len(t, conf.Rules, 2)
+	rule := conf.Rules[0]
+	assert.Equal(t, "archive-updates", rule.Name)
+	assert.Equal(t, rules.Uninteresting, rule.Interest)
+	assert.Equal(t, []string{"old"}, rule.XFilters)
+	assert.Equal(t, []string{"Archived"}, rule.Actions.AddLabels)
+	assert.True(t, rule.Actions.Archive)
+	assert.NoError(t, rules.ValidateRules(conf.Rules))
+
+	selected, err := rules.SelectRules(conf.Rules, []string{"trash-spam"})
+	assert.NoError(t, err)
+	assert.Equal(t, "trash-spam", selected[0].Name)
+	selected, err = rules.SelectRules(conf.Rules, nil)
+	assert.NoError(t, err)
+	assert.Len(t, selected, 2)
+	_, err = rules.SelectRules(conf.Rules, []string{"nope"})
+	assert.Error(t, err)
+
+	invalid := func(mod func(r *rules.Rule)) error {
+		r := conf.Rules[0]
+		mod(&r)
+		return rules.ValidateRules([]rules.Rule{r})
+	}
+	assert.Error(t, invalid(func(r *rules.Rule) { r.Name = "" }))
+	assert.Error(t, invalid(func(r *rules.Rule) { r.Query = "" }))
+	assert.Error(t, invalid(func(r *rules.Rule) { r.Interest = "maybe" }))
+	assert.Error(t, invalid(func(r *rules.Rule) { r.LabelPatterns = []string{"("} }))
+	assert.Error(t, invalid(func(r *rules.Rule) { r.Actions = rules.Actions{} }))
+	assert.Error(t, invalid(func(r *rules.Rule) { r.Schedule = "hourly" }))
+	assert.Error(t, rules.ValidateRules([]rules.Rule{conf.Rules[1], conf.Rules[1]}))
+}
+
+func TestRulesLock(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "rules.lock")
+
+	lock, err := rules.AcquireLock(fname)
+	assert.NoError(t, err)
+	_, err = rules.AcquireLock(fname)
+	if assert.IsType(t, &rules.LockedError{}, err) {
+		assert.Equal(t, os.Getpid(), err.(*rules.LockedError).Pid)
+	}
+	assert.NoError(t, lock.Release())
+
+	// A lock left by a process which no longer exists is taken over
+	assert.NoError(t, os.WriteFile(fname, []byte("999999999\n"), 0600))
+	lock, err = rules.AcquireLock(fname)
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Release())
+}
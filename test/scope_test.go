@@ -0,0 +1,61 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tsiemens/gmail-tools/api"
+)
+
+func TestScopeProfileForOps(t *testing.T) {
+	profile, err := api.ScopeProfileForOps(api.ReadMessagesOp, api.ReadLabelsOp)
+	assert.Nil(t, err)
+	assert.Equal(t, api.ReadScope, profile)
+
+	profile, err = api.ScopeProfileForOps(api.ReadLabelsOp, api.ReadSettingsOp)
+	assert.Nil(t, err)
+	assert.Equal(t, api.ReadScope, profile)
+
+	profile, err = api.ScopeProfileForOps(api.ReadMessagesOp, api.ModifyLabelsOp)
+	assert.Nil(t, err)
+	assert.Equal(t, api.LabelsScope, profile)
+
+	profile, err = api.ScopeProfileForOps(api.ReadMessagesOp, api.ModifyMessagesOp)
+	assert.Nil(t, err)
+	assert.Equal(t, api.ModifyScope, profile)
+
+	profile, err = api.ScopeProfileForOps(api.ReadSettingsOp, api.ModifySettingsOp)
+	assert.Nil(t, err)
+	assert.Equal(t, api.FiltersScope, profile)
+
+	profile, err = api.ScopeProfileForOps(api.SendMessagesOp)
+	assert.Nil(t, err)
+	assert.Equal(t, api.SendScope, profile)
+
+	profile, err = api.ScopeProfileForOps(api.ComposeDraftsOp)
+	assert.Nil(t, err)
+	assert.Equal(t, api.ComposeScope, profile)
+
+	profile, err = api.ScopeProfileForOps(api.ReadMessagesOp, api.SendMessagesOp)
+	assert.Nil(t, err)
+	assert.Equal(t, api.ModifyScope, profile)
+
+	_, err = api.ScopeProfileForOps(api.ModifyMessagesOp, api.ModifySettingsOp)
+	assert.NotNil(t, err)
+}
+
+func TestScopeProfileByName(t *testing.T) {
+	for _, profile := range api.ScopeProfiles {
+		found, ok := api.ScopeProfileByName(profile.Name)
+		assert.True(t, ok)
+		assert.Equal(t, profile, found)
+	}
+
+	profile, ok := api.ScopeProfileByName("email")
+	assert.True(t, ok)
+	assert.Equal(t, api.ModifyScope, profile)
+
+	_, ok = api.ScopeProfileByName("bogus")
+	assert.False(t, ok)
+}
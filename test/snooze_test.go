@@ -0,0 +1,86 @@
+package test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tsiemens/gmail-tools/snooze"
+)
+
+func TestSnoozeParseUntil(t *testing.T) {
+	now := time.Date(2026, 10, 18, 13, 30, 0, 0, time.UTC)
+	check := func(s string, expected time.Time) {
+		until, err := snooze.ParseUntil(s, now)
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, expected, until, s)
+		}
+	}
+	check("2026-11-01T09:00", time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC))
+	check("2026-11-01 17:45", time.Date(2026, 11, 1, 17, 45, 0, 0, time.UTC))
+	check("2026-11-01", time.Date(2026, 11, 1, 8, 0, 0, 0, time.UTC))
+	check("3h", time.Date(2026, 10, 18, 16, 30, 0, 0, time.UTC))
+	check("2d", time.Date(2026, 10, 20, 13, 30, 0, 0, time.UTC))
+
+	// A date is 08:00 local time, even when the clocks change that day
+	if loc, err := time.LoadLocation("America/New_York"); err == nil {
+		until, err := snooze.ParseUntil("2026-03-08", now.In(loc))
+		assert.NoError(t, err)
+		assert.Equal(t, time.Date(2026, 3, 8, 8, 0, 0, 0, loc), until)
+		assert.Equal(t, 8, until.Hour())
+	}
+
+	for _, bad := range []string{"", "tomorrow", "-3h", "2026-13-01", "d"} {
+		_, err := snooze.ParseUntil(bad, now)
+		assert.Error(t, err, bad)
+	}
+
+	assert.Equal(t, "Snoozed/2026-11-01",
+		snooze.LabelForTime(time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC)))
+}
+
+func TestSnoozeDB(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "snooze.json")
+	db, err := snooze.LoadDB(fname)
+	assert.NoError(t, err)
+	assert.Empty(t, db.Entries)
+
+	day := func(d int) time.Time { return time.Date(2026, 11, d, 8, 0, 0, 0, time.UTC) }
+	entry := func(id string, d int) *snooze.Entry {
+		return &snooze.Entry{ThreadId: id, Until: day(d), Label: snooze.LabelForTime(day(d))}
+	}
+	assert.Nil(t, db.Add(entry("t1", 3)))
+	assert.Nil(t, db.Add(entry("t2", 1)))
+	assert.Nil(t, db.Add(entry("t3", 3)))
+	// Resnoozing replaces the old entry
+	old := db.Add(entry("t1", 5))
+	if assert.NotNil(t, old) {
+		assert.Equal(t, day(3), old.Until)
+	}
+
+	ids := func(entries []*snooze.Entry) []string {
+		var ids []string
+		for _, e := range entries {
+			ids = append(ids, e.ThreadId)
+		}
+		return ids
+	}
+	// Sorted by wake time
+	assert.Equal(t, []string{"t2", "t3", "t1"}, ids(db.Entries))
+	assert.Equal(t, []string{"t2", "t3"}, ids(db.Due(day(3))))
+	assert.Empty(t, db.Due(day(1).Add(-time.Second)))
+
+	assert.True(t, db.LabelInUse("Snoozed/2026-11-03"))
+	db.Remove("t3")
+	assert.False(t, db.LabelInUse("Snoozed/2026-11-03"))
+
+	assert.NoError(t, db.Save())
+	loaded, err := snooze.LoadDB(fname)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"t2", "t1"}, ids(loaded.Entries))
+	e, ok := loaded.Get("t1")
+	assert.True(t, ok)
+	assert.Equal(t, day(5), e.Until.UTC())
+}
@@ -0,0 +1,44 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+)
+
+func threadMsg(from, subject string, millis int64, labelIds ...string) *gm.Message {
+	return &gm.Message{
+		InternalDate: millis,
+		LabelIds:     labelIds,
+		Payload: &gm.MessagePart{Headers: []*gm.MessagePartHeader{
+			{Name: "From", Value: from},
+			{Name: "Subject", Value: subject},
+		}},
+	}
+}
+
+func TestSummarizeThread(t *testing.T) {
+	thread := &gm.Thread{Id: "t1", Messages: []*gm.Message{
+		threadMsg("Alice <alice@example.com>", "Lunch?", 1000, "INBOX", "Label_1"),
+		threadMsg("bob@example.com", "Re: Lunch?", 3000, "INBOX"),
+		threadMsg("Alice <alice@example.com>", "Re: Lunch?", 2000, "Label_2"),
+	}}
+
+	summary := api.SummarizeThread(thread)
+	assert.Equal(t, "t1", summary.Id)
+	assert.Equal(t, "Lunch?", summary.Subject)
+	assert.Equal(t, 3, summary.MessageCount)
+	assert.Equal(t, []api.EmailAddress{
+		{Name: "Alice", Address: "alice@example.com"},
+		{Address: "bob@example.com"},
+	}, summary.Participants)
+	assert.Equal(t, int64(3000), summary.LatestDate.UnixMilli())
+	assert.Equal(t, []string{"INBOX", "Label_1", "Label_2"}, summary.LabelIds)
+
+	empty := api.SummarizeThread(&gm.Thread{Id: "t2"})
+	assert.Equal(t, 0, empty.MessageCount)
+	assert.True(t, empty.LatestDate.IsZero())
+}
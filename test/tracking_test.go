@@ -0,0 +1,62 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tsiemens/gmail-tools/plugin"
+	"github.com/tsiemens/gmail-tools/pluginstracking"
+)
+
+func TestTrackingFindNumber(t *testing.T) {
+	check := func(text, carrier, number string) {
+		num, ok := pluginstracking.FindNumber(text)
+		if carrier == "" {
+			assert.False(t, ok, text)
+			return
+		}
+		assert.True(t, ok, text)
+		assert.Equal(t, pluginstracking.Number{Carrier: carrier, Number: number}, num, text)
+	}
+
+	check("Your tracking number is 1Z999AA10123456784.", "UPS", "1Z999AA10123456784")
+	check("tracking: 1z999aa10123456784", "UPS", "1Z999AA10123456784")
+	check("Track it: 9400 1118 9922 3197 4284 90", "USPS", "9400111899223197428490")
+	check("International: RA123456789US", "USPS", "RA123456789US")
+	check("Shipped with FedEx, tracking 123456789012", "FedEx", "123456789012")
+	// FedEx numbers are only recognized when FedEx is mentioned
+	check("Order number 123456789012", "", "")
+	check("Your order has shipped", "", "")
+	check("Account 1Z999AA1012345678", "", "")
+}
+
+func TestTrackingPlugin(t *testing.T) {
+	plug := pluginstracking.NewPlugin("Shipments")
+	assert.Equal(t, []string{"action:track"}, plug.Capabilities())
+	assert.Contains(t, plug.MessageActions["track"].Desc, "Shipments")
+
+	// The command is registered without building the plugin, and is given to
+	// it when it is loaded
+	commands := plugin.BuiltinCommands()["tracking"]
+	if assert.Len(t, commands, 1) {
+		assert.Equal(t, "tracking", commands[0].Cobra.Name())
+	}
+	lp := plugin.LoadBuiltinPlugin("tracking", &plugin.PluginsConfig{}, nil)
+	if assert.NoError(t, lp.Err) {
+		assert.Equal(t, []string{"action:track", "command:tracking"},
+			lp.Plugin.Capabilities())
+		assert.Equal(t, "tracking", lp.Plugin.Ctx.Id)
+	}
+	lp = plugin.LoadBuiltinPlugin("tracking",
+		&plugin.PluginsConfig{Disabled: []string{"tracking"}}, nil)
+	assert.True(t, lp.Disabled)
+	assert.Nil(t, lp.Plugin)
+	lp = plugin.LoadBuiltinPlugin("missing", &plugin.PluginsConfig{}, nil)
+	assert.EqualError(t, lp.Err, "No builtin plugin missing")
+
+	conf := &pluginstracking.Config{}
+	assert.Equal(t, "Tracking", conf.GetLabel())
+	conf.Label = "Parcels"
+	assert.Equal(t, "Parcels", conf.GetLabel())
+}
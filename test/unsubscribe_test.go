@@ -0,0 +1,73 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/compose"
+)
+
+func TestUnsubscribeOptions(t *testing.T) {
+	headers := &api.Headers{
+		ListUnsubscribe: []string{
+			"http://x.com/unsub", "mailto:leave@x.com", "https://x.com/one"},
+		ListUnsubscribePost: "List-Unsubscribe=One-Click",
+	}
+	assert.Equal(t, []api.UnsubscribeOption{
+		{Method: api.OneClickUnsubscribe, Uri: "https://x.com/one"},
+		{Method: api.MailtoUnsubscribe, Uri: "mailto:leave@x.com"},
+		{Method: api.ManualUnsubscribe, Uri: "http://x.com/unsub"},
+	}, api.UnsubscribeOptions(headers))
+
+	// Without List-Unsubscribe-Post, https links must be visited manually
+	headers.ListUnsubscribePost = ""
+	assert.Equal(t, []api.UnsubscribeOption{
+		{Method: api.MailtoUnsubscribe, Uri: "mailto:leave@x.com"},
+		{Method: api.ManualUnsubscribe, Uri: "http://x.com/unsub"},
+		{Method: api.ManualUnsubscribe, Uri: "https://x.com/one"},
+	}, api.UnsubscribeOptions(headers))
+
+	assert.Empty(t, api.UnsubscribeOptions(&api.Headers{}))
+}
+
+func TestFromMailto(t *testing.T) {
+	msg, err := compose.FromMailto("mailto:leave%2Bab@x.com?subject=Remove%20me&body=bye")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"leave+ab@x.com"}, msg.To)
+	assert.Equal(t, "Remove me", msg.Subject)
+	assert.Equal(t, "bye", msg.Body)
+
+	msg, err = compose.FromMailto("mailto:?to=a@x.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a@x.com"}, msg.To)
+	assert.Equal(t, "unsubscribe", msg.Subject)
+
+	_, err = compose.FromMailto("mailto:")
+	assert.NotNil(t, err)
+	_, err = compose.FromMailto("https://x.com")
+	assert.NotNil(t, err)
+}
+
+func TestComposeBytes(t *testing.T) {
+	msg := &compose.Message{
+		From:    "Ann <ann@x.com>",
+		To:      []string{"bob@y.com"},
+		Subject: "Héllo",
+		Body:    "line 1\nline 2",
+	}
+	raw, err := msg.Bytes()
+	assert.Nil(t, err)
+	str := string(raw)
+	assert.Contains(t, str, "From: \"Ann\" <ann@x.com>\r\n")
+	assert.Contains(t, str, "To: <bob@y.com>\r\n")
+	assert.Contains(t, str, "Subject: =?utf-8?q?H=C3=A9llo?=\r\n")
+	assert.True(t, strings.HasSuffix(str, "\r\n\r\nline 1\r\nline 2\r\n"))
+
+	_, err = (&compose.Message{Subject: "x"}).Bytes()
+	assert.NotNil(t, err)
+	_, err = (&compose.Message{To: []string{"not an address"}}).Bytes()
+	assert.NotNil(t, err)
+}
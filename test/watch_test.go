@@ -0,0 +1,118 @@
+package test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tsiemens/gmail-tools/watch"
+)
+
+func TestWatchCheckpoint(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "watch.checkpoint")
+
+	cp, err := watch.LoadCheckpoint(fname)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), cp.HistoryId)
+
+	assert.NoError(t, cp.Update(12345))
+	loaded, err := watch.LoadCheckpoint(fname)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(12345), loaded.HistoryId)
+	assert.WithinDuration(t, time.Now(), loaded.Time, time.Minute)
+}
+
+func TestWatchCheckpointPending(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "watch.checkpoint")
+	cp, err := watch.LoadCheckpoint(fname)
+	assert.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Empty(t, cp.SetPending([]string{"b", "a"}, start, 10*time.Minute))
+	assert.Equal(t, []string{"a", "b"}, cp.PendingIds())
+
+	// Pending messages are saved with the checkpoint
+	assert.NoError(t, cp.Update(1))
+	cp, err = watch.LoadCheckpoint(fname)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, cp.PendingIds())
+
+	// Messages which are still pending keep their first seen time, and are
+	// dropped after the timeout. Those no longer given are no longer pending.
+	later := start.Add(5 * time.Minute)
+	assert.Empty(t, cp.SetPending([]string{"a", "c"}, later, 10*time.Minute))
+	assert.Equal(t, []string{"a", "c"}, cp.PendingIds())
+	assert.True(t, start.Equal(cp.Pending["a"]))
+	assert.Equal(t, []string{"a"},
+		cp.SetPending([]string{"a", "c"}, start.Add(11*time.Minute), 10*time.Minute))
+	assert.Equal(t, []string{"c"}, cp.PendingIds())
+
+	assert.Empty(t, cp.SetPending(nil, later, 10*time.Minute))
+	assert.Nil(t, cp.Pending)
+}
+
+func TestWatchBackoff(t *testing.T) {
+	b := watch.Backoff{Min: time.Second, Max: 5 * time.Second}
+	assert.Equal(t, time.Second, b.Next())
+	assert.Equal(t, 2*time.Second, b.Next())
+	assert.Equal(t, 4*time.Second, b.Next())
+	assert.Equal(t, 5*time.Second, b.Next())
+	assert.Equal(t, 5*time.Second, b.Next())
+	b.Reset()
+	assert.Equal(t, time.Second, b.Next())
+}
+
+func TestPubSubPuller(t *testing.T) {
+	notification := base64.StdEncoding.EncodeToString(
+		[]byte(`{"emailAddress": "me@example.com", "historyId": 9876}`))
+	var acked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/v1/projects/p/subscriptions/s:pull":
+			assert.JSONEq(t, `{"maxMessages": 10}`, string(body))
+			w.Write([]byte(`{"receivedMessages": [
+				{"ackId": "a1", "message": {"data": "` + notification + `"}}]}`))
+		case "/v1/projects/p/subscriptions/s:acknowledge":
+			var req struct{ AckIds []string }
+			assert.NoError(t, json.Unmarshal(body, &req))
+			acked = req.AckIds
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	_, err := watch.NewPubSubPuller(host, "subscriptions/s")
+	assert.Error(t, err)
+	_, err = watch.NewPubSubPuller("", "projects/p/subscriptions/s")
+	assert.Error(t, err)
+
+	puller, err := watch.NewPubSubPuller(host, "projects/p/subscriptions/s")
+	assert.NoError(t, err)
+	msgs, err := puller.Pull(10)
+	assert.NoError(t, err)
+	if assert.Len(t, msgs, 1) {
+		n, err := watch.ParseGmailNotification(msgs[0].Data)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(9876), n.HistoryId)
+		assert.Equal(t, "me@example.com", n.EmailAddress)
+	}
+	assert.NoError(t, puller.Ack(msgs))
+	assert.Equal(t, []string{"a1"}, acked)
+
+	missing, err := watch.NewPubSubPuller(host, "projects/p/subscriptions/other")
+	assert.NoError(t, err)
+	_, err = missing.Pull(1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,205 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/plugin"
+	"github.com/tsiemens/gmail-tools/xfilter"
+)
+
+// xfilterTestFilters returns test filters, and the names of the filters which
+// have been evaluated, in order.
+func xfilterTestFilters() (map[string]*plugin.MessageFilter, *[]string) {
+	var calls []string
+	record := func(name string, match func(*gm.Message, plugin.FilterArgs) bool,
+	) func(*plugin.Context, *gm.Message, plugin.FilterArgs) (bool, error) {
+		return func(ctx *plugin.Context, m *gm.Message, args plugin.FilterArgs,
+		) (bool, error) {
+			calls = append(calls, name)
+			return match(m, args), nil
+		}
+	}
+	filters := map[string]*plugin.MessageFilter{
+		"yes": {
+			Matches: record("yes", func(*gm.Message, plugin.FilterArgs) bool { return true }),
+		},
+		"no": {
+			Matches: record("no", func(*gm.Message, plugin.FilterArgs) bool { return false }),
+		},
+		"snippet-has": {
+			Params: []plugin.FilterParam{{Name: "text", Type: plugin.StringParam}},
+			Matches: record("snippet-has", func(m *gm.Message, args plugin.FilterArgs) bool {
+				return strings.Contains(m.Snippet, args.String(0))
+			}),
+		},
+		"snippet-longer": {
+			Params: []plugin.FilterParam{{Name: "n", Type: plugin.IntParam}},
+			Matches: record("snippet-longer", func(m *gm.Message, args plugin.FilterArgs) bool {
+				return int64(len(m.Snippet)) > args.Int(0)
+			}),
+		},
+		"fails": {
+			Matches: func(*plugin.Context, *gm.Message, plugin.FilterArgs) (bool, error) {
+				calls = append(calls, "fails")
+				return false, errors.New("request failed")
+			},
+		},
+		"has-labels": {
+			Detail: api.LabelsOnly,
+			Matches: record("has-labels", func(m *gm.Message, _ plugin.FilterArgs) bool {
+				return len(m.LabelIds) > 0
+			}),
+		},
+		"subject": {
+			Params: []plugin.FilterParam{{Name: "pattern", Type: plugin.RegexpParam}},
+			Detail: api.LabelsAndPayload,
+			Matches: record("subject", func(m *gm.Message, args plugin.FilterArgs) bool {
+				headers, err := api.GetMsgHeaders(m)
+				return err == nil && args.Regexp(0).MatchString(headers.Subject)
+			}),
+		},
+	}
+	return filters, &calls
+}
+
+func xfilterLookup(filters map[string]*plugin.MessageFilter) xfilter.Lookup {
+	return func(name string) (*plugin.MessageFilter, *plugin.Context, bool) {
+		f, ok := filters[name]
+		return f, nil, ok
+	}
+}
+
+func TestXFilterParse(t *testing.T) {
+	filters, _ := xfilterTestFilters()
+	lookup := xfilterLookup(filters)
+
+	check := func(src, canonical string) {
+		expr, err := xfilter.Parse(src, lookup)
+		if assert.NoError(t, err, src) {
+			assert.Equal(t, canonical, expr.String(), src)
+		}
+	}
+	check("yes", "yes")
+	check("  yes AND no ", "yes and no")
+	check("yes or no and not no", "yes or no and not no")
+	check("(yes or no) and no", "(yes or no) and no")
+	check("not (yes or no)", "not (yes or no)")
+	check("not not yes", "not not yes")
+	check("((yes))", "yes")
+	check("snippet-has(foo) or snippet-has('a b') or snippet-has(\"it's\")",
+		"snippet-has(foo) or snippet-has('a b') or snippet-has(\"it's\")")
+	check("snippet-longer( 10 )", "snippet-longer(10)")
+	check("subject('^re:')", "subject(^re:)")
+
+	expr, err := xfilter.Parse("subject(x) and (no or yes) and subject(y)", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"no", "subject", "yes"}, expr.FilterNames())
+
+	checkErr := func(src string, pos int, msg string) {
+		_, err := xfilter.Parse(src, lookup)
+		var synErr *xfilter.SyntaxError
+		if assert.True(t, errors.As(err, &synErr), src) {
+			assert.Equal(t, pos, synErr.Pos, src)
+			assert.Contains(t, synErr.Msg, msg, src)
+		}
+	}
+	checkErr("", 1, "empty expression")
+	checkErr("yes and", 8, "expected a filter name, found end of expression")
+	checkErr("yes no", 5, "expected 'and', 'or' or end of expression, found 'no'")
+	checkErr("(yes or no", 11, "expected ')'")
+	checkErr("yes)", 4, "found ')'")
+	checkErr("not and", 5, "expected a filter name, found 'and'")
+	checkErr("snippet-has('foo", 13, "unterminated string")
+	checkErr("snippet-has(a b)", 15, "expected ',' or ')'")
+	checkErr("yes and maybe", 9, "'maybe' is not an available xfilter")
+	checkErr("snippet-has", 1, "snippet-has(text string) takes 1 arguments, but 0 were given")
+	checkErr("yes(1)", 1, "yes takes 0 arguments, but 1 were given")
+	checkErr("snippet-longer(ten)", 1, "argument n: 'ten' is not an int")
+	checkErr("subject('(')", 1, "argument pattern: '(' is not a valid regexp")
+}
+
+func TestXFilterMatches(t *testing.T) {
+	filters, calls := xfilterTestFilters()
+	lookup := xfilterLookup(filters)
+
+	full := &gm.Message{
+		Id:       "m1",
+		Snippet:  "hello world",
+		LabelIds: []string{"INBOX"},
+		Payload: &gm.MessagePart{
+			Headers: []*gm.MessagePartHeader{{Name: "Subject", Value: "Re: Hello"}},
+			Body:    &gm.MessagePartBody{},
+		},
+	}
+	var loads []api.MessageDetailLevel
+	load := func(m *gm.Message, detail api.MessageDetailLevel) (*gm.Message, error) {
+		loads = append(loads, detail)
+		return full, nil
+	}
+
+	check := func(src string, matches bool, expCalls []string,
+		expLoads []api.MessageDetailLevel) {
+
+		*calls = nil
+		loads = nil
+		expr, err := xfilter.Parse(src, lookup)
+		if !assert.NoError(t, err, src) {
+			return
+		}
+		m := &gm.Message{Id: "m1", Snippet: "hello world"}
+		matched, loaded, err := expr.Matches(m, load)
+		assert.NoError(t, err, src)
+		assert.Equal(t, matches, matched, src)
+		assert.Equal(t, expCalls, *calls, src)
+		assert.Equal(t, expLoads, loads, src)
+		// The message is returned as it was last loaded
+		if expLoads == nil {
+			assert.Same(t, m, loaded, src)
+		} else {
+			assert.Same(t, full, loaded, src)
+		}
+	}
+
+	// The message is only loaded once a filter needs more detail
+	check("snippet-has(world)", true, []string{"snippet-has"}, nil)
+	check("snippet-longer(20) or not yes", false,
+		[]string{"snippet-longer", "yes"}, nil)
+	check("has-labels", true, []string{"has-labels"},
+		[]api.MessageDetailLevel{api.LabelsOnly})
+	check("has-labels and subject('^re:')", true, []string{"has-labels", "subject"},
+		[]api.MessageDetailLevel{api.LabelsOnly})
+	check("subject(hello) and has-labels", true, []string{"subject", "has-labels"},
+		[]api.MessageDetailLevel{api.LabelsAndPayload})
+
+	// and/or short-circuit, so later filters are not evaluated or loaded for
+	check("no and subject(hello)", false, []string{"no"}, nil)
+	check("yes or subject(hello)", true, []string{"yes"}, nil)
+	check("(no or snippet-has(hello)) and not (yes and has-labels)", false,
+		[]string{"no", "snippet-has", "yes", "has-labels"},
+		[]api.MessageDetailLevel{api.LabelsOnly})
+
+	// A load error is returned, and the message does not match
+	expr, err := xfilter.Parse("not has-labels", lookup)
+	assert.NoError(t, err)
+	matched, _, err := expr.Matches(&gm.Message{Id: "m2"},
+		func(*gm.Message, api.MessageDetailLevel) (*gm.Message, error) {
+			return nil, errors.New("not found")
+		})
+	assert.EqualError(t, err, "not found")
+	assert.False(t, matched)
+
+	// As is a filter's error, which stops evaluation
+	*calls = nil
+	expr, err = xfilter.Parse("not fails or yes", lookup)
+	assert.NoError(t, err)
+	matched, _, err = expr.Matches(&gm.Message{Id: "m3"}, load)
+	assert.EqualError(t, err, "request failed")
+	assert.False(t, matched)
+	assert.Equal(t, []string{"fails"}, *calls)
+}
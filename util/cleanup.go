@@ -20,12 +20,15 @@ func UnregisterCleanupHandler(k interface{}) {
 	delete(cleanupHandlers, k)
 }
 
+// RunCleanupHandlers runs and unregisters the registered handlers, so that each
+// is only run once.
 func RunCleanupHandlers() {
 	cleanupMutex.Lock()
 	handlersCopy := make([]func(), 0, len(cleanupHandlers))
 	for _, h := range cleanupHandlers {
 		handlersCopy = append(handlersCopy, h)
 	}
+	cleanupHandlers = make(map[interface{}]func())
 	cleanupMutex.Unlock()
 
 	for _, h := range handlersCopy {
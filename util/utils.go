@@ -9,6 +9,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/tsiemens/gmail-tools/prnt"
 )
@@ -149,3 +150,18 @@ func CheckErrf(err error, format string, v ...interface{}) {
 		prnt.StderrLog.Fatalf(format+" %v\n", v...)
 	}
 }
+
+// TimeFromMillis converts milliseconds since the epoch (as used by the API's
+// InternalDate) to a Time.
+func TimeFromMillis(millis int64) time.Time {
+	return time.Unix(millis/1000, (millis%1000)*int64(time.Millisecond))
+}
+
+// RemoveIfExists deletes fname, ignoring the error if it does not exist.
+func RemoveIfExists(fname string) error {
+	err := os.Remove(fname)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package watch
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PubSubEmulatorHostEnv is the environment variable the Pub/Sub emulator
+// (gcloud beta emulators pubsub) is conventionally found through.
+const PubSubEmulatorHostEnv = "PUBSUB_EMULATOR_HOST"
+
+// PubSubPuller pulls messages from a subscription through the Pub/Sub REST
+// API, as served by the local emulator (which needs no authentication).
+type PubSubPuller struct {
+	// host:port of the emulator
+	Host string
+	// Full subscription name: projects/PROJECT/subscriptions/SUBSCRIPTION
+	Subscription string
+
+	client *http.Client
+}
+
+type PubSubMessage struct {
+	AckId string
+	Data  []byte
+}
+
+func NewPubSubPuller(host, subscription string) (*PubSubPuller, error) {
+	if host == "" {
+		return nil, fmt.Errorf("No Pub/Sub host provided (set %s)", PubSubEmulatorHostEnv)
+	}
+	if !strings.HasPrefix(subscription, "projects/") ||
+		!strings.Contains(subscription, "/subscriptions/") {
+		return nil, fmt.Errorf(
+			"Subscription must be of the form projects/PROJECT/subscriptions/NAME")
+	}
+	return &PubSubPuller{
+		Host: host, Subscription: subscription,
+		// Pulls wait on the server until messages are available
+		client: &http.Client{Timeout: 2 * time.Minute},
+	}, nil
+}
+
+func (p *PubSubPuller) post(method string, req interface{}, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://%s/v1/%s:%s", p.Host, p.Subscription, method)
+	r, err := p.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("Pub/Sub %s failed: %s: %s", method, r.Status,
+			strings.TrimSpace(string(data)))
+	}
+	if resp != nil {
+		return json.Unmarshal(data, resp)
+	}
+	return nil
+}
+
+// Pull waits for up to maxMessages messages from the subscription. The
+// messages must be acknowledged with Ack, or they will be redelivered.
+func (p *PubSubPuller) Pull(maxMessages int) ([]PubSubMessage, error) {
+	var resp struct {
+		ReceivedMessages []struct {
+			AckId   string `json:"ackId"`
+			Message struct {
+				Data string `json:"data"`
+			} `json:"message"`
+		} `json:"receivedMessages"`
+	}
+	err := p.post("pull", map[string]interface{}{"maxMessages": maxMessages}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]PubSubMessage, 0, len(resp.ReceivedMessages))
+	for _, rm := range resp.ReceivedMessages {
+		data, err := base64.StdEncoding.DecodeString(rm.Message.Data)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Pub/Sub message data: %v", err)
+		}
+		msgs = append(msgs, PubSubMessage{AckId: rm.AckId, Data: data})
+	}
+	return msgs, nil
+}
+
+// Ack acknowledges the messages, so that they are not delivered again.
+func (p *PubSubPuller) Ack(msgs []PubSubMessage) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	ackIds := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		ackIds = append(ackIds, m.AckId)
+	}
+	return p.post("acknowledge", map[string]interface{}{"ackIds": ackIds}, nil)
+}
+
+// GmailNotification is the data of a Gmail push notification, sent when the
+// mailbox changes (see users.watch).
+type GmailNotification struct {
+	EmailAddress string `json:"emailAddress"`
+	HistoryId    uint64 `json:"historyId"`
+}
+
+func ParseGmailNotification(data []byte) (*GmailNotification, error) {
+	n := &GmailNotification{}
+	if err := json.Unmarshal(data, n); err != nil {
+		return nil, fmt.Errorf("Invalid Gmail notification: %v", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,121 @@
+// Package watch provides the pieces of the long running watch command which
+// are independent of the Gmail API: checkpoints, backoff and Pub/Sub pulls.
+package watch
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+)
+
+// Checkpoint records how far through the mailbox history watch has
+// processed, so that it can resume where it left off after a restart.
+type Checkpoint struct {
+	HistoryId uint64    `json:"historyId"`
+	Time      time.Time `json:"time"`
+	// IDs of messages from before HistoryId which have not been handled yet,
+	// by when they were first seen.
+	Pending map[string]time.Time `json:"pending,omitempty"`
+
+	fname string
+}
+
+// LoadCheckpoint reads the checkpoint file fname. If it does not exist, an
+// empty checkpoint (with HistoryId 0) is returned.
+func LoadCheckpoint(fname string) (*Checkpoint, error) {
+	cp := &Checkpoint{fname: fname}
+	data, err := os.ReadFile(fname)
+	if os.IsNotExist(err) {
+		return cp, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// Update sets the history ID, and saves the checkpoint.
+func (c *Checkpoint) Update(historyId uint64) error {
+	c.HistoryId = historyId
+	c.Time = time.Now()
+	return c.Save()
+}
+
+// PendingIds returns the IDs of the pending messages, sorted.
+func (c *Checkpoint) PendingIds() []string {
+	ids := make([]string, 0, len(c.Pending))
+	for id := range c.Pending {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// SetPending replaces the pending messages with ids. IDs which were already
+// pending keep the time they were first seen, unless that is more than timeout
+// before now, in which case they are dropped and returned. The checkpoint is
+// not saved.
+func (c *Checkpoint) SetPending(ids []string, now time.Time, timeout time.Duration,
+) []string {
+	pending := make(map[string]time.Time)
+	var expired []string
+	for _, id := range ids {
+		since, ok := c.Pending[id]
+		if !ok {
+			since = now
+		}
+		if now.Sub(since) > timeout {
+			expired = append(expired, id)
+			continue
+		}
+		pending[id] = since
+	}
+	if len(pending) == 0 {
+		pending = nil
+	}
+	c.Pending = pending
+	return expired
+}
+
+// Save writes the checkpoint file. The file is replaced atomically, so that
+// it is never left partially written.
+func (c *Checkpoint) Save() error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmpName := c.fname + ".tmp"
+	if err = os.WriteFile(tmpName, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, c.fname)
+}
+
+// Backoff provides exponentially increasing delays after consecutive errors.
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+
+	cur time.Duration
+}
+
+// Next returns how long to wait after another error.
+func (b *Backoff) Next() time.Duration {
+	if b.cur == 0 {
+		b.cur = b.Min
+	} else {
+		b.cur *= 2
+	}
+	if b.cur > b.Max {
+		b.cur = b.Max
+	}
+	return b.cur
+}
+
+// Reset is called after a success, so that the next error waits Min again.
+func (b *Backoff) Reset() {
+	b.cur = 0
+}
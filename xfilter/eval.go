@@ -0,0 +1,189 @@
+package xfilter
+
+import (
+	"sort"
+	"strings"
+
+	gm "google.golang.org/api/gmail/v1"
+
+	"github.com/tsiemens/gmail-tools/api"
+	"github.com/tsiemens/gmail-tools/plugin"
+)
+
+// Loader returns m loaded with at least detail
+type Loader func(m *gm.Message, detail api.MessageDetailLevel) (*gm.Message, error)
+
+// evalState is the message an expression is being evaluated on, as loaded so
+// far.
+type evalState struct {
+	msg  *gm.Message
+	load Loader
+}
+
+func (st *evalState) message(detail api.MessageDetailLevel) (*gm.Message, error) {
+	if !api.MessageMeetsDetailLevel(st.msg, detail) {
+		m, err := st.load(st.msg, detail)
+		if err != nil {
+			return nil, err
+		}
+		st.msg = m
+	}
+	return st.msg, nil
+}
+
+type node interface {
+	eval(st *evalState) (bool, error)
+	// prec is the precedence of the node, for String
+	prec() int
+	String() string
+}
+
+const (
+	orPrec = iota
+	andPrec
+	notPrec
+	filterPrec
+)
+
+// operandString returns the string of n, in parens if it binds less tightly
+// than its parent.
+func operandString(n node, parentPrec int) string {
+	if n.prec() < parentPrec {
+		return "(" + n.String() + ")"
+	}
+	return n.String()
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n *orNode) eval(st *evalState) (bool, error) {
+	if matched, err := n.left.eval(st); matched || err != nil {
+		return matched, err
+	}
+	return n.right.eval(st)
+}
+
+func (n *orNode) prec() int { return orPrec }
+
+func (n *orNode) String() string {
+	return operandString(n.left, orPrec) + " or " + operandString(n.right, orPrec)
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n *andNode) eval(st *evalState) (bool, error) {
+	if matched, err := n.left.eval(st); !matched || err != nil {
+		return false, err
+	}
+	return n.right.eval(st)
+}
+
+func (n *andNode) prec() int { return andPrec }
+
+func (n *andNode) String() string {
+	return operandString(n.left, andPrec) + " and " + operandString(n.right, andPrec)
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) eval(st *evalState) (bool, error) {
+	matched, err := n.operand.eval(st)
+	return !matched && err == nil, err
+}
+
+func (n *notNode) prec() int { return notPrec }
+
+func (n *notNode) String() string {
+	return "not " + operandString(n.operand, notPrec)
+}
+
+type filterNode struct {
+	name    string
+	rawArgs []string
+	args    plugin.FilterArgs
+	filter  *plugin.MessageFilter
+	ctx     *plugin.Context
+}
+
+func (n *filterNode) eval(st *evalState) (bool, error) {
+	m, err := st.message(n.filter.Detail)
+	if err != nil {
+		return false, err
+	}
+	return n.filter.Matches(n.ctx, m, n.args)
+}
+
+func (n *filterNode) prec() int { return filterPrec }
+
+func quoteArg(arg string) string {
+	if arg != "" && strings.IndexFunc(arg, func(r rune) bool { return !isWordRune(r) }) < 0 {
+		return arg
+	}
+	if strings.Contains(arg, "'") {
+		return "\"" + arg + "\""
+	}
+	return "'" + arg + "'"
+}
+
+func (n *filterNode) String() string {
+	if n.rawArgs == nil {
+		return n.name
+	}
+	args := make([]string, 0, len(n.rawArgs))
+	for _, arg := range n.rawArgs {
+		args = append(args, quoteArg(arg))
+	}
+	return n.name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// Expr is a parsed xfilter expression
+type Expr struct {
+	root node
+}
+
+// Matches evaluates the expression on m. m is loaded with load only when a
+// filter needs more detail than it has, and m as it was last loaded is
+// returned. An error is returned if m could not be loaded, or a filter failed.
+func (e *Expr) Matches(m *gm.Message, load Loader) (bool, *gm.Message, error) {
+	st := &evalState{msg: m, load: load}
+	matched, err := e.root.eval(st)
+	return matched, st.msg, err
+}
+
+// String returns the expression in its canonical form
+func (e *Expr) String() string {
+	return e.root.String()
+}
+
+func filterNames(n node, names map[string]bool) {
+	switch n := n.(type) {
+	case *orNode:
+		filterNames(n.left, names)
+		filterNames(n.right, names)
+	case *andNode:
+		filterNames(n.left, names)
+		filterNames(n.right, names)
+	case *notNode:
+		filterNames(n.operand, names)
+	case *filterNode:
+		names[n.name] = true
+	}
+}
+
+// FilterNames returns the names of the filters used in the expression, sorted
+func (e *Expr) FilterNames() []string {
+	names := make(map[string]bool)
+	filterNames(e.root, names)
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
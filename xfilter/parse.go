@@ -0,0 +1,249 @@
+// Package xfilter parses and evaluates xfilter expressions, which combine the
+// MessageFilters of plugins, e.g.
+//
+//	(thread-has-multiple-senders or sender-domain(github.com)) and not subject('^re:')
+//
+// Filters are evaluated left to right, and and/or short-circuit, so messages
+// are only loaded with the detail a filter needs once it is evaluated.
+package xfilter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/tsiemens/gmail-tools/plugin"
+)
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	stringToken
+	lParenToken
+	rParenToken
+	commaToken
+	endToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) desc() string {
+	if t.kind == endToken {
+		return "end of expression"
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+// SyntaxError is an error in an expression, at column Pos (from 1)
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("Invalid xfilter expression at column %d: %s", e.Pos, e.Msg)
+}
+
+func syntaxError(pos int, format string, a ...interface{}) *SyntaxError {
+	return &SyntaxError{Pos: pos + 1, Msg: fmt.Sprintf(format, a...)}
+}
+
+func isWordRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune("(),'\"", r)
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{lParenToken, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{rParenToken, ")", i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{commaToken, ",", i})
+			i++
+		case r == '\'' || r == '"':
+			start := i
+			i++
+			for i < len(runes) && runes[i] != r {
+				i++
+			}
+			if i == len(runes) {
+				return nil, syntaxError(start, "unterminated string")
+			}
+			tokens = append(tokens, token{stringToken, string(runes[start+1 : i]), start})
+			i++
+		default:
+			start := i
+			for i < len(runes) && isWordRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{wordToken, string(runes[start:i]), start})
+		}
+	}
+	return append(tokens, token{endToken, "", len(runes)}), nil
+}
+
+// Lookup returns the filter named name, and the Context of the plugin which
+// provides it, or false if there is none.
+type Lookup func(name string) (*plugin.MessageFilter, *plugin.Context, bool)
+
+type parser struct {
+	tokens []token
+	pos    int
+	lookup Lookup
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != endToken {
+		p.pos++
+	}
+	return t
+}
+
+func isKeyword(t token, kw string) bool {
+	return t.kind == wordToken && strings.EqualFold(t.text, kw)
+}
+
+func isAnyKeyword(t token) bool {
+	return isKeyword(t, "and") || isKeyword(t, "or") || isKeyword(t, "not")
+}
+
+// expr := and ("or" and)*
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for isKeyword(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+// and := not ("and" not)*
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for isKeyword(p.peek(), "and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+// not := "not" not | primary
+func (p *parser) parseNot() (node, error) {
+	if isKeyword(p.peek(), "not") {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+// primary := "(" expr ")" | NAME [ "(" [ arg ("," arg)* ] ")" ]
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	if t.kind == lParenToken {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != rParenToken {
+			return nil, syntaxError(closing.pos, "expected ')', found %s", closing.desc())
+		}
+		return n, nil
+	}
+	if t.kind != wordToken || isAnyKeyword(t) {
+		return nil, syntaxError(t.pos, "expected a filter name, found %s", t.desc())
+	}
+
+	var args []string
+	if p.peek().kind == lParenToken {
+		p.next()
+		if p.peek().kind == rParenToken {
+			p.next()
+		} else {
+			for {
+				arg := p.next()
+				if arg.kind != wordToken && arg.kind != stringToken {
+					return nil, syntaxError(arg.pos, "expected an argument, found %s",
+						arg.desc())
+				}
+				args = append(args, arg.text)
+				sep := p.next()
+				if sep.kind == rParenToken {
+					break
+				} else if sep.kind != commaToken {
+					return nil, syntaxError(sep.pos, "expected ',' or ')', found %s",
+						sep.desc())
+				}
+			}
+		}
+	}
+
+	filter, ctx, ok := p.lookup(t.text)
+	if !ok {
+		return nil, syntaxError(t.pos, "'%s' is not an available xfilter", t.text)
+	}
+	parsedArgs, err := filter.ParseArgs(args)
+	if err != nil {
+		return nil, syntaxError(t.pos, "%s %v", filter.Usage(t.text), err)
+	}
+	return &filterNode{name: t.text, rawArgs: args, args: parsedArgs,
+		filter: filter, ctx: ctx}, nil
+}
+
+// Parse parses the expression s, in which filters are found with lookup, and
+// their arguments are checked against their parameters.
+func Parse(s string, lookup Lookup) (*Expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, lookup: lookup}
+	if p.peek().kind == endToken {
+		return nil, syntaxError(0, "empty expression")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != endToken {
+		return nil, syntaxError(t.pos, "expected 'and', 'or' or end of expression, "+
+			"found %s", t.desc())
+	}
+	return &Expr{root: root}, nil
+}